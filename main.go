@@ -1,9 +1,12 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/wlmsrvty/git-go/mygit"
 )
@@ -32,8 +35,68 @@ var commands = []Command{
 		Run: lsRemote},
 	{Name: "log",
 		Run: logCommit},
+	{Name: "add",
+		Run: add},
 	{Name: "commit",
 		Run: commit},
+	{Name: "status",
+		Run: status},
+	{Name: "diff",
+		Run: diff},
+	{Name: "diff-tree",
+		Run: diffTree},
+	{Name: "index-pack",
+		Run: indexPack},
+	{Name: "verify-pack",
+		Run: verifyPack},
+	{Name: "show-index",
+		Run: showIndex},
+	{Name: "pack-objects",
+		Run: packObjects},
+	{Name: "repack",
+		Run: repack},
+	{Name: "gc",
+		Run: gc},
+	{Name: "fsck",
+		Run: fsck},
+	{Name: "prune",
+		Run: prune},
+	{Name: "tag",
+		Run: tag},
+	{Name: "rev-parse",
+		Run: revParse},
+	{Name: "branch",
+		Run: branch},
+	{Name: "switch",
+		Run: switchBranch},
+	{Name: "checkout",
+		Run: checkout},
+	{Name: "pack-refs",
+		Run: packRefs},
+	{Name: "update-ref",
+		Run: updateRef},
+	{Name: "reflog",
+		Run: reflog},
+	{Name: "symbolic-ref",
+		Run: symbolicRef},
+	{Name: "show-ref",
+		Run: showRef},
+	{Name: "for-each-ref",
+		Run: forEachRef},
+	{Name: "check-ignore",
+		Run: checkIgnore},
+	{Name: "merge-base",
+		Run: mergeBase},
+	{Name: "merge-tree",
+		Run: mergeTree},
+	{Name: "merge",
+		Run: merge},
+	{Name: "cherry-pick",
+		Run: cherryPick},
+	{Name: "revert",
+		Run: revert},
+	{Name: "rebase",
+		Run: rebase},
 }
 
 func Usage() {
@@ -44,12 +107,42 @@ Commands:
     cat-file    Provide content or type and size information for repository objects
     hash-object Compute object ID and optionally creates a blob from a file
     ls-tree 	List the contents of a tree object
-    write-tree 	Create a tree object from the current working directory
+    write-tree 	Create a tree object from the current index
     commit-tree Create a new commit object
     clone       Clone a repository into a new directory
     ls-remote   List references in a remote repository
     log         Show commit logs for a commit ID
-    commit      Record changes to the repository`
+    add         Add file contents to the index
+    commit      Record changes to the repository
+    status      Show the working tree status
+    diff        Show changes between commits, commit and working tree, etc
+    index-pack  Build pack index file for an existing packed archive
+    verify-pack Validate packed Git archive files
+    show-index  Show packed archive index
+    pack-objects Create a packed archive of objects
+    repack      Pack unpacked objects in a repository
+    gc          Cleanup unnecessary files and optimize the local repository
+    fsck        Verify the connectivity and validity of the objects in the database
+    prune       Prune all unreachable objects from the object database
+    tag         Create, list or delete tags
+    rev-parse   Pick out and massage parameters
+    branch      List, create, or delete branches
+    switch      Switch branches
+    checkout    Switch branches or detach HEAD at a commit
+    pack-refs   Pack heads and tags for efficient repository access
+    update-ref  Update the object name stored in a ref safely
+    reflog      Manage reflog information
+    symbolic-ref Read, modify and delete symbolic refs
+    show-ref    List references in a local repository
+    for-each-ref Output information on each ref
+    check-ignore Debug gitignore / exclude files
+    diff-tree   Compare the content and mode of blobs found via two tree objects
+    merge-base  Find as good common ancestors as possible for a merge
+    merge-tree  Perform merge without touching index or working tree
+    merge       Join two development histories together
+    cherry-pick Apply the changes introduced by some existing commits
+    revert      Revert some existing commits
+    rebase      Reapply commits on top of another base tip`
 	fmt.Fprintf(os.Stderr, "%s\n", usage)
 }
 
@@ -94,34 +187,72 @@ func gitInit(args []string) error {
 }
 
 func git_cat_file(args []string) error {
-	var prettyPrint bool
 	flagSet := flag.NewFlagSet("cat-file", flag.ExitOnError)
+	var prettyPrint bool
 	flagSet.BoolVar(&prettyPrint, "p", false,
 		"Pretty-print the contents of the object to the terminal")
+	var showType bool
+	flagSet.BoolVar(&showType, "t", false, "Show the object type")
+	var showSize bool
+	flagSet.BoolVar(&showSize, "s", false, "Show the object size")
+	var exists bool
+	flagSet.BoolVar(&exists, "e", false,
+		"Exit with zero status if the object exists and is valid")
+	var batch bool
+	flagSet.BoolVar(&batch, "batch", false,
+		"Print information and content of objects named on stdin")
+	var batchCheck bool
+	flagSet.BoolVar(&batchCheck, "batch-check", false,
+		"Print information of objects named on stdin")
 	flagSet.Usage = func() {
 		fmt.Fprintln(os.Stderr,
 			`Provide content or type and size information for repository objects
 
-Usage: mygit cat-file [options] <blob_sha>`)
+Usage: mygit cat-file (-p | -t | -s | -e) <revision>
+       mygit cat-file (--batch | --batch-check)`)
 		flagSet.PrintDefaults()
 	}
 	flagSet.Parse(args)
 
-	if flagSet.NArg() < 1 {
+	if batch || batchCheck {
+		options := mygit.CatFileBatchOptions{
+			Contents: batch,
+		}
+		return mygit.CatFileBatch(os.Stdin, os.Stdout, &options)
+	}
+
+	modes := 0
+	for _, mode := range []bool{prettyPrint, showType, showSize, exists} {
+		if mode {
+			modes++
+		}
+	}
+	if flagSet.NArg() < 1 || modes != 1 {
 		flagSet.Usage()
 		os.Exit(1)
 	}
 
-	blob_sha := flagSet.Arg(0)
+	objectName := flagSet.Arg(0)
 
-	gitObject, err := mygit.NewObject(blob_sha)
+	if exists {
+		if !mygit.ObjectExists(objectName) {
+			os.Exit(1)
+		}
+		return nil
+	}
+
+	gitObject, err := mygit.ResolveObject(objectName)
 	if err != nil {
 		return err
 	}
 
-	if prettyPrint {
-		gitObject.CatFile()
-		return nil
+	switch {
+	case showType:
+		fmt.Println(gitObject.Type)
+	case showSize:
+		fmt.Println(gitObject.Size)
+	default:
+		return gitObject.PrettyPrint()
 	}
 
 	return nil
@@ -163,7 +294,7 @@ func git_ls_tree(args []string) error {
 		fmt.Fprintln(os.Stderr,
 			`List the contents of a tree object
 
-Usage: mygit ls-tree [options] <tree_sha>`)
+Usage: mygit ls-tree [options] <tree-ish>`)
 		flagSet.PrintDefaults()
 	}
 
@@ -178,7 +309,7 @@ Usage: mygit ls-tree [options] <tree_sha>`)
 	}
 
 	tree_sha := flagSet.Arg(0)
-	gitObject, err := mygit.NewObject(tree_sha)
+	gitObject, err := mygit.ResolveTree(tree_sha)
 	if err != nil {
 		return err
 	}
@@ -194,19 +325,19 @@ func writeTree(args []string) error {
 	flagSet := flag.NewFlagSet("write-tree", flag.ExitOnError)
 	flagSet.Usage = func() {
 		fmt.Fprintln(os.Stderr,
-			`Create a tree object from the current working directory
+			`Create a tree object from the current index
 
 Usage: mygit write-tree`)
 	}
 
 	flagSet.Parse(args)
 
-	treeEntry, err := mygit.RecordTree(".", true)
+	tree, err := mygit.WriteTree()
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(treeEntry.Hash)
+	fmt.Println(tree)
 
 	return nil
 }
@@ -217,34 +348,27 @@ func commitTree(args []string) error {
 		fmt.Fprintln(os.Stderr,
 			`Create a new commit object
 
-Usage: mygit commit-tree [options] <tree_sha>
+Usage: mygit commit-tree [options] <tree-ish>
 
 Options:
-    -p <parent_commit>  Parent commit hash
+    -p <parent_commit>  Parent commit hash, repeated for each parent
     -m <message>        Commit message`)
 	}
 
-	var parentCommit string
-	flagSet.StringVar(&parentCommit, "p", "", "Parent commit")
+	var parentCommits stringsFlag
+	flagSet.Var(&parentCommits, "p", "Parent commit")
 	var commitMessage string
 	flagSet.StringVar(&commitMessage, "m", "", "Commit message")
 
 	// workaround for flag package not supporting options after arguments
 	var treeSha string
-	if len(args) > 1 {
-		switch args[0] {
-		case "-p":
-			flagSet.Parse(args)
-		case "-m":
-			flagSet.Parse(args)
-		default:
-			treeSha = args[0]
-			flagSet.Parse(args[1:])
-		}
+	if len(args) > 1 && !strings.HasPrefix(args[0], "-") {
+		treeSha = args[0]
+		flagSet.Parse(args[1:])
+	} else {
+		flagSet.Parse(args)
 	}
 
-	flagSet.Parse(args)
-
 	if flagSet.NArg() < 1 && treeSha == "" {
 		flagSet.Usage()
 		os.Exit(1)
@@ -260,7 +384,7 @@ Options:
 		os.Exit(1)
 	}
 
-	commitOID, err := mygit.CommitTree(treeSha, parentCommit, commitMessage)
+	commitOID, err := mygit.CommitTree(treeSha, parentCommits, commitMessage)
 	if err != nil {
 		return err
 	}
@@ -323,21 +447,62 @@ func logCommit(args []string) error {
 		fmt.Fprintln(os.Stderr,
 			`Show commit logs for a commit ID
 
-Usage: mygit log [<commit_id>]`)
+Usage: mygit log [--follow] [<revision range>] [[--] <path>...]`)
+		flagSet.PrintDefaults()
 	}
+	var follow bool
+	flagSet.BoolVar(&follow, "follow", false, "Continue listing the history of a file beyond renames")
+
+	args, pathspecs := splitPathspecs(args)
 	if err := flagSet.Parse(args); err != nil {
 		return err
 	}
 
-	commitId := ""
-	if flagSet.NArg() > 0 {
-		commitId = flagSet.Arg(0)
+	options := mygit.LogOptions{Follow: follow}
+	return mygit.Log(flagSet.Args(), pathspecs, &options)
+}
+
+func add(args []string) error {
+	flagSet := flag.NewFlagSet("add", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Add file contents to the index
+
+Usage: mygit add [-n] [-v] [-f] [-u | -A] [<pathspec>...]`)
+		flagSet.PrintDefaults()
 	}
-	if err := mygit.Log(commitId); err != nil {
+
+	var update bool
+	flagSet.BoolVar(&update, "u", false, "Only stage modified and deleted tracked files, "+
+		"of the whole working tree without pathspec")
+	var all bool
+	flagSet.BoolVar(&all, "A", false, "Stage new, modified and deleted files, "+
+		"of the whole working tree without pathspec")
+	var dryRun bool
+	flagSet.BoolVar(&dryRun, "n", false, "Only show what would be staged")
+	flagSet.BoolVar(&dryRun, "dry-run", false, "Only show what would be staged")
+	var verbose bool
+	flagSet.BoolVar(&verbose, "v", false, "Show the staged files")
+	var force bool
+	flagSet.BoolVar(&force, "f", false, "Allow adding ignored files")
+	flagSet.BoolVar(&force, "force", false, "Allow adding ignored files")
+
+	if err := flagSet.Parse(args); err != nil {
 		return err
 	}
 
-	return nil
+	options := mygit.AddOptions{
+		Update:  update,
+		All:     all,
+		DryRun:  dryRun,
+		Verbose: verbose,
+		Force:   force,
+	}
+	err := mygit.Add(flagSet.Args(), &options)
+	if errors.Is(err, mygit.ErrIgnoredPaths) {
+		os.Exit(1)
+	}
+	return err
 }
 
 func commit(args []string) error {
@@ -346,12 +511,21 @@ func commit(args []string) error {
 		fmt.Fprintln(os.Stderr,
 			`Record changes to the repository
 
-Usage: mygit commit -m <message>`)
+Usage: mygit commit [-a] [--amend] [--allow-empty] -m <message>`)
 	}
 
 	var message string
 	flagSet.StringVar(&message, "m", "", "Commit message")
 
+	var all bool
+	flagSet.BoolVar(&all, "a", false, "Stage modified and deleted tracked files first")
+
+	var amend bool
+	flagSet.BoolVar(&amend, "amend", false, "Replace the tip of the current branch by a new commit")
+
+	var allowEmpty bool
+	flagSet.BoolVar(&allowEmpty, "allow-empty", false, "Allow a commit without changes from HEAD")
+
 	var allowEmptyMessage bool
 	flagSet.BoolVar(&allowEmptyMessage, "allow-empty-message", false, "Allow empty message")
 
@@ -363,9 +537,1420 @@ Usage: mygit commit -m <message>`)
 		return fmt.Errorf("commit message is required")
 	}
 
-	if err := mygit.Commit(message); err != nil {
+	options := mygit.CommitOptions{
+		All:        all,
+		AllowEmpty: allowEmpty,
+		Amend:      amend,
+	}
+
+	if err := mygit.Commit(message, &options); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// porcelainFlag is the --porcelain flag, given with or without a format
+// version, as in --porcelain or --porcelain=v2
+type porcelainFlag int
+
+func (p *porcelainFlag) String() string {
+	return fmt.Sprint(int(*p))
+}
+
+func (p *porcelainFlag) Set(value string) error {
+	switch value {
+	case "true", "v1":
+		*p = 1
+	case "v2":
+		*p = 2
+	default:
+		return fmt.Errorf("unsupported porcelain version '%s'", value)
+	}
+	return nil
+}
+
+func (p *porcelainFlag) IsBoolFlag() bool {
+	return true
+}
+
+// untrackedFlag is the --untracked-files flag, "all" when given without
+// a mode
+type untrackedFlag string
+
+func (u *untrackedFlag) String() string {
+	return string(*u)
+}
+
+func (u *untrackedFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*u = "all"
+	case "no", "normal", "all":
+		*u = untrackedFlag(value)
+	default:
+		return fmt.Errorf("invalid untracked files mode '%s'", value)
+	}
+	return nil
+}
+
+func (u *untrackedFlag) IsBoolFlag() bool {
+	return true
+}
+
+func status(args []string) error {
+	flagSet := flag.NewFlagSet("status", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Show the working tree status
+
+Usage: mygit status [-s] [-b] [--porcelain[=<version>]] [-z] [-u[=<mode>]] [--ignored]
+                    [--find-renames[=<n>]] [--no-renames]`)
+		flagSet.PrintDefaults()
+	}
+
+	var short bool
+	flagSet.BoolVar(&short, "s", false, "Give the output in the short format")
+	flagSet.BoolVar(&short, "short", false, "Give the output in the short format")
+	var branch bool
+	flagSet.BoolVar(&branch, "b", false, "Show the branch and tracking info in the short format")
+	flagSet.BoolVar(&branch, "branch", false, "Show the branch and tracking info in the short format")
+	var porcelain porcelainFlag
+	flagSet.Var(&porcelain, "porcelain", "Give the output in a stable format for scripts, v1 or v2")
+	var nullTerminated bool
+	flagSet.BoolVar(&nullTerminated, "z", false, "Terminate entries with NUL, implies --porcelain=v1")
+	untracked := untrackedFlag("normal")
+	flagSet.Var(&untracked, "u", "Show untracked files, mode no, normal or all (default all)")
+	flagSet.Var(&untracked, "untracked-files", "Show untracked files, mode no, normal or all (default all)")
+	var ignored bool
+	flagSet.BoolVar(&ignored, "ignored", false, "Show ignored files as well")
+	renames, err := mygit.DefaultRenameOptions("status")
+	if err != nil {
+		return err
+	}
+	flagSet.Var(&renameFlag{options: &renames}, "find-renames",
+		"Detect renames, with an optional minimum similarity index")
+	flagSet.BoolFunc("no-renames", "Turn off rename detection", func(string) error {
+		renames = mygit.RenameOptions{}
+		return nil
+	})
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if flagSet.NArg() != 0 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	options := mygit.StatusOptions{
+		Porcelain:      int(porcelain),
+		Branch:         branch,
+		NullTerminated: nullTerminated,
+		UntrackedFiles: string(untracked),
+		Ignored:        ignored,
+		Renames:        renames,
+	}
+	if (short || nullTerminated) && options.Porcelain == 0 {
+		options.Porcelain = 1
+	}
+	return mygit.Status(&options)
+}
+
+func diff(args []string) error {
+	flagSet := flag.NewFlagSet("diff", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Show changes between commits, commit and working tree, etc
+
+Usage: mygit diff [<options>] [<commit>] [--] [<path>...]
+       mygit diff [<options>] --cached [<commit>] [--] [<path>...]
+       mygit diff [<options>] <commit> <commit> [--] [<path>...]
+       mygit diff [<options>] <commit>..<commit> [--] [<path>...]`)
+		flagSet.PrintDefaults()
+	}
+
+	var cached bool
+	flagSet.BoolVar(&cached, "cached", false, "Show the changes staged for the next commit")
+	flagSet.BoolVar(&cached, "staged", false, "Show the changes staged for the next commit")
+	var context int
+	flagSet.IntVar(&context, "U", mygit.DefaultDiffContext, "Generate diffs with <n> lines of context")
+	flagSet.IntVar(&context, "unified", mygit.DefaultDiffContext, "Generate diffs with <n> lines of context")
+	var stat bool
+	flagSet.BoolVar(&stat, "stat", false, "Show the number of changed lines of each file")
+	var nameOnly bool
+	flagSet.BoolVar(&nameOnly, "name-only", false, "Show only the names of changed files")
+	var nameStatus bool
+	flagSet.BoolVar(&nameStatus, "name-status", false, "Show only the names and status of changed files")
+	algorithm := mygit.DiffMyers
+	flagSet.StringVar(&algorithm, "diff-algorithm", mygit.DiffMyers,
+		"Diff algorithm: myers, minimal, patience or histogram")
+	for _, name := range []string{mygit.DiffMinimal, mygit.DiffPatience, mygit.DiffHistogram} {
+		flagSet.BoolFunc(name, "Generate a diff using the "+name+" diff algorithm", func(string) error {
+			algorithm = name
+			return nil
+		})
+	}
+	renames, err := mygit.DefaultRenameOptions("diff")
+	if err != nil {
+		return err
+	}
+	addRenameFlags(flagSet, &renames)
+
+	args, pathspecs := splitPathspecs(args)
+	if err := flagSet.Parse(attachValues(args, "UMC")); err != nil {
+		return err
+	}
+
+	options := mygit.DiffOptions{
+		Cached:     cached,
+		Context:    context,
+		Algorithm:  algorithm,
+		Stat:       stat,
+		NameOnly:   nameOnly,
+		NameStatus: nameStatus,
+		Renames:    renames,
+	}
+	return mygit.Diff(flagSet.Args(), pathspecs, &options)
+}
+
+// splitPathspecs separates the arguments before "--" from the paths after
+// it
+func splitPathspecs(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// attachValues rewrites "-<letter><value>" to "-<letter>=<value>" for the
+// given one letter flags, the flag package only reading the latter
+func attachValues(args []string, letters string) []string {
+	rewritten := make([]string, len(args))
+	for i, arg := range args {
+		rewritten[i] = arg
+		if len(arg) > 2 && arg[0] == '-' && strings.IndexByte(letters, arg[1]) >= 0 && arg[2] != '=' {
+			rewritten[i] = arg[:2] + "=" + arg[2:]
+		}
+	}
+	return rewritten
+}
+
+// renameFlag turns the detection of renamed files on, and of copied files
+// too for copies, with an optional minimum similarity as in -M50%
+type renameFlag struct {
+	options *mygit.RenameOptions
+	copies  bool
+}
+
+func (r *renameFlag) String() string {
+	return ""
+}
+
+func (r *renameFlag) Set(value string) error {
+	r.options.FindRenames = true
+	r.options.FindCopies = r.options.FindCopies || r.copies
+	if value == "true" {
+		return nil
+	}
+	score, err := mygit.ParseRenameScore(value)
+	if err != nil {
+		return err
+	}
+	r.options.MinScore = score
+	return nil
+}
+
+func (r *renameFlag) IsBoolFlag() bool {
+	return true
+}
+
+// addRenameFlags adds the flags of the detection of renamed and copied
+// files
+func addRenameFlags(flagSet *flag.FlagSet, options *mygit.RenameOptions) {
+	renames := &renameFlag{options: options}
+	flagSet.Var(renames, "M", "Detect renames, with an optional minimum similarity index")
+	flagSet.Var(renames, "find-renames", "Detect renames, with an optional minimum similarity index")
+	copies := &renameFlag{options: options, copies: true}
+	flagSet.Var(copies, "C", "Detect copies as well as renames, with an optional minimum similarity index")
+	flagSet.Var(copies, "find-copies", "Detect copies as well as renames, with an optional minimum similarity index")
+	flagSet.BoolFunc("no-renames", "Turn off rename detection", func(string) error {
+		*options = mygit.RenameOptions{}
+		return nil
+	})
+}
+
+func diffTree(args []string) error {
+	flagSet := flag.NewFlagSet("diff-tree", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Compare the content and mode of blobs found via two tree objects
+
+Usage: mygit diff-tree [-r] [--root] [-m] [-z] [-M[<n>]] [-C[<n>]] <tree-ish> [<tree-ish>] [<path>...]`)
+		flagSet.PrintDefaults()
+	}
+
+	var recursive bool
+	flagSet.BoolVar(&recursive, "r", false, "Recurse into subtrees")
+	var root bool
+	flagSet.BoolVar(&root, "root", false, "Show the initial commit as a creation of all its files")
+	var merges bool
+	flagSet.BoolVar(&merges, "m", false, "Show the changes of merge commits against each parent")
+	var nullTerminated bool
+	flagSet.BoolVar(&nullTerminated, "z", false, "Terminate fields with NUL and do not quote paths")
+	var renames mygit.RenameOptions
+	addRenameFlags(flagSet, &renames)
+
+	args, pathspecs := splitPathspecs(args)
+	if err := flagSet.Parse(attachValues(args, "MC")); err != nil {
+		return err
+	}
+	if flagSet.NArg() < 1 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	options := mygit.DiffTreeOptions{
+		Recursive:      recursive,
+		Root:           root,
+		Merges:         merges,
+		NullTerminated: nullTerminated,
+		Renames:        renames,
+	}
+	return mygit.DiffTree(flagSet.Args(), pathspecs, &options)
+}
+
+func indexPack(args []string) error {
+	flagSet := flag.NewFlagSet("index-pack", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Build pack index file for an existing packed archive
+
+Usage: mygit index-pack [-o <index-file>] <pack-file>`)
+		flagSet.PrintDefaults()
+	}
+
+	var indexFile string
+	flagSet.StringVar(&indexFile, "o", "",
+		"Write the index into the specified file (default: <pack-file> with .idx extension)")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	if flagSet.NArg() < 1 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	packChecksum, err := mygit.IndexPack(flagSet.Arg(0), indexFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(packChecksum)
+
+	return nil
+}
+
+func verifyPack(args []string) error {
+	flagSet := flag.NewFlagSet("verify-pack", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Validate packed Git archive files
+
+Usage: mygit verify-pack [-v] [-s] <pack>.idx...`)
+		flagSet.PrintDefaults()
+	}
+
+	var verbose bool
+	flagSet.BoolVar(&verbose, "v", false,
+		"List objects, their delta chain and a chain length histogram")
+	var statOnly bool
+	flagSet.BoolVar(&statOnly, "s", false,
+		"Only show the chain length histogram")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	if flagSet.NArg() < 1 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	for _, path := range flagSet.Args() {
+		options := mygit.VerifyPackOptions{
+			Path:     path,
+			Verbose:  verbose,
+			StatOnly: statOnly,
+		}
+		if err := mygit.VerifyPack(&options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func showIndex(args []string) error {
+	flagSet := flag.NewFlagSet("show-index", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Show packed archive index
+
+Usage: mygit show-index [<idx-file>]
+
+Reads the index from the standard input when no file is given`)
+	}
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	if flagSet.NArg() < 1 {
+		return mygit.ShowIndex(os.Stdin)
+	}
+
+	file, err := os.Open(flagSet.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return mygit.ShowIndex(file)
+}
+
+func packObjects(args []string) error {
+	flagSet := flag.NewFlagSet("pack-objects", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Create a packed archive of objects
+
+Usage: mygit pack-objects [options] <base-name> < <object-list>
+       mygit pack-objects --stdout [options] < <object-list>
+
+Reads object IDs from the standard input, one per line, optionally
+followed by the path of the object. Writes <base-name>-<checksum>.pack
+and its index, then prints the checksum.`)
+		flagSet.PrintDefaults()
+	}
+
+	var stdout bool
+	flagSet.BoolVar(&stdout, "stdout", false, "Write the pack contents to the standard output")
+	var window int
+	flagSet.IntVar(&window, "window", mygit.DefaultPackWindow,
+		"Number of objects considered as delta base (0 disables deltas)")
+	var depth int
+	flagSet.IntVar(&depth, "depth", mygit.DefaultPackDepth, "Maximum delta chain length")
+	var deltaBaseOffset bool
+	flagSet.BoolVar(&deltaBaseOffset, "delta-base-offset", false, "Use offset deltas")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	if flagSet.NArg() < 1 && !stdout {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	options := mygit.PackObjectsOptions{
+		BaseName:        flagSet.Arg(0),
+		Stdout:          stdout,
+		Window:          window,
+		Depth:           depth,
+		DeltaBaseOffset: deltaBaseOffset,
+	}
+
+	return mygit.PackObjects(os.Stdin, &options)
+}
+
+func repack(args []string) error {
+	flagSet := flag.NewFlagSet("repack", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Pack unpacked objects in a repository
+
+Usage: mygit repack [-a] [-d] [options]`)
+		flagSet.PrintDefaults()
+	}
+
+	var all bool
+	flagSet.BoolVar(&all, "a", false,
+		"Pack every reachable object into a single pack, including packed ones")
+	var delete bool
+	flagSet.BoolVar(&delete, "d", false,
+		"Remove redundant packs and loose objects after packing")
+	var window int
+	flagSet.IntVar(&window, "window", mygit.DefaultPackWindow,
+		"Number of objects considered as delta base (0 disables deltas)")
+	var depth int
+	flagSet.IntVar(&depth, "depth", mygit.DefaultPackDepth, "Maximum delta chain length")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	options := mygit.RepackOptions{
+		All:    all,
+		Delete: delete,
+		Window: window,
+		Depth:  depth,
+	}
+
+	return mygit.Repack(&options)
+}
+
+func gc(args []string) error {
+	flagSet := flag.NewFlagSet("gc", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Cleanup unnecessary files and optimize the local repository
+
+Usage: mygit gc
+
+Packs the refs, then every object reachable from refs, HEAD and reflogs
+into a single pack and removes the redundant packs and loose objects.`)
+	}
+
+	if err := flagSet.Parse(args); err != nil {
 		return err
 	}
 
+	return mygit.Gc()
+}
+
+func fsck(args []string) error {
+	flagSet := flag.NewFlagSet("fsck", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Verify the connectivity and validity of the objects in the database
+
+Usage: mygit fsck [--no-dangling] [--unreachable]`)
+		flagSet.PrintDefaults()
+	}
+
+	var noDangling bool
+	flagSet.BoolVar(&noDangling, "no-dangling", false, "Do not print dangling objects")
+	var unreachable bool
+	flagSet.BoolVar(&unreachable, "unreachable", false,
+		"Print every unreachable object, not only dangling ones")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	options := mygit.FsckOptions{
+		NoDangling:  noDangling,
+		Unreachable: unreachable,
+	}
+
+	return mygit.Fsck(&options)
+}
+
+func prune(args []string) error {
+	flagSet := flag.NewFlagSet("prune", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Prune all unreachable objects from the object database
+
+Usage: mygit prune [-n] [-v] [--expire <time>]`)
+		flagSet.PrintDefaults()
+	}
+
+	var dryRun bool
+	flagSet.BoolVar(&dryRun, "n", false, "Do not remove anything, just report what would be removed")
+	var verbose bool
+	flagSet.BoolVar(&verbose, "v", false, "Report all removed objects")
+	var expire string
+	flagSet.StringVar(&expire, "expire", "",
+		"Only expire loose objects older than <time> (e.g. 2.weeks.ago, never)")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	options := mygit.PruneOptions{
+		Expire:  expire,
+		DryRun:  dryRun,
+		Verbose: verbose,
+	}
+
+	return mygit.Prune(&options)
+}
+
+func tag(args []string) error {
+	flagSet := flag.NewFlagSet("tag", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Create, list or delete tags
+
+Usage: mygit tag [-a] [-f] [-m <message>] <tagname> [<commit>]
+       mygit tag -d <tagname>...
+       mygit tag [-l] [<pattern>...]`)
+		flagSet.PrintDefaults()
+	}
+
+	var annotate bool
+	flagSet.BoolVar(&annotate, "a", false, "Make an unsigned, annotated tag object")
+	var message string
+	flagSet.StringVar(&message, "m", "", "Use the given tag message (implies -a)")
+	var force bool
+	flagSet.BoolVar(&force, "f", false, "Replace an existing tag")
+	var delete bool
+	flagSet.BoolVar(&delete, "d", false, "Delete existing tags with the given names")
+	var list bool
+	flagSet.BoolVar(&list, "l", false, "List tags, only the ones matching a pattern if given")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	if delete {
+		if flagSet.NArg() < 1 {
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		for _, name := range flagSet.Args() {
+			if err := mygit.DeleteTag(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if list || flagSet.NArg() == 0 {
+		return mygit.ListTags(flagSet.Args())
+	}
+
+	if flagSet.NArg() > 2 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	target := ""
+	if flagSet.NArg() == 2 {
+		target = flagSet.Arg(1)
+	}
+
+	options := mygit.TagOptions{
+		Annotate: annotate,
+		Message:  message,
+		Force:    force,
+	}
+
+	return mygit.CreateTag(flagSet.Arg(0), target, &options)
+}
+
+// abbrevFlag is a flag that may be given with or without a length,
+// as in --short or --short=8
+type abbrevFlag int
+
+func (a *abbrevFlag) String() string {
+	return fmt.Sprint(int(*a))
+}
+
+func (a *abbrevFlag) Set(value string) error {
+	if value == "true" {
+		*a = mygit.DefaultAbbrev
+		return nil
+	}
+	length, err := strconv.Atoi(value)
+	if err != nil || length < 0 {
+		return fmt.Errorf("invalid length '%s'", value)
+	}
+	*a = abbrevFlag(length)
+	return nil
+}
+
+func (a *abbrevFlag) IsBoolFlag() bool {
+	return true
+}
+
+func revParse(args []string) error {
+	flagSet := flag.NewFlagSet("rev-parse", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Pick out and massage parameters
+
+Usage: mygit rev-parse [--verify] [--short[=<length>]] <revision>...
+       mygit rev-parse --disambiguate=<prefix>`)
+		flagSet.PrintDefaults()
+	}
+
+	var short abbrevFlag
+	flagSet.Var(&short, "short", "Abbreviate the object names, to at least <length> characters")
+	var verify bool
+	flagSet.BoolVar(&verify, "verify", false, "Verify that exactly one revision naming an object is given")
+	var disambiguate string
+	flagSet.StringVar(&disambiguate, "disambiguate", "",
+		"Show every object whose name begins with the given prefix")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	if disambiguate != "" {
+		return mygit.Disambiguate(disambiguate)
+	}
+
+	if flagSet.NArg() < 1 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	options := mygit.RevParseOptions{
+		Short:  int(short),
+		Verify: verify,
+	}
+
+	return mygit.RevParse(flagSet.Args(), &options)
+}
+
+func branch(args []string) error {
+	flagSet := flag.NewFlagSet("branch", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`List, create, or delete branches
+
+Usage: mygit branch [-v]
+       mygit branch [-f] <branchname> [<start-point>]
+       mygit branch (-d | -D) <branchname>...
+       mygit branch (-m | -M) [<oldbranch>] <newbranch>`)
+		flagSet.PrintDefaults()
+	}
+
+	var verbose bool
+	flagSet.BoolVar(&verbose, "v", false, "Show the tip commit of each branch")
+	var force bool
+	flagSet.BoolVar(&force, "f", false, "Reset <branchname> to <start-point> if it already exists")
+	var delete bool
+	flagSet.BoolVar(&delete, "d", false, "Delete branches, they must be merged in HEAD")
+	var forceDelete bool
+	flagSet.BoolVar(&forceDelete, "D", false, "Delete branches, even if not merged")
+	var move bool
+	flagSet.BoolVar(&move, "m", false, "Rename a branch")
+	var forceMove bool
+	flagSet.BoolVar(&forceMove, "M", false, "Rename a branch, even if the new name exists")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	options := mygit.BranchOptions{
+		Force:   force || forceDelete || forceMove,
+		Verbose: verbose,
+	}
+
+	switch {
+	case delete || forceDelete:
+		if flagSet.NArg() < 1 {
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		for _, name := range flagSet.Args() {
+			if err := mygit.DeleteBranch(name, &options); err != nil {
+				return err
+			}
+		}
+		return nil
+	case move || forceMove:
+		switch flagSet.NArg() {
+		case 1:
+			return mygit.RenameBranch("", flagSet.Arg(0), &options)
+		case 2:
+			return mygit.RenameBranch(flagSet.Arg(0), flagSet.Arg(1), &options)
+		}
+		flagSet.Usage()
+		os.Exit(1)
+	case flagSet.NArg() == 0:
+		return mygit.ListBranches(&options)
+	case flagSet.NArg() > 2:
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	return mygit.CreateBranch(flagSet.Arg(0), flagSet.Arg(1), &options)
+}
+
+func switchBranch(args []string) error {
+	flagSet := flag.NewFlagSet("switch", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Switch branches
+
+Usage: mygit switch <branch>
+       mygit switch -c <new-branch> [<start-point>]
+       mygit switch --detach <commit>`)
+		flagSet.PrintDefaults()
+	}
+
+	var create string
+	flagSet.StringVar(&create, "c", "", "Create a new branch at <start-point> and switch to it")
+	var detach bool
+	flagSet.BoolVar(&detach, "detach", false, "Switch to a commit, detaching HEAD")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	if (create == "" && flagSet.NArg() != 1) || flagSet.NArg() > 1 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	options := mygit.SwitchOptions{
+		Create: create,
+		Detach: detach,
+	}
+
+	return mygit.Switch(flagSet.Arg(0), &options)
+}
+
+func checkout(args []string) error {
+	flagSet := flag.NewFlagSet("checkout", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Switch branches or detach HEAD at a commit
+
+Usage: mygit checkout [-b <new-branch>] <branch-or-commit>`)
+		flagSet.PrintDefaults()
+	}
+
+	var create string
+	flagSet.StringVar(&create, "b", "", "Create a new branch at <start-point> and switch to it")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	if create != "" {
+		if flagSet.NArg() > 1 {
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		return mygit.Switch(flagSet.Arg(0), &mygit.SwitchOptions{Create: create})
+	}
+
+	if flagSet.NArg() != 1 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	return mygit.Checkout(flagSet.Arg(0))
+}
+
+func packRefs(args []string) error {
+	flagSet := flag.NewFlagSet("pack-refs", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Pack heads and tags for efficient repository access
+
+Usage: mygit pack-refs [--all]`)
+		flagSet.PrintDefaults()
+	}
+
+	var all bool
+	flagSet.BoolVar(&all, "all", false,
+		"Pack every ref, not only tags and already packed refs")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if flagSet.NArg() != 0 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	return mygit.PackRefs(&mygit.PackRefsOptions{All: all})
+}
+
+func updateRef(args []string) error {
+	flagSet := flag.NewFlagSet("update-ref", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Update the object name stored in a ref safely
+
+Usage: mygit update-ref [-m <reason>] [--no-deref] <ref> <new-oid> [<old-oid>]
+       mygit update-ref [-m <reason>] [--no-deref] -d <ref> [<old-oid>]
+       mygit update-ref [-m <reason>] [--no-deref] --stdin
+
+With <old-oid>, the ref is only changed if it points to <old-oid>,
+an empty or zero <old-oid> requires the ref not to exist.
+
+--stdin reads one command per line and applies all of them or none:
+    update <ref> <new-oid> [<old-oid>]
+    create <ref> <new-oid>
+    delete <ref> [<old-oid>]
+    verify <ref> [<old-oid>]
+    option no-deref`)
+		flagSet.PrintDefaults()
+	}
+
+	var delete bool
+	flagSet.BoolVar(&delete, "d", false, "Delete the ref")
+	var noDeref bool
+	flagSet.BoolVar(&noDeref, "no-deref", false,
+		"Update a symbolic ref itself rather than the ref it points to")
+	var stdin bool
+	flagSet.BoolVar(&stdin, "stdin", false, "Read updates from the standard input")
+	var message string
+	flagSet.StringVar(&message, "m", "", "Reason of the update, recorded in the reflog")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	options := mygit.UpdateRefOptions{
+		Delete:  delete,
+		NoDeref: noDeref,
+		Message: message,
+	}
+
+	if stdin {
+		if delete || flagSet.NArg() != 0 {
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		return mygit.UpdateRefStdin(os.Stdin, &options)
+	}
+
+	// <ref> <new-oid> [<old-oid>], without <new-oid> when deleting
+	values := flagSet.Args()
+	if len(values) < 1 || (!delete && len(values) < 2) || len(values) > 3 ||
+		(delete && len(values) > 2) {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	refName, values := values[0], values[1:]
+	newValue := ""
+	if !delete {
+		newValue, values = values[0], values[1:]
+	}
+
+	oldValue := ""
+	if len(values) == 1 {
+		oldValue = values[0]
+		// an empty old value requires the ref not to exist
+		if oldValue == "" {
+			oldValue = strings.Repeat("0", 40)
+		}
+	}
+
+	return mygit.UpdateRef(refName, newValue, oldValue, &options)
+}
+
+func reflog(args []string) error {
+	usage := `Manage reflog information
+
+Usage: mygit reflog [show] [<ref>]
+       mygit reflog expire [--expire=<time>] [-n] [--all | <ref>...]
+       mygit reflog delete <ref>@{<n>}...`
+
+	subcommand := "show"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "show", "expire", "delete":
+			subcommand, args = args[0], args[1:]
+		}
+	}
+
+	flagSet := flag.NewFlagSet("reflog "+subcommand, flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		flagSet.PrintDefaults()
+	}
+
+	switch subcommand {
+	case "expire":
+		var expire string
+		flagSet.StringVar(&expire, "expire", mygit.DefaultReflogExpire,
+			"Remove entries older than <time> (e.g. 2.weeks.ago, all, never)")
+		var all bool
+		flagSet.BoolVar(&all, "all", false, "Expire the reflogs of every ref")
+		var dryRun bool
+		flagSet.BoolVar(&dryRun, "n", false, "Do not remove anything, just report what would be removed")
+
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if all == (flagSet.NArg() > 0) {
+			flagSet.Usage()
+			os.Exit(1)
+		}
+
+		options := mygit.ReflogExpireOptions{
+			Expire: expire,
+			All:    all,
+			DryRun: dryRun,
+		}
+		return mygit.ReflogExpire(flagSet.Args(), &options)
+
+	case "delete":
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() < 1 {
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		return mygit.ReflogDelete(flagSet.Args())
+
+	default:
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() > 1 {
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		return mygit.ReflogShow(flagSet.Arg(0))
+	}
+}
+
+func symbolicRef(args []string) error {
+	flagSet := flag.NewFlagSet("symbolic-ref", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Read, modify and delete symbolic refs
+
+Usage: mygit symbolic-ref [-q] [--short] <name>
+       mygit symbolic-ref [-m <reason>] <name> <ref>
+       mygit symbolic-ref --delete [-q] <name>`)
+		flagSet.PrintDefaults()
+	}
+
+	var quiet bool
+	flagSet.BoolVar(&quiet, "q", false, "Exit with status 1 without an error message if <name> is not a symbolic ref")
+	var short bool
+	flagSet.BoolVar(&short, "short", false, "Shorten the ref name, refs/heads/master to master")
+	var delete bool
+	flagSet.BoolVar(&delete, "delete", false, "Delete the symbolic ref")
+	var message string
+	flagSet.StringVar(&message, "m", "", "Reason of the update, recorded in the reflog")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	options := mygit.SymbolicRefOptions{
+		Short:   short,
+		Message: message,
+	}
+
+	var err error
+	switch {
+	case delete && flagSet.NArg() == 1:
+		err = mygit.DeleteSymbolicRef(flagSet.Arg(0))
+	case !delete && flagSet.NArg() == 1:
+		err = mygit.ShowSymbolicRef(flagSet.Arg(0), &options)
+	case !delete && flagSet.NArg() == 2:
+		err = mygit.SetSymbolicRef(flagSet.Arg(0), flagSet.Arg(1), &options)
+	default:
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if quiet && errors.Is(err, mygit.ErrNotSymbolicRef) {
+		os.Exit(1)
+	}
+	return err
+}
+
+func showRef(args []string) error {
+	flagSet := flag.NewFlagSet("show-ref", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`List references in a local repository
+
+Usage: mygit show-ref [--head] [-d] [--hash] [--abbrev[=<n>]] [--heads] [--tags] [<pattern>...]
+       mygit show-ref --verify [-q] [-d] [--hash] [--abbrev[=<n>]] <ref>...`)
+		flagSet.PrintDefaults()
+	}
+
+	var heads bool
+	flagSet.BoolVar(&heads, "heads", false, "Limit to branches")
+	var tags bool
+	flagSet.BoolVar(&tags, "tags", false, "Limit to tags")
+	var head bool
+	flagSet.BoolVar(&head, "head", false, "Show HEAD even if it would be filtered out")
+	var dereference bool
+	flagSet.BoolVar(&dereference, "d", false, "Show the objects annotated tags point to")
+	flagSet.BoolVar(&dereference, "dereference", false, "Show the objects annotated tags point to")
+	var hash bool
+	flagSet.BoolVar(&hash, "hash", false, "Only show the object names")
+	var abbrev abbrevFlag
+	flagSet.Var(&abbrev, "abbrev", "Abbreviate the object names, to at least <n> characters")
+	var verify bool
+	flagSet.BoolVar(&verify, "verify", false, "Require exact full ref names")
+	var quiet bool
+	flagSet.BoolVar(&quiet, "q", false, "Do not print anything, only set the exit status")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	options := mygit.ShowRefOptions{
+		Heads:       heads,
+		Tags:        tags,
+		Head:        head,
+		Dereference: dereference,
+		Hash:        hash,
+		Abbrev:      int(abbrev),
+		Verify:      verify,
+		Quiet:       quiet,
+	}
+
+	matched, err := mygit.ShowRef(flagSet.Args(), &options)
+	if quiet && errors.Is(err, mygit.ErrInvalidRef) {
+		os.Exit(1)
+	}
+	if err != nil {
+		return err
+	}
+	if !matched {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func checkIgnore(args []string) error {
+	flagSet := flag.NewFlagSet("check-ignore", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Debug gitignore / exclude files
+
+Usage: mygit check-ignore [-q] [-v [-n]] [--no-index] <pathname>...`)
+		flagSet.PrintDefaults()
+	}
+
+	var quiet bool
+	flagSet.BoolVar(&quiet, "q", false, "Do not output anything, just set the exit status")
+	var verbose bool
+	flagSet.BoolVar(&verbose, "v", false, "Show the matching pattern of each path")
+	flagSet.BoolVar(&verbose, "verbose", false, "Show the matching pattern of each path")
+	var nonMatching bool
+	flagSet.BoolVar(&nonMatching, "n", false, "Show the paths not matching any pattern too, with -v")
+	flagSet.BoolVar(&nonMatching, "non-matching", false, "Show the paths not matching any pattern too, with -v")
+	var noIndex bool
+	flagSet.BoolVar(&noIndex, "no-index", false, "Check tracked files too")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	options := mygit.CheckIgnoreOptions{
+		Verbose:     verbose,
+		NonMatching: nonMatching,
+		Quiet:       quiet,
+		NoIndex:     noIndex,
+	}
+
+	ignored, err := mygit.CheckIgnore(flagSet.Args(), &options)
+	if err != nil {
+		return err
+	}
+	if !ignored {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// stringsFlag is a flag that may be given several times
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func forEachRef(args []string) error {
+	flagSet := flag.NewFlagSet("for-each-ref", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Output information on each ref
+
+Usage: mygit for-each-ref [--count=<count>] [--sort=<key>]... [--format=<format>]
+                          [--points-at=<object>] [<pattern>...]`)
+		flagSet.PrintDefaults()
+	}
+
+	var format string
+	flagSet.StringVar(&format, "format", mygit.DefaultRefFormat,
+		"Format of each ref line, with %(<field>) placeholders")
+	var sortKeys stringsFlag
+	flagSet.Var(&sortKeys, "sort", "Field to sort on, prefixed by - for descending order, "+
+		"may be given several times, the last key being the primary one")
+	var count int
+	flagSet.IntVar(&count, "count", 0, "Stop after showing <count> refs")
+	var pointsAt string
+	flagSet.StringVar(&pointsAt, "points-at", "", "Only list refs which point to the given object")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	options := mygit.ForEachRefOptions{
+		Format:   format,
+		Sort:     sortKeys,
+		Count:    count,
+		PointsAt: pointsAt,
+	}
+	return mygit.ForEachRef(flagSet.Args(), &options)
+}
+
+func mergeBase(args []string) error {
+	flagSet := flag.NewFlagSet("merge-base", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Find as good common ancestors as possible for a merge
+
+Usage: mygit merge-base [-a] <commit> <commit>...
+       mygit merge-base [-a] --octopus <commit>...`)
+		flagSet.PrintDefaults()
+	}
+
+	var all bool
+	flagSet.BoolVar(&all, "a", false, "Output all merge bases rather than one")
+	flagSet.BoolVar(&all, "all", false, "Output all merge bases rather than one")
+	var octopus bool
+	flagSet.BoolVar(&octopus, "octopus", false, "Find the merge bases of a merge of all the commits")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	options := mygit.MergeBaseOptions{
+		All:     all,
+		Octopus: octopus,
+	}
+
+	found, err := mygit.MergeBase(flagSet.Args(), &options)
+	if err != nil {
+		return err
+	}
+	if !found {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func mergeTree(args []string) error {
+	flagSet := flag.NewFlagSet("merge-tree", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Perform merge without touching index or working tree
+
+Usage: mygit merge-tree [--write-tree] [--name-only] [--[no-]messages] <branch1> <branch2>`)
+		flagSet.PrintDefaults()
+	}
+
+	flagSet.Bool("write-tree", true, "Write the merged tree, the only mode supported")
+	var nameOnly bool
+	flagSet.BoolVar(&nameOnly, "name-only", false, "List the conflicted files without their stages")
+	var messages *bool
+	flagSet.BoolFunc("messages", "Show the messages about the merge, even when it is clean", func(string) error {
+		show := true
+		messages = &show
+		return nil
+	})
+	flagSet.BoolFunc("no-messages", "Do not show the messages about the merge", func(string) error {
+		show := false
+		messages = &show
+		return nil
+	})
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if flagSet.NArg() != 2 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	options := mygit.MergeTreeOptions{
+		NameOnly: nameOnly,
+		Messages: messages,
+	}
+
+	clean, err := mygit.MergeTree(flagSet.Arg(0), flagSet.Arg(1), &options)
+	if err != nil {
+		return err
+	}
+	if !clean {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func merge(args []string) error {
+	flagSet := flag.NewFlagSet("merge", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Join two development histories together
+
+Usage: mygit merge [--no-ff | --ff-only] [-m <message>] <commit>
+       mygit merge --abort`)
+		flagSet.PrintDefaults()
+	}
+
+	var message string
+	flagSet.StringVar(&message, "m", "", "Message of the merge commit")
+	var noFastForward bool
+	flagSet.BoolVar(&noFastForward, "no-ff", false, "Create a merge commit even when a fast-forward is possible")
+	var fastForwardOnly bool
+	flagSet.BoolVar(&fastForwardOnly, "ff-only", false, "Refuse to merge unless a fast-forward is possible")
+	var abort bool
+	flagSet.BoolVar(&abort, "abort", false, "Abort the merge left to conclude and reset to HEAD")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if abort {
+		return mygit.MergeAbort()
+	}
+	if flagSet.NArg() != 1 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	options := mygit.MergeOptions{
+		Message:         message,
+		NoFastForward:   noFastForward,
+		FastForwardOnly: fastForwardOnly,
+	}
+
+	clean, err := mygit.Merge(flagSet.Arg(0), &options)
+	if err != nil {
+		return err
+	}
+	if !clean {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// sequencerCommand runs cherry-pick or revert: the commits to apply, or
+// --continue, --skip or --abort of the sequence in progress
+func sequencerCommand(flagSet *flag.FlagSet, args []string, start func([]string) (bool, error)) error {
+	var continueSequence bool
+	flagSet.BoolVar(&continueSequence, "continue", false, "Conclude the commit stopped at and go on")
+	var skip bool
+	flagSet.BoolVar(&skip, "skip", false, "Skip the commit stopped at and go on")
+	var abort bool
+	flagSet.BoolVar(&abort, "abort", false, "Cancel the operation and return to the commit HEAD was at")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	var done bool
+	var err error
+	switch {
+	case abort:
+		return mygit.AbortPicks()
+	case continueSequence:
+		done, err = mygit.ContinuePicks()
+	case skip:
+		done, err = mygit.SkipPick()
+	default:
+		if flagSet.NArg() == 0 {
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		done, err = start(flagSet.Args())
+	}
+	if err != nil {
+		return err
+	}
+	if !done {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func cherryPick(args []string) error {
+	flagSet := flag.NewFlagSet("cherry-pick", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Apply the changes introduced by some existing commits
+
+Usage: mygit cherry-pick <commit>...
+       mygit cherry-pick (--continue | --skip | --abort)`)
+		flagSet.PrintDefaults()
+	}
+	return sequencerCommand(flagSet, args, mygit.CherryPick)
+}
+
+func revert(args []string) error {
+	flagSet := flag.NewFlagSet("revert", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Revert some existing commits
+
+Usage: mygit revert <commit>...
+       mygit revert (--continue | --skip | --abort)`)
+		flagSet.PrintDefaults()
+	}
+	return sequencerCommand(flagSet, args, mygit.Revert)
+}
+
+func rebase(args []string) error {
+	flagSet := flag.NewFlagSet("rebase", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`Reapply commits on top of another base tip
+
+Usage: mygit rebase [-i] <upstream>
+       mygit rebase (--continue | --skip | --abort | --edit-todo)`)
+		flagSet.PrintDefaults()
+	}
+	var interactive bool
+	flagSet.BoolVar(&interactive, "i", false, "Edit the list of commits to replay first")
+	flagSet.BoolVar(&interactive, "interactive", false, "Edit the list of commits to replay first")
+	var continueRebase bool
+	flagSet.BoolVar(&continueRebase, "continue", false, "Conclude the commit stopped at and go on")
+	var skip bool
+	flagSet.BoolVar(&skip, "skip", false, "Skip the commit stopped at and go on")
+	var abort bool
+	flagSet.BoolVar(&abort, "abort", false, "Cancel the rebase and return to the branch rebased")
+	var editTodo bool
+	flagSet.BoolVar(&editTodo, "edit-todo", false, "Edit the list of commands left")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	var done bool
+	var err error
+	switch {
+	case abort:
+		return mygit.RebaseAbort()
+	case editTodo:
+		return mygit.RebaseEditTodo()
+	case continueRebase:
+		done, err = mygit.RebaseContinue()
+	case skip:
+		done, err = mygit.RebaseSkip()
+	default:
+		if flagSet.NArg() != 1 {
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		done, err = mygit.Rebase(flagSet.Arg(0), &mygit.RebaseOptions{Interactive: interactive})
+	}
+	if err != nil {
+		return err
+	}
+	if !done {
+		os.Exit(1)
+	}
 	return nil
 }
@@ -0,0 +1,199 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// shortest accepted abbreviated object ID
+	minAbbrev = 4
+	// length of the abbreviated object IDs displayed by default
+	DefaultAbbrev = 7
+)
+
+// ambiguousObjectError is returned when an abbreviated object ID
+// matches several objects
+type ambiguousObjectError struct {
+	prefix     string
+	candidates []string
+}
+
+func (e *ambiguousObjectError) Error() string {
+	message := strings.Builder{}
+	fmt.Fprintf(&message, "ambiguous argument '%s': short object ID %s is ambiguous\n", e.prefix, e.prefix)
+	message.WriteString("hint: The candidates are:")
+	for _, candidate := range e.candidates {
+		fmt.Fprintf(&message, "\nhint:   %s", describeCandidate(candidate))
+	}
+	return message.String()
+}
+
+// isObjectPrefix checks that name looks like an abbreviated object ID
+func isObjectPrefix(name string) bool {
+	return len(name) >= minAbbrev && len(name) <= 40 && isHex(strings.ToLower(name))
+}
+
+// findObjectsByPrefix returns the sorted object IDs of the loose and packed
+// objects starting with the given hexadecimal prefix
+func findObjectsByPrefix(prefix string) ([]string, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < 2 || !isHex(prefix) {
+		return nil, fmt.Errorf("invalid object ID prefix '%s'", prefix)
+	}
+
+	found := map[string]bool{}
+
+	// loose objects
+	dirEntries, err := os.ReadDir(".git/objects/" + prefix[:2])
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, dirEntry := range dirEntries {
+		oid := prefix[:2] + dirEntry.Name()
+		if len(oid) == 40 && isHex(oid) && strings.HasPrefix(oid, prefix) {
+			found[oid] = true
+		}
+	}
+
+	// packed objects
+	for _, p := range getPacks() {
+		for _, oid := range p.index.findPrefix(prefix) {
+			found[oid] = true
+		}
+	}
+
+	oids := make([]string, 0, len(found))
+	for oid := range found {
+		oids = append(oids, oid)
+	}
+	sort.Strings(oids)
+	return oids, nil
+}
+
+// resolveAbbrev returns the single object ID starting with the given prefix
+func resolveAbbrev(prefix string) (string, error) {
+	if !isObjectPrefix(prefix) {
+		return "", fmt.Errorf("not a valid object name: '%s'", prefix)
+	}
+
+	oids, err := findObjectsByPrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(oids) {
+	case 0:
+		return "", fmt.Errorf("not a valid object name: '%s'", prefix)
+	case 1:
+		return oids[0], nil
+	}
+
+	return "", &ambiguousObjectError{prefix: prefix, candidates: sortCandidates(oids)}
+}
+
+// isAmbiguous checks whether the error is an ambiguous object ID error
+func isAmbiguous(err error) bool {
+	var ambiguousErr *ambiguousObjectError
+	return errors.As(err, &ambiguousErr)
+}
+
+// candidate display order: tags, commits, trees then blobs
+var candidateTypeOrder = map[ObjectType]int{
+	ObjectTypeTag:    0,
+	ObjectTypeCommit: 1,
+	ObjectTypeTree:   2,
+	ObjectTypeBlob:   3,
+}
+
+// sortCandidates sorts ambiguous object IDs by type then object ID
+func sortCandidates(oids []string) []string {
+	order := map[string]int{}
+	for _, oid := range oids {
+		order[oid] = len(candidateTypeOrder)
+		if object, err := NewObject(oid); err == nil {
+			if typeOrder, ok := candidateTypeOrder[object.Type]; ok {
+				order[oid] = typeOrder
+			}
+		}
+	}
+
+	sorted := make([]string, len(oids))
+	copy(sorted, oids)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return order[sorted[i]] < order[sorted[j]]
+	})
+	return sorted
+}
+
+// describeCandidate describes an ambiguous object the way git does:
+//
+//	<short_oid> commit <date> - <subject>
+//	<short_oid> tag <date> - <tag_name>
+//	<short_oid> tree
+//	<short_oid> blob
+func describeCandidate(oid string) string {
+	short := shortestUniqueAbbrev(oid, DefaultAbbrev)
+
+	object, err := NewObject(oid)
+	if err != nil {
+		return short + " [bad object]"
+	}
+
+	switch object.Type {
+	case ObjectTypeCommit:
+		commit, err := parseCommitObject(object)
+		if err != nil {
+			break
+		}
+		date, err := parseObjectDate(commit.AuthorDateSeconds, commit.AuthorDateTimeZone)
+		if err != nil {
+			break
+		}
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		return fmt.Sprintf("%s commit %s - %s", short, date.Format("2006-01-02"), subject)
+	case ObjectTypeTag:
+		tag, err := parseTagObject(object)
+		if err != nil || tag.TaggerDateSeconds == "" {
+			break
+		}
+		date, err := parseObjectDate(tag.TaggerDateSeconds, tag.TaggerDateTimeZone)
+		if err != nil {
+			break
+		}
+		return fmt.Sprintf("%s tag %s - %s", short, date.Format("2006-01-02"), tag.Tag)
+	}
+
+	return fmt.Sprintf("%s %s", short, object.Type)
+}
+
+// shortestUniqueAbbrev returns the shortest prefix of oid, at least
+// minLength long, that no other object starts with
+func shortestUniqueAbbrev(oid string, minLength int) string {
+	minLength = max(minLength, minAbbrev)
+	if minLength >= len(oid) {
+		return oid
+	}
+
+	oids, err := findObjectsByPrefix(oid[:minLength])
+	if err != nil {
+		return oid
+	}
+
+	length := minLength
+	for _, other := range oids {
+		if other == oid {
+			continue
+		}
+		// first differing character
+		common := 0
+		for common < len(oid) && oid[common] == other[common] {
+			common++
+		}
+		length = max(length, common+1)
+	}
+	return oid[:min(length, len(oid))]
+}
@@ -0,0 +1,169 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// ErrIgnoredPaths is returned by Add when pathspecs only match ignored
+// files, the other files being staged
+var ErrIgnoredPaths = errors.New("paths are ignored")
+
+type AddOptions struct {
+	// only stage the changes of tracked files, modifications and removals
+	Update bool
+	// stage every change, new files included, of the whole working tree
+	// when no pathspec is given
+	All bool
+	// do not stage anything, just show what would be staged
+	DryRun bool
+	// show the staged files
+	Verbose bool
+	// stage ignored files too
+	Force bool
+}
+
+// Add stages the content of the working tree files matching the pathspecs:
+// new and modified files are added to the index, removed files removed
+// from it. New files that are ignored are left out unless Force is set,
+// ErrIgnoredPaths being returned when a pathspec only matches such files
+func Add(patterns []string, options *AddOptions) error {
+	if len(patterns) == 0 && !options.Update && !options.All {
+		fmt.Println("Nothing specified, nothing added.")
+		return nil
+	}
+
+	lock, index, err := lockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+
+	paths, files, err := workingTreeFiles()
+	if err != nil {
+		return err
+	}
+
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return err
+	}
+
+	specs := parsePathspecs(patterns)
+	matched := make([]bool, len(specs))
+	matchedIgnored := make([]bool, len(specs))
+	show := func(action string, filePath string) {
+		if options.DryRun || options.Verbose {
+			fmt.Printf("%s '%s'\n", action, filePath)
+		}
+	}
+
+	// tracked files first, then the new ones
+	tracked := map[string]bool{}
+	for _, entry := range append([]*indexEntry{}, index.entries...) {
+		if tracked[entry.path] {
+			continue
+		}
+		tracked[entry.path] = true
+		if !matchPathspecs(specs, entry.path, matched) {
+			continue
+		}
+
+		info, exists := files[entry.path]
+		if !exists {
+			// submodules are left as they are
+			if entry.mode == 0160000 {
+				if info, err := os.Stat(entry.path); err == nil && info.IsDir() {
+					continue
+				}
+			}
+			show("remove", entry.path)
+			index.remove(entry.path)
+			continue
+		}
+		if err := stageFile(index, entry.path, info, options.DryRun, show); err != nil {
+			return err
+		}
+	}
+
+	if !options.Update {
+		for _, filePath := range paths {
+			if tracked[filePath] {
+				continue
+			}
+			if !options.Force {
+				ignored, err := rules.ignored(filePath, false)
+				if err != nil {
+					return err
+				}
+				if ignored {
+					matchPathspecs(specs, filePath, matchedIgnored)
+					continue
+				}
+			}
+			if !matchPathspecs(specs, filePath, matched) {
+				continue
+			}
+			if err := stageFile(index, filePath, files[filePath], options.DryRun, show); err != nil {
+				return err
+			}
+		}
+	}
+
+	ignoredSpecs := []string{}
+	for i, spec := range specs {
+		if matched[i] {
+			continue
+		}
+		if matchedIgnored[i] {
+			ignoredSpecs = append(ignoredSpecs, spec.pattern)
+			continue
+		}
+		if options.Update {
+			return fmt.Errorf("pathspec '%s' did not match any file(s) known to git", spec.pattern)
+		}
+		return fmt.Errorf("pathspec '%s' did not match any files", spec.pattern)
+	}
+
+	if !options.DryRun {
+		if err := writeIndex(lock, index); err != nil {
+			return err
+		}
+		if err := lock.commit(); err != nil {
+			return err
+		}
+	}
+
+	if len(ignoredSpecs) > 0 {
+		fmt.Fprintln(os.Stderr, "The following paths are ignored by one of your .gitignore files:")
+		for _, pattern := range ignoredSpecs {
+			fmt.Fprintln(os.Stderr, pattern)
+		}
+		fmt.Fprintln(os.Stderr, "hint: Use -f if you really want to add them.")
+		return ErrIgnoredPaths
+	}
+	return nil
+}
+
+// stageFile updates the entry of a working tree file, only hashing its
+// content when its stat data changed
+func stageFile(index *stagingIndex, filePath string, info fs.FileInfo, dryRun bool,
+	show func(action string, filePath string)) error {
+	entry := index.entry(filePath)
+	if entry != nil && index.upToDate(entry, info) {
+		return nil
+	}
+
+	oid, err := hashWorkingFile(filePath, info, !dryRun)
+	if err != nil {
+		return err
+	}
+	newEntry := newIndexEntry(filePath, oid, info)
+	if entry == nil || entry.oid != oid || entry.mode != newEntry.mode {
+		show("add", filePath)
+	}
+	index.add(newEntry)
+	return nil
+}
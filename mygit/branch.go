@@ -0,0 +1,244 @@
+package mygit
+
+import (
+	"fmt"
+	"strings"
+)
+
+const headsPrefix = "refs/heads/"
+
+type BranchOptions struct {
+	// create or rename over an existing branch, delete unmerged branches
+	Force bool
+	// show the tip commit of each branch when listing
+	Verbose bool
+}
+
+// currentBranch returns the name of the checked out branch,
+// empty when HEAD is detached
+func currentBranch() (string, error) {
+	refName, _, err := readHead()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(refName, headsPrefix), nil
+}
+
+// branchOID returns the commit a branch points to, empty if the branch
+// does not exist
+func branchOID(name string) (string, error) {
+	if !validRefName(name) {
+		return "", nil
+	}
+	return readRef(headsPrefix + name)
+}
+
+// ListBranches prints the branches, the current one marked with '*'
+func ListBranches(options *BranchOptions) error {
+	type branchLine struct {
+		name    string
+		oid     string
+		current bool
+	}
+
+	head, headOID, err := readHead()
+	if err != nil {
+		return err
+	}
+
+	lines := []branchLine{}
+	if head == "" {
+		lines = append(lines, branchLine{
+			name:    fmt.Sprintf("(HEAD detached at %s)", shortestUniqueAbbrev(headOID, DefaultAbbrev)),
+			oid:     headOID,
+			current: true,
+		})
+	}
+
+	names, err := listRefs(headsPrefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		oid, err := readRef(headsPrefix + name)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, branchLine{name: name, oid: oid, current: headsPrefix+name == head})
+	}
+
+	width := 0
+	for _, line := range lines {
+		width = max(width, len(line.name))
+	}
+
+	for _, line := range lines {
+		marker := ' '
+		if line.current {
+			marker = '*'
+		}
+		if !options.Verbose {
+			fmt.Printf("%c %s\n", marker, line.name)
+			continue
+		}
+
+		commit, err := peelToCommit(line.oid)
+		if err != nil {
+			return err
+		}
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		fmt.Printf("%c %-*s %s %s\n", marker, width, line.name,
+			shortestUniqueAbbrev(line.oid, DefaultAbbrev), subject)
+	}
+
+	return nil
+}
+
+// CreateBranch creates a branch pointing to the commit of the start
+// point, HEAD by default
+func CreateBranch(name string, startPoint string, options *BranchOptions) error {
+	if !validRefName(name) || name == "HEAD" {
+		return fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+
+	existing, err := branchOID(name)
+	if err != nil {
+		return err
+	}
+	if existing != "" {
+		if !options.Force {
+			return fmt.Errorf("a branch named '%s' already exists", name)
+		}
+		current, err := currentBranch()
+		if err != nil {
+			return err
+		}
+		if current == name {
+			return fmt.Errorf("cannot force update the current branch")
+		}
+	}
+
+	if startPoint == "" {
+		startPoint = "HEAD"
+	}
+	oid, err := resolveRevision(startPoint)
+	if err != nil {
+		return fmt.Errorf("not a valid object name: '%s'", startPoint)
+	}
+	commit, err := peelToCommit(oid)
+	if err != nil {
+		return err
+	}
+
+	message := "branch: Created from " + startPoint
+	if existing != "" {
+		message = "branch: Reset to " + startPoint
+	}
+	return writeRef(headsPrefix+name, commit.Hash, message)
+}
+
+// DeleteBranch deletes a branch, unless it is not merged in HEAD
+func DeleteBranch(name string, options *BranchOptions) error {
+	oid, err := branchOID(name)
+	if err != nil {
+		return err
+	}
+	if oid == "" {
+		return fmt.Errorf("branch '%s' not found", name)
+	}
+
+	current, err := currentBranch()
+	if err != nil {
+		return err
+	}
+	if current == name {
+		return fmt.Errorf("cannot delete branch '%s' checked out", name)
+	}
+
+	if !options.Force {
+		merged, err := isMergedInHead(oid)
+		if err != nil {
+			return err
+		}
+		if !merged {
+			return fmt.Errorf("the branch '%s' is not fully merged, "+
+				"run 'mygit branch -D %s' to delete it anyway", name, name)
+		}
+	}
+
+	if err := deleteRef(headsPrefix + name); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted branch %s (was %s).\n", name, shortestUniqueAbbrev(oid, DefaultAbbrev))
+	return nil
+}
+
+// isMergedInHead checks that a commit is an ancestor of HEAD
+func isMergedInHead(oid string) (bool, error) {
+	head, err := getHeadOID()
+	if err != nil || head == "" {
+		return false, err
+	}
+	ancestors, err := commitAncestors(head)
+	if err != nil {
+		return false, err
+	}
+	_, merged := ancestors[oid]
+	return merged, nil
+}
+
+// RenameBranch renames a branch, the current one if oldName is empty,
+// HEAD follows the renamed branch
+func RenameBranch(oldName string, newName string, options *BranchOptions) error {
+	current, err := currentBranch()
+	if err != nil {
+		return err
+	}
+	if oldName == "" {
+		if current == "" {
+			return fmt.Errorf("cannot rename the current branch while not on any")
+		}
+		oldName = current
+	}
+
+	if !validRefName(newName) || newName == "HEAD" {
+		return fmt.Errorf("'%s' is not a valid branch name", newName)
+	}
+
+	oid, err := branchOID(oldName)
+	if err != nil {
+		return err
+	}
+	if oid == "" {
+		return fmt.Errorf("no branch named '%s'", oldName)
+	}
+
+	existing, err := branchOID(newName)
+	if err != nil {
+		return err
+	}
+	if existing != "" && oldName != newName && !options.Force {
+		return fmt.Errorf("a branch named '%s' already exists", newName)
+	}
+
+	if oldName == newName {
+		return nil
+	}
+
+	// the reflog follows the branch
+	message := fmt.Sprintf("Branch: renamed %s%s to %s%s", headsPrefix, oldName, headsPrefix, newName)
+	if err := renameReflog(headsPrefix+oldName, headsPrefix+newName); err != nil {
+		return err
+	}
+	if err := deleteRef(headsPrefix + oldName); err != nil {
+		return err
+	}
+	if err := writeRef(headsPrefix+newName, oid, message); err != nil {
+		return err
+	}
+
+	if current == oldName {
+		return writeSymref("HEAD", headsPrefix+newName, message)
+	}
+	return nil
+}
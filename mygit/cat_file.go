@@ -1,7 +1,10 @@
 package mygit
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"strings"
 )
 
 // CatFile simply prints the content of a git object
@@ -9,3 +12,91 @@ func (o *Object) CatFile() {
 	textContent := string(o.Content[:])
 	fmt.Print(textContent)
 }
+
+// PrettyPrint prints the content of a git object according to its type:
+// trees are listed like ls-tree, other objects are printed as is
+func (o *Object) PrettyPrint() error {
+	if o.Type == ObjectTypeTree {
+		return o.PrintTreeContent(&PrintTreeContentOptions{})
+	}
+	o.CatFile()
+	return nil
+}
+
+// ResolveObject returns the object with the given name
+func ResolveObject(name string) (*Object, error) {
+	oid, err := resolveRevision(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewObject(oid)
+}
+
+// ResolveTree returns the tree a revision points to, the tree
+// of a commit or the object a tag points to are accepted
+func ResolveTree(revision string) (*Object, error) {
+	oid, err := resolveRevision(revision)
+	if err != nil {
+		return nil, err
+	}
+	oid, err = peelRevision(oid, string(ObjectTypeTree))
+	if err != nil {
+		return nil, err
+	}
+	return NewObject(oid)
+}
+
+// ObjectExists checks that the name is a valid name of an existing object
+func ObjectExists(name string) bool {
+	oid, err := resolveRevision(name)
+	return err == nil && objectExists(oid)
+}
+
+type CatFileBatchOptions struct {
+	// print the object content after its information
+	Contents bool
+}
+
+// CatFileBatch reads object names from input, one per line, and writes
+// for each of them:
+//
+//	<oid> <type> <size>
+//	<content>
+//
+// The content is only written with the Contents option,
+// "<name> missing" is written for unknown objects and
+// "<name> ambiguous" for ambiguous abbreviated object IDs
+func CatFileBatch(input io.Reader, output io.Writer, options *CatFileBatchOptions) error {
+	writer := bufio.NewWriter(output)
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+
+		var object *Object
+		err := fmt.Errorf("empty object name")
+		if name != "" {
+			object, err = ResolveObject(name)
+		}
+		if isAmbiguous(err) {
+			fmt.Fprintf(writer, "%s ambiguous\n", name)
+		} else if err != nil {
+			fmt.Fprintf(writer, "%s missing\n", name)
+		} else {
+			fmt.Fprintf(writer, "%s %s %d\n", object.Hash, object.Type, object.Size)
+			if options.Contents {
+				writer.Write(object.Content)
+				writer.WriteByte('\n')
+			}
+		}
+
+		// answers are flushed one by one, the caller may wait for
+		// them before sending the next name
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
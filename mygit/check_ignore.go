@@ -0,0 +1,89 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type CheckIgnoreOptions struct {
+	// show the pattern matching each path, negated ones included
+	Verbose bool
+	// with Verbose, show the paths no pattern matches too
+	NonMatching bool
+	// show nothing, only report whether a path is ignored
+	Quiet bool
+	// check tracked files too, which are never ignored otherwise
+	NoIndex bool
+}
+
+// CheckIgnore shows the paths that are ignored, or with Verbose the
+// pattern deciding it as "<source>:<line>:<pattern>\t<path>"
+// Returns whether a path is ignored, or matched by a pattern with Verbose
+func CheckIgnore(paths []string, options *CheckIgnoreOptions) (bool, error) {
+	if len(paths) == 0 {
+		return false, fmt.Errorf("no path specified")
+	}
+	if options.Quiet && options.Verbose {
+		return false, fmt.Errorf("cannot have both --quiet and --verbose")
+	}
+	if options.Quiet && len(paths) > 1 {
+		return false, fmt.Errorf("--quiet is only valid with a single pathname")
+	}
+	if options.NonMatching && !options.Verbose {
+		return false, fmt.Errorf("--non-matching is only valid with --verbose")
+	}
+
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return false, err
+	}
+	tracked := map[string]bool{}
+	if !options.NoIndex {
+		index, err := readIndex()
+		if err != nil {
+			return false, err
+		}
+		for _, entry := range index.entries {
+			tracked[entry.path] = true
+		}
+	}
+
+	found := false
+	for _, argument := range paths {
+		filePath := path.Clean(filepath.ToSlash(argument))
+		if filePath == ".." || strings.HasPrefix(filePath, "../") {
+			return found, fmt.Errorf("%s: '%s' is outside repository", argument, argument)
+		}
+		isDir := strings.HasSuffix(argument, "/")
+		if info, err := os.Lstat(filePath); err == nil && info.IsDir() {
+			isDir = true
+		}
+
+		var pattern *ignorePattern
+		if !tracked[filePath] {
+			pattern, err = rules.find(filePath, isDir)
+			if err != nil {
+				return found, err
+			}
+		}
+		if !options.Verbose && !pattern.excludes() {
+			continue
+		}
+		if pattern != nil {
+			found = true
+		}
+		switch {
+		case options.Quiet:
+		case !options.Verbose:
+			fmt.Println(argument)
+		case pattern != nil:
+			fmt.Printf("%s:%d:%s\t%s\n", pattern.source, pattern.line, pattern.text, argument)
+		case options.NonMatching:
+			fmt.Printf("::\t%s\n", argument)
+		}
+	}
+	return found, nil
+}
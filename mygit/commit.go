@@ -6,13 +6,25 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 )
 
-func createCommitObject(treeSha string, parentCommit string, commitMessage string) (
+// createCommitObject builds a commit object, author being its author
+// identity "<name> <<email>> <seconds> <timezone>", or empty for the author
+// of the environment
+func createCommitObject(treeSha string, parentCommits []string, commitMessage string, author string) (
 	[]byte, string, error) {
+	// the commit records full object IDs, of a tree and commits
+	// even when given a commit or tags
+	treeSha, err := resolveRevision(treeSha)
+	if err != nil {
+		return nil, "", err
+	}
+	treeSha, err = peelRevision(treeSha, string(ObjectTypeTree))
+	if err != nil {
+		return nil, "", err
+	}
 	object, err := NewObject(treeSha)
 	if err != nil {
 		return nil, "", err
@@ -22,10 +34,17 @@ func createCommitObject(treeSha string, parentCommit string, commitMessage strin
 		return nil, "", fmt.Errorf("given object is not a tree")
 	}
 
-	// TODO: check parentCommit object
-	var parentCommitObject *Object = nil
-	if parentCommit != "" {
-		parentCommitObject, err = NewObject(parentCommit)
+	parents := make([]string, 0, len(parentCommits))
+	for _, parentCommit := range parentCommits {
+		parentCommit, err = resolveRevision(parentCommit)
+		if err != nil {
+			return nil, "", err
+		}
+		parentCommit, err = peelRevision(parentCommit, string(ObjectTypeCommit))
+		if err != nil {
+			return nil, "", err
+		}
+		parentCommitObject, err := NewObject(parentCommit)
 		if err != nil {
 			return nil, "", err
 		}
@@ -33,6 +52,7 @@ func createCommitObject(treeSha string, parentCommit string, commitMessage strin
 		if parentCommitObject.Type != ObjectTypeCommit {
 			return nil, "", fmt.Errorf("given parent object is not a commit")
 		}
+		parents = append(parents, parentCommit)
 	}
 
 	// commit-object format: https://stackoverflow.com/questions/22968856/what-is-the-file-format-of-a-git-commit-object-data-structure
@@ -42,22 +62,24 @@ func createCommitObject(treeSha string, parentCommit string, commitMessage strin
 	// tree <tree_sha>
 	commitContent.WriteString(fmt.Sprintf("tree %s\n", treeSha))
 
-	// parent <parent_commit>
-	if parentCommit != "" {
-		commitContent.WriteString(fmt.Sprintf("parent %s\n", parentCommit))
+	// parent <parent_commit>, for each parent
+	for _, parent := range parents {
+		commitContent.WriteString(fmt.Sprintf("parent %s\n", parent))
 	}
 
 	// author
-	authorName := getAuthorName()
-	if authorName == "" {
-		return nil, "", fmt.Errorf("user name not set")
-	}
-	authorEmail := getAuthorEmail()
-	if authorEmail == "" {
-		return nil, "", fmt.Errorf("user email not set")
+	if author == "" {
+		authorName := getAuthorName()
+		if authorName == "" {
+			return nil, "", fmt.Errorf("user name not set")
+		}
+		authorEmail := getAuthorEmail()
+		if authorEmail == "" {
+			return nil, "", fmt.Errorf("user email not set")
+		}
+		author = fmt.Sprintf("%s <%s> %s", authorName, authorEmail, getAuthorDate())
 	}
-	authorText := fmt.Sprintf("author %s <%s> %s\n", authorName, authorEmail, getAuthorDate())
-	commitContent.WriteString(authorText)
+	commitContent.WriteString("author " + author + "\n")
 
 	// committer
 	committerName := getCommitterName()
@@ -90,8 +112,14 @@ func createCommitObject(treeSha string, parentCommit string, commitMessage strin
 	return commitRawBytes, hashString, nil
 }
 
-func CommitTree(treeSha string, parentCommit string, commitMessage string) (string, error) {
-	commitRawBytes, hashString, err := createCommitObject(treeSha, parentCommit, commitMessage)
+func CommitTree(treeSha string, parentCommits []string, commitMessage string) (string, error) {
+	return writeCommit(treeSha, parentCommits, commitMessage, "")
+}
+
+// writeCommit writes a commit object, with the author identity of another
+// commit unless author is empty
+func writeCommit(treeSha string, parentCommits []string, commitMessage string, author string) (string, error) {
+	commitRawBytes, hashString, err := createCommitObject(treeSha, parentCommits, commitMessage, author)
 	if err != nil {
 		return "", err
 	}
@@ -122,6 +150,13 @@ type CommitObject struct {
 	Message string
 }
 
+// author returns the author identity of a commit, as recorded in its
+// author line
+func (commit *CommitObject) author() string {
+	return fmt.Sprintf("%s <%s> %s %s", commit.AuthorName, commit.AuthorEmail,
+		commit.AuthorDateSeconds, commit.AuthorDateTimeZone)
+}
+
 func parseCommitObject(object *Object) (*CommitObject, error) {
 	// commit object format
 	// https://stackoverflow.com/questions/22968856/what-is-the-file-format-of-a-git-commit-object-data-structure
@@ -234,56 +269,131 @@ func parseCommitObject(object *Object) (*CommitObject, error) {
 	}, nil
 }
 
-func setHeadOID(oid string) error {
-	data, err := os.ReadFile(".git/HEAD")
-	if err != nil {
-		return err
-	}
-
-	ref := strings.Split(string(data), " ")[1]
-	ref = strings.TrimSpace(ref)
+// setHeadOID moves the current branch to oid, or HEAD itself
+// when it is detached, provided it still points to oldOID
+// (zeroOID on an unborn branch)
+func setHeadOID(oid string, oldOID string, message string) error {
+	return updateRefs([]refUpdate{{name: "HEAD", newOID: oid, oldOID: oldOID, message: message}})
+}
 
-	refPath := ".git/" + ref
+type CommitOptions struct {
+	// stage the changes of tracked files first, as add -u does
+	All bool
+	// record a commit even when its tree is the tree of HEAD
+	AllowEmpty bool
+	// replace HEAD by a commit with its parents and its author
+	Amend bool
+}
 
-	dir := filepath.Dir(refPath)
+// Commit records the tree of the index in a new commit on top of HEAD
+func Commit(message string, options *CommitOptions) error {
+	if options.All {
+		if err := Add(nil, &AddOptions{Update: true}); err != nil {
+			return err
+		}
+	}
 
-	err = os.MkdirAll(dir, 0755)
+	// get HEAD commit
+	head, err := getHeadOID()
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile(refPath, []byte(oid), 0644)
+	// a merge left to conclude is recorded with the merged commit as
+	// second parent, even without changes from HEAD
+	mergeHead, err := readMergeHead()
 	if err != nil {
 		return err
 	}
-
-	return nil
-}
-
-func Commit(message string) error {
-	// get HEAD commit
-	head, err := getHeadOID()
+	// as does a cherry-pick left to conclude, or a commit a rebase stopped
+	// at, with the author of the picked commit
+	pickHead, revert, err := readPickHead()
 	if err != nil {
 		return err
 	}
-
-	treeEntry, err := RecordTree(".", true)
+	_, err = os.Stat(rebaseDir)
+	rebasing := err == nil
+	author := ""
+	if pickHead != "" && !revert {
+		picked, err := peelToCommit(pickHead)
+		if err != nil {
+			return err
+		}
+		author = picked.author()
+	}
+	if options.Amend && mergeHead != "" {
+		return fmt.Errorf("you are in the middle of a merge -- cannot amend")
+	}
+	if options.Amend && head == "" {
+		return fmt.Errorf("you have nothing to amend")
+	}
+	index, err := readIndex()
 	if err != nil {
 		return err
 	}
+	if len(index.unmerged()) > 0 {
+		return fmt.Errorf("committing is not possible because you have unmerged files")
+	}
 
-	currentTree := treeEntry.Hash
+	currentTree, err := WriteTree()
+	if err != nil {
+		return err
+	}
+	headTree, err := commitTreeOID(head)
+	if err != nil {
+		return err
+	}
+	if mergeHead == "" && !options.AllowEmpty && !options.Amend &&
+		(currentTree == headTree || (head == "" && currentTree == emptyTreeOID)) {
+		return fmt.Errorf("nothing to commit")
+	}
 
-	hashCommit, err := CommitTree(currentTree, head, message)
+	parents := []string{}
+	if head != "" {
+		parents = append(parents, head)
+	}
+	if mergeHead != "" {
+		parents = append(parents, mergeHead)
+	}
+	if options.Amend {
+		headCommit, err := peelToCommit(head)
+		if err != nil {
+			return err
+		}
+		parents, author = headCommit.Parents, headCommit.author()
+	}
+	hashCommit, err := writeCommit(currentTree, parents, message, author)
 	if err != nil {
 		return err
 	}
 
-	// update HEAD
-	err = setHeadOID(hashCommit)
+	// update HEAD, unless another commit moved it meanwhile
+	oldHead := head
+	reflogMessage := "commit: " + message
+	switch {
+	case oldHead == "":
+		oldHead = zeroOID
+		reflogMessage = "commit (initial): " + message
+	case options.Amend:
+		reflogMessage = "commit (amend): " + message
+	case mergeHead != "":
+		reflogMessage = "commit (merge): " + message
+	case pickHead != "" && !revert && rebasing:
+		reflogMessage = "commit (rebase): " + message
+	case pickHead != "" && !revert:
+		reflogMessage = "commit (cherry-pick): " + message
+	}
+	subject, _, _ := strings.Cut(reflogMessage, "\n")
+	err = setHeadOID(hashCommit, oldHead, subject)
 	if err != nil {
 		return err
 	}
+	if err := removeMergeState(); err != nil {
+		return err
+	}
+	if err := removePickState(); err != nil {
+		return err
+	}
 
 	fmt.Printf("[%s] %s\n", hashCommit, message)
 
@@ -1,13 +1,111 @@
 package mygit
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"os/user"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// repository configuration, see git-config
+const configPath = ".git/config"
+
+// readConfig returns the value of a "<section>.[<subsection>.]<key>"
+// variable of the repository configuration, empty when it is not set
+// Section and key names are case insensitive, subsection names are not
+func readConfig(name string) (string, error) {
+	file, err := os.Open(configPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	section, key, found := strings.Cut(name, ".")
+	if !found {
+		return "", fmt.Errorf("invalid config variable name: %s", name)
+	}
+	subsection := ""
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		subsection, key = key[:i], key[i+1:]
+	}
+
+	value := ""
+	current := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		// [section], [section "subsection"]
+		if line[0] == '[' {
+			header, _, _ := strings.Cut(line[1:], "]")
+			sectionName, sub, hasSub := strings.Cut(header, " ")
+			current = strings.ToLower(sectionName)
+			if hasSub {
+				current += "." + strings.Trim(strings.TrimSpace(sub), "\"")
+			}
+			continue
+		}
+
+		variable, rawValue, hasValue := strings.Cut(line, "=")
+		if current != strings.ToLower(section)+prefixed(".", subsection) ||
+			!strings.EqualFold(strings.TrimSpace(variable), key) {
+			continue
+		}
+		// a variable without value is a true boolean
+		if !hasValue {
+			value = "true"
+			continue
+		}
+		value = parseConfigValue(rawValue)
+	}
+	return value, scanner.Err()
+}
+
+// prefixed returns prefix followed by value, empty for an empty value
+func prefixed(prefix string, value string) string {
+	if value == "" {
+		return ""
+	}
+	return prefix + value
+}
+
+// parseConfigValue unquotes a config value and strips its comment
+func parseConfigValue(raw string) string {
+	value := strings.Builder{}
+	quoted := false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			default:
+				value.WriteByte(raw[i])
+			}
+		case (c == '#' || c == ';') && !quoted:
+			return strings.TrimSpace(value.String())
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(value.String())
+}
+
 // https://git-scm.com/book/en/v2/Git-Internals-Environment-Variables
 
 func currentUserName() string {
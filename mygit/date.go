@@ -0,0 +1,64 @@
+package mygit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// approximate durations of the units accepted in relative dates
+var dateUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+	"year":   365 * 24 * time.Hour,
+}
+
+// parseApproxDate parses the dates accepted by options such as
+// --expire or the @{<date>} revision syntax:
+//
+//	now, never, yesterday
+//	<n>.<unit>.ago, <n> <unit>s ago (seconds, minutes, ..., years)
+//	<unix timestamp>
+//	2006-01-02, 2006-01-02 15:04:05, RFC 3339
+func parseApproxDate(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	switch strings.ToLower(value) {
+	case "now", "all":
+		return now, nil
+	case "never":
+		return time.Time{}, nil
+	case "yesterday":
+		return now.Add(-24 * time.Hour), nil
+	}
+
+	fields := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return r == '.' || r == ' '
+	})
+	if len(fields) == 3 && fields[2] == "ago" {
+		count, err := strconv.Atoi(fields[0])
+		if err == nil {
+			unit, ok := dateUnits[strings.TrimSuffix(fields[1], "s")]
+			if ok {
+				return now.Add(-time.Duration(count) * unit), nil
+			}
+		}
+	}
+
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(timestamp, 0), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date '%s'", value)
+}
@@ -0,0 +1,162 @@
+package mygit
+
+import (
+	"bytes"
+)
+
+// Delta encoding, the reverse of applyDelta
+//
+// The base object is indexed by blocks of deltaBlockSize bytes,
+// the target is then scanned for blocks found in the base:
+// matches are extended as far as possible and emitted as copy
+// instructions, everything else becomes insert instructions.
+
+const (
+	deltaBlockSize = 16
+	// maximum number of base positions remembered per block
+	deltaMaxBlockPositions = 64
+	// maximum size of a single copy instruction (3 size bytes)
+	deltaMaxCopySize = 0xffffff
+	// maximum size of a single insert instruction (7 bits)
+	deltaMaxInsertSize = 0x7f
+)
+
+// deltaIndex maps blocks of a base object to their positions
+type deltaIndex struct {
+	base   []byte
+	blocks map[string][]int
+}
+
+// newDeltaIndex indexes the base object blocks, it can be reused
+// to compute the delta of several targets against the same base
+func newDeltaIndex(base []byte) *deltaIndex {
+	blocks := map[string][]int{}
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		key := string(base[i : i+deltaBlockSize])
+		if len(blocks[key]) < deltaMaxBlockPositions {
+			blocks[key] = append(blocks[key], i)
+		}
+	}
+	return &deltaIndex{base: base, blocks: blocks}
+}
+
+// createDelta computes the delta instructions transforming the base into target
+// Returns nil when the delta would be larger than maxSize (0: no limit)
+func (index *deltaIndex) createDelta(target []byte, maxSize int) []byte {
+	base := index.base
+	blocks := index.blocks
+
+	delta := bytes.Buffer{}
+	delta.Write(encodeSize(uint64(len(base))))
+	delta.Write(encodeSize(uint64(len(target))))
+
+	insert := []byte{}
+	flushInsert := func() {
+		for len(insert) > 0 {
+			size := min(len(insert), deltaMaxInsertSize)
+			delta.WriteByte(byte(size))
+			delta.Write(insert[:size])
+			insert = insert[size:]
+		}
+	}
+
+	i := 0
+	for i < len(target) {
+		if maxSize > 0 && delta.Len()+len(insert) > maxSize {
+			return nil
+		}
+
+		bestOffset, bestSize := 0, 0
+		if i+deltaBlockSize <= len(target) {
+			for _, position := range blocks[string(target[i:i+deltaBlockSize])] {
+				size := deltaBlockSize
+				for position+size < len(base) && i+size < len(target) &&
+					base[position+size] == target[i+size] {
+					size++
+				}
+				if size > bestSize {
+					bestOffset, bestSize = position, size
+				}
+			}
+		}
+
+		if bestSize == 0 {
+			insert = append(insert, target[i])
+			i++
+			continue
+		}
+
+		// extend the match backwards over pending inserted bytes
+		i += bestSize
+		for len(insert) > 0 && bestOffset > 0 &&
+			base[bestOffset-1] == insert[len(insert)-1] {
+			insert = insert[:len(insert)-1]
+			bestOffset--
+			bestSize++
+		}
+
+		flushInsert()
+		for bestSize > 0 {
+			size := min(bestSize, deltaMaxCopySize)
+			writeCopyInstruction(&delta, bestOffset, size)
+			bestOffset += size
+			bestSize -= size
+		}
+	}
+	flushInsert()
+
+	if maxSize > 0 && delta.Len() > maxSize {
+		return nil
+	}
+	return delta.Bytes()
+}
+
+// writeCopyInstruction encodes a copy instruction, only the non zero
+// bytes of the offset and size are written
+//
+//	+----------+---------+---------+---------+---------+-------+-------+-------+
+//	| 1xxxxxxx | offset1 | offset2 | offset3 | offset4 | size1 | size2 | size3 |
+//	+----------+---------+---------+---------+---------+-------+-------+-------+
+func writeCopyInstruction(delta *bytes.Buffer, offset int, size int) {
+	opCode := byte(0x80)
+	args := []byte{}
+
+	for bit := 0; bit < 4; bit++ {
+		b := byte(offset >> (bit * 8))
+		if b != 0 {
+			opCode |= 1 << bit
+			args = append(args, b)
+		}
+	}
+
+	// a size of 0x10000 is encoded as 0
+	if size != 0x10000 {
+		for bit := 0; bit < 3; bit++ {
+			b := byte(size >> (bit * 8))
+			if b != 0 {
+				opCode |= 1 << (4 + bit)
+				args = append(args, b)
+			}
+		}
+	}
+
+	delta.WriteByte(opCode)
+	delta.Write(args)
+}
+
+// encodeSize encodes a variable length integer, the reverse of parseSize
+//
+// [MSB 1 bit][SIZE 7 bit]
+// [MSB 1 bit][SIZE 7 bit]
+// ...
+func encodeSize(size uint64) []byte {
+	encoded := []byte{}
+	for {
+		b := byte(size & 0x7f)
+		size >>= 7
+		if size == 0 {
+			return append(encoded, b)
+		}
+		encoded = append(encoded, b|0x80)
+	}
+}
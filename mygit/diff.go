@@ -0,0 +1,524 @@
+package mygit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// default number of context lines around changes
+const DefaultDiffContext = 3
+
+type DiffOptions struct {
+	// compare a commit, HEAD by default, with the index instead of the
+	// index with the working tree
+	Cached bool
+	// number of context lines around changes
+	Context int
+	// myers, minimal, patience or histogram
+	Algorithm string
+	// show the number of changed lines of each file instead of a patch
+	Stat bool
+	// show the names of the changed files only
+	NameOnly bool
+	// show the names and the status letters of the changed files
+	NameStatus bool
+	// detection of renamed and copied files
+	Renames RenameOptions
+}
+
+// diffFile is a side of a changed file, a mode of 0 meaning it does not
+// exist on this side
+type diffFile struct {
+	path string
+	mode uint32
+	oid  string
+	// read from the working tree rather than the object database
+	worktree bool
+}
+
+// exists checks whether the file exists on its side
+func (file *diffFile) exists() bool {
+	return file.mode != 0
+}
+
+// content returns the content of the file: the target of a symbolic link,
+// and for a submodule the commit it points to
+func (file *diffFile) content() ([]byte, error) {
+	switch {
+	case !file.exists():
+		return nil, nil
+	case file.mode == 0160000:
+		return []byte("Subproject commit " + file.oid + "\n"), nil
+	case file.worktree && file.mode == 0120000:
+		target, err := os.Readlink(file.path)
+		return []byte(target), err
+	case file.worktree:
+		return os.ReadFile(file.path)
+	}
+	object, err := NewObject(file.oid)
+	if err != nil {
+		return nil, err
+	}
+	return object.Content, nil
+}
+
+// diffPair is a file that differs between the two sides of a diff, or a
+// file renamed or copied to another path
+type diffPair struct {
+	old, new diffFile
+	// similarity of a renamed or copied file, out of MaxSimilarity
+	score int
+	// copied rather than renamed
+	copied bool
+}
+
+// renamed checks whether the pair is a renamed or copied file
+func (pair *diffPair) renamed() bool {
+	return pair.old.exists() && pair.new.exists() && pair.old.path != pair.new.path
+}
+
+// status returns the letter of the change: A for added, D for deleted,
+// R for renamed, C for copied, T for a type change, M for a modification
+// of content or mode
+func (pair *diffPair) status() byte {
+	switch {
+	case pair.renamed() && pair.copied:
+		return 'C'
+	case pair.renamed():
+		return 'R'
+	case !pair.old.exists():
+		return 'A'
+	case !pair.new.exists():
+		return 'D'
+	case pair.old.mode&0170000 != pair.new.mode&0170000:
+		return 'T'
+	}
+	return 'M'
+}
+
+// statusScore returns the status letter of the pair, followed by the
+// similarity percentage of a renamed or copied file, as in "R086"
+func (pair *diffPair) statusScore() string {
+	if pair.renamed() {
+		return fmt.Sprintf("%c%03d", pair.status(), similarityPercent(pair.score))
+	}
+	return string(pair.status())
+}
+
+// Diff shows the changes between the index and the working tree, a commit
+// and the index with Cached, a commit and the working tree, or two commits
+// Arguments are the commits, "<commit>..<commit>" for two, then pathspecs
+// limiting the files compared
+func Diff(arguments []string, pathspecs []string, options *DiffOptions) error {
+	revisions := []string{}
+	for i, argument := range arguments {
+		if _, err := resolveDiffRevision(argument); err != nil {
+			pathspecs = append(arguments[i:len(arguments):len(arguments)], pathspecs...)
+			break
+		}
+		revisions = append(revisions, argument)
+	}
+	if len(revisions) == 1 {
+		if from, to, found := strings.Cut(revisions[0], ".."); found {
+			revisions = []string{defaultRevision(from), defaultRevision(to)}
+		}
+	}
+
+	specs := parsePathspecs(pathspecs)
+	var pairs []diffPair
+	var old, new map[string]diffFile
+	var err error
+	switch {
+	case len(revisions) > 2 || len(revisions) == 2 && options.Cached:
+		return fmt.Errorf("too many revisions")
+	case len(revisions) == 2:
+		pairs, err = treeDiffPairs(revisions[0], revisions[1], specs)
+	case options.Cached:
+		var index *stagingIndex
+		if index, err = readIndex(); err != nil {
+			return err
+		}
+		if len(revisions) == 1 {
+			old, err = revisionDiffFiles(revisions[0])
+		} else {
+			old, err = headDiffFiles()
+		}
+		if err != nil {
+			return err
+		}
+		new = indexDiffFiles(index)
+	default:
+		var index *stagingIndex
+		if index, err = readIndex(); err != nil {
+			return err
+		}
+		if len(revisions) == 1 {
+			old, err = revisionDiffFiles(revisions[0])
+		} else {
+			old = indexDiffFiles(index)
+		}
+		if err != nil {
+			return err
+		}
+		new, err = worktreeDiffFiles(index)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(revisions) != 2 {
+		pairs = diffFiles(old, new, specs)
+	}
+	if pairs, err = detectRenames(pairs, &options.Renames); err != nil {
+		return err
+	}
+	out := bufio.NewWriter(os.Stdout)
+	if err := writeDiff(out, pairs, options); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// defaultRevision returns HEAD for the empty side of "<commit>..<commit>"
+func defaultRevision(revision string) string {
+	if revision == "" {
+		return "HEAD"
+	}
+	return revision
+}
+
+// resolveDiffRevision resolves a commit argument of diff, or both ends of
+// "<commit>..<commit>"
+func resolveDiffRevision(argument string) (string, error) {
+	if from, to, found := strings.Cut(argument, ".."); found {
+		if _, err := resolveRevision(defaultRevision(from)); err != nil {
+			return "", err
+		}
+		return resolveRevision(defaultRevision(to))
+	}
+	return resolveRevision(argument)
+}
+
+// revisionDiffFiles returns the files of the tree of a commit
+func revisionDiffFiles(revision string) (map[string]diffFile, error) {
+	oid, err := resolveRevision(revision)
+	if err != nil {
+		return nil, err
+	}
+	treeOID, err := peelRevision(oid, "tree")
+	if err != nil {
+		return nil, err
+	}
+	return treeDiffFiles(treeOID)
+}
+
+// treeDiffPairs compares the trees of two commits, walking them together
+func treeDiffPairs(oldRevision string, newRevision string, specs []*pathspec) ([]diffPair, error) {
+	trees := make([]string, 2)
+	for i, revision := range []string{oldRevision, newRevision} {
+		oid, err := resolveRevision(revision)
+		if err != nil {
+			return nil, err
+		}
+		if trees[i], err = peelRevision(oid, "tree"); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := CompareTrees(trees[0], trees[1], &CompareTreesOptions{Recursive: true})
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]bool, len(specs))
+	pairs := []diffPair{}
+	for _, change := range changes {
+		if !matchPathspecs(specs, change.Path, matched) {
+			continue
+		}
+		pairs = append(pairs, treeChangePair(change))
+	}
+	return pairs, nil
+}
+
+// headDiffFiles returns the files of the HEAD commit, none on an unborn
+// branch
+func headDiffFiles() (map[string]diffFile, error) {
+	_, head, err := readHead()
+	if err != nil {
+		return nil, err
+	}
+	treeOID, err := commitTreeOID(head)
+	if err != nil {
+		return nil, err
+	}
+	return treeDiffFiles(treeOID)
+}
+
+// treeDiffFiles returns the files of a tree
+func treeDiffFiles(treeOID string) (map[string]diffFile, error) {
+	entries, err := treeFiles(treeOID)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]diffFile, len(entries))
+	for filePath, entry := range entries {
+		mode, err := strconv.ParseUint(entry.Mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mode %s of %s", entry.Mode, filePath)
+		}
+		files[filePath] = diffFile{path: filePath, mode: uint32(mode), oid: entry.Hash}
+	}
+	return files, nil
+}
+
+// indexDiffFiles returns the merged files of the index, leaving out the
+// files only intended to be added
+func indexDiffFiles(index *stagingIndex) map[string]diffFile {
+	files := make(map[string]diffFile, len(index.entries))
+	for _, entry := range index.entries {
+		if entry.stage() != 0 || entry.extendedFlags&indexFlagIntentToAdd != 0 {
+			continue
+		}
+		files[entry.path] = diffFile{path: entry.path, mode: entry.mode, oid: entry.oid}
+	}
+	return files
+}
+
+// worktreeDiffFiles returns the working tree files tracked by the index,
+// hashing the ones whose stat data differs from the index
+func worktreeDiffFiles(index *stagingIndex) (map[string]diffFile, error) {
+	files := make(map[string]diffFile, len(index.entries))
+	for _, entry := range index.entries {
+		if entry.stage() != 0 {
+			continue
+		}
+		info, err := os.Lstat(entry.path)
+		if os.IsNotExist(err) || err == nil && info.IsDir() && entry.mode != 0160000 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		file := diffFile{path: entry.path, mode: entry.mode, oid: entry.oid}
+		// submodules are compared by the commit recorded in the index
+		if entry.mode == 0160000 {
+			files[entry.path] = file
+			continue
+		}
+		file.mode = workingFileMode(info)
+		intentToAdd := entry.extendedFlags&indexFlagIntentToAdd != 0
+		if intentToAdd || !index.upToDate(entry, info) {
+			if file.oid, err = hashWorkingFile(entry.path, info, false); err != nil {
+				return nil, err
+			}
+		}
+		file.worktree = true
+		files[entry.path] = file
+	}
+	return files, nil
+}
+
+// diffFiles returns the files that differ between two sides, sorted by
+// path and selected by pathspecs
+func diffFiles(old map[string]diffFile, new map[string]diffFile, specs []*pathspec) []diffPair {
+	paths := []string{}
+	for filePath := range old {
+		paths = append(paths, filePath)
+	}
+	for filePath := range new {
+		if _, found := old[filePath]; !found {
+			paths = append(paths, filePath)
+		}
+	}
+	sort.Strings(paths)
+
+	matched := make([]bool, len(specs))
+	pairs := []diffPair{}
+	for _, filePath := range paths {
+		if !matchPathspecs(specs, filePath, matched) {
+			continue
+		}
+		pair := diffPair{old: old[filePath], new: new[filePath]}
+		if pair.old.mode == pair.new.mode && pair.old.oid == pair.new.oid {
+			continue
+		}
+		pair.old.path, pair.new.path = filePath, filePath
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+// writeDiff writes the changed files in the format of the options
+func writeDiff(out *bufio.Writer, pairs []diffPair, options *DiffOptions) error {
+	switch {
+	case options.NameOnly:
+		for _, pair := range pairs {
+			fmt.Fprintf(out, "%s\n", quotePath(pair.new.path, false))
+		}
+	case options.NameStatus:
+		for _, pair := range pairs {
+			if pair.renamed() {
+				fmt.Fprintf(out, "%s\t%s\t", pair.statusScore(), quotePath(pair.old.path, false))
+			} else {
+				fmt.Fprintf(out, "%s\t", pair.statusScore())
+			}
+			fmt.Fprintf(out, "%s\n", quotePath(pair.new.path, false))
+		}
+	case options.Stat:
+		stats := make([]diffStat, 0, len(pairs))
+		for _, pair := range pairs {
+			stat, err := pair.stat(options)
+			if err != nil {
+				return err
+			}
+			stats = append(stats, stat)
+		}
+		if len(stats) != 0 {
+			writeDiffStat(out, stats)
+		}
+	default:
+		for _, pair := range pairs {
+			// a change of type is shown as a deletion then a creation
+			if pair.status() == 'T' {
+				deletion := diffPair{old: pair.old, new: diffFile{path: pair.new.path}}
+				creation := diffPair{old: diffFile{path: pair.old.path}, new: pair.new}
+				if err := deletion.writePatch(out, options); err != nil {
+					return err
+				}
+				if err := creation.writePatch(out, options); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := pair.writePatch(out, options); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// contents returns the contents of both sides
+func (pair *diffPair) contents() ([]byte, []byte, error) {
+	content1, err := pair.old.content()
+	if err != nil {
+		return nil, nil, err
+	}
+	content2, err := pair.new.content()
+	if err != nil {
+		return nil, nil, err
+	}
+	return content1, content2, nil
+}
+
+// lineChanges compares the lines of both sides, the common end of the
+// files being left out without context lines
+func lineChanges(content1 []byte, content2 []byte, options *DiffOptions) ([]string, []string, []diffChange, error) {
+	if options.Context == 0 {
+		content1, content2 = trimCommonTail(content1, content2)
+	}
+	lines1, lines2 := splitLines(content1), splitLines(content2)
+	script, err := diffLines(lines1, lines2, options.Algorithm, true)
+	return lines1, lines2, script, err
+}
+
+// stat counts the added and deleted lines, or bytes for binary files
+func (pair *diffPair) stat(options *DiffOptions) (diffStat, error) {
+	stat := diffStat{name: quotePath(pair.new.path, false)}
+	if pair.renamed() {
+		stat.name = renamedName(pair.old.path, pair.new.path)
+	}
+	content1, content2, err := pair.contents()
+	if err != nil {
+		return stat, err
+	}
+	if isBinary(content1) || isBinary(content2) {
+		stat.binary = true
+		stat.deleted, stat.added = len(content1), len(content2)
+		return stat, nil
+	}
+	if pair.old.oid == pair.new.oid && pair.status() != 'T' {
+		return stat, nil
+	}
+	_, _, script, err := lineChanges(content1, content2, &DiffOptions{Algorithm: options.Algorithm})
+	if err != nil {
+		return stat, err
+	}
+	for _, change := range script {
+		stat.deleted += change.chg1
+		stat.added += change.chg2
+	}
+	return stat, nil
+}
+
+// writePatch writes the "diff --git" header of a file and its changes in
+// the unified format
+func (pair *diffPair) writePatch(out *bufio.Writer, options *DiffOptions) error {
+	name1 := quotePath("a/"+pair.old.path, false)
+	name2 := quotePath("b/"+pair.new.path, false)
+	fmt.Fprintf(out, "diff --git %s %s\n", name1, name2)
+	switch {
+	case !pair.old.exists():
+		fmt.Fprintf(out, "new file mode %06o\n", pair.new.mode)
+		name1 = "/dev/null"
+	case !pair.new.exists():
+		fmt.Fprintf(out, "deleted file mode %06o\n", pair.old.mode)
+		name2 = "/dev/null"
+	case pair.old.mode != pair.new.mode:
+		fmt.Fprintf(out, "old mode %06o\nnew mode %06o\n", pair.old.mode, pair.new.mode)
+	}
+	if pair.renamed() {
+		kind := "rename"
+		if pair.copied {
+			kind = "copy"
+		}
+		fmt.Fprintf(out, "similarity index %d%%\n%s from %s\n%s to %s\n", similarityPercent(pair.score),
+			kind, quotePath(pair.old.path, false), kind, quotePath(pair.new.path, false))
+	}
+
+	oid1, oid2 := pair.old.oid, pair.new.oid
+	if oid1 == "" {
+		oid1 = zeroOID
+	}
+	if oid2 == "" {
+		oid2 = zeroOID
+	}
+	if oid1 == oid2 {
+		return nil
+	}
+	fmt.Fprintf(out, "index %s..%s", shortestUniqueAbbrev(oid1, DefaultAbbrev),
+		shortestUniqueAbbrev(oid2, DefaultAbbrev))
+	if pair.old.mode == pair.new.mode {
+		fmt.Fprintf(out, " %06o", pair.new.mode)
+	}
+	out.WriteString("\n")
+
+	content1, content2, err := pair.contents()
+	if err != nil {
+		return err
+	}
+	if isBinary(content1) || isBinary(content2) {
+		fmt.Fprintf(out, "Binary files %s and %s differ\n", name1, name2)
+		return nil
+	}
+	lines1, lines2, script, err := lineChanges(content1, content2, options)
+	if err != nil || len(script) == 0 {
+		return err
+	}
+
+	// names with spaces are followed by a tab for patch to read them
+	if pair.old.exists() && strings.Contains(pair.old.path, " ") {
+		name1 += "\t"
+	}
+	if pair.new.exists() && strings.Contains(pair.new.path, " ") {
+		name2 += "\t"
+	}
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", name1, name2)
+	writeHunks(out, lines1, lines2, script, options.Context)
+	return nil
+}
@@ -0,0 +1,162 @@
+package mygit
+
+// Histogram diff: a variant of patience diff matching the longest run of
+// common lines whose lines are the least frequent in the first file, then
+// diffing the ranges before and after it the same way
+//
+// Lines are counted from 1.
+
+// lines found more often than this in the first file make Myers'
+// algorithm take over
+const histogramMaxChainLength = 64
+
+// histogramRecord is a distinct line of the first file: its first
+// occurrence and its number of occurrences
+type histogramRecord struct {
+	ptr, cnt int
+}
+
+// histogramRegion is a run of common lines, begin1 and begin2 being 0
+// when none was found
+type histogramRegion struct {
+	begin1, end1 int
+	begin2, end2 int
+}
+
+type histogram struct {
+	ha1, ha2           []int
+	changes1, changes2 changeMap
+}
+
+// histogramDiff marks the changed lines with the histogram algorithm
+func histogramDiff(ha1 []int, ha2 []int) (changeMap, changeMap) {
+	h := &histogram{
+		ha1:      ha1,
+		ha2:      ha2,
+		changes1: make(changeMap, len(ha1)),
+		changes2: make(changeMap, len(ha2)),
+	}
+	h.diff(1, len(ha1), 1, len(ha2))
+	return h.changes1, h.changes2
+}
+
+func (h *histogram) diff(line1 int, count1 int, line2 int, count2 int) {
+	for {
+		if count1 <= 0 && count2 <= 0 {
+			return
+		}
+		if count1 == 0 {
+			for i := 0; i < count2; i++ {
+				h.changes2[line2-1+i] = true
+			}
+			return
+		}
+		if count2 == 0 {
+			for i := 0; i < count1; i++ {
+				h.changes1[line1-1+i] = true
+			}
+			return
+		}
+
+		lcs, fallBack := h.findLCS(line1, count1, line2, count2)
+		if fallBack {
+			fallBackDiff(h.ha1, h.ha2, h.changes1, h.changes2, line1, count1, line2, count2)
+			return
+		}
+		if lcs.begin1 == 0 && lcs.begin2 == 0 {
+			for i := 0; i < count1; i++ {
+				h.changes1[line1-1+i] = true
+			}
+			for i := 0; i < count2; i++ {
+				h.changes2[line2-1+i] = true
+			}
+			return
+		}
+
+		h.diff(line1, lcs.begin1-line1, line2, lcs.begin2-line2)
+		count1 = line1 + count1 - 1 - lcs.end1
+		line1 = lcs.end1 + 1
+		count2 = line2 + count2 - 1 - lcs.end2
+		line2 = lcs.end2 + 1
+	}
+}
+
+// findLCS finds the longest run of common lines with the least frequent
+// lines, or reports that all common lines are too frequent
+func (h *histogram) findLCS(line1 int, count1 int, line2 int, count2 int) (histogramRegion, bool) {
+	end1, end2 := line1+count1-1, line2+count2-1
+
+	// occurrences of each line of the first file, chained in order
+	records := map[int]*histogramRecord{}
+	lineRecords := make([]*histogramRecord, count1)
+	nextPtrs := make([]int, count1)
+	for ptr := end1; ptr >= line1; ptr-- {
+		record := records[h.ha1[ptr-1]]
+		if record != nil {
+			nextPtrs[ptr-line1] = record.ptr
+			record.ptr = ptr
+			record.cnt++
+		} else {
+			record = &histogramRecord{ptr: ptr, cnt: 1}
+			records[h.ha1[ptr-1]] = record
+		}
+		lineRecords[ptr-line1] = record
+	}
+
+	lcs := histogramRegion{}
+	lowest := histogramMaxChainLength + 1
+	hasCommon := false
+	for bPtr := line2; bPtr <= end2; {
+		bNext := bPtr + 1
+		record := records[h.ha2[bPtr-1]]
+		if record == nil {
+			bPtr = bNext
+			continue
+		}
+		hasCommon = true
+		if record.cnt > lowest {
+			bPtr = bNext
+			continue
+		}
+
+		for as := record.ptr; ; {
+			np := nextPtrs[as-line1]
+			bs, ae, be := bPtr, as, bPtr
+			rc := record.cnt
+
+			for line1 < as && line2 < bs && h.ha1[as-2] == h.ha2[bs-2] {
+				as--
+				bs--
+				if rc > 1 {
+					rc = min(rc, lineRecords[as-line1].cnt)
+				}
+			}
+			for ae < end1 && be < end2 && h.ha1[ae] == h.ha2[be] {
+				ae++
+				be++
+				if rc > 1 {
+					rc = min(rc, lineRecords[ae-line1].cnt)
+				}
+			}
+
+			if bNext <= be {
+				bNext = be + 1
+			}
+			if lcs.end1-lcs.begin1 < ae-as || rc < lowest {
+				lcs = histogramRegion{begin1: as, end1: ae, begin2: bs, end2: be}
+				lowest = rc
+			}
+
+			// next occurrence after the run
+			for np != 0 && np <= ae {
+				np = nextPtrs[np-line1]
+			}
+			if np == 0 {
+				break
+			}
+			as = np
+		}
+		bPtr = bNext
+	}
+	return lcs, hasCommon && lowest > histogramMaxChainLength
+}
@@ -0,0 +1,785 @@
+package mygit
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Line diff, following git's xdiff so that hunks come out the same
+//
+// Lines are classified first: equal lines get the same class number and
+// are compared by it. The algorithm marks the changed lines of both files,
+// the groups of changed lines are then slid to the place git puts them,
+// and the edit script is read from the marks.
+
+// line diff algorithms, see --diff-algorithm
+const (
+	DiffMyers     = "myers"
+	DiffMinimal   = "minimal"
+	DiffPatience  = "patience"
+	DiffHistogram = "histogram"
+)
+
+const (
+	// the Myers search stops looking for the optimal path past this cost
+	// (at least, it grows with the square root of the file sizes)
+	diffMaxCostMin = 256
+	// cost over which a diagonal with a long enough snake is taken
+	diffHeuristicMinCost = 256
+	// length of a snake good enough for the heuristic
+	diffSnakeCount      = 20
+	diffHeuristicFactor = 4
+	// lines matching more than this many lines are discarded around
+	// lines without a match, a run of them being searched this far
+	diffMaxEqualLimit   = 1024
+	diffSimilarScanSize = 100
+	diffKeepRunRatio    = 4
+	// indent heuristic: how far a group is slid looking for a better place
+	diffMaxSliding = 100
+)
+
+// changeMap marks the changed lines of a file, lines out of the file
+// being unchanged
+type changeMap []bool
+
+func (changes changeMap) at(i int) bool {
+	return i >= 0 && i < len(changes) && changes[i]
+}
+
+// diffChange is a group of changed lines: chg1 lines of the first file
+// from line i1 replaced by chg2 lines of the second file from line i2,
+// lines being counted from 0
+type diffChange struct {
+	i1, i2     int
+	chg1, chg2 int
+}
+
+// splitLines splits content in lines, each with its newline, the last one
+// missing it when the content does not end with a newline
+func splitLines(content []byte) []string {
+	lines := []string{}
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n')
+		if end < 0 {
+			end = len(content) - 1
+		}
+		lines = append(lines, string(content[:end+1]))
+		content = content[end+1:]
+	}
+	return lines
+}
+
+// classifyLines numbers the distinct lines of both files
+func classifyLines(lines1 []string, lines2 []string) ([]int, []int) {
+	classes := map[string]int{}
+	classify := func(lines []string) []int {
+		ha := make([]int, len(lines))
+		for i, line := range lines {
+			class, found := classes[line]
+			if !found {
+				class = len(classes)
+				classes[line] = class
+			}
+			ha[i] = class
+		}
+		return ha
+	}
+	return classify(lines1), classify(lines2)
+}
+
+// diffLines compares two files split in lines and returns the groups of
+// changed lines, placed by the indent heuristic if asked for
+func diffLines(lines1 []string, lines2 []string, algorithm string, indentHeuristic bool) ([]diffChange, error) {
+	ha1, ha2 := classifyLines(lines1, lines2)
+
+	var changes1, changes2 changeMap
+	switch algorithm {
+	case DiffMyers, "default", "":
+		changes1, changes2 = myersDiff(ha1, ha2, false)
+	case DiffMinimal:
+		changes1, changes2 = myersDiff(ha1, ha2, true)
+	case DiffPatience:
+		changes1, changes2 = patienceDiff(ha1, ha2)
+	case DiffHistogram:
+		changes1, changes2 = histogramDiff(ha1, ha2)
+	default:
+		return nil, fmt.Errorf("unknown diff algorithm: %s", algorithm)
+	}
+
+	compactChanges(changes1, ha1, lines1, changes2, indentHeuristic)
+	compactChanges(changes2, ha2, lines2, changes1, indentHeuristic)
+	return buildScript(changes1, changes2), nil
+}
+
+// myersFile is a file as seen by the Myers search: the lines that may
+// match a line of the other file, and their line numbers
+type myersFile struct {
+	ha      []int
+	rindex  []int
+	changes changeMap
+}
+
+// myersDiff marks the changed lines with Myers' algorithm, finding the
+// middle snake of the shortest edit script and recursing on both sides
+// of it, with the cutoffs of xdiff unless minimal is set
+func myersDiff(ha1 []int, ha2 []int, minimal bool) (changeMap, changeMap) {
+	changes1 := make(changeMap, len(ha1))
+	changes2 := make(changeMap, len(ha2))
+
+	// the common head and tail are left out
+	start := 0
+	for start < len(ha1) && start < len(ha2) && ha1[start] == ha2[start] {
+		start++
+	}
+	end1, end2 := len(ha1)-1, len(ha2)-1
+	for end1 >= start && end2 >= start && ha1[end1] == ha2[end2] {
+		end1--
+		end2--
+	}
+
+	file1, file2 := cleanupLines(ha1, ha2, changes1, changes2, start, end1, end2)
+
+	ndiags := len(file1.ha) + len(file2.ha) + 3
+	search := &myersSearch{
+		kvdf:    make([]int, ndiags),
+		kvdb:    make([]int, ndiags),
+		offset:  len(file2.ha) + 1,
+		maxCost: max(bogoSqrt(ndiags), diffMaxCostMin),
+	}
+	search.compare(file1, 0, len(file1.ha), file2, 0, len(file2.ha), minimal)
+	return changes1, changes2
+}
+
+// bogoSqrt is xdiff's approximation of a square root
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+// cleanupLines marks the lines without any match in the other file as
+// changed, as well as the lines with many matches that sit among them,
+// and returns the lines left for the search
+func cleanupLines(ha1 []int, ha2 []int, changes1 changeMap, changes2 changeMap,
+	start int, end1 int, end2 int) (*myersFile, *myersFile) {
+	count1 := map[int]int{}
+	for _, class := range ha1 {
+		count1[class]++
+	}
+	count2 := map[int]int{}
+	for _, class := range ha2 {
+		count2[class]++
+	}
+
+	// 0: no match, 1: some matches, 2: too many matches
+	discards := func(ha []int, end int, other map[int]int) []byte {
+		limit := min(bogoSqrt(len(ha)), diffMaxEqualLimit)
+		dis := make([]byte, len(ha))
+		for i := start; i <= end; i++ {
+			switch matches := other[ha[i]]; {
+			case matches == 0:
+				dis[i] = 0
+			case matches >= limit:
+				dis[i] = 2
+			default:
+				dis[i] = 1
+			}
+		}
+		return dis
+	}
+	keep := func(ha []int, end int, dis []byte, changes changeMap) *myersFile {
+		file := &myersFile{changes: changes}
+		for i := start; i <= end; i++ {
+			if dis[i] == 1 || (dis[i] == 2 && !cleanMultiMatch(dis, i, start, end)) {
+				file.rindex = append(file.rindex, i)
+				file.ha = append(file.ha, ha[i])
+			} else {
+				changes[i] = true
+			}
+		}
+		return file
+	}
+
+	dis1 := discards(ha1, end1, count2)
+	dis2 := discards(ha2, end2, count1)
+	return keep(ha1, end1, dis1, changes1), keep(ha2, end2, dis2, changes2)
+}
+
+// cleanMultiMatch checks whether a line with many matches is surrounded
+// by enough lines without match to be discarded
+func cleanMultiMatch(dis []byte, i int, start int, end int) bool {
+	start = max(start, i-diffSimilarScanSize)
+	end = min(end, i+diffSimilarScanSize)
+
+	noMatchBefore, multiBefore := 0, 1
+	for r := 1; i-r >= start; r++ {
+		if dis[i-r] == 0 {
+			noMatchBefore++
+		} else if dis[i-r] == 2 {
+			multiBefore++
+		} else {
+			break
+		}
+	}
+	// only discard lines in the middle of lines without match
+	if noMatchBefore == 0 {
+		return false
+	}
+	noMatchAfter, multiAfter := 0, 1
+	for r := 1; i+r <= end; r++ {
+		if dis[i+r] == 0 {
+			noMatchAfter++
+		} else if dis[i+r] == 2 {
+			multiAfter++
+		} else {
+			break
+		}
+	}
+	if noMatchAfter == 0 {
+		return false
+	}
+	noMatch := noMatchBefore + noMatchAfter
+	multi := multiBefore + multiAfter
+	return multi*diffKeepRunRatio < multi+noMatch
+}
+
+// myersSearch holds the furthest reaching paths of the forward and
+// backward searches, by diagonal
+type myersSearch struct {
+	kvdf, kvdb []int
+	// index of diagonal 0 in kvdf and kvdb
+	offset  int
+	maxCost int
+}
+
+// myersSplit is where a box is divided, and whether each half needs the
+// optimal path
+type myersSplit struct {
+	i1, i2       int
+	minLo, minHi bool
+}
+
+// compare marks the changes of the box [off1, lim1) x [off2, lim2)
+func (search *myersSearch) compare(file1 *myersFile, off1 int, lim1 int,
+	file2 *myersFile, off2 int, lim2 int, needMinimal bool) {
+	ha1, ha2 := file1.ha, file2.ha
+	for off1 < lim1 && off2 < lim2 && ha1[off1] == ha2[off2] {
+		off1++
+		off2++
+	}
+	for off1 < lim1 && off2 < lim2 && ha1[lim1-1] == ha2[lim2-1] {
+		lim1--
+		lim2--
+	}
+
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			file2.changes[file2.rindex[off2]] = true
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			file1.changes[file1.rindex[off1]] = true
+		}
+	default:
+		split := search.split(ha1, off1, lim1, ha2, off2, lim2, needMinimal)
+		search.compare(file1, off1, split.i1, file2, off2, split.i2, split.minLo)
+		search.compare(file1, split.i1, lim1, file2, split.i2, lim2, split.minHi)
+	}
+}
+
+// split finds where the forward and backward searches meet, or a good
+// enough place when the edit cost gets too high
+func (search *myersSearch) split(ha1 []int, off1 int, lim1 int,
+	ha2 []int, off2 int, lim2 int, needMinimal bool) myersSplit {
+	const lineMax = int(^uint(0) >> 1)
+	kvdf := func(d int) *int { return &search.kvdf[d+search.offset] }
+	kvdb := func(d int) *int { return &search.kvdb[d+search.offset] }
+
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	*kvdf(fmid) = off1
+	*kvdb(bmid) = lim1
+
+	for ec := 1; ; ec++ {
+		gotSnake := false
+
+		// forward search, extending the range of diagonals by one
+		if fmin > dmin {
+			fmin--
+			*kvdf(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			*kvdf(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if *kvdf(d - 1) >= *kvdf(d + 1) {
+				i1 = *kvdf(d - 1) + 1
+			} else {
+				i1 = *kvdf(d + 1)
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 < lim1 && i2 < lim2 && ha1[i1] == ha2[i2] {
+				i1++
+				i2++
+			}
+			if i1-prev1 > diffSnakeCount {
+				gotSnake = true
+			}
+			*kvdf(d) = i1
+			if odd && bmin <= d && d <= bmax && *kvdb(d) <= i1 {
+				return myersSplit{i1: i1, i2: i2, minLo: true, minHi: true}
+			}
+		}
+
+		// backward search
+		if bmin > dmin {
+			bmin--
+			*kvdb(bmin - 1) = lineMax
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			*kvdb(bmax + 1) = lineMax
+		} else {
+			bmax--
+		}
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if *kvdb(d - 1) < *kvdb(d + 1) {
+				i1 = *kvdb(d - 1)
+			} else {
+				i1 = *kvdb(d + 1) - 1
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 > off1 && i2 > off2 && ha1[i1-1] == ha2[i2-1] {
+				i1--
+				i2--
+			}
+			if prev1-i1 > diffSnakeCount {
+				gotSnake = true
+			}
+			*kvdb(d) = i1
+			if !odd && fmin <= d && d <= fmax && i1 <= *kvdf(d) {
+				return myersSplit{i1: i1, i2: i2, minLo: true, minHi: true}
+			}
+		}
+
+		if needMinimal {
+			continue
+		}
+
+		// past some cost, a diagonal far enough from the corner ending
+		// with a long snake is taken
+		if gotSnake && ec > diffHeuristicMinCost {
+			best := 0
+			split := myersSplit{minLo: true}
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := d - fmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdf(d)
+				i2 := i1 - d
+				v := (i1 - off1) + (i2 - off2) - dd
+				if v > diffHeuristicFactor*ec && v > best &&
+					off1+diffSnakeCount <= i1 && i1 < lim1 &&
+					off2+diffSnakeCount <= i2 && i2 < lim2 {
+					for k := 1; ha1[i1-k] == ha2[i2-k]; k++ {
+						if k == diffSnakeCount {
+							best = v
+							split.i1, split.i2 = i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return split
+			}
+
+			split = myersSplit{minHi: true}
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := d - bmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdb(d)
+				i2 := i1 - d
+				v := (lim1 - i1) + (lim2 - i2) - dd
+				if v > diffHeuristicFactor*ec && v > best &&
+					off1 < i1 && i1 <= lim1-diffSnakeCount &&
+					off2 < i2 && i2 <= lim2-diffSnakeCount {
+					for k := 0; ha1[i1+k] == ha2[i2+k]; k++ {
+						if k == diffSnakeCount-1 {
+							best = v
+							split.i1, split.i2 = i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return split
+			}
+		}
+
+		// enough is enough, the furthest reaching path is taken
+		if ec >= search.maxCost {
+			fbest, fbest1 := -1, -1
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := min(*kvdf(d), lim1)
+				i2 := i1 - d
+				if lim2 < i2 {
+					i1, i2 = lim2+d, lim2
+				}
+				if fbest < i1+i2 {
+					fbest, fbest1 = i1+i2, i1
+				}
+			}
+			bbest, bbest1 := lineMax, lineMax
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := max(off1, *kvdb(d))
+				i2 := i1 - d
+				if i2 < off2 {
+					i1, i2 = off2+d, off2
+				}
+				if i1+i2 < bbest {
+					bbest, bbest1 = i1+i2, i1
+				}
+			}
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return myersSplit{i1: fbest1, i2: fbest - fbest1, minLo: true}
+			}
+			return myersSplit{i1: bbest1, i2: bbest - bbest1, minHi: true}
+		}
+	}
+}
+
+// fallBackDiff marks the changes of line ranges with Myers' algorithm,
+// lines being counted from 1 as in the patience and histogram diffs
+func fallBackDiff(ha1 []int, ha2 []int, changes1 changeMap, changes2 changeMap,
+	line1 int, count1 int, line2 int, count2 int) {
+	sub1, sub2 := myersDiff(ha1[line1-1:line1-1+count1], ha2[line2-1:line2-1+count2], false)
+	copy(changes1[line1-1:], sub1)
+	copy(changes2[line2-1:], sub2)
+}
+
+// diffGroup is a group of changed lines [start, end) of a file, empty
+// between two unchanged lines
+type diffGroup struct {
+	start, end int
+}
+
+func firstGroup(changes changeMap) diffGroup {
+	group := diffGroup{}
+	for changes.at(group.end) {
+		group.end++
+	}
+	return group
+}
+
+// next moves to the next group, false at the end of the file
+func (group *diffGroup) next(changes changeMap) bool {
+	if group.end == len(changes) {
+		return false
+	}
+	group.start = group.end + 1
+	for group.end = group.start; changes.at(group.end); group.end++ {
+	}
+	return true
+}
+
+// previous moves to the previous group, false at the start of the file
+func (group *diffGroup) previous(changes changeMap) bool {
+	if group.start == 0 {
+		return false
+	}
+	group.end = group.start - 1
+	for group.start = group.end; changes.at(group.start - 1); group.start-- {
+	}
+	return true
+}
+
+// slideDown moves the group one line down if the line after it is the
+// same as its first line, merging it with the next group it touches
+func (group *diffGroup) slideDown(changes changeMap, ha []int) bool {
+	if group.end < len(changes) && ha[group.start] == ha[group.end] {
+		changes[group.start] = false
+		changes[group.end] = true
+		group.start++
+		group.end++
+		for changes.at(group.end) {
+			group.end++
+		}
+		return true
+	}
+	return false
+}
+
+// slideUp moves the group one line up if the line before it is the same
+// as its last line, merging it with the previous group it touches
+func (group *diffGroup) slideUp(changes changeMap, ha []int) bool {
+	if group.start > 0 && ha[group.start-1] == ha[group.end-1] {
+		group.start--
+		group.end--
+		changes[group.start] = true
+		changes[group.end] = false
+		for changes.at(group.start - 1) {
+			group.start--
+		}
+		return true
+	}
+	return false
+}
+
+// compactChanges slides each group of changed lines of a file, merging
+// the groups it meets: a group lines up with a change of the other file
+// when it can, otherwise it goes where the indent heuristic prefers, or
+// as low as it can without the heuristic
+func compactChanges(changes changeMap, ha []int, lines []string, other changeMap, indentHeuristic bool) {
+	group := firstGroup(changes)
+	otherGroup := firstGroup(other)
+
+	for {
+		if group.end != group.start {
+			var groupSize, earliestEnd int
+			endMatchingOther := -1
+			for {
+				groupSize = group.end - group.start
+				endMatchingOther = -1
+
+				for group.slideUp(changes, ha) {
+					otherGroup.previous(other)
+				}
+				earliestEnd = group.end
+				if otherGroup.end > otherGroup.start {
+					endMatchingOther = group.end
+				}
+
+				for group.slideDown(changes, ha) {
+					otherGroup.next(other)
+					if otherGroup.end > otherGroup.start {
+						endMatchingOther = group.end
+					}
+				}
+				if groupSize == group.end-group.start {
+					break
+				}
+			}
+
+			switch {
+			case group.end == earliestEnd:
+				// the group cannot move
+			case endMatchingOther != -1:
+				for otherGroup.end == otherGroup.start {
+					group.slideUp(changes, ha)
+					otherGroup.previous(other)
+				}
+			case indentHeuristic:
+				bestShift := -1
+				var bestScore splitScore
+				shift := max(earliestEnd, group.end-groupSize-1, group.end-diffMaxSliding)
+				for ; shift <= group.end; shift++ {
+					score := splitScore{}
+					score.add(measureSplit(lines, shift))
+					score.add(measureSplit(lines, shift-groupSize))
+					if bestShift == -1 || score.compare(bestScore) <= 0 {
+						bestScore = score
+						bestShift = shift
+					}
+				}
+				for group.end > bestShift {
+					group.slideUp(changes, ha)
+					otherGroup.previous(other)
+				}
+			}
+		}
+
+		if !group.next(changes) {
+			break
+		}
+		otherGroup.next(other)
+	}
+}
+
+// indent heuristic, measures of the place between two lines where a
+// group of changes starts or ends
+const (
+	maxIndent = 200
+	maxBlanks = 20
+
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+)
+
+type splitMeasure struct {
+	// the split is at the end of the file
+	endOfFile bool
+	// indent of the line after the split, -1 if blank
+	indent int
+	// blank lines before the split, and indent of the non-blank line
+	// before them, -1 if none
+	preBlank  int
+	preIndent int
+	// blank lines after the line after the split, and indent of the
+	// non-blank line after them, -1 if none
+	postBlank  int
+	postIndent int
+}
+
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+// lineIndent returns the indent of a line, a tab going to the next
+// multiple of 8, -1 for a blank line
+func lineIndent(line string) int {
+	indent := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			indent++
+		case '\t':
+			indent += 8 - indent%8
+		case '\n', '\r', '\v', '\f':
+		default:
+			return indent
+		}
+		if indent >= maxIndent {
+			return maxIndent
+		}
+	}
+	return -1
+}
+
+func measureSplit(lines []string, split int) splitMeasure {
+	measure := splitMeasure{indent: -1, preIndent: -1, postIndent: -1}
+	if split >= len(lines) {
+		measure.endOfFile = true
+	} else {
+		measure.indent = lineIndent(lines[split])
+	}
+
+	for i := split - 1; i >= 0; i-- {
+		measure.preIndent = lineIndent(lines[i])
+		if measure.preIndent != -1 {
+			break
+		}
+		measure.preBlank++
+		if measure.preBlank == maxBlanks {
+			measure.preIndent = 0
+			break
+		}
+	}
+
+	for i := split + 1; i < len(lines); i++ {
+		measure.postIndent = lineIndent(lines[i])
+		if measure.postIndent != -1 {
+			break
+		}
+		measure.postBlank++
+		if measure.postBlank == maxBlanks {
+			measure.postIndent = 0
+			break
+		}
+	}
+	return measure
+}
+
+func (score *splitScore) add(measure splitMeasure) {
+	if measure.preIndent == -1 && measure.preBlank == 0 {
+		score.penalty += startOfFilePenalty
+	}
+	if measure.endOfFile {
+		score.penalty += endOfFilePenalty
+	}
+
+	postBlank := 0
+	if measure.indent == -1 {
+		postBlank = 1 + measure.postBlank
+	}
+	totalBlank := measure.preBlank + postBlank
+	score.penalty += totalBlankWeight * totalBlank
+	score.penalty += postBlankWeight * postBlank
+
+	indent := measure.indent
+	if indent == -1 {
+		indent = measure.postIndent
+	}
+	anyBlanks := totalBlank != 0
+	score.effectiveIndent += indent
+
+	pick := func(withBlank int, without int) int {
+		if anyBlanks {
+			return withBlank
+		}
+		return without
+	}
+	switch {
+	case indent == -1, measure.preIndent == -1, indent == measure.preIndent:
+	case indent > measure.preIndent:
+		score.penalty += pick(relativeIndentWithBlankPenalty, relativeIndentPenalty)
+	case measure.postIndent != -1 && measure.postIndent > indent:
+		score.penalty += pick(relativeOutdentWithBlankPenalty, relativeOutdentPenalty)
+	default:
+		score.penalty += pick(relativeDedentWithBlankPenalty, relativeDedentPenalty)
+	}
+}
+
+// compare is negative when score is better than other
+func (score splitScore) compare(other splitScore) int {
+	cmpIndents := 0
+	if score.effectiveIndent > other.effectiveIndent {
+		cmpIndents = 1
+	} else if score.effectiveIndent < other.effectiveIndent {
+		cmpIndents = -1
+	}
+	return indentWeight*cmpIndents + (score.penalty - other.penalty)
+}
+
+// buildScript collects the groups of changed lines of both files
+func buildScript(changes1 changeMap, changes2 changeMap) []diffChange {
+	script := []diffChange{}
+	for i1, i2 := len(changes1), len(changes2); i1 >= 0 || i2 >= 0; i1, i2 = i1-1, i2-1 {
+		if changes1.at(i1-1) || changes2.at(i2-1) {
+			l1, l2 := i1, i2
+			for changes1.at(i1 - 1) {
+				i1--
+			}
+			for changes2.at(i2 - 1) {
+				i2--
+			}
+			script = append(script, diffChange{i1: i1, i2: i2, chg1: l1 - i1, chg2: l2 - i2})
+		}
+	}
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+	return script
+}
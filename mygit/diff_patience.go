@@ -0,0 +1,177 @@
+package mygit
+
+// Patience diff: the lines found exactly once in both files are matched
+// along their longest common subsequence, then the ranges between them
+// are diffed the same way, Myers' algorithm taking over for ranges without
+// such lines
+//
+// Lines are counted from 1.
+
+// patienceLine is a line of the first file, with the line it matches in
+// the second file
+type patienceLine struct {
+	line1 int
+	// 0 when the line is not in the second file, patienceNonUnique when
+	// it is not unique in either file
+	line2 int
+	// neighbours in the longest common subsequence
+	previous, next *patienceLine
+}
+
+const patienceNonUnique = -1
+
+type patience struct {
+	ha1, ha2           []int
+	changes1, changes2 changeMap
+}
+
+// patienceDiff marks the changed lines with the patience algorithm
+func patienceDiff(ha1 []int, ha2 []int) (changeMap, changeMap) {
+	p := &patience{
+		ha1:      ha1,
+		ha2:      ha2,
+		changes1: make(changeMap, len(ha1)),
+		changes2: make(changeMap, len(ha2)),
+	}
+	p.diff(1, len(ha1), 1, len(ha2))
+	return p.changes1, p.changes2
+}
+
+func (p *patience) diff(line1 int, count1 int, line2 int, count2 int) {
+	if count1 == 0 {
+		for i := 0; i < count2; i++ {
+			p.changes2[line2-1+i] = true
+		}
+		return
+	}
+	if count2 == 0 {
+		for i := 0; i < count1; i++ {
+			p.changes1[line1-1+i] = true
+		}
+		return
+	}
+
+	// lines of the first file in order, with their match in the second
+	lines := []*patienceLine{}
+	byClass := map[int]*patienceLine{}
+	for l := line1; l < line1+count1; l++ {
+		if line := byClass[p.ha1[l-1]]; line != nil {
+			line.line2 = patienceNonUnique
+			continue
+		}
+		line := &patienceLine{line1: l}
+		byClass[p.ha1[l-1]] = line
+		lines = append(lines, line)
+	}
+	hasMatches := false
+	for l := line2; l < line2+count2; l++ {
+		line := byClass[p.ha2[l-1]]
+		if line == nil {
+			continue
+		}
+		hasMatches = true
+		if line.line2 != 0 {
+			line.line2 = patienceNonUnique
+		} else {
+			line.line2 = l
+		}
+	}
+
+	if !hasMatches {
+		for i := 0; i < count1; i++ {
+			p.changes1[line1-1+i] = true
+		}
+		for i := 0; i < count2; i++ {
+			p.changes2[line2-1+i] = true
+		}
+		return
+	}
+
+	if first := longestCommonSequence(lines); first != nil {
+		p.walkCommonSequence(first, line1, count1, line2, count2)
+		return
+	}
+	fallBackDiff(p.ha1, p.ha2, p.changes1, p.changes2, line1, count1, line2, count2)
+}
+
+// longestCommonSequence returns the first line of the longest sequence of
+// unique lines in the same order in both files, linked by their next
+// field, nil if there is none
+func longestCommonSequence(lines []*patienceLine) *patienceLine {
+	// the sequence of each length ending with the smallest line2
+	sequence := []*patienceLine{}
+	for _, line := range lines {
+		if line.line2 == 0 || line.line2 == patienceNonUnique {
+			continue
+		}
+		// longest sequence ending before line2
+		left, right := -1, len(sequence)
+		for left+1 < right {
+			middle := left + (right-left)/2
+			if sequence[middle].line2 > line.line2 {
+				right = middle
+			} else {
+				left = middle
+			}
+		}
+		line.previous = nil
+		if left >= 0 {
+			line.previous = sequence[left]
+		}
+		if left+1 == len(sequence) {
+			sequence = append(sequence, line)
+		} else {
+			sequence[left+1] = line
+		}
+	}
+	if len(sequence) == 0 {
+		return nil
+	}
+
+	line := sequence[len(sequence)-1]
+	line.next = nil
+	for line.previous != nil {
+		line.previous.next = line
+		line = line.previous
+	}
+	return line
+}
+
+func (p *patience) match(line1 int, line2 int) bool {
+	return p.ha1[line1-1] == p.ha2[line2-1]
+}
+
+// walkCommonSequence diffs the ranges between the lines of the sequence,
+// after growing the sequence with the equal lines around them
+func (p *patience) walkCommonSequence(first *patienceLine, line1 int, count1 int, line2 int, count2 int) {
+	end1, end2 := line1+count1, line2+count2
+	for {
+		var next1, next2 int
+		if first != nil {
+			next1, next2 = first.line1, first.line2
+			for next1 > line1 && next2 > line2 && p.match(next1-1, next2-1) {
+				next1--
+				next2--
+			}
+		} else {
+			next1, next2 = end1, end2
+		}
+		for line1 < next1 && line2 < next2 && p.match(line1, line2) {
+			line1++
+			line2++
+		}
+
+		if next1 > line1 || next2 > line2 {
+			p.diff(line1, next1-line1, line2, next2-line2)
+		}
+		if first == nil {
+			return
+		}
+
+		for first.next != nil && first.next.line1 == first.line1+1 && first.next.line2 == first.line2+1 {
+			first = first.next
+		}
+		line1, line2 = first.line1+1, first.line2+1
+		first = first.next
+	}
+}
@@ -0,0 +1,511 @@
+package mygit
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// similarity scores range from 0 to MaxSimilarity, as in git
+const MaxSimilarity = 60000
+
+// minimum similarity of a rename or a copy by default, 50%
+const DefaultRenameScore = MaxSimilarity / 2
+
+// number of best sources kept for each added file
+const renameCandidates = 4
+
+// modulo of the hashes of the chunks compared by the similarity estimate
+const spanHashBase = 107927
+
+type RenameOptions struct {
+	// pair deleted files with similar added files, showing them as renamed
+	FindRenames bool
+	// pair modified files with similar added files too, showing them as
+	// copied
+	FindCopies bool
+	// minimum similarity of a pair, out of MaxSimilarity, DefaultRenameScore
+	// if 0
+	MinScore int
+}
+
+// DefaultRenameOptions returns the rename detection of a command from the
+// "<command>.renames" and "diff.renames" configuration, renames being found
+// by default and copies too with the "copies" value
+func DefaultRenameOptions(command string) (RenameOptions, error) {
+	options := RenameOptions{FindRenames: true}
+	value, err := readConfig(command + ".renames")
+	if err == nil && value == "" {
+		value, err = readConfig("diff.renames")
+	}
+	if err != nil {
+		return options, err
+	}
+	switch strings.ToLower(value) {
+	case "copies", "copy":
+		options.FindCopies = true
+	case "false", "no", "off", "0":
+		options.FindRenames = false
+	}
+	return options, nil
+}
+
+// ParseRenameScore parses the minimum similarity given to -M and -C: the
+// digits after a decimal point, "5" and "50" both meaning 50%, or a
+// percentage such as "50%"
+func ParseRenameScore(text string) (int, error) {
+	number, scale := 0, 1
+	dot := false
+	i := 0
+	for ; i < len(text); i++ {
+		c := text[i]
+		if c == '.' && !dot {
+			scale = 1
+			dot = true
+		} else if c == '%' {
+			if dot {
+				scale *= 100
+			} else {
+				scale = 100
+			}
+			i++
+			break
+		} else if c >= '0' && c <= '9' {
+			if scale < 100000 {
+				scale *= 10
+				number = number*10 + int(c-'0')
+			}
+		} else {
+			break
+		}
+	}
+	if i != len(text) {
+		return 0, fmt.Errorf("invalid similarity score: %s", text)
+	}
+	if number >= scale {
+		return MaxSimilarity, nil
+	}
+	return MaxSimilarity * number / scale, nil
+}
+
+// renameSource is a deleted file, or a modified one when looking for
+// copies, that may be the origin of an added file
+type renameSource struct {
+	pair *diffPair
+	// number of added files paired with it, a modified file counting
+	// itself as one since it stays
+	used int
+}
+
+// renameMatch is a source found for an added file
+type renameMatch struct {
+	source *renameSource
+	score  int
+}
+
+// renameCandidate is a possible pairing of an added file, by index
+type renameCandidate struct {
+	destination int
+	source      int
+	score       int
+	// 1 if both files have the same name
+	nameScore int
+}
+
+// better checks whether a candidate sorts before another one: the higher
+// score first, then the same file name first
+func (candidate *renameCandidate) better(other *renameCandidate) bool {
+	if candidate.score != other.score {
+		return candidate.score > other.score
+	}
+	return candidate.nameScore > other.nameScore
+}
+
+// similarityData is what the similarity estimate reads of a file
+type similarityData struct {
+	size int
+	// number of bytes of the chunks of the file by their hash
+	chunks map[uint32]int
+}
+
+// renameDetection finds the sources of added files the way git's diffcore
+// does: files with the same object ID first, then files with the same
+// name that are similar enough, then the most similar files
+type renameDetection struct {
+	options      *RenameOptions
+	minScore     int
+	sources      []*renameSource
+	destinations []*diffPair
+	// sources found, by index of destination
+	matches map[int]renameMatch
+	data    map[*diffFile]*similarityData
+}
+
+// detectRenames pairs the added files with deleted files, or modified
+// files when looking for copies, of similar content
+// The added file of a pair is replaced by a renamed or copied pair, and a
+// deleted file that was renamed is left out
+func detectRenames(pairs []diffPair, options *RenameOptions) ([]diffPair, error) {
+	if !options.FindRenames && !options.FindCopies {
+		return pairs, nil
+	}
+	detection := &renameDetection{
+		options:  options,
+		minScore: options.MinScore,
+		matches:  map[int]renameMatch{},
+		data:     map[*diffFile]*similarityData{},
+	}
+	if detection.minScore == 0 {
+		detection.minScore = DefaultRenameScore
+	}
+
+	sourceOf := map[*diffPair]*renameSource{}
+	destinationOf := map[*diffPair]int{}
+	for i := range pairs {
+		pair := &pairs[i]
+		switch {
+		case !pair.old.exists():
+			destinationOf[pair] = len(detection.destinations)
+			detection.destinations = append(detection.destinations, pair)
+		case !pair.new.exists():
+			sourceOf[pair] = &renameSource{pair: pair}
+			detection.sources = append(detection.sources, sourceOf[pair])
+		case options.FindCopies:
+			sourceOf[pair] = &renameSource{pair: pair, used: 1}
+			detection.sources = append(detection.sources, sourceOf[pair])
+		}
+	}
+	if len(detection.sources) == 0 || len(detection.destinations) == 0 {
+		return pairs, nil
+	}
+
+	detection.findExact()
+	if !options.FindCopies {
+		if err := detection.findSameNames(); err != nil {
+			return nil, err
+		}
+	}
+	if err := detection.findSimilar(); err != nil {
+		return nil, err
+	}
+
+	// the last pair of a source is its rename, the others are copies
+	result := []diffPair{}
+	resultSources := []*renameSource{}
+	for i := range pairs {
+		pair := &pairs[i]
+		if destination, found := destinationOf[pair]; found {
+			if match, found := detection.matches[destination]; found {
+				renamed := diffPair{old: match.source.pair.old, new: pair.new, score: match.score}
+				result = append(result, renamed)
+				resultSources = append(resultSources, match.source)
+				continue
+			}
+		}
+		if source := sourceOf[pair]; source != nil && !pair.new.exists() && source.used > 0 {
+			continue
+		}
+		result = append(result, *pair)
+		resultSources = append(resultSources, nil)
+	}
+	for i, source := range resultSources {
+		if source != nil {
+			source.used--
+			result[i].copied = source.used > 0
+		}
+	}
+	return result, nil
+}
+
+// record pairs an added file with a source
+func (detection *renameDetection) record(destination int, source *renameSource, score int) {
+	detection.matches[destination] = renameMatch{source: source, score: score}
+	source.used++
+}
+
+// findExact pairs the added files with a source of the same object ID,
+// preferring an unused source with the same name
+func (detection *renameDetection) findExact() {
+	for i, destination := range detection.destinations {
+		var best *renameSource
+		bestScore := -1
+		for _, source := range detection.sources {
+			old := &source.pair.old
+			if old.oid != destination.new.oid {
+				continue
+			}
+			// other files than regular ones only match the same mode
+			if (!isRegularMode(old.mode) || !isRegularMode(destination.new.mode)) &&
+				old.mode != destination.new.mode {
+				continue
+			}
+			if source.used > 0 && !detection.options.FindCopies {
+				continue
+			}
+			score := 0
+			if source.used == 0 {
+				score++
+			}
+			if path.Base(old.path) == path.Base(destination.new.path) {
+				score++
+			}
+			if score > bestScore {
+				best, bestScore = source, score
+				if score == 2 {
+					break
+				}
+			}
+		}
+		if best != nil {
+			detection.record(i, best, MaxSimilarity)
+		}
+	}
+}
+
+// findSameNames pairs an added file with a source of the same file name,
+// when the name is unique on both sides and the files are quite similar
+func (detection *renameDetection) findSameNames() error {
+	minScore := detection.minScore + (MaxSimilarity-detection.minScore)/2
+
+	sources := map[string]int{}
+	for i, source := range detection.sources {
+		if source.used > 0 {
+			continue
+		}
+		name := path.Base(source.pair.old.path)
+		if _, found := sources[name]; found {
+			sources[name] = -1
+		} else {
+			sources[name] = i
+		}
+	}
+	destinations := map[string]int{}
+	for i, destination := range detection.destinations {
+		if _, found := detection.matches[i]; found {
+			continue
+		}
+		name := path.Base(destination.new.path)
+		if _, found := destinations[name]; found {
+			destinations[name] = -1
+		} else {
+			destinations[name] = i
+		}
+	}
+
+	for i, source := range detection.sources {
+		name := path.Base(source.pair.old.path)
+		if source.used > 0 || sources[name] != i {
+			continue
+		}
+		destination, found := destinations[name]
+		if !found || destination < 0 {
+			continue
+		}
+		if _, found := detection.matches[destination]; found {
+			continue
+		}
+		score, err := detection.similarity(&source.pair.old, &detection.destinations[destination].new)
+		if err != nil {
+			return err
+		}
+		if score >= minScore {
+			detection.record(destination, source, score)
+		}
+	}
+	return nil
+}
+
+// findSimilar pairs the remaining added files with their most similar
+// sources, the best pairs first, then allows several copies of a source
+func (detection *renameDetection) findSimilar() error {
+	candidates := []renameCandidate{}
+	for i, destination := range detection.destinations {
+		if _, found := detection.matches[i]; found {
+			continue
+		}
+		best := []renameCandidate{}
+		for j, source := range detection.sources {
+			if source.used > 0 && !detection.options.FindCopies {
+				continue
+			}
+			score, err := detection.similarity(&source.pair.old, &destination.new)
+			if err != nil {
+				return err
+			}
+			candidate := renameCandidate{destination: i, source: j, score: score}
+			if path.Base(source.pair.old.path) == path.Base(destination.new.path) {
+				candidate.nameScore = 1
+			}
+			if len(best) < renameCandidates {
+				best = append(best, candidate)
+				continue
+			}
+			worst := 0
+			for k := 1; k < len(best); k++ {
+				if best[worst].better(&best[k]) {
+					worst = k
+				}
+			}
+			if candidate.better(&best[worst]) {
+				best[worst] = candidate
+			}
+		}
+		candidates = append(candidates, best...)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].better(&candidates[j])
+	})
+
+	find := func(copies bool) {
+		for _, candidate := range candidates {
+			if candidate.score < detection.minScore {
+				break
+			}
+			if _, found := detection.matches[candidate.destination]; found {
+				continue
+			}
+			source := detection.sources[candidate.source]
+			if !copies && source.used > 0 {
+				continue
+			}
+			detection.record(candidate.destination, source, candidate.score)
+		}
+	}
+	find(false)
+	if detection.options.FindCopies {
+		find(true)
+	}
+	return nil
+}
+
+// isRegularMode checks whether a mode is the one of a regular file
+func isRegularMode(mode uint32) bool {
+	return mode&0170000 == 0100000
+}
+
+// similarity estimates how much of the content of dst comes from src, as
+// the share of the bigger file made of chunks found in both files
+// Only regular files are compared, and files whose sizes are too far apart
+// to reach the minimum score are not read further
+func (detection *renameDetection) similarity(src *diffFile, dst *diffFile) (int, error) {
+	if !isRegularMode(src.mode) || !isRegularMode(dst.mode) {
+		return 0, nil
+	}
+	srcData, err := detection.similarityData(src)
+	if err != nil {
+		return 0, err
+	}
+	dstData, err := detection.similarityData(dst)
+	if err != nil {
+		return 0, err
+	}
+
+	maxSize, baseSize := max(srcData.size, dstData.size), min(srcData.size, dstData.size)
+	if maxSize*(MaxSimilarity-detection.minScore) < (maxSize-baseSize)*MaxSimilarity {
+		return 0, nil
+	}
+	if dstData.size == 0 {
+		return 0, nil
+	}
+	copied := 0
+	for hash, count := range srcData.chunks {
+		copied += min(count, dstData.chunks[hash])
+	}
+	return copied * MaxSimilarity / maxSize, nil
+}
+
+// similarityData reads a file and hashes its chunks, once per file
+func (detection *renameDetection) similarityData(file *diffFile) (*similarityData, error) {
+	if data, found := detection.data[file]; found {
+		return data, nil
+	}
+	content, err := file.content()
+	if err != nil {
+		return nil, err
+	}
+	data := &similarityData{size: len(content), chunks: hashChunks(content)}
+	detection.data[file] = data
+	return data, nil
+}
+
+// hashChunks splits content in chunks ending at a newline or 64 bytes
+// long, and counts the bytes of the chunks by hash; the carriage returns
+// of CRLF line ends of text files are left out
+func hashChunks(content []byte) map[uint32]int {
+	chunks := map[uint32]int{}
+	text := !isBinary(content)
+	var accum1, accum2 uint32
+	n := 0
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if text && c == '\r' && i+1 < len(content) && content[i+1] == '\n' {
+			continue
+		}
+		old1 := accum1
+		accum1 = (accum1 << 7) ^ (accum2 >> 25)
+		accum2 = (accum2 << 7) ^ (old1 >> 25)
+		accum1 += uint32(c)
+		n++
+		if n < 64 && c != '\n' {
+			continue
+		}
+		chunks[(accum1+accum2*0x61)%spanHashBase] += n
+		n = 0
+		accum1, accum2 = 0, 0
+	}
+	if n > 0 {
+		chunks[(accum1+accum2*0x61)%spanHashBase] += n
+	}
+	return chunks
+}
+
+// similarityPercent returns a similarity score as a percentage
+func similarityPercent(score int) int {
+	return score * 100 / MaxSimilarity
+}
+
+// renamedName returns "<old> => <new>" for a renamed file, the common
+// leading directories and trailing path written once around braces, as
+// in "dir/{a => b}/file"
+func renamedName(oldPath string, newPath string) string {
+	quotedOld, quotedNew := quotePath(oldPath, false), quotePath(newPath, false)
+	if quotedOld != oldPath || quotedNew != newPath {
+		return quotedOld + " => " + quotedNew
+	}
+
+	prefix := 0
+	for i := 0; i < len(oldPath) && i < len(newPath) && oldPath[i] == newPath[i]; i++ {
+		if oldPath[i] == '/' {
+			prefix = i + 1
+		}
+	}
+
+	// the end of a string reads as a NUL byte, and when there is a common
+	// prefix the search may go back to its final slash
+	at := func(s string, i int) byte {
+		if i == len(s) {
+			return 0
+		}
+		return s[i]
+	}
+	adjust := 0
+	if prefix > 0 {
+		adjust = 1
+	}
+	suffix := 0
+	for i, j := len(oldPath), len(newPath); prefix-adjust <= i && prefix-adjust <= j &&
+		at(oldPath, i) == at(newPath, j); i, j = i-1, j-1 {
+		if at(oldPath, i) == '/' {
+			suffix = len(oldPath) - i
+		}
+	}
+
+	oldMiddle := max(len(oldPath)-prefix-suffix, 0)
+	newMiddle := max(len(newPath)-prefix-suffix, 0)
+	if prefix+suffix == 0 {
+		return oldPath + " => " + newPath
+	}
+	return oldPath[:prefix] + "{" + oldPath[prefix:prefix+oldMiddle] + " => " +
+		newPath[prefix:prefix+newMiddle] + "}" + oldPath[len(oldPath)-suffix:]
+}
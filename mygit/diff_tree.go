@@ -0,0 +1,265 @@
+package mygit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+)
+
+// TreeChange is an entry that differs between two trees, the side that
+// does not have it holding an empty entry
+type TreeChange struct {
+	Path string
+	// A for added, D for deleted, T for a type change, M otherwise
+	Status   byte
+	Old, New TreeEntry
+}
+
+type CompareTreesOptions struct {
+	// compare the files of subtrees rather than the subtrees themselves
+	Recursive bool
+}
+
+// CompareTrees walks two trees in lockstep and returns the entries that
+// differ, in the order of the trees; an empty object ID stands for a
+// tree without entries
+func CompareTrees(oldTreeOID string, newTreeOID string, options *CompareTreesOptions) ([]TreeChange, error) {
+	changes := []TreeChange{}
+	err := compareTrees(oldTreeOID, newTreeOID, "", options.Recursive, &changes)
+	return changes, err
+}
+
+// compareTrees adds the changes between two trees found at a path
+func compareTrees(oldTreeOID string, newTreeOID string, treePath string, recursive bool, changes *[]TreeChange) error {
+	if oldTreeOID == newTreeOID {
+		return nil
+	}
+	oldEntries, err := readTreeEntries(oldTreeOID)
+	if err != nil {
+		return err
+	}
+	newEntries, err := readTreeEntries(newTreeOID)
+	if err != nil {
+		return err
+	}
+
+	// both trees are sorted, tree names as if they ended with a '/', so a
+	// file and a tree of the same name are different entries
+	for len(oldEntries) > 0 || len(newEntries) > 0 {
+		var old, new TreeEntry
+		switch {
+		case len(newEntries) == 0 ||
+			len(oldEntries) > 0 && treeEntryLess(&oldEntries[0], &newEntries[0]):
+			old, oldEntries = oldEntries[0], oldEntries[1:]
+		case len(oldEntries) == 0 || treeEntryLess(&newEntries[0], &oldEntries[0]):
+			new, newEntries = newEntries[0], newEntries[1:]
+		default:
+			old, new = oldEntries[0], newEntries[0]
+			oldEntries, newEntries = oldEntries[1:], newEntries[1:]
+			if old.Hash == new.Hash && old.Mode == new.Mode {
+				continue
+			}
+		}
+
+		name := old.Name
+		if name == "" {
+			name = new.Name
+		}
+		change := TreeChange{Path: path.Join(treePath, name), Old: old, New: new}
+		if recursive && (old.Type == ObjectTypeTree || new.Type == ObjectTypeTree) {
+			if err := compareTrees(old.Hash, new.Hash, change.Path, recursive, changes); err != nil {
+				return err
+			}
+			continue
+		}
+		change.Status = treeChangeStatus(old, new)
+		*changes = append(*changes, change)
+	}
+	return nil
+}
+
+// treeChangeStatus returns the status letter of a changed entry
+func treeChangeStatus(old TreeEntry, new TreeEntry) byte {
+	switch {
+	case old.Name == "":
+		return 'A'
+	case new.Name == "":
+		return 'D'
+	case treeEntryMode(old)&0170000 != treeEntryMode(new)&0170000:
+		return 'T'
+	}
+	return 'M'
+}
+
+// treeEntryMode returns the mode of an entry as a number, 0 for an empty
+// entry
+func treeEntryMode(entry TreeEntry) uint32 {
+	mode, _ := strconv.ParseUint(entry.Mode, 8, 32)
+	return uint32(mode)
+}
+
+// readTreeEntries returns the entries of a tree, none for an empty
+// object ID
+func readTreeEntries(treeOID string) ([]TreeEntry, error) {
+	if treeOID == "" {
+		return nil, nil
+	}
+	object, err := NewObject(treeOID)
+	if err != nil {
+		return nil, err
+	}
+	if object.Type != ObjectTypeTree {
+		return nil, fmt.Errorf("object %s is not a tree", treeOID)
+	}
+	return parseTree(bufio.NewReader(bytes.NewReader(object.Content)))
+}
+
+type DiffTreeOptions struct {
+	// compare the files of subtrees rather than the subtrees themselves
+	Recursive bool
+	// compare a commit without parent with the empty tree
+	Root bool
+	// compare a merge commit with each of its parents
+	Merges bool
+	// terminate fields with NUL and do not quote paths
+	NullTerminated bool
+	// detection of renamed and copied files
+	Renames RenameOptions
+}
+
+// DiffTree compares two trees, or a commit with its parents, and shows
+// the changed entries in the raw format:
+//
+//	:<old mode> <new mode> <old oid> <new oid> <status>\t<path>
+//
+// The changes of a commit are shown after a line with its object ID.
+// Arguments are one or two tree-ish objects, then pathspecs selecting the
+// changes shown
+func DiffTree(arguments []string, pathspecs []string, options *DiffTreeOptions) error {
+	objects := []string{}
+	for len(objects) < 2 && len(arguments) > 0 {
+		oid, err := resolveRevision(arguments[0])
+		if err != nil {
+			if len(objects) == 0 {
+				return err
+			}
+			break
+		}
+		objects = append(objects, oid)
+		arguments = arguments[1:]
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("no tree-ish specified")
+	}
+	specs := parsePathspecs(append(arguments[:len(arguments):len(arguments)], pathspecs...))
+	out := bufio.NewWriter(os.Stdout)
+
+	if len(objects) == 2 {
+		trees := make([]string, 2)
+		for i, oid := range objects {
+			tree, err := peelRevision(oid, "tree")
+			if err != nil {
+				return err
+			}
+			trees[i] = tree
+		}
+		if err := writeRawChanges(out, trees[0], trees[1], specs, "", options); err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+
+	commit, err := peelToCommit(objects[0])
+	if err != nil {
+		return err
+	}
+	parents := commit.Parents
+	switch {
+	case len(parents) == 0 && options.Root:
+		parents = []string{""}
+	case len(parents) > 1 && !options.Merges:
+		parents = nil
+	}
+	for _, parent := range parents {
+		parentTree, err := commitTreeOID(parent)
+		if err != nil {
+			return err
+		}
+		if err := writeRawChanges(out, parentTree, commit.Tree, specs, commit.Hash, options); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// writeRawChanges writes the changes between two trees in the raw format,
+// after a header line if there are some and the header is not empty
+func writeRawChanges(out *bufio.Writer, oldTreeOID string, newTreeOID string,
+	specs []*pathspec, header string, options *DiffTreeOptions) error {
+	changes, err := CompareTrees(oldTreeOID, newTreeOID, &CompareTreesOptions{Recursive: options.Recursive})
+	if err != nil {
+		return err
+	}
+	matched := make([]bool, len(specs))
+	pairs := []diffPair{}
+	for _, change := range changes {
+		if matchPathspecs(specs, change.Path, matched) {
+			pairs = append(pairs, treeChangePair(change))
+			continue
+		}
+		// trees are shown when the pathspecs select some of their files
+		if change.Old.Type == ObjectTypeTree || change.New.Type == ObjectTypeTree {
+			for _, spec := range specs {
+				if spec.leadsInto(change.Path) {
+					pairs = append(pairs, treeChangePair(change))
+					break
+				}
+			}
+		}
+	}
+	if pairs, err = detectRenames(pairs, &options.Renames); err != nil || len(pairs) == 0 {
+		return err
+	}
+
+	end := "\n"
+	if options.NullTerminated {
+		end = "\x00"
+	}
+	if header != "" {
+		out.WriteString(header + end)
+	}
+	for _, pair := range pairs {
+		oldOID, newOID := pair.old.oid, pair.new.oid
+		if oldOID == "" {
+			oldOID = zeroOID
+		}
+		if newOID == "" {
+			newOID = zeroOID
+		}
+		fmt.Fprintf(out, ":%06o %06o %s %s %s", pair.old.mode, pair.new.mode, oldOID, newOID, pair.statusScore())
+		paths := []string{pair.new.path}
+		if pair.renamed() {
+			paths = []string{pair.old.path, pair.new.path}
+		}
+		for _, filePath := range paths {
+			if options.NullTerminated {
+				fmt.Fprintf(out, "\x00%s", filePath)
+			} else {
+				fmt.Fprintf(out, "\t%s", quotePath(filePath, false))
+			}
+		}
+		out.WriteString(end)
+	}
+	return nil
+}
+
+// treeChangePair returns the sides of a changed tree entry
+func treeChangePair(change TreeChange) diffPair {
+	return diffPair{
+		old: diffFile{path: change.Path, mode: treeEntryMode(change.Old), oid: change.Old.Hash},
+		new: diffFile{path: change.Path, mode: treeEntryMode(change.New), oid: change.New.Hash},
+	}
+}
@@ -0,0 +1,297 @@
+package mygit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// binary detection looks for a NUL byte in the first bytes of a file
+const binaryCheckSize = 8000
+
+// maximum length of the function name shown in hunk headers
+const maxFuncNameLength = 80
+
+// isBinary checks whether content looks like binary data
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), binaryCheckSize)], 0) >= 0
+}
+
+// trimCommonTail leaves out the common end of two contents, by blocks
+// and up to a line boundary, which cannot change a diff without context
+func trimCommonTail(a []byte, b []byte) ([]byte, []byte) {
+	const block = 1024
+	trimmed := 0
+	smaller := min(len(a), len(b))
+	for block+trimmed <= smaller &&
+		bytes.Equal(a[len(a)-trimmed-block:len(a)-trimmed], b[len(b)-trimmed-block:len(b)-trimmed]) {
+		trimmed += block
+	}
+	recovered := 0
+	for recovered < trimmed {
+		recovered++
+		if a[len(a)-trimmed+recovered-1] == '\n' {
+			break
+		}
+	}
+	return a[:len(a)-trimmed+recovered], b[:len(b)-trimmed+recovered]
+}
+
+// funcName returns the function name shown in hunk headers for a line,
+// a line starting with a letter, '_' or '$', empty for other lines
+func funcName(line string) (string, bool) {
+	if line == "" {
+		return "", false
+	}
+	c := line[0]
+	if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$') {
+		return "", false
+	}
+	line = line[:min(len(line), maxFuncNameLength)]
+	return strings.TrimRight(line, " \t\n\v\f\r"), true
+}
+
+// hunkRange formats the start and the line count of a hunk
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// writeDiffLine writes a line of a hunk, marking a missing newline
+func writeDiffLine(out *bufio.Writer, prefix byte, line string) {
+	out.WriteByte(prefix)
+	out.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		out.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// writeHunks writes the changes in the unified format, changes closer
+// than twice the number of context lines sharing a hunk
+func writeHunks(out *bufio.Writer, lines1 []string, lines2 []string, script []diffChange, context int) {
+	funcLine := ""
+	funcSearched := -1
+	for first := 0; first < len(script); {
+		// last change of the hunk
+		last := first
+		for last+1 < len(script) &&
+			script[last+1].i1-(script[last].i1+script[last].chg1) <= 2*context {
+			last++
+		}
+		start, end := script[first], script[last]
+
+		s1 := max(start.i1-context, 0)
+		s2 := max(start.i2-context, 0)
+		postContext := min(context, len(lines1)-(end.i1+end.chg1), len(lines2)-(end.i2+end.chg2))
+		e1 := end.i1 + end.chg1 + postContext
+		e2 := end.i2 + end.chg2 + postContext
+
+		// the function name is looked for up from the hunk, down to the
+		// place looked at for the previous hunk
+		for l := s1 - 1; l > funcSearched && l >= 0; l-- {
+			if name, found := funcName(lines1[l]); found {
+				funcLine = name
+				break
+			}
+		}
+		funcSearched = s1 - 1
+
+		header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(s1+1, e1-s1), hunkRange(s2+1, e2-s2))
+		if funcLine != "" {
+			header += " " + funcLine
+		}
+		out.WriteString(header + "\n")
+
+		for ; s2 < start.i2; s2++ {
+			writeDiffLine(out, ' ', lines2[s2])
+		}
+		for i := first; i <= last; i++ {
+			change := script[i]
+			if i > first {
+				previous := script[i-1]
+				for l := previous.i2 + previous.chg2; l < change.i2; l++ {
+					writeDiffLine(out, ' ', lines2[l])
+				}
+			}
+			for l := change.i1; l < change.i1+change.chg1; l++ {
+				writeDiffLine(out, '-', lines1[l])
+			}
+			for l := change.i2; l < change.i2+change.chg2; l++ {
+				writeDiffLine(out, '+', lines2[l])
+			}
+		}
+		for l := end.i2 + end.chg2; l < e2; l++ {
+			writeDiffLine(out, ' ', lines2[l])
+		}
+		first = last + 1
+	}
+}
+
+// diffStat is the line of a file in --stat output
+type diffStat struct {
+	name    string
+	added   int
+	deleted int
+	binary  bool
+}
+
+// terminalWidth returns the width --stat fits in: $COLUMNS, 80 otherwise
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return 80
+}
+
+// writeDiffSummary writes the files created, deleted, renamed or copied
+// and the changes of mode, as shown after a diffstat
+func writeDiffSummary(out *bufio.Writer, pairs []diffPair) {
+	for _, pair := range pairs {
+		switch {
+		case !pair.old.exists():
+			fmt.Fprintf(out, " create mode %06o %s\n", pair.new.mode, quotePath(pair.new.path, false))
+		case !pair.new.exists():
+			fmt.Fprintf(out, " delete mode %06o %s\n", pair.old.mode, quotePath(pair.old.path, false))
+		case pair.renamed():
+			verb := "rename"
+			if pair.copied {
+				verb = "copy"
+			}
+			fmt.Fprintf(out, " %s %s (%d%%)\n", verb, renamedName(pair.old.path, pair.new.path),
+				similarityPercent(pair.score))
+			if pair.old.mode != pair.new.mode {
+				fmt.Fprintf(out, " mode change %06o => %06o\n", pair.old.mode, pair.new.mode)
+			}
+		case pair.old.mode != pair.new.mode:
+			fmt.Fprintf(out, " mode change %06o => %06o %s\n", pair.old.mode, pair.new.mode,
+				quotePath(pair.new.path, false))
+		}
+	}
+}
+
+// writeDiffStat writes the number of changed lines of each file with
+// a graph of '+' and '-', names and graph sharing the terminal width
+// the way git does, and a summary
+func writeDiffStat(out *bufio.Writer, stats []diffStat) {
+	maxLength, maxChange := 0, 0
+	binWidth, numberWidth := 0, 0
+	for _, stat := range stats {
+		maxLength = max(maxLength, len(stat.name))
+		if stat.binary {
+			// "Bin XXX -> YYY bytes"
+			binWidth = max(binWidth, 14+len(strconv.Itoa(stat.added))+len(strconv.Itoa(stat.deleted)))
+			numberWidth = 3
+			continue
+		}
+		maxChange = max(maxChange, stat.added+stat.deleted)
+	}
+
+	width := terminalWidth()
+	numberWidth = max(numberWidth, len(strconv.Itoa(maxChange)))
+	width = max(width, 16+6+numberWidth)
+
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+	nameWidth := maxLength
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = max(width*3/8-numberWidth-6, 6)
+		}
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	scale := func(n int) int {
+		if n == 0 {
+			return 0
+		}
+		return 1 + n*(graphWidth-1)/maxChange
+	}
+
+	insertions, deletions := 0, 0
+	for _, stat := range stats {
+		// long names are cut at a '/' after their start
+		name, prefix := stat.name, ""
+		if nameWidth < len(name) {
+			prefix = "..."
+			length := max(nameWidth-3, 0)
+			name = name[len(name)-length:]
+			if slash := strings.IndexByte(name, '/'); slash >= 0 {
+				name = name[slash:]
+			}
+		}
+		padding := max(nameWidth-len(prefix)-len(name), 0)
+		if prefix == "" {
+			padding = nameWidth - len(name)
+		}
+		fmt.Fprintf(out, " %s%s%*s | ", prefix, name, padding, "")
+
+		if stat.binary {
+			fmt.Fprintf(out, "%*s", numberWidth, "Bin")
+			if stat.added != 0 || stat.deleted != 0 {
+				fmt.Fprintf(out, " %d -> %d bytes", stat.deleted, stat.added)
+			}
+			out.WriteString("\n")
+			continue
+		}
+
+		insertions += stat.added
+		deletions += stat.deleted
+		added, deleted := stat.added, stat.deleted
+		if graphWidth <= maxChange {
+			total := scale(added + deleted)
+			if total < 2 && added != 0 && deleted != 0 {
+				total = 2
+			}
+			if added < deleted {
+				added = scale(added)
+				deleted = total - added
+			} else {
+				deleted = scale(deleted)
+				added = total - deleted
+			}
+		}
+		fmt.Fprintf(out, "%*d", numberWidth, stat.added+stat.deleted)
+		if stat.added+stat.deleted != 0 {
+			out.WriteString(" ")
+		}
+		out.WriteString(strings.Repeat("+", added) + strings.Repeat("-", deleted) + "\n")
+	}
+
+	writeStatSummary(out, len(stats), insertions, deletions)
+}
+
+// writeStatSummary writes "N files changed, X insertions(+), Y deletions(-)"
+func writeStatSummary(out *bufio.Writer, files int, insertions int, deletions int) {
+	if files == 0 {
+		out.WriteString(" 0 files changed\n")
+		return
+	}
+	plural := func(n int, singular string, pluralForm string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, singular)
+		}
+		return fmt.Sprintf("%d %s", n, pluralForm)
+	}
+	summary := " " + plural(files, "file changed", "files changed")
+	if insertions != 0 || deletions == 0 {
+		summary += ", " + plural(insertions, "insertion(+)", "insertions(+)")
+	}
+	if deletions != 0 || insertions == 0 {
+		summary += ", " + plural(deletions, "deletion(-)", "deletions(-)")
+	}
+	out.WriteString(summary + "\n")
+}
@@ -0,0 +1,557 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// default format of for-each-ref
+const DefaultRefFormat = "%(objectname) %(objecttype)\t%(refname)"
+
+// refInfo is a ref with the object it points to, parsed on demand
+type refInfo struct {
+	name string
+	oid  string
+	// ref a symbolic ref points to
+	symref string
+
+	object *Object
+	commit *CommitObject
+	tag    *TagObject
+}
+
+// localRefs returns the refs under refs/ sorted by name, skipping the
+// broken ones
+func localRefs() ([]*refInfo, error) {
+	names, err := listRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []*refInfo{}
+	for _, name := range names {
+		refName := "refs/" + name
+		oid, err := readRef(refName)
+		if err != nil || oid == "" {
+			fmt.Fprintf(os.Stderr, "warning: ignoring broken ref %s\n", refName)
+			continue
+		}
+		target, symbolic, err := readLooseRef(refName)
+		if err != nil {
+			return nil, err
+		}
+		ref := &refInfo{name: refName, oid: oid}
+		if symbolic {
+			ref.symref = target
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// load reads and parses the object the ref points to
+func (ref *refInfo) load() error {
+	if ref.object != nil {
+		return nil
+	}
+	object, err := NewObject(ref.oid)
+	if err != nil {
+		return err
+	}
+	switch object.Type {
+	case ObjectTypeCommit:
+		if ref.commit, err = parseCommitObject(object); err != nil {
+			return err
+		}
+	case ObjectTypeTag:
+		if ref.tag, err = parseTagObject(object); err != nil {
+			return err
+		}
+	}
+	ref.object = object
+	return nil
+}
+
+// peeled returns the ref as seen through the tags it points to,
+// nil when it does not point to a tag
+func (ref *refInfo) peeled() (*refInfo, error) {
+	if err := ref.load(); err != nil {
+		return nil, err
+	}
+	if ref.tag == nil {
+		return nil, nil
+	}
+	object, err := peelObject(ref.oid)
+	if err != nil {
+		return nil, err
+	}
+	peeled := &refInfo{name: ref.name, oid: object.Hash}
+	return peeled, peeled.load()
+}
+
+// refAtom is a "%(<name>[:<modifier>])" field of a ref format,
+// "%(*<name>)" for the object a tag points to
+type refAtom struct {
+	name     string
+	modifier string
+	deref    bool
+}
+
+// refFormatPart is either a literal or an atom of a ref format
+type refFormatPart struct {
+	literal string
+	atom    *refAtom
+}
+
+// atoms accepted in ref formats and sort keys
+var refAtoms = map[string]bool{
+	"refname": true, "objectname": true, "objecttype": true, "objectsize": true,
+	"tree": true, "parent": true, "HEAD": true, "symref": true, "upstream": true,
+	"subject": true, "body": true, "contents": true,
+	"author": true, "authorname": true, "authoremail": true, "authordate": true,
+	"committer": true, "committername": true, "committeremail": true, "committerdate": true,
+	"tagger": true, "taggername": true, "taggeremail": true, "taggerdate": true,
+	"creator": true, "creatordate": true,
+}
+
+func parseRefAtom(field string) (*refAtom, error) {
+	atom := &refAtom{}
+	field, atom.deref = strings.CutPrefix(field, "*")
+	atom.name, atom.modifier, _ = strings.Cut(field, ":")
+	if !refAtoms[atom.name] {
+		return nil, fmt.Errorf("unknown field name: %s", field)
+	}
+	return atom, nil
+}
+
+// parseRefFormat splits a format into literals and atoms, "%%" being a
+// literal '%' and "%xx" a byte in hexadecimal
+func parseRefFormat(format string) ([]refFormatPart, error) {
+	parts := []refFormatPart{}
+	literal := strings.Builder{}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			literal.WriteByte(format[i])
+			continue
+		}
+
+		switch next := format[i+1]; {
+		case next == '%':
+			literal.WriteByte('%')
+			i++
+		case next == '(':
+			end := strings.IndexByte(format[i:], ')')
+			if end < 0 {
+				return nil, fmt.Errorf("malformed format string %s", format)
+			}
+			atom, err := parseRefAtom(format[i+2 : i+end])
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, refFormatPart{literal: literal.String()}, refFormatPart{atom: atom})
+			literal.Reset()
+			i += end
+		default:
+			if i+2 < len(format) {
+				if b, err := strconv.ParseUint(format[i+1:i+3], 16, 8); err == nil {
+					literal.WriteByte(byte(b))
+					i += 2
+					continue
+				}
+			}
+			literal.WriteByte('%')
+		}
+	}
+	return append(parts, refFormatPart{literal: literal.String()}), nil
+}
+
+// refField is the value of an atom for a ref, numeric for dates and sizes
+// so that they sort as such
+type refField struct {
+	text    string
+	number  int64
+	numeric bool
+}
+
+// field returns the value of an atom for a ref
+func (ref *refInfo) field(atom *refAtom) (refField, error) {
+	switch atom.name {
+	case "refname":
+		name, err := formatRefName(ref.name, atom.modifier)
+		return refField{text: name}, err
+	case "HEAD":
+		head, err := resolveSymref("HEAD")
+		if err != nil || head != ref.name {
+			return refField{text: " "}, err
+		}
+		return refField{text: "*"}, nil
+	case "symref":
+		name, err := formatRefName(ref.symref, atom.modifier)
+		return refField{text: name}, err
+	case "upstream":
+		upstream, err := branchUpstream(ref.name)
+		if err != nil {
+			return refField{}, err
+		}
+		name, err := formatRefName(upstream, atom.modifier)
+		return refField{text: name}, err
+	}
+
+	target := ref
+	if atom.deref {
+		peeled, err := ref.peeled()
+		if err != nil || peeled == nil {
+			return refField{}, err
+		}
+		target = peeled
+	}
+	if err := target.load(); err != nil {
+		return refField{}, err
+	}
+	return target.objectField(atom)
+}
+
+// objectField returns the value of an atom describing the object
+// a ref points to
+func (ref *refInfo) objectField(atom *refAtom) (refField, error) {
+	commit, tag := ref.commit, ref.tag
+
+	switch atom.name {
+	case "objectname":
+		return refField{text: formatObjectName(ref.oid, atom.modifier)}, nil
+	case "objecttype":
+		return refField{text: string(ref.object.Type)}, nil
+	case "objectsize":
+		size := int64(len(ref.object.Content))
+		return refField{text: strconv.FormatInt(size, 10), number: size, numeric: true}, nil
+	case "tree":
+		if commit == nil {
+			return refField{}, nil
+		}
+		return refField{text: formatObjectName(commit.Tree, atom.modifier)}, nil
+	case "parent":
+		if commit == nil {
+			return refField{}, nil
+		}
+		parents := []string{}
+		for _, parent := range commit.Parents {
+			parents = append(parents, formatObjectName(parent, atom.modifier))
+		}
+		return refField{text: strings.Join(parents, " ")}, nil
+	}
+
+	message := ""
+	switch {
+	case commit != nil:
+		message = commit.Message
+	case tag != nil:
+		message = tag.Message
+	}
+	switch atom.name {
+	case "subject":
+		subject, _ := splitMessage(message)
+		return refField{text: subject}, nil
+	case "body":
+		_, body := splitMessage(message)
+		return refField{text: body}, nil
+	case "contents":
+		subject, body := splitMessage(message)
+		switch atom.modifier {
+		case "subject":
+			return refField{text: subject}, nil
+		case "body":
+			return refField{text: body}, nil
+		}
+		return refField{text: message}, nil
+	}
+
+	// identities: <role>, <role>name, <role>email, <role>date
+	var name, email, seconds, timeZone string
+	role := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(atom.name, "name"), "email"), "date")
+	switch {
+	case commit != nil && (role == "author"):
+		name, email = commit.AuthorName, commit.AuthorEmail
+		seconds, timeZone = commit.AuthorDateSeconds, commit.AuthorDateTimeZone
+	case commit != nil && (role == "committer" || role == "creator"):
+		name, email = commit.CommitterName, commit.CommitterEmail
+		seconds, timeZone = commit.CommitterDateSeconds, commit.CommitterDateTimeZone
+	case tag != nil && (role == "tagger" || role == "creator"):
+		name, email = tag.TaggerName, tag.TaggerEmail
+		seconds, timeZone = tag.TaggerDateSeconds, tag.TaggerDateTimeZone
+	default:
+		return refField{}, nil
+	}
+
+	switch strings.TrimPrefix(atom.name, role) {
+	case "name":
+		return refField{text: name}, nil
+	case "email":
+		return refField{text: "<" + email + ">"}, nil
+	case "date":
+		date, err := parseObjectDate(seconds, timeZone)
+		if err != nil {
+			return refField{}, err
+		}
+		text, err := formatRefDate(date, seconds, timeZone, atom.modifier)
+		return refField{text: text, number: date.Unix(), numeric: true}, err
+	}
+	return refField{text: fmt.Sprintf("%s <%s> %s %s", name, email, seconds, timeZone)}, nil
+}
+
+// splitMessage splits a commit or tag message into its subject, the
+// first paragraph on one line, and its body
+func splitMessage(message string) (string, string) {
+	message = strings.TrimLeft(message, "\n")
+	subject, body, _ := strings.Cut(message, "\n\n")
+	subject = strings.Join(strings.Fields(strings.ReplaceAll(subject, "\n", " ")), " ")
+	return subject, strings.TrimLeft(body, "\n")
+}
+
+// formatRefName applies the modifiers short, lstrip=<n> and rstrip=<n>
+// to a ref name
+func formatRefName(refName string, modifier string) (string, error) {
+	if refName == "" || modifier == "" {
+		return refName, nil
+	}
+	if modifier == "short" {
+		return shortRefName(refName)
+	}
+
+	option, value, _ := strings.Cut(modifier, "=")
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return "", fmt.Errorf("unrecognized %%(refname) argument: %s", modifier)
+	}
+	components := strings.Split(refName, "/")
+	// a negative count is the number of components kept
+	if n < 0 {
+		n = max(len(components)+n, 0)
+	}
+	n = min(n, len(components))
+	switch option {
+	case "lstrip", "strip":
+		return strings.Join(components[n:], "/"), nil
+	case "rstrip":
+		return strings.Join(components[:len(components)-n], "/"), nil
+	}
+	return "", fmt.Errorf("unrecognized %%(refname) argument: %s", modifier)
+}
+
+// formatObjectName applies the modifiers short and short=<n> to an
+// object ID
+func formatObjectName(oid string, modifier string) string {
+	length, found := strings.CutPrefix(modifier, "short")
+	if !found {
+		return oid
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(length, "="))
+	if err != nil {
+		n = DefaultAbbrev
+	}
+	return shortestUniqueAbbrev(oid, max(n, minAbbrev))
+}
+
+// formatRefDate formats a date as git does, in the timezone it was
+// recorded in
+func formatRefDate(date time.Time, seconds string, timeZone string, modifier string) (string, error) {
+	switch modifier {
+	case "":
+		return date.Format("Mon Jan 2 15:04:05 2006 -0700"), nil
+	case "unix":
+		return seconds, nil
+	case "raw":
+		return seconds + " " + timeZone, nil
+	case "iso", "iso8601":
+		return date.Format("2006-01-02 15:04:05 -0700"), nil
+	case "iso-strict", "iso8601-strict":
+		return date.Format(time.RFC3339), nil
+	case "rfc", "rfc2822":
+		return date.Format("Mon, 2 Jan 2006 15:04:05 -0700"), nil
+	case "short":
+		return date.Format("2006-01-02"), nil
+	}
+	return "", fmt.Errorf("unknown date format %s", modifier)
+}
+
+// branchUpstream returns the remote-tracking branch a branch tracks,
+// from the branch.<name>.remote and branch.<name>.merge configuration
+// mapped by the fetch refspec of the remote
+func branchUpstream(refName string) (string, error) {
+	branch, found := strings.CutPrefix(refName, headsPrefix)
+	if !found {
+		return "", nil
+	}
+	remote, err := readConfig("branch." + branch + ".remote")
+	if err != nil || remote == "" {
+		return "", err
+	}
+	merge, err := readConfig("branch." + branch + ".merge")
+	if err != nil || merge == "" {
+		return "", err
+	}
+	// a local branch
+	if remote == "." {
+		return merge, nil
+	}
+
+	refspec, err := readConfig("remote." + remote + ".fetch")
+	if err != nil {
+		return "", err
+	}
+	return mapRefspec(strings.TrimPrefix(refspec, "+"), merge), nil
+}
+
+// mapRefspec maps a remote ref name to the local ref a "<src>:<dst>"
+// refspec stores it in, empty when the refspec does not match
+func mapRefspec(refspec string, refName string) string {
+	src, dst, found := strings.Cut(refspec, ":")
+	if !found {
+		return ""
+	}
+	srcPrefix, srcSuffix, glob := strings.Cut(src, "*")
+	if !glob {
+		if src == refName {
+			return dst
+		}
+		return ""
+	}
+	if !strings.HasPrefix(refName, srcPrefix) || !strings.HasSuffix(refName, srcSuffix) ||
+		len(refName) < len(srcPrefix)+len(srcSuffix) {
+		return ""
+	}
+	matched := refName[len(srcPrefix) : len(refName)-len(srcSuffix)]
+	return strings.Replace(dst, "*", matched, 1)
+}
+
+// refMatchesPattern checks a ref name against a for-each-ref pattern,
+// a glob or a prefix ending at a '/'
+func refMatchesPattern(refName string, pattern string) bool {
+	if strings.ContainsAny(pattern, "*?[") {
+		matched, _ := path.Match(pattern, refName)
+		return matched
+	}
+	return refName == pattern || strings.HasPrefix(refName, strings.TrimSuffix(pattern, "/")+"/")
+}
+
+type ForEachRefOptions struct {
+	Format string
+	// sort keys, atoms optionally prefixed by '-' for descending order,
+	// the last one being the primary key
+	Sort []string
+	// maximum number of refs shown, 0 for all
+	Count int
+	// only show the refs pointing to this object, directly or through tags
+	PointsAt string
+}
+
+// ForEachRef prints the refs matching one of the patterns, all of them
+// without pattern, with the given format
+func ForEachRef(patterns []string, options *ForEachRefOptions) error {
+	format := options.Format
+	if format == "" {
+		format = DefaultRefFormat
+	}
+	parts, err := parseRefFormat(format)
+	if err != nil {
+		return err
+	}
+
+	type sortKey struct {
+		atom    *refAtom
+		reverse bool
+	}
+	keys := []sortKey{}
+	for _, key := range options.Sort {
+		field, reverse := strings.CutPrefix(key, "-")
+		atom, err := parseRefAtom(field)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, sortKey{atom: atom, reverse: reverse})
+	}
+
+	pointsAt := ""
+	if options.PointsAt != "" {
+		if pointsAt, err = resolveRevision(options.PointsAt); err != nil {
+			return fmt.Errorf("malformed object name %s", options.PointsAt)
+		}
+	}
+
+	allRefs, err := localRefs()
+	if err != nil {
+		return err
+	}
+	refs := []*refInfo{}
+	for _, ref := range allRefs {
+		matched := len(patterns) == 0
+		for _, pattern := range patterns {
+			matched = matched || refMatchesPattern(ref.name, pattern)
+		}
+		if !matched {
+			continue
+		}
+		if pointsAt != "" && ref.oid != pointsAt {
+			peeled, err := ref.peeled()
+			if err != nil {
+				return err
+			}
+			if peeled == nil || peeled.oid != pointsAt {
+				continue
+			}
+		}
+		refs = append(refs, ref)
+	}
+
+	// fields of the sort keys, per ref
+	values := map[*refInfo][]refField{}
+	for _, ref := range refs {
+		for _, key := range keys {
+			value, err := ref.field(key.atom)
+			if err != nil {
+				return err
+			}
+			values[ref] = append(values[ref], value)
+		}
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		for k := len(keys) - 1; k >= 0; k-- {
+			a, b := values[refs[i]][k], values[refs[j]][k]
+			if keys[k].reverse {
+				a, b = b, a
+			}
+			if a.numeric && b.numeric && a.number != b.number {
+				return a.number < b.number
+			}
+			if !(a.numeric && b.numeric) && a.text != b.text {
+				return a.text < b.text
+			}
+		}
+		return refs[i].name < refs[j].name
+	})
+
+	if options.Count > 0 && len(refs) > options.Count {
+		refs = refs[:options.Count]
+	}
+
+	for _, ref := range refs {
+		line := strings.Builder{}
+		for _, part := range parts {
+			if part.atom == nil {
+				line.WriteString(part.literal)
+				continue
+			}
+			value, err := ref.field(part.atom)
+			if err != nil {
+				return err
+			}
+			line.WriteString(value.text)
+		}
+		fmt.Println(line.String())
+	}
+	return nil
+}
@@ -0,0 +1,421 @@
+package mygit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type FsckOptions struct {
+	// do not report dangling objects
+	NoDangling bool
+	// report every unreachable object rather than dangling ones only
+	Unreachable bool
+}
+
+// fsckObject is an object found in the object store, and the objects
+// it points to
+type fsckObject struct {
+	objectType ObjectType
+	links      []fsckLink
+}
+
+type fsckLink struct {
+	oid        string
+	objectType ObjectType
+}
+
+type fsckChecker struct {
+	objects map[string]*fsckObject
+	errors  int
+}
+
+// Fsck verifies the connectivity and validity of every loose and packed
+// object, reporting problems in git's format
+func Fsck(options *FsckOptions) error {
+	checker := &fsckChecker{objects: map[string]*fsckObject{}}
+
+	// loose objects, NewObject checks the header and the hash
+	oids, err := looseObjects()
+	if err != nil {
+		return err
+	}
+	for _, oid := range oids {
+		object, err := NewObject(oid)
+		if err != nil {
+			checker.errorf("%s: object corrupt or missing: %s", getObjectPath(oid), err)
+			continue
+		}
+		checker.checkObject(object)
+	}
+
+	// packed objects, every entry is resolved and hashed
+	for _, p := range getPacks() {
+		packFile, err := os.ReadFile(p.packPath)
+		if err != nil {
+			return err
+		}
+		entries, err := indexPackFile(packFile)
+		if err != nil {
+			checker.errorf("%s: %s", p.packPath, err)
+			continue
+		}
+		if err := verifyPackIndex(p.index, packFile, entries); err != nil {
+			checker.errorf("%s: %s", p.packPath, err)
+			continue
+		}
+		for _, entry := range entries {
+			checker.checkObject(&Object{
+				Type:      ObjectType(PackFileObjectTypeString[entry.contentType]),
+				Size:      len(entry.content),
+				Path:      p.packPath,
+				Content:   entry.content,
+				Hash:      entry.hash,
+				HashBytes: entry.hashBytes,
+			})
+		}
+	}
+
+	roots, err := rootObjects()
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		if _, ok := checker.objects[root.oid]; !ok {
+			checker.errorf("%s: invalid sha1 pointer %s", root.name, root.oid)
+		}
+	}
+
+	sortedOIDs := make([]string, 0, len(checker.objects))
+	for oid := range checker.objects {
+		sortedOIDs = append(sortedOIDs, oid)
+	}
+	sort.Strings(sortedOIDs)
+
+	// connectivity
+	referenced := map[string]bool{}
+	missing := map[string]ObjectType{}
+	for _, oid := range sortedOIDs {
+		object := checker.objects[oid]
+		for _, link := range object.links {
+			referenced[link.oid] = true
+			if _, ok := checker.objects[link.oid]; ok {
+				continue
+			}
+			fmt.Printf("broken link from %7s %s\n", object.objectType, oid)
+			fmt.Printf("              to %7s %s\n", link.objectType, link.oid)
+			missing[link.oid] = link.objectType
+		}
+	}
+	missingOIDs := make([]string, 0, len(missing))
+	for oid := range missing {
+		missingOIDs = append(missingOIDs, oid)
+	}
+	sort.Strings(missingOIDs)
+	for _, oid := range missingOIDs {
+		fmt.Printf("missing %s %s\n", missing[oid], oid)
+		checker.errors++
+	}
+
+	// reachability
+	reachable := map[string]bool{}
+	queue := rootObjectIDs(roots)
+	for len(queue) > 0 {
+		oid := queue[0]
+		queue = queue[1:]
+		object, ok := checker.objects[oid]
+		if !ok || reachable[oid] {
+			continue
+		}
+		reachable[oid] = true
+		for _, link := range object.links {
+			queue = append(queue, link.oid)
+		}
+	}
+
+	// dangling objects are unreachable objects no other object points to
+	for _, oid := range sortedOIDs {
+		if reachable[oid] {
+			continue
+		}
+		objectType := checker.objects[oid].objectType
+		if options.Unreachable {
+			fmt.Printf("unreachable %s %s\n", objectType, oid)
+		} else if !referenced[oid] && !options.NoDangling {
+			fmt.Printf("dangling %s %s\n", objectType, oid)
+		}
+	}
+
+	if checker.errors > 0 {
+		return fmt.Errorf("fsck found %d errors", checker.errors)
+	}
+	return nil
+}
+
+func (checker *fsckChecker) errorf(format string, args ...any) {
+	checker.errors++
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+}
+
+// objectError reports a problem of an object, with the fsck message ID
+func (checker *fsckChecker) objectError(object *Object, messageID string, description string) {
+	checker.errors++
+	fmt.Fprintf(os.Stderr, "error in %s %s: %s: %s\n", object.Type, object.Hash, messageID, description)
+}
+
+// objectWarning reports a suspicious but harmless object property
+func (checker *fsckChecker) objectWarning(object *Object, messageID string, description string) {
+	fmt.Fprintf(os.Stderr, "warning in %s %s: %s: %s\n", object.Type, object.Hash, messageID, description)
+}
+
+// checkObject validates an object and records its links
+func (checker *fsckChecker) checkObject(object *Object) {
+	if _, ok := checker.objects[object.Hash]; ok {
+		// packed and loose, or in several packfiles
+		return
+	}
+
+	fsckObject := &fsckObject{objectType: object.Type}
+	checker.objects[object.Hash] = fsckObject
+
+	switch object.Type {
+	case ObjectTypeBlob:
+	case ObjectTypeTree:
+		fsckObject.links = checker.checkTree(object)
+	case ObjectTypeCommit:
+		fsckObject.links = checker.checkCommit(object)
+	case ObjectTypeTag:
+		fsckObject.links = checker.checkTag(object)
+	default:
+		checker.objectError(object, "badType", fmt.Sprintf("unknown object type '%s'", object.Type))
+	}
+}
+
+var validTreeModes = map[string]bool{
+	"100644": true,
+	"100755": true,
+	"100664": true,
+	"120000": true,
+	"40000":  true,
+	"160000": true,
+}
+
+func (checker *fsckChecker) checkTree(object *Object) []fsckLink {
+	links := []fsckLink{}
+	names := map[string]bool{}
+	var previous *TreeEntry
+	zeroPadded, badMode, badName := false, false, ""
+
+	content := object.Content
+	for len(content) > 0 {
+		nul := bytes.IndexByte(content, 0)
+		if nul < 0 || nul+21 > len(content) {
+			checker.objectError(object, "badTree", "cannot be parsed as a tree")
+			return links
+		}
+		mode, name, found := strings.Cut(string(content[:nul]), " ")
+		if !found {
+			checker.objectError(object, "badTree", "cannot be parsed as a tree")
+			return links
+		}
+		hash := fmt.Sprintf("%x", content[nul+1:nul+21])
+		content = content[nul+21:]
+
+		if strings.HasPrefix(mode, "0") {
+			zeroPadded = true
+			mode = strings.TrimLeft(mode, "0")
+		}
+		if !validTreeModes[mode] {
+			badMode = true
+		}
+
+		switch {
+		case name == "":
+			badName = "emptyName: contains empty pathname"
+		case strings.Contains(name, "/"):
+			badName = "fullPathname: contains full pathnames"
+		case name == ".":
+			badName = "hasDot: contains '.'"
+		case name == "..":
+			badName = "hasDotdot: contains '..'"
+		case strings.EqualFold(name, ".git"):
+			badName = "hasDotgit: contains '.git'"
+		}
+
+		entry := &TreeEntry{Mode: mode, Type: ObjectTypeBlob, Hash: hash, Name: name}
+		if mode == "40000" {
+			entry.Type = ObjectTypeTree
+		}
+
+		if names[name] {
+			checker.objectError(object, "duplicateEntries", "contains duplicate file entries")
+		} else if previous != nil && !treeEntryLess(previous, entry) {
+			checker.objectError(object, "treeNotSorted", "not properly sorted")
+		}
+		names[name] = true
+		previous = entry
+
+		// submodule commits live in another repository
+		if mode != "160000" {
+			links = append(links, fsckLink{oid: hash, objectType: entry.Type})
+		}
+	}
+
+	if zeroPadded {
+		checker.objectWarning(object, "zeroPaddedFilemode", "contains zero-padded file modes")
+	}
+	if badMode {
+		checker.objectWarning(object, "badFilemode", "contains bad file modes")
+	}
+	if badName != "" {
+		messageID, description, _ := strings.Cut(badName, ": ")
+		checker.objectWarning(object, messageID, description)
+	}
+
+	return links
+}
+
+// {name} <{email}> {date_seconds} {date_timezone}
+var identRegex = regexp.MustCompile(`^([^<>]*) <([^<>]*)> (\S+) (\S+)$`)
+var timezoneRegex = regexp.MustCompile(`^[+-]\d{4}$`)
+
+// checkIdent validates an author, committer or tagger line value
+func (checker *fsckChecker) checkIdent(object *Object, ident string) bool {
+	matches := identRegex.FindStringSubmatch(ident)
+	if matches == nil {
+		if !strings.Contains(ident, "<") {
+			checker.objectError(object, "missingEmail", "invalid author/committer line - missing email")
+		} else {
+			checker.objectError(object, "badEmail", "invalid author/committer line - bad email")
+		}
+		return false
+	}
+	if strings.Trim(matches[3], "0123456789") != "" {
+		checker.objectError(object, "badDate", "invalid author/committer line - bad date")
+		return false
+	}
+	if !timezoneRegex.MatchString(matches[4]) {
+		checker.objectError(object, "badTimezone", "invalid author/committer line - bad time zone")
+		return false
+	}
+	return true
+}
+
+// objectHeaderLines returns the header lines of a commit or tag object,
+// continuation lines (starting with a space) are skipped
+func objectHeaderLines(content []byte) []string {
+	header, _, _ := bytes.Cut(content, []byte("\n\n"))
+	lines := []string{}
+	for _, line := range strings.Split(string(header), "\n") {
+		if !strings.HasPrefix(line, " ") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func (checker *fsckChecker) checkCommit(object *Object) []fsckLink {
+	links := []fsckLink{}
+	lines := objectHeaderLines(object.Content)
+
+	next := func(prefix string) (string, bool) {
+		if len(lines) == 0 || !strings.HasPrefix(lines[0], prefix) {
+			return "", false
+		}
+		value := strings.TrimPrefix(lines[0], prefix)
+		lines = lines[1:]
+		return value, true
+	}
+
+	tree, ok := next("tree ")
+	if !ok {
+		checker.objectError(object, "missingTree", "invalid format - expected 'tree' line")
+		return links
+	}
+	if len(tree) != 40 || !isHex(tree) {
+		checker.objectError(object, "badTreeSha1", "invalid 'tree' line format - bad sha1")
+		return links
+	}
+	links = append(links, fsckLink{oid: tree, objectType: ObjectTypeTree})
+
+	for {
+		parent, ok := next("parent ")
+		if !ok {
+			break
+		}
+		if len(parent) != 40 || !isHex(parent) {
+			checker.objectError(object, "badParentSha1", "invalid 'parent' line format - bad sha1")
+			return links
+		}
+		links = append(links, fsckLink{oid: parent, objectType: ObjectTypeCommit})
+	}
+
+	author, ok := next("author ")
+	if !ok {
+		checker.objectError(object, "missingAuthor", "invalid format - expected 'author' line")
+		return links
+	}
+	if !checker.checkIdent(object, author) {
+		return links
+	}
+
+	committer, ok := next("committer ")
+	if !ok {
+		checker.objectError(object, "missingCommitter", "invalid format - expected 'committer' line")
+		return links
+	}
+	checker.checkIdent(object, committer)
+
+	return links
+}
+
+func (checker *fsckChecker) checkTag(object *Object) []fsckLink {
+	links := []fsckLink{}
+	lines := objectHeaderLines(object.Content)
+
+	next := func(prefix string) (string, bool) {
+		if len(lines) == 0 || !strings.HasPrefix(lines[0], prefix) {
+			return "", false
+		}
+		value := strings.TrimPrefix(lines[0], prefix)
+		lines = lines[1:]
+		return value, true
+	}
+
+	target, ok := next("object ")
+	if !ok {
+		checker.objectError(object, "missingObject", "invalid format - expected 'object' line")
+		return links
+	}
+	if len(target) != 40 || !isHex(target) {
+		checker.objectError(object, "badObjectSha1", "invalid 'object' line format - bad sha1")
+		return links
+	}
+
+	targetType, ok := next("type ")
+	if !ok {
+		checker.objectError(object, "missingTypeEntry", "invalid format - expected 'type' line")
+		return links
+	}
+	switch ObjectType(targetType) {
+	case ObjectTypeBlob, ObjectTypeTree, ObjectTypeCommit, ObjectTypeTag:
+	default:
+		checker.objectError(object, "badType", "invalid 'type' value")
+		return links
+	}
+	links = append(links, fsckLink{oid: target, objectType: ObjectType(targetType)})
+
+	if _, ok := next("tag "); !ok {
+		checker.objectError(object, "missingTagEntry", "invalid format - expected 'tag' line")
+		return links
+	}
+
+	if tagger, ok := next("tagger "); ok {
+		checker.checkIdent(object, tagger)
+	}
+
+	return links
+}
@@ -0,0 +1,223 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type RepackOptions struct {
+	// pack every reachable object, including already packed ones,
+	// into a single packfile
+	All bool
+	// remove the packfiles and loose objects made redundant
+	Delete bool
+	// write unreachable objects of the removed packfiles as loose objects
+	// instead of losing them, so that they can expire later
+	KeepUnreachable bool
+	Window          int
+	Depth           int
+}
+
+// Gc packs the refs and every reachable object into a single packfile
+// and removes the now redundant packfiles and loose objects
+func Gc() error {
+	if err := PackRefs(&PackRefsOptions{All: true}); err != nil {
+		return err
+	}
+	return Repack(&RepackOptions{
+		All:             true,
+		Delete:          true,
+		KeepUnreachable: true,
+		Window:          DefaultPackWindow,
+		Depth:           DefaultPackDepth,
+	})
+}
+
+// Repack packs the reachable objects into a new packfile, either the
+// loose ones only or every one of them
+func Repack(options *RepackOptions) error {
+	roots, err := rootObjects()
+	if err != nil {
+		return err
+	}
+
+	reachable, err := reachableObjects(rootObjectIDs(roots))
+	if err != nil {
+		return err
+	}
+
+	oldPacks := getPacks()
+
+	inputs := reachable
+	if !options.All {
+		inputs = []packObjectInput{}
+		for _, input := range reachable {
+			if _, _, packed := findPackedObject(input.hash); !packed {
+				inputs = append(inputs, input)
+			}
+		}
+	}
+
+	if len(inputs) == 0 {
+		fmt.Println("Nothing new to pack.")
+		return nil
+	}
+
+	packOptions := PackObjectsOptions{
+		Window:          options.Window,
+		Depth:           options.Depth,
+		DeltaBaseOffset: true,
+	}
+	checksum, err := writePackFiles(path.Join(packDirectory, "pack"), inputs, &packOptions)
+	if err != nil {
+		return err
+	}
+	newPackPath := path.Join(packDirectory, "pack-"+checksum+".pack")
+
+	if options.All && options.Delete {
+		if options.KeepUnreachable {
+			err := explodeUnreachable(oldPacks, reachable)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, p := range oldPacks {
+			if p.packPath == newPackPath {
+				continue
+			}
+			if err := removePack(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	reloadPacks()
+
+	if options.Delete {
+		return prunePacked()
+	}
+
+	return nil
+}
+
+// explodeUnreachable writes the unreachable objects of the given packfiles
+// as loose objects
+func explodeUnreachable(packs []*pack, reachable []packObjectInput) error {
+	reachableSet := make(map[string]bool, len(reachable))
+	for _, input := range reachable {
+		reachableSet[input.hash] = true
+	}
+
+	for _, p := range packs {
+		// exploded objects get the age of their packfile
+		packInfo, err := os.Stat(p.packPath)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < p.index.count(); i++ {
+			hash := fmt.Sprintf("%x", p.index.hash(i))
+			if reachableSet[hash] {
+				continue
+			}
+
+			objectType, content, err := p.readObject(p.index.offset(i))
+			if err != nil {
+				return err
+			}
+			header := fmt.Sprintf("%s %d\x00", PackFileObjectTypeString[objectType], len(content))
+			err = writeLooseObject(hash, []byte(header), content)
+			if err != nil {
+				return err
+			}
+			err = os.Chtimes(getObjectPath(hash), packInfo.ModTime(), packInfo.ModTime())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeLooseObject writes an object as a loose object, even if it is packed
+func writeLooseObject(sha string, header []byte, content []byte) error {
+	if _, err := os.Stat(getObjectPath(sha)); err == nil {
+		return nil
+	}
+	return writeAnyObject(sha, append(header, content...))
+}
+
+// removePack removes a packfile along with its index
+func removePack(p *pack) error {
+	if p.file != nil {
+		p.file.Close()
+		p.file = nil
+	}
+
+	// the index goes first so that readers never see a packfile
+	// without its content
+	indexPath := strings.TrimSuffix(p.packPath, ".pack") + ".idx"
+	if err := os.Remove(indexPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(p.packPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// looseObjects lists the object IDs of every loose object
+func looseObjects() ([]string, error) {
+	objects := []string{}
+
+	dirs, err := filepath.Glob(".git/objects/[0-9a-f][0-9a-f]")
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		dirEntries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, dirEntry := range dirEntries {
+			oid := filepath.Base(dir) + dirEntry.Name()
+			if len(oid) != 40 || !isHex(oid) {
+				continue
+			}
+			objects = append(objects, oid)
+		}
+	}
+
+	return objects, nil
+}
+
+func isHex(s string) bool {
+	return strings.Trim(s, "0123456789abcdef") == ""
+}
+
+// prunePacked removes the loose objects that are also packed
+func prunePacked() error {
+	objects, err := looseObjects()
+	if err != nil {
+		return err
+	}
+
+	for _, oid := range objects {
+		if _, _, packed := findPackedObject(oid); !packed {
+			continue
+		}
+		objectPath := getObjectPath(oid)
+		if err := os.Remove(objectPath); err != nil {
+			return err
+		}
+		// remove the fan-out directory once empty
+		os.Remove(filepath.Dir(objectPath))
+	}
+
+	return nil
+}
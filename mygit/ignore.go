@@ -0,0 +1,267 @@
+package mygit
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// file of the repository wide ignore patterns
+const infoExcludePath = ".git/info/exclude"
+
+// ignorePattern is a line of an ignore file, see gitignore
+type ignorePattern struct {
+	// the line as written, trailing spaces aside
+	text string
+	glob *regexp.Regexp
+	// "!<pattern>", includes again what an earlier pattern ignores
+	negated bool
+	// "<pattern>/", only matches directories
+	dirOnly bool
+	// a pattern with a '/' matches paths from the directory of its file,
+	// others match file names
+	anchored bool
+
+	// directory of the .gitignore file of the pattern, empty for the root
+	// and the repository wide files
+	base string
+	// file and line number of the pattern
+	source string
+	line   int
+}
+
+// ignoreRules are the ignore patterns of a repository, from the least to
+// the most important one: core.excludesFile, .git/info/exclude, then the
+// .gitignore files, a directory's one after the one of its parent
+type ignoreRules struct {
+	patterns []*ignorePattern
+	// directories whose .gitignore has been read
+	loaded map[string]bool
+}
+
+// loadIgnoreRules reads the repository wide ignore files, the .gitignore
+// files being read as their directory is looked into
+func loadIgnoreRules() (*ignoreRules, error) {
+	rules := &ignoreRules{loaded: map[string]bool{}}
+	excludesFile, err := globalExcludesFile()
+	if err != nil {
+		return nil, err
+	}
+	for _, filePath := range []string{excludesFile, infoExcludePath} {
+		if err := rules.readFile(filePath, ""); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// globalExcludesFile returns the ignore file of the user: core.excludesFile,
+// by default $XDG_CONFIG_HOME/git/ignore or ~/.config/git/ignore
+func globalExcludesFile() (string, error) {
+	excludesFile, err := readConfig("core.excludesFile")
+	if err != nil {
+		return "", err
+	}
+	home, _ := os.UserHomeDir()
+	if excludesFile != "" {
+		if rest, found := strings.CutPrefix(excludesFile, "~/"); found && home != "" {
+			excludesFile = filepath.Join(home, rest)
+		}
+		return excludesFile, nil
+	}
+
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "git", "ignore"), nil
+	}
+	if home == "" {
+		return "", nil
+	}
+	return filepath.Join(home, ".config", "git", "ignore"), nil
+}
+
+// loadDir reads the .gitignore file of a directory, "" for the root,
+// unless it has already been read
+func (rules *ignoreRules) loadDir(dir string) error {
+	if rules.loaded[dir] {
+		return nil
+	}
+	rules.loaded[dir] = true
+	return rules.readFile(path.Join(dir, ".gitignore"), dir)
+}
+
+// readFile adds the patterns of an ignore file, if it exists, base being
+// the directory the patterns are relative to
+func (rules *ignoreRules) readFile(filePath string, base string) error {
+	if filePath == "" {
+		return nil
+	}
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := parseIgnorePattern(scanner.Text())
+		if pattern == nil {
+			continue
+		}
+		pattern.base = base
+		pattern.source = filePath
+		pattern.line = line
+		rules.patterns = append(rules.patterns, pattern)
+	}
+	return scanner.Err()
+}
+
+// parseIgnorePattern parses a line of an ignore file, nil for a blank line
+// or a comment
+func parseIgnorePattern(line string) *ignorePattern {
+	// trailing spaces are ignored unless escaped
+	trimmed := strings.TrimRight(line, " ")
+	if strings.HasSuffix(trimmed, "\\") && len(trimmed) < len(line) {
+		trimmed += " "
+	}
+	line = trimmed
+	if line == "" || line[0] == '#' {
+		return nil
+	}
+
+	pattern := &ignorePattern{text: line}
+	if line[0] == '!' {
+		pattern.negated = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		pattern.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+	pattern.glob = ignoreRegexp(line)
+	return pattern
+}
+
+// ignoreRegexp converts an ignore pattern to a regular expression matching
+// whole paths: '*' and '?' do not match '/', "**/" matches any number of
+// directories and a trailing "/**" everything in a directory
+func ignoreRegexp(pattern string) *regexp.Regexp {
+	expression := strings.Builder{}
+	expression.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**") && (i == 0 || pattern[i-1] == '/') &&
+			(i+2 == len(pattern) || pattern[i+2] == '/'):
+			if i+2 == len(pattern) {
+				expression.WriteString(".*")
+				i++
+			} else {
+				expression.WriteString("(?:.*/)?")
+				i += 2
+			}
+		case c == '*':
+			expression.WriteString("[^/]*")
+		case c == '?':
+			expression.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expression.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expression.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expression.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expression.WriteString("$")
+	matcher, err := regexp.Compile(expression.String())
+	if err != nil {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "$")
+	}
+	return matcher
+}
+
+// matches checks a path, relative to the root, against the pattern
+func (pattern *ignorePattern) matches(filePath string, isDir bool) bool {
+	if pattern.dirOnly && !isDir {
+		return false
+	}
+	name := filePath
+	if pattern.base != "" {
+		relative, found := strings.CutPrefix(filePath, pattern.base+"/")
+		if !found {
+			return false
+		}
+		name = relative
+	}
+	if !pattern.anchored {
+		name = path.Base(name)
+	}
+	return pattern.glob.MatchString(name)
+}
+
+// excludes checks whether a matching pattern ignores the path, nil
+// meaning no pattern matched
+func (pattern *ignorePattern) excludes() bool {
+	return pattern != nil && !pattern.negated
+}
+
+// find returns the pattern deciding whether a path is ignored, nil for
+// none: the pattern ignoring one of its directories, otherwise the last
+// pattern matching it
+func (rules *ignoreRules) find(filePath string, isDir bool) (*ignorePattern, error) {
+	if err := rules.loadDir(""); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(filePath, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		if pattern := rules.match(dir, true); pattern.excludes() {
+			return pattern, nil
+		}
+		if err := rules.loadDir(dir); err != nil {
+			return nil, err
+		}
+	}
+	return rules.match(filePath, isDir), nil
+}
+
+// ignored checks whether a path is ignored, by itself or by one of its
+// directories
+func (rules *ignoreRules) ignored(filePath string, isDir bool) (bool, error) {
+	pattern, err := rules.find(filePath, isDir)
+	return pattern.excludes(), err
+}
+
+// match returns the last pattern matching a path, without looking at its
+// directories, only the .gitignore files already read counting
+func (rules *ignoreRules) match(filePath string, isDir bool) *ignorePattern {
+	for i := len(rules.patterns) - 1; i >= 0; i-- {
+		if rules.patterns[i].matches(filePath, isDir) {
+			return rules.patterns[i]
+		}
+	}
+	return nil
+}
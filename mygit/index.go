@@ -0,0 +1,581 @@
+package mygit
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Index (.git/index) format, versions 2 to 4, see `man gitformat-index`:
+//
+//	┌────────────────────────────────────────────────────────────────┐
+//	│ signature "DIRC" | version | number of entries                 │
+//	│ entries, sorted by path then stage:                            │
+//	│   ctime | mtime (seconds, nanoseconds)                         │
+//	│   dev | ino | mode | uid | gid | size (4 bytes each)           │
+//	│   object ID (20 bytes) | flags (2 bytes)                       │
+//	│   extended flags (2 bytes, version 3 and later, if flagged)    │
+//	│   path, NUL terminated and NUL padded to a multiple of 8 bytes │
+//	│   (version 4: path prefix compressed, no padding)              │
+//	│ extensions: signature | size | data                            │
+//	│ checksum: SHA-1 of everything above                            │
+//	└────────────────────────────────────────────────────────────────┘
+var indexSignature = []byte("DIRC")
+
+const indexFilePath = ".git/index"
+
+const (
+	defaultIndexVersion = 2
+	minIndexVersion     = 2
+	maxIndexVersion     = 4
+)
+
+// flags of an index entry
+const (
+	indexFlagAssumeValid = 0x8000
+	indexFlagExtended    = 0x4000
+	indexFlagStageMask   = 0x3000
+	indexFlagStageShift  = 12
+	indexFlagNameMask    = 0x0fff
+	// extended flags, version 3 and later
+	indexFlagSkipWorktree = 0x4000
+	indexFlagIntentToAdd  = 0x2000
+)
+
+// size of an index entry up to its path, without extended flags
+const indexEntryFixedSize = 62
+
+// indexEntry is a file of the index, along with the stat data of the
+// working tree file it was last seen as
+type indexEntry struct {
+	ctimeSeconds     uint32
+	ctimeNanoseconds uint32
+	mtimeSeconds     uint32
+	mtimeNanoseconds uint32
+	dev              uint32
+	ino              uint32
+	// object type and permissions: 0100644, 0100755, 0120000 or 0160000
+	mode uint32
+	uid  uint32
+	gid  uint32
+	// size of the working tree file, truncated to 32 bits
+	size uint32
+	oid  string
+	// assume-valid flag and stage, the name length is computed when written
+	flags uint16
+	// skip-worktree and intent-to-add flags
+	extendedFlags uint16
+	path          string
+}
+
+// stage returns the merge stage of an entry, 0 for a merged entry
+func (entry *indexEntry) stage() int {
+	return int(entry.flags&indexFlagStageMask) >> indexFlagStageShift
+}
+
+// treeMode returns the mode of an entry as written in tree objects
+func (entry *indexEntry) treeMode() string {
+	return strconv.FormatUint(uint64(entry.mode), 8)
+}
+
+// stagingIndex is an in-memory .git/index file
+type stagingIndex struct {
+	version uint32
+	entries []*indexEntry
+	// modification time of the index file: an entry modified at the same
+	// time may have changed after it was recorded, and is not trusted
+	timestamp time.Time
+}
+
+// newStagingIndex returns an empty index, of the version set by the
+// index.version configuration if any
+func newStagingIndex() (*stagingIndex, error) {
+	version := uint32(defaultIndexVersion)
+	value, err := readConfig("index.version")
+	if err != nil {
+		return nil, err
+	}
+	if value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < minIndexVersion || n > maxIndexVersion {
+			fmt.Fprintf(os.Stderr, "warning: index.version set, but the value is invalid.\n"+
+				"Using version %d\n", defaultIndexVersion)
+		} else {
+			version = uint32(n)
+		}
+	}
+	return &stagingIndex{version: version}, nil
+}
+
+// readIndex reads .git/index, an empty index if there is none
+func readIndex() (*stagingIndex, error) {
+	data, err := os.ReadFile(indexFilePath)
+	if os.IsNotExist(err) {
+		return newStagingIndex()
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(indexFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := parseIndex(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", indexFilePath, err)
+	}
+	index.timestamp = info.ModTime()
+	return index, nil
+}
+
+// lockIndex takes the lock of the index and reads it, the new index is
+// written to the lock with writeIndex
+func lockIndex() (*lockFile, *stagingIndex, error) {
+	lock, err := lockPath(indexFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	index, err := readIndex()
+	if err != nil {
+		lock.rollback()
+		return nil, nil, err
+	}
+	return lock, index, nil
+}
+
+func parseIndex(data []byte) (*stagingIndex, error) {
+	const headerSize = 12
+	if len(data) < headerSize+sha1.Size {
+		return nil, fmt.Errorf("index file smaller than expected")
+	}
+	if !bytes.Equal(data[:4], indexSignature) {
+		return nil, fmt.Errorf("bad signature 0x%x", data[:4])
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < minIndexVersion || version > maxIndexVersion {
+		return nil, fmt.Errorf("bad index version %d", version)
+	}
+
+	// the checksum is left null when index.skipHash is set
+	content, checksum := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	sum := sha1.Sum(content)
+	if !bytes.Equal(checksum, sum[:]) && !bytes.Equal(checksum, make([]byte, sha1.Size)) {
+		return nil, fmt.Errorf("bad index file sha1 signature")
+	}
+
+	count := binary.BigEndian.Uint32(data[8:12])
+	index := &stagingIndex{version: version, entries: make([]*indexEntry, 0, count)}
+	offset := headerSize
+	previousPath := ""
+	for i := uint32(0); i < count; i++ {
+		entry, size, err := parseIndexEntry(content[offset:], version, previousPath)
+		if err != nil {
+			return nil, err
+		}
+		index.entries = append(index.entries, entry)
+		previousPath = entry.path
+		offset += size
+	}
+
+	// extensions are caches that are dropped when the index is written,
+	// but one that changes the meaning of the index must be understood
+	for offset+8 <= len(content) {
+		signature := content[offset : offset+4]
+		size := int(binary.BigEndian.Uint32(content[offset+4 : offset+8]))
+		if signature[0] < 'A' || signature[0] > 'Z' {
+			return nil, fmt.Errorf("index uses %s extension, which we do not understand", signature)
+		}
+		offset += 8 + size
+	}
+	if offset != len(content) {
+		return nil, fmt.Errorf("index file corrupt")
+	}
+
+	return index, nil
+}
+
+// parseIndexEntry parses the entry at the start of data, returning its
+// size in bytes
+func parseIndexEntry(data []byte, version uint32, previousPath string) (*indexEntry, int, error) {
+	if len(data) < indexEntryFixedSize {
+		return nil, 0, fmt.Errorf("index file corrupt")
+	}
+	field := func(i int) uint32 {
+		return binary.BigEndian.Uint32(data[i*4 : i*4+4])
+	}
+	entry := &indexEntry{
+		ctimeSeconds:     field(0),
+		ctimeNanoseconds: field(1),
+		mtimeSeconds:     field(2),
+		mtimeNanoseconds: field(3),
+		dev:              field(4),
+		ino:              field(5),
+		mode:             field(6),
+		uid:              field(7),
+		gid:              field(8),
+		size:             field(9),
+		oid:              hex.EncodeToString(data[40:60]),
+	}
+	flags := binary.BigEndian.Uint16(data[60:62])
+	entry.flags = flags &^ (indexFlagExtended | indexFlagNameMask)
+	offset := indexEntryFixedSize
+	if flags&indexFlagExtended != 0 {
+		if version < 3 || len(data) < offset+2 {
+			return nil, 0, fmt.Errorf("index file corrupt")
+		}
+		entry.extendedFlags = binary.BigEndian.Uint16(data[offset : offset+2])
+		offset += 2
+	}
+
+	// version 4: number of bytes to remove from the end of the previous
+	// path, then the rest of the path
+	prefix := ""
+	if version == 4 {
+		reader := bytes.NewReader(data[offset:])
+		strip, err := parseDeltaOffset(reader)
+		if err != nil || strip > int64(len(previousPath)) {
+			return nil, 0, fmt.Errorf("index file corrupt")
+		}
+		prefix = previousPath[:len(previousPath)-int(strip)]
+		offset = len(data) - reader.Len()
+	}
+
+	end := bytes.IndexByte(data[offset:], 0)
+	if end < 0 {
+		return nil, 0, fmt.Errorf("index file corrupt")
+	}
+	entry.path = prefix + string(data[offset:offset+end])
+	offset += end + 1
+
+	if version < 4 {
+		// 1 to 8 NUL bytes pad the entry to a multiple of 8 bytes
+		offset = (offset - 1 + 8) &^ 7
+		if offset > len(data) {
+			return nil, 0, fmt.Errorf("index file corrupt")
+		}
+	}
+	return entry, offset, nil
+}
+
+// writeIndex writes an index to its lock, to be committed by the caller
+func writeIndex(lock *lockFile, index *stagingIndex) error {
+	version := index.version
+	if version == 0 {
+		version = defaultIndexVersion
+	}
+	// version 3 is only needed for extended flags
+	if version == 2 || version == 3 {
+		version = 2
+		for _, entry := range index.entries {
+			if entry.extendedFlags != 0 {
+				version = 3
+				break
+			}
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	buffer.Write(indexSignature)
+	binary.Write(&buffer, binary.BigEndian, version)
+	binary.Write(&buffer, binary.BigEndian, uint32(len(index.entries)))
+
+	previousPath := ""
+	for _, entry := range index.entries {
+		start := buffer.Len()
+		for _, field := range []uint32{entry.ctimeSeconds, entry.ctimeNanoseconds,
+			entry.mtimeSeconds, entry.mtimeNanoseconds, entry.dev, entry.ino,
+			entry.mode, entry.uid, entry.gid, entry.size} {
+			binary.Write(&buffer, binary.BigEndian, field)
+		}
+		oid, err := hex.DecodeString(entry.oid)
+		if err != nil || len(oid) != sha1.Size {
+			return fmt.Errorf("invalid object name %s for '%s'", entry.oid, entry.path)
+		}
+		buffer.Write(oid)
+
+		flags := entry.flags | uint16(min(len(entry.path), indexFlagNameMask))
+		if entry.extendedFlags != 0 {
+			flags |= indexFlagExtended
+		}
+		binary.Write(&buffer, binary.BigEndian, flags)
+		if entry.extendedFlags != 0 {
+			binary.Write(&buffer, binary.BigEndian, entry.extendedFlags)
+		}
+
+		if version == 4 {
+			common := 0
+			for common < len(previousPath) && common < len(entry.path) &&
+				previousPath[common] == entry.path[common] {
+				common++
+			}
+			buffer.Write(encodeDeltaOffset(int64(len(previousPath) - common)))
+			buffer.WriteString(entry.path[common:])
+			buffer.WriteByte(0)
+			previousPath = entry.path
+			continue
+		}
+		buffer.WriteString(entry.path)
+		padding := 8 - (buffer.Len()-start)%8
+		buffer.Write(make([]byte, padding))
+	}
+
+	checksum := sha1.Sum(buffer.Bytes())
+	buffer.Write(checksum[:])
+	_, err := lock.Write(buffer.Bytes())
+	return err
+}
+
+// compareIndexEntries orders entries by path, compared byte-wise, then stage
+func compareIndexEntries(path string, stage int, entry *indexEntry) int {
+	if c := strings.Compare(path, entry.path); c != 0 {
+		return c
+	}
+	return stage - entry.stage()
+}
+
+// find returns the position of an entry, or where it would be inserted
+func (index *stagingIndex) find(path string, stage int) (int, bool) {
+	i := sort.Search(len(index.entries), func(i int) bool {
+		return compareIndexEntries(path, stage, index.entries[i]) <= 0
+	})
+	return i, i < len(index.entries) && compareIndexEntries(path, stage, index.entries[i]) == 0
+}
+
+// entry returns the merged entry of a path, nil if there is none
+func (index *stagingIndex) entry(path string) *indexEntry {
+	if i, found := index.find(path, 0); found {
+		return index.entries[i]
+	}
+	return nil
+}
+
+// add adds or replaces the entry of a path, resolving its conflicts, and
+// removes the entries it replaces: the files under a path that becomes a
+// file, the file at a directory of the path
+func (index *stagingIndex) add(entry *indexEntry) {
+	index.remove(entry.path)
+	for dir := entry.path; strings.Contains(dir, "/"); {
+		dir = dir[:strings.LastIndex(dir, "/")]
+		index.remove(dir)
+	}
+	kept := index.entries[:0]
+	for _, other := range index.entries {
+		if !strings.HasPrefix(other.path, entry.path+"/") {
+			kept = append(kept, other)
+		}
+	}
+	index.entries = kept
+
+	i, _ := index.find(entry.path, entry.stage())
+	index.entries = append(index.entries, nil)
+	copy(index.entries[i+1:], index.entries[i:])
+	index.entries[i] = entry
+}
+
+// addUnmerged replaces the entries of a path by the entries of its merge
+// stages 1 to 3, nil where the path is missing
+func (index *stagingIndex) addUnmerged(path string, stages [3]*indexEntry) {
+	index.remove(path)
+	i, _ := index.find(path, 1)
+	for stage, entry := range stages {
+		if entry == nil {
+			continue
+		}
+		entry.flags = entry.flags&^indexFlagStageMask | uint16(stage+1)<<indexFlagStageShift
+		index.entries = append(index.entries, nil)
+		copy(index.entries[i+1:], index.entries[i:])
+		index.entries[i] = entry
+		i++
+	}
+}
+
+// remove removes every stage of a path, returning whether it was in the index
+func (index *stagingIndex) remove(path string) bool {
+	start, _ := index.find(path, 0)
+	end := start
+	for end < len(index.entries) && index.entries[end].path == path {
+		end++
+	}
+	index.entries = append(index.entries[:start], index.entries[end:]...)
+	return end > start
+}
+
+// unmerged returns the paths with entries in a merge stage
+func (index *stagingIndex) unmerged() []string {
+	paths := []string{}
+	for _, entry := range index.entries {
+		if entry.stage() != 0 && (len(paths) == 0 || paths[len(paths)-1] != entry.path) {
+			paths = append(paths, entry.path)
+		}
+	}
+	return paths
+}
+
+// writeTree writes the tree objects of the index and returns the root
+// tree, files marked intent-to-add being left out
+func (index *stagingIndex) writeTree() (string, error) {
+	if unmerged := index.unmerged(); len(unmerged) > 0 {
+		for _, path := range unmerged {
+			fmt.Fprintf(os.Stderr, "%s: unmerged\n", path)
+		}
+		return "", fmt.Errorf("error building trees")
+	}
+
+	entries := []*indexEntry{}
+	for _, entry := range index.entries {
+		if entry.extendedFlags&indexFlagIntentToAdd == 0 {
+			entries = append(entries, entry)
+		}
+	}
+	hash, err := writeIndexTree(entries, "")
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+// writeIndexTree writes the tree of the entries under a directory prefix,
+// entries that are sorted by path, and its subtrees
+func writeIndexTree(entries []*indexEntry, prefix string) ([]byte, error) {
+	treeEntries := []*TreeEntry{}
+	for i := 0; i < len(entries); {
+		entry := entries[i]
+		name := strings.TrimPrefix(entry.path, prefix)
+
+		dir, _, isDir := strings.Cut(name, "/")
+		if !isDir {
+			hash, err := hex.DecodeString(entry.oid)
+			if err != nil {
+				return nil, err
+			}
+			treeEntries = append(treeEntries, &TreeEntry{
+				Mode:      entry.treeMode(),
+				Type:      ObjectTypeBlob,
+				Hash:      entry.oid,
+				HashBytes: hash,
+				Name:      name,
+			})
+			i++
+			continue
+		}
+
+		// the entries of a directory are contiguous
+		dirPrefix := prefix + dir + "/"
+		end := i
+		for end < len(entries) && strings.HasPrefix(entries[end].path, dirPrefix) {
+			end++
+		}
+		hash, err := writeIndexTree(entries[i:end], dirPrefix)
+		if err != nil {
+			return nil, err
+		}
+		treeEntries = append(treeEntries, &TreeEntry{
+			Mode:      "40000",
+			Type:      ObjectTypeTree,
+			Hash:      hex.EncodeToString(hash),
+			HashBytes: hash,
+			Name:      dir,
+		})
+		i = end
+	}
+
+	sort.Slice(treeEntries, func(i, j int) bool {
+		return treeEntryLess(treeEntries[i], treeEntries[j])
+	})
+	return HashTree(&treeEntries, true)
+}
+
+// WriteTree writes the tree objects of the index and returns the object
+// ID of the root tree
+func WriteTree() (string, error) {
+	index, err := readIndex()
+	if err != nil {
+		return "", err
+	}
+	return index.writeTree()
+}
+
+// workingFileMode returns the index mode of a working tree file
+func workingFileMode(info fs.FileInfo) uint32 {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		return 0120000
+	case info.IsDir():
+		return 0160000
+	case info.Mode()&0111 != 0:
+		return 0100755
+	}
+	return 0100644
+}
+
+// newIndexEntry returns the merged entry of a working tree file
+func newIndexEntry(path string, oid string, info fs.FileInfo) *indexEntry {
+	entry := &indexEntry{path: path, oid: oid, mode: workingFileMode(info)}
+	entry.setStat(info)
+	return entry
+}
+
+// statMatches checks whether a working tree file is the one an entry
+// recorded the stat data of
+func (entry *indexEntry) statMatches(info fs.FileInfo) bool {
+	current := indexEntry{}
+	current.setStat(info)
+	return entry.mode == workingFileMode(info) &&
+		entry.mtimeSeconds == current.mtimeSeconds &&
+		entry.mtimeNanoseconds == current.mtimeNanoseconds &&
+		entry.ctimeSeconds == current.ctimeSeconds &&
+		entry.ctimeNanoseconds == current.ctimeNanoseconds &&
+		entry.ino == current.ino &&
+		entry.uid == current.uid &&
+		entry.gid == current.gid &&
+		entry.size == current.size
+}
+
+// upToDate checks from the stat data whether a working tree file still
+// has the content of its entry, without reading it
+// A file modified in the same second as the index was written may have
+// changed after its entry was recorded ("racy git") and is not trusted
+func (index *stagingIndex) upToDate(entry *indexEntry, info fs.FileInfo) bool {
+	if !entry.statMatches(info) {
+		return false
+	}
+	if index.timestamp.IsZero() {
+		return true
+	}
+	modified := time.Unix(int64(entry.mtimeSeconds), int64(entry.mtimeNanoseconds))
+	return modified.Before(index.timestamp)
+}
+
+// hashWorkingFile computes the object ID of a working tree file, the
+// target of a symbolic link, and optionally stores it as a blob
+func hashWorkingFile(filePath string, info fs.FileInfo, write bool) (string, error) {
+	if info.Mode()&fs.ModeSymlink == 0 {
+		blobInfo, err := HashBlob(filePath, write)
+		if err != nil {
+			return "", err
+		}
+		return blobInfo.Hash, nil
+	}
+
+	target, err := os.Readlink(filePath)
+	if err != nil {
+		return "", err
+	}
+	header := fmt.Sprintf("%s %d\x00", ObjectTypeBlob, len(target))
+	oid := hex.EncodeToString(hashObjectContent(string(ObjectTypeBlob), []byte(target)))
+	if write {
+		if err := writeObject(oid, []byte(header), strings.NewReader(target)); err != nil {
+			return "", err
+		}
+	}
+	return oid, nil
+}
@@ -0,0 +1,59 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// IndexPack builds the version 2 index of an arbitrary packfile
+// Every delta is resolved and every object hashed on the way,
+// returns the packfile checksum
+func IndexPack(packPath string, indexPath string) (string, error) {
+	if indexPath == "" {
+		if !strings.HasSuffix(packPath, ".pack") {
+			return "", fmt.Errorf("packfile name '%s' does not end with '.pack'", packPath)
+		}
+		indexPath = strings.TrimSuffix(packPath, ".pack") + ".idx"
+	}
+
+	packFile, err := os.ReadFile(packPath)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := indexPackFile(packFile)
+	if err != nil {
+		return "", err
+	}
+
+	packChecksum := packFile[len(packFile)-20:]
+	err = writePackIndexFile(indexPath, entries, packChecksum)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", packChecksum), nil
+}
+
+// indexPackFile checks the whole packfile and resolves its entries
+func indexPackFile(packFile []byte) ([]*packEntry, error) {
+	_, numObjects, err := parsePackFileHeader(packFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// entries are parsed first so that a truncated packfile
+	// is reported as such rather than as a checksum mismatch
+	entries, err := parsePackFile(packFile, numObjects)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyPackFileChecksum(packFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,25 @@
+package mygit
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// setStat records the stat data of a working tree file in an entry
+func (entry *indexEntry) setStat(info fs.FileInfo) {
+	entry.mtimeSeconds = uint32(info.ModTime().Unix())
+	entry.mtimeNanoseconds = uint32(info.ModTime().Nanosecond())
+	entry.size = uint32(info.Size())
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		entry.ctimeSeconds, entry.ctimeNanoseconds = entry.mtimeSeconds, entry.mtimeNanoseconds
+		return
+	}
+	entry.ctimeSeconds = uint32(stat.Ctim.Sec)
+	entry.ctimeNanoseconds = uint32(stat.Ctim.Nsec)
+	entry.dev = uint32(stat.Dev)
+	entry.ino = uint32(stat.Ino)
+	entry.uid = stat.Uid
+	entry.gid = stat.Gid
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package mygit
+
+import "io/fs"
+
+// setStat records the stat data of a working tree file in an entry,
+// the modification time standing for the change time
+func (entry *indexEntry) setStat(info fs.FileInfo) {
+	entry.mtimeSeconds = uint32(info.ModTime().Unix())
+	entry.mtimeNanoseconds = uint32(info.ModTime().Nanosecond())
+	entry.ctimeSeconds, entry.ctimeNanoseconds = entry.mtimeSeconds, entry.mtimeNanoseconds
+	entry.size = uint32(info.Size())
+}
@@ -0,0 +1,62 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const lockSuffix = ".lock"
+
+// lockFile is the "<path>.lock" file holding the new content of a file:
+// only one writer can create it, and it replaces the file atomically when
+// committed
+type lockFile struct {
+	path string
+	file *os.File
+}
+
+// lockPath takes the lock of a file, failing if another writer holds it
+func lockPath(filePath string) (*lockFile, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filePath+lockSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("unable to create '%s%s': file exists, "+
+			"another process seems to be updating it", filePath, lockSuffix)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lockFile{path: filePath, file: file}, nil
+}
+
+func (l *lockFile) Write(p []byte) (int, error) {
+	return l.file.Write(p)
+}
+
+// commit replaces the file with the content written to the lock
+func (l *lockFile) commit() error {
+	if l.file == nil {
+		return fmt.Errorf("lock of %s already released", l.path)
+	}
+	err := l.file.Close()
+	l.file = nil
+	if err != nil {
+		os.Remove(l.path + lockSuffix)
+		return err
+	}
+	return os.Rename(l.path+lockSuffix, l.path)
+}
+
+// rollback releases the lock leaving the file untouched,
+// does nothing once the lock is committed
+func (l *lockFile) rollback() {
+	if l.file == nil {
+		return
+	}
+	l.file.Close()
+	l.file = nil
+	os.Remove(l.path + lockSuffix)
+}
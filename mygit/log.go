@@ -2,47 +2,86 @@ package mygit
 
 import (
 	"fmt"
-	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// Prints the commit history of the given object ID
-func Log(oid string) error {
-	if oid == "" {
-		var err error
-		oid, err = getHeadOID()
-		if err != nil {
+type LogOptions struct {
+	// follow the file given as the only pathspec across renames
+	Follow bool
+}
+
+// Prints the commit history of the given revision (HEAD by default),
+// a range such as A..B excludes the history of A
+// Arguments are an optional revision, then pathspecs: only the commits
+// changing the selected files are shown, and the history of a merge is
+// followed through the first parent with the same files, if any
+func Log(arguments []string, pathspecs []string, options *LogOptions) error {
+	revision := "HEAD"
+	if len(arguments) > 0 {
+		if _, err := parseRevisionSpecs(arguments[0]); err == nil {
+			revision, arguments = arguments[0], arguments[1:]
+		} else if len(pathspecs) > 0 {
 			return err
 		}
 	}
+	pathspecs = append(arguments[:len(arguments):len(arguments)], pathspecs...)
+	if options.Follow && len(pathspecs) != 1 {
+		return fmt.Errorf("--follow requires exactly one pathspec")
+	}
+	limiter := &pathLimiter{specs: parsePathspecs(pathspecs), follow: options.Follow}
 
-	object, err := NewObject(oid)
+	specs, err := parseRevisionSpecs(revision)
 	if err != nil {
 		return err
 	}
 
-	if object.Type != ObjectTypeCommit {
-		return fmt.Errorf("%s is not a commit object", oid)
-	}
+	excluded := map[string]*CommitObject{}
+	commits := []*CommitObject{}
+	for _, spec := range specs {
+		if spec.exclude {
+			ancestors, err := commitAncestors(spec.oid)
+			if err != nil {
+				return err
+			}
+			for oid, commit := range ancestors {
+				excluded[oid] = commit
+			}
+			continue
+		}
 
-	commitObject, err := parseCommitObject(object)
-	if err != nil {
-		return err
+		// annotated tags show the history of the commit they point to
+		commitObject, err := peelToCommit(spec.oid)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, commitObject)
 	}
 
-	commits := []*CommitObject{commitObject}
+	seen := map[string]bool{}
 
 	for len(commits) > 0 {
 		commit := commits[0]
 		commits = commits[1:]
 
-		if err := displayCommit(commit); err != nil {
+		if _, ok := excluded[commit.Hash]; ok || seen[commit.Hash] {
+			continue
+		}
+		seen[commit.Hash] = true
+
+		changed, parents, err := limiter.simplify(commit)
+		if err != nil {
 			return err
 		}
+		if changed {
+			if err := displayCommit(commit); err != nil {
+				return err
+			}
+		}
 
-		for _, parent := range commit.Parents {
+		for _, parent := range parents {
 			parentObject, err := NewObject(parent)
 			if err != nil {
 				return err
@@ -64,27 +103,105 @@ func Log(oid string) error {
 	return nil
 }
 
-func displayCommit(commit *CommitObject) error {
-	fmt.Printf("commit %s\n", commit.Hash)
-	fmt.Printf("Author:\t%s <%s>\n", commit.AuthorName, commit.AuthorEmail)
+// pathLimiter selects the commits changing the files of some pathspecs
+type pathLimiter struct {
+	specs []*pathspec
+	// with a single pathspec, replace it by the origin of a renamed file
+	follow bool
+}
 
-	// format date
-	i, err := strconv.ParseInt(commit.AuthorDateSeconds, 10, 64)
+// simplify checks whether a commit changes the selected files, compared
+// with each of its parents, and returns the parents whose history is
+// walked: the first one with the same selected files, or all of them
+func (limiter *pathLimiter) simplify(commit *CommitObject) (bool, []string, error) {
+	if len(limiter.specs) == 0 {
+		return true, commit.Parents, nil
+	}
+	parents := commit.Parents
+	if len(parents) == 0 {
+		// a root commit is compared with the empty tree
+		parents = []string{""}
+	}
+	for _, parent := range parents {
+		parentTree, err := commitTreeOID(parent)
+		if err != nil {
+			return false, nil, err
+		}
+		changes, err := CompareTrees(parentTree, commit.Tree, &CompareTreesOptions{Recursive: true})
+		if err != nil {
+			return false, nil, err
+		}
+		added := false
+		same := true
+		matched := make([]bool, len(limiter.specs))
+		for _, change := range changes {
+			if matchPathspecs(limiter.specs, change.Path, matched) {
+				same = false
+				added = added || change.Status == 'A'
+			}
+		}
+		if same {
+			if parent == "" {
+				return false, nil, nil
+			}
+			return false, []string{parent}, nil
+		}
+		if added && limiter.follow {
+			if err := limiter.followRename(parentTree, changes); err != nil {
+				return false, nil, err
+			}
+		}
+	}
+	return true, commit.Parents, nil
+}
+
+// followRename looks for the origin of the followed file when it is added,
+// and follows that file instead in the rest of the history
+// As in git, any file of the parent may be the origin, copies included
+func (limiter *pathLimiter) followRename(parentTree string, changes []TreeChange) error {
+	followed := limiter.specs[0].pattern
+	files, err := treeFiles(parentTree)
 	if err != nil {
 		return err
 	}
-	timeZone, err := strconv.ParseInt(commit.AuthorDateTimeZone, 10, 64)
+	pairs := []diffPair{}
+	for _, change := range changes {
+		delete(files, change.Path)
+		// the other added files are not looked for
+		if change.Status == 'A' && change.Path != followed {
+			continue
+		}
+		pairs = append(pairs, treeChangePair(change))
+	}
+	for filePath, entry := range files {
+		pairs = append(pairs, treeChangePair(TreeChange{Path: filePath, Old: entry, New: entry}))
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].new.path < pairs[j].new.path
+	})
+
+	pairs, err = detectRenames(pairs, &RenameOptions{FindRenames: true, FindCopies: true})
 	if err != nil {
 		return err
 	}
-	negative := 1
-	if timeZone < 0 {
-		negative = -1
-		timeZone = -timeZone
+	for _, pair := range pairs {
+		if pair.renamed() && pair.new.path == followed {
+			limiter.specs = parsePathspecs([]string{pair.old.path})
+			break
+		}
+	}
+	return nil
+}
+
+func displayCommit(commit *CommitObject) error {
+	fmt.Printf("commit %s\n", commit.Hash)
+	fmt.Printf("Author:\t%s <%s>\n", commit.AuthorName, commit.AuthorEmail)
+
+	// format date
+	tm, err := parseObjectDate(commit.AuthorDateSeconds, commit.AuthorDateTimeZone)
+	if err != nil {
+		return err
 	}
-	hours := int(timeZone / 100)
-	minutes := int(timeZone % 100)
-	tm := time.Unix(i, 0).In(time.FixedZone("", (hours*60*60+minutes*60)*negative))
 	fmt.Printf("Date: \t%s %s\n", tm.Format(time.ANSIC), commit.AuthorDateTimeZone)
 
 	fmt.Printf("\n\t%s\n", strings.ReplaceAll(commit.Message, "\n", "\n\t"))
@@ -92,21 +209,31 @@ func displayCommit(commit *CommitObject) error {
 	return nil
 }
 
-func getHeadOID() (string, error) {
-	// get HEAD commit
-	data, err := os.ReadFile(".git/HEAD")
+// parseObjectDate parses the date of a commit or tag header line,
+// in the timezone it was recorded in
+func parseObjectDate(seconds string, timeZone string) (time.Time, error) {
+	i, err := strconv.ParseInt(seconds, 10, 64)
 	if err != nil {
-		return "", err
-	}
-	ref := strings.Split(string(data), " ")[1]
-	ref = strings.TrimSpace(ref)
-
-	data, err = os.ReadFile(".git/" + ref)
-	if os.IsNotExist(err) {
-		return "", nil
+		return time.Time{}, err
 	}
+	zone, err := strconv.ParseInt(timeZone, 10, 64)
 	if err != nil {
-		return "", err
+		return time.Time{}, err
+	}
+	negative := 1
+	if zone < 0 {
+		negative = -1
+		zone = -zone
 	}
-	return strings.TrimSpace(string(data)), nil
+	hours := int(zone / 100)
+	minutes := int(zone % 100)
+	return time.Unix(i, 0).In(time.FixedZone("", (hours*60*60+minutes*60)*negative)), nil
+}
+
+// getHeadOID returns the commit HEAD points to, either through
+// the current branch or directly when detached
+// Returns an empty object ID on a branch without commits yet
+func getHeadOID() (string, error) {
+	_, oid, err := readHead()
+	return oid, err
 }
@@ -0,0 +1,402 @@
+package mygit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// files of a merge left to conclude, removed by the commit concluding it
+const (
+	mergeHeadPath = ".git/MERGE_HEAD"
+	mergeMsgPath  = ".git/MERGE_MSG"
+	mergeModePath = ".git/MERGE_MODE"
+)
+
+// readMergeHead returns the commit being merged, empty if no merge is left
+// to conclude
+func readMergeHead() (string, error) {
+	data, err := os.ReadFile(mergeHeadPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	oid, _, _ := strings.Cut(string(data), "\n")
+	return oid, nil
+}
+
+// removeMergeState removes the files of a merge left to conclude
+func removeMergeState() error {
+	for _, filePath := range []string{mergeHeadPath, mergeMsgPath, mergeModePath} {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+type MergeOptions struct {
+	// message of the merge commit, by default naming the merged commit
+	Message string
+	// create a merge commit even when HEAD can be fast-forwarded
+	NoFastForward bool
+	// refuse to merge unless HEAD can be fast-forwarded
+	FastForwardOnly bool
+}
+
+// Merge merges a commit into HEAD: HEAD is fast-forwarded to it when it
+// descends from HEAD, otherwise the changes of both sides since their
+// merge bases are merged and recorded in a commit with two parents. It
+// returns false when conflicts are left in the index and the working tree,
+// the merge being concluded by a commit once they are resolved
+func Merge(revision string, options *MergeOptions) (bool, error) {
+	mergeHead, err := readMergeHead()
+	if err != nil {
+		return false, err
+	}
+	if mergeHead != "" {
+		return false, fmt.Errorf("you have not concluded your merge (MERGE_HEAD exists)\n" +
+			"Please, commit your changes before you merge")
+	}
+
+	headRef, head, err := readHead()
+	if err != nil {
+		return false, err
+	}
+	oid, err := resolveRevision(revision)
+	if err != nil {
+		return false, err
+	}
+	history := newCommitHistory()
+	theirs, err := history.commit(oid)
+	if err != nil {
+		return false, err
+	}
+	reflogMessage := "merge " + revision + ": "
+
+	if head == "" {
+		// an unborn branch starts at the merged commit
+		if err := checkoutTree("", theirs.Tree, "merge"); err != nil {
+			return false, err
+		}
+		return true, setHeadOID(theirs.Hash, zeroOID, reflogMessage+"initial pull")
+	}
+	ours, err := history.commit(head)
+	if err != nil {
+		return false, err
+	}
+	if err := writeRef("ORIG_HEAD", ours.Hash, ""); err != nil {
+		return false, err
+	}
+
+	if upToDate, err := history.isAncestor(theirs.Hash, ours.Hash); err != nil {
+		return false, err
+	} else if upToDate {
+		fmt.Println("Already up to date.")
+		return true, nil
+	}
+	fastForward, err := history.isAncestor(ours.Hash, theirs.Hash)
+	if err != nil {
+		return false, err
+	}
+	if fastForward && !options.NoFastForward {
+		fmt.Printf("Updating %s..%s\n", shortestUniqueAbbrev(ours.Hash, DefaultAbbrev),
+			shortestUniqueAbbrev(theirs.Hash, DefaultAbbrev))
+		if err := checkoutTree(ours.Tree, theirs.Tree, "merge"); err != nil {
+			return false, err
+		}
+		if err := setHeadOID(theirs.Hash, ours.Hash, reflogMessage+"Fast-forward"); err != nil {
+			return false, err
+		}
+		fmt.Println("Fast-forward")
+		return true, writeMergeStat(ours.Hash, theirs.Hash)
+	}
+	if options.FastForwardOnly {
+		return false, fmt.Errorf("not possible to fast-forward, aborting")
+	}
+
+	// the merge is made from the index, which must not have changes
+	if err := requireCleanIndex(ours.Tree, "merge"); err != nil {
+		return false, err
+	}
+
+	merge, err := newTreeMerge(history, "HEAD", revision)
+	if err != nil {
+		return false, err
+	}
+	tree, err := merge.mergeCommits(ours, theirs)
+	if err != nil {
+		return false, err
+	}
+	if err := checkoutTree(ours.Tree, tree, "merge"); err != nil {
+		return false, err
+	}
+	for _, message := range merge.sortedMessages() {
+		fmt.Println(message)
+	}
+
+	message := options.Message
+	if message == "" {
+		if message, err = mergeMessage(headRef, revision); err != nil {
+			return false, err
+		}
+	}
+	if len(merge.conflicts) > 0 {
+		return false, recordConflicts(merge.conflicts, theirs.Hash, message, options)
+	}
+
+	commit, err := CommitTree(tree, []string{ours.Hash, theirs.Hash}, message)
+	if err != nil {
+		return false, err
+	}
+	if err := setHeadOID(commit, ours.Hash, reflogMessage+"Merge made by the 'ort' strategy."); err != nil {
+		return false, err
+	}
+	fmt.Println("Merge made by the 'ort' strategy.")
+	return true, writeMergeStat(ours.Hash, commit)
+}
+
+// mergeMessage returns the default message of the merge of a revision
+// into the branch of HEAD: "Merge branch '<branch>'", followed by
+// " into <branch>" unless HEAD is on main or master
+func mergeMessage(headRef string, revision string) (string, error) {
+	kind, name := "commit", revision
+	refName, _, err := dwimRef(revision)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(refName, headsPrefix):
+		kind, name = "branch", strings.TrimPrefix(refName, headsPrefix)
+	case strings.HasPrefix(refName, tagsPrefix):
+		kind, name = "tag", strings.TrimPrefix(refName, tagsPrefix)
+	case strings.HasPrefix(refName, "refs/remotes/"):
+		kind, name = "remote-tracking branch", strings.TrimPrefix(refName, "refs/remotes/")
+	}
+	message := fmt.Sprintf("Merge %s '%s'", kind, name)
+	branch := strings.TrimPrefix(headRef, headsPrefix)
+	if headRef == "" {
+		branch = "HEAD"
+	}
+	if branch != "main" && branch != "master" {
+		message += " into " + branch
+	}
+	return message, nil
+}
+
+// recordConflicts leaves the stages of the conflicted files in the index,
+// and the merge to conclude in MERGE_HEAD, MERGE_MSG and MERGE_MODE
+func recordConflicts(conflicts []mergeConflict, theirs string, message string, options *MergeOptions) error {
+	if err := writeConflictStages(conflicts); err != nil {
+		return err
+	}
+
+	mode := ""
+	if options.NoFastForward {
+		mode = "no-ff"
+	}
+	if err := os.WriteFile(mergeHeadPath, []byte(theirs+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(mergeMsgPath, []byte(conflictsMessage(message, conflicts)), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(mergeModePath, []byte(mode), 0644); err != nil {
+		return err
+	}
+	fmt.Println("Automatic merge failed; fix conflicts and then commit the result.")
+	return nil
+}
+
+// requireCleanIndex refuses an operation made from the index when the
+// index has changes from the tree of HEAD
+func requireCleanIndex(headTree string, operation string) error {
+	indexTree, err := WriteTree()
+	if err != nil {
+		return err
+	}
+	if indexTree == headTree {
+		return nil
+	}
+	changes, err := CompareTrees(headTree, indexTree, &CompareTreesOptions{Recursive: true})
+	if err != nil {
+		return err
+	}
+	paths := make([]string, len(changes))
+	for i, change := range changes {
+		paths[i] = change.Path
+	}
+	return fmt.Errorf("your local changes to the following files would be overwritten by %s:\n\t%s\n"+
+		"Please commit your changes or stash them before you %s",
+		operation, strings.Join(paths, "\n\t"), operation)
+}
+
+// writeConflictStages replaces the entries of the conflicted paths in the
+// index by their stages
+func writeConflictStages(conflicts []mergeConflict) error {
+	lock, index, err := lockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+	for _, conflict := range conflicts {
+		stages := [3]*indexEntry{}
+		for i, entry := range conflict.stages {
+			if entry.Name != "" {
+				stages[i] = treeIndexEntry(conflict.path, entry)
+			}
+		}
+		index.addUnmerged(conflict.path, stages)
+	}
+	if err := writeIndex(lock, index); err != nil {
+		return err
+	}
+	return lock.commit()
+}
+
+// conflictsMessage returns the message of a commit left to conclude after
+// conflicts, followed by the list of the conflicted paths, as comments
+func conflictsMessage(message string, conflicts []mergeConflict) string {
+	paths := make([]string, len(conflicts))
+	for i, conflict := range conflicts {
+		paths[i] = conflict.path
+	}
+	sort.Strings(paths)
+	message += "\n\n# Conflicts:\n"
+	for _, filePath := range paths {
+		message += "#\t" + filePath + "\n"
+	}
+	return message
+}
+
+// changeStats returns the changes from a commit to another, renames
+// detected, with their diffstat
+func changeStats(oldCommit string, newCommit string) ([]diffPair, []diffStat, error) {
+	pairs, err := treeDiffPairs(oldCommit, newCommit, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pairs, err = detectRenames(pairs, &RenameOptions{FindRenames: true}); err != nil {
+		return nil, nil, err
+	}
+	stats := make([]diffStat, 0, len(pairs))
+	for _, pair := range pairs {
+		stat, err := pair.stat(&DiffOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return pairs, stats, nil
+}
+
+// writeMergeStat shows the diffstat and the summary of the changes that a
+// merge brought to HEAD
+func writeMergeStat(oldHead string, newHead string) error {
+	pairs, stats, err := changeStats(oldHead, newHead)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(os.Stdout)
+	if len(stats) > 0 {
+		writeDiffStat(out, stats)
+	}
+	writeDiffSummary(out, pairs)
+	return out.Flush()
+}
+
+// MergeAbort abandons a merge left to conclude: the index and the working
+// tree are reset to HEAD, as well as the files changed by the merge
+func MergeAbort() error {
+	mergeHead, err := readMergeHead()
+	if err != nil {
+		return err
+	}
+	if mergeHead == "" {
+		return fmt.Errorf("there is no merge to abort (MERGE_HEAD missing)")
+	}
+	_, head, err := readHead()
+	if err != nil {
+		return err
+	}
+	headTree, err := commitTreeOID(head)
+	if err != nil {
+		return err
+	}
+	if err := resetTree(headTree); err != nil {
+		return err
+	}
+	return removeMergeState()
+}
+
+// resetTree resets the index and the working tree to the files of a tree:
+// the files that differ from the index, or in the index from the tree,
+// are overwritten and the files of the index missing from the tree are
+// removed, untracked files being left alone
+func resetTree(treeOID string) error {
+	files, err := treeFiles(treeOID)
+	if err != nil {
+		return err
+	}
+	lock, index, err := lockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+
+	removed := map[string]bool{}
+	for _, entry := range index.entries {
+		if _, ok := files[entry.path]; !ok {
+			removed[entry.path] = true
+		}
+	}
+	for filePath := range removed {
+		if err := os.RemoveAll(filePath); err != nil {
+			return err
+		}
+		removeEmptyDirs(filepath.Dir(filePath), 0)
+		index.remove(filePath)
+	}
+
+	paths := make([]string, 0, len(files))
+	for filePath := range files {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+	for _, filePath := range paths {
+		entry := files[filePath]
+		if current := index.entry(filePath); current != nil && current.oid == entry.Hash &&
+			current.treeMode() == entry.Mode {
+			if modified, err := workingFileModified(filePath, entry); err != nil {
+				return err
+			} else if _, err := os.Lstat(filePath); !modified && err == nil {
+				continue
+			}
+		}
+		if info, err := os.Lstat(filePath); err == nil && info.IsDir() && entry.Mode != "160000" {
+			if err := os.RemoveAll(filePath); err != nil {
+				return err
+			}
+		}
+		if err := writeWorkingFile(filePath, entry); err != nil {
+			return err
+		}
+		indexEntry := treeIndexEntry(filePath, entry)
+		info, err := os.Lstat(filePath)
+		if err != nil {
+			return err
+		}
+		indexEntry.setStat(info)
+		index.add(indexEntry)
+	}
+
+	if err := writeIndex(lock, index); err != nil {
+		return err
+	}
+	return lock.commit()
+}
@@ -0,0 +1,322 @@
+package mygit
+
+import (
+	"container/heap"
+	"fmt"
+	"strconv"
+)
+
+// marks of the commits painted by the merge base search
+const (
+	paintParent1 = 1 << iota
+	paintParent2
+	paintStale
+	paintResult
+)
+
+// historyCommit is a commit read by a history walk, with its commit date
+type historyCommit struct {
+	*CommitObject
+	date int64
+}
+
+// commitHistory reads commits once for the walks of a command
+type commitHistory struct {
+	commits map[string]*historyCommit
+}
+
+func newCommitHistory() *commitHistory {
+	return &commitHistory{commits: map[string]*historyCommit{}}
+}
+
+// commit returns a commit of the history, reading it the first time
+func (history *commitHistory) commit(oid string) (*historyCommit, error) {
+	if commit, ok := history.commits[oid]; ok {
+		return commit, nil
+	}
+	commitObject, err := peelToCommit(oid)
+	if err != nil {
+		return nil, err
+	}
+	date, err := strconv.ParseInt(commitObject.CommitterDateSeconds, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid committer date in commit %s", commitObject.Hash)
+	}
+	commit := &historyCommit{CommitObject: commitObject, date: date}
+	history.commits[oid] = commit
+	history.commits[commitObject.Hash] = commit
+	return commit, nil
+}
+
+// dateQueue is a priority queue of commits, the most recent first and
+// commits of the same date in the order they were added
+type dateQueue struct {
+	commits []*historyCommit
+	order   []int
+	added   int
+}
+
+func (queue *dateQueue) Len() int { return len(queue.commits) }
+
+func (queue *dateQueue) Less(i, j int) bool {
+	if queue.commits[i].date != queue.commits[j].date {
+		return queue.commits[i].date > queue.commits[j].date
+	}
+	return queue.order[i] < queue.order[j]
+}
+
+func (queue *dateQueue) Swap(i, j int) {
+	queue.commits[i], queue.commits[j] = queue.commits[j], queue.commits[i]
+	queue.order[i], queue.order[j] = queue.order[j], queue.order[i]
+}
+
+func (queue *dateQueue) Push(x any) {
+	queue.commits = append(queue.commits, x.(*historyCommit))
+	queue.order = append(queue.order, queue.added)
+	queue.added++
+}
+
+func (queue *dateQueue) Pop() any {
+	last := len(queue.commits) - 1
+	commit := queue.commits[last]
+	queue.commits, queue.order = queue.commits[:last], queue.order[:last]
+	return commit
+}
+
+// insertByDate inserts a commit in a list sorted by date, the most recent
+// first, after the commits of the same date
+func insertByDate(list []*historyCommit, commit *historyCommit) []*historyCommit {
+	i := 0
+	for i < len(list) && list[i].date >= commit.date {
+		i++
+	}
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = commit
+	return list
+}
+
+// paintDownToCommon walks the history of one and twos from the most recent
+// commits, marking the commits reachable from one, from twos, and the
+// ancestors of common commits as stale, and returns the common commits
+// found, by date
+func (history *commitHistory) paintDownToCommon(one *historyCommit, twos []*historyCommit) (
+	[]*historyCommit, map[string]int, error) {
+	marks := map[string]int{one.Hash: paintParent1}
+	if len(twos) == 0 {
+		return []*historyCommit{one}, marks, nil
+	}
+	queue := &dateQueue{}
+	heap.Push(queue, one)
+	for _, two := range twos {
+		marks[two.Hash] |= paintParent2
+		heap.Push(queue, two)
+	}
+
+	nonStale := func() bool {
+		for _, commit := range queue.commits {
+			if marks[commit.Hash]&paintStale == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	result := []*historyCommit{}
+	for nonStale() {
+		commit := heap.Pop(queue).(*historyCommit)
+		flags := marks[commit.Hash] & (paintParent1 | paintParent2 | paintStale)
+		if flags == paintParent1|paintParent2 {
+			if marks[commit.Hash]&paintResult == 0 {
+				marks[commit.Hash] |= paintResult
+				result = insertByDate(result, commit)
+			}
+			// the ancestors of a common commit are not merge bases
+			flags |= paintStale
+		}
+		for _, parentOID := range commit.Parents {
+			parent, err := history.commit(parentOID)
+			if err != nil {
+				return nil, nil, err
+			}
+			if marks[parent.Hash]&flags == flags {
+				continue
+			}
+			marks[parent.Hash] |= flags
+			heap.Push(queue, parent)
+		}
+	}
+	return result, marks, nil
+}
+
+// mergeBasesMany returns the common ancestors of one and any of twos that
+// are not ancestors of other common ancestors found on the way, by date
+func (history *commitHistory) mergeBasesMany(one *historyCommit, twos []*historyCommit) ([]*historyCommit, error) {
+	for _, two := range twos {
+		if one.Hash == two.Hash {
+			return []*historyCommit{one}, nil
+		}
+	}
+	common, marks, err := history.paintDownToCommon(one, twos)
+	if err != nil {
+		return nil, err
+	}
+	result := []*historyCommit{}
+	for _, commit := range common {
+		if marks[commit.Hash]&paintStale == 0 {
+			result = insertByDate(result, commit)
+		}
+	}
+	return result, nil
+}
+
+// removeRedundant leaves out the commits reachable from other commits of
+// the list
+func (history *commitHistory) removeRedundant(commits []*historyCommit) ([]*historyCommit, error) {
+	redundant := make([]bool, len(commits))
+	for i, commit := range commits {
+		if redundant[i] {
+			continue
+		}
+		others := []*historyCommit{}
+		indexes := []int{}
+		for j, other := range commits {
+			if i != j && !redundant[j] {
+				others = append(others, other)
+				indexes = append(indexes, j)
+			}
+		}
+		_, marks, err := history.paintDownToCommon(commit, others)
+		if err != nil {
+			return nil, err
+		}
+		if marks[commit.Hash]&paintParent2 != 0 {
+			redundant[i] = true
+		}
+		for k, other := range others {
+			if marks[other.Hash]&paintParent1 != 0 {
+				redundant[indexes[k]] = true
+			}
+		}
+	}
+	kept := []*historyCommit{}
+	for i, commit := range commits {
+		if !redundant[i] {
+			kept = append(kept, commit)
+		}
+	}
+	return kept, nil
+}
+
+// mergeBases returns the best common ancestors of one and any of twos:
+// none of them is an ancestor of another one
+func (history *commitHistory) mergeBases(one *historyCommit, twos ...*historyCommit) ([]*historyCommit, error) {
+	bases, err := history.mergeBasesMany(one, twos)
+	if err != nil || len(bases) <= 1 {
+		return bases, err
+	}
+	bases, err = history.removeRedundant(bases)
+	if err != nil {
+		return nil, err
+	}
+	sorted := []*historyCommit{}
+	for _, base := range bases {
+		sorted = insertByDate(sorted, base)
+	}
+	return sorted, nil
+}
+
+// octopusMergeBases returns the common ancestors of all the commits, the
+// merge bases of each commit with the bases of the ones before it, without
+// the ones found twice or reachable from other ones
+func (history *commitHistory) octopusMergeBases(commits []*historyCommit) ([]*historyCommit, error) {
+	result := commits[:1]
+	for _, commit := range commits[1:] {
+		next := []*historyCommit{}
+		for _, base := range result {
+			bases, err := history.mergeBases(commit, base)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, bases...)
+		}
+		result = next
+	}
+	seen := map[string]bool{}
+	unique := []*historyCommit{}
+	for _, commit := range result {
+		if !seen[commit.Hash] {
+			seen[commit.Hash] = true
+			unique = append(unique, commit)
+		}
+	}
+	return history.removeRedundant(unique)
+}
+
+// isAncestor checks whether ancestor is reachable from commit
+func (history *commitHistory) isAncestor(ancestor string, commit string) (bool, error) {
+	one, err := history.commit(ancestor)
+	if err != nil {
+		return false, err
+	}
+	two, err := history.commit(commit)
+	if err != nil {
+		return false, err
+	}
+	bases, err := history.mergeBasesMany(one, []*historyCommit{two})
+	if err != nil {
+		return false, err
+	}
+	for _, base := range bases {
+		if base.Hash == one.Hash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type MergeBaseOptions struct {
+	// show all the merge bases rather than one
+	All bool
+	// the common ancestors of all the commits, for a merge of them all
+	Octopus bool
+}
+
+// MergeBase shows the best common ancestor of the first commit and a merge
+// of the other ones, or with Octopus of all the commits, and returns
+// whether there is one
+func MergeBase(revisions []string, options *MergeBaseOptions) (bool, error) {
+	history := newCommitHistory()
+	commits := []*historyCommit{}
+	for _, revision := range revisions {
+		oid, err := resolveRevision(revision)
+		if err != nil {
+			return false, err
+		}
+		commit, err := history.commit(oid)
+		if err != nil {
+			return false, err
+		}
+		commits = append(commits, commit)
+	}
+	if len(commits) == 0 || len(commits) == 1 && !options.Octopus {
+		return false, fmt.Errorf("at least two commits are needed")
+	}
+
+	var bases []*historyCommit
+	var err error
+	if options.Octopus {
+		bases, err = history.octopusMergeBases(commits)
+	} else {
+		bases, err = history.mergeBases(commits[0], commits[1:]...)
+	}
+	if err != nil || len(bases) == 0 {
+		return false, err
+	}
+	if !options.All {
+		bases = bases[:1]
+	}
+	for _, base := range bases {
+		fmt.Println(base.Hash)
+	}
+	return true, nil
+}
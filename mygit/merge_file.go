@@ -0,0 +1,365 @@
+package mygit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// conflict styles of the merge.conflictStyle configuration
+const (
+	// ours and theirs between conflict markers
+	ConflictStyleMerge = "merge"
+	// the base too, after ours
+	ConflictStyleDiff3 = "diff3"
+)
+
+// size of the conflict markers, grown in the merges of merge bases
+const conflictMarkerSize = 7
+
+// hunk modes of a three-way merge
+const (
+	hunkConflict = 0
+	hunkOurs     = 1
+	hunkTheirs   = 2
+	// the same change on both sides
+	hunkBoth = 4
+)
+
+// mergeHunk is a part of a three-way merge: lines of the base, of ours and
+// of theirs, of which one side is taken, or which conflict
+type mergeHunk struct {
+	mode     int
+	i0, chg0 int
+	i1, chg1 int
+	i2, chg2 int
+}
+
+// mergeLabels name the sides in conflict markers
+type mergeLabels struct {
+	base, ours, theirs string
+}
+
+// conflictStyle returns the style of conflicts of merge.conflictStyle
+func conflictStyle() (string, error) {
+	style, err := readConfig("merge.conflictStyle")
+	if err != nil {
+		return "", err
+	}
+	switch style {
+	case "":
+		return ConflictStyleMerge, nil
+	case ConflictStyleMerge, ConflictStyleDiff3:
+		return style, nil
+	}
+	return "", fmt.Errorf("unknown style '%s' given for 'merge.conflictstyle'", style)
+}
+
+// lineMerge is a three-way merge of the lines of files, as git's xdiff
+// does it
+type lineMerge struct {
+	base, ours, theirs []string
+	labels             *mergeLabels
+	style              string
+	markerSize         int
+}
+
+// mergeLines merges the changes from base to ours and from base to theirs,
+// and returns the merged content and the number of conflicts, the lines
+// changed differently by both sides being left between conflict markers.
+// Both sides are compared with the histogram diff, as git's ort strategy
+// does, the lines it matches deciding what conflicts
+func mergeLines(base []byte, ours []byte, theirs []byte, labels *mergeLabels, style string, markerSize int) (
+	[]byte, int, error) {
+	merge := &lineMerge{
+		base:       splitLines(base),
+		ours:       splitLines(ours),
+		theirs:     splitLines(theirs),
+		labels:     labels,
+		style:      style,
+		markerSize: markerSize,
+	}
+	script1, err := diffLines(merge.base, merge.ours, DiffHistogram, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	script2, err := diffLines(merge.base, merge.theirs, DiffHistogram, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case len(script1) == 0:
+		return theirs, 0, nil
+	case len(script2) == 0:
+		return ours, 0, nil
+	}
+
+	hunks := merge.hunks(script1, script2)
+	// the base shown in conflicts must match the lines of the conflict,
+	// which are only refined in the merge style
+	if style == ConflictStyleMerge {
+		var err error
+		if hunks, err = merge.refineConflicts(hunks); err != nil {
+			return nil, 0, err
+		}
+		hunks = merge.simplifyNonConflicts(hunks)
+	}
+
+	conflicts := 0
+	for _, hunk := range hunks {
+		if hunk.mode == hunkConflict {
+			conflicts++
+		}
+	}
+	return merge.output(hunks), conflicts, nil
+}
+
+// appendHunk adds a hunk, merging it with the previous one if they touch,
+// the merged hunk being a conflict if their modes differ
+func appendHunk(hunks []mergeHunk, hunk mergeHunk) []mergeHunk {
+	if len(hunks) > 0 {
+		last := &hunks[len(hunks)-1]
+		if hunk.i1 <= last.i1+last.chg1 || hunk.i2 <= last.i2+last.chg2 {
+			if hunk.mode != last.mode {
+				last.mode = hunkConflict
+			}
+			last.chg0 = hunk.i0 + hunk.chg0 - last.i0
+			last.chg1 = hunk.i1 + hunk.chg1 - last.i1
+			last.chg2 = hunk.i2 + hunk.chg2 - last.i2
+			return hunks
+		}
+	}
+	return append(hunks, hunk)
+}
+
+// hunks walks the changes of both sides in order, a change of one side
+// that does not overlap a change of the other side being taken, and
+// overlapping changes conflicting unless they are the same
+func (merge *lineMerge) hunks(script1 []diffChange, script2 []diffChange) []mergeHunk {
+	hunks := []mergeHunk{}
+	for len(script1) > 0 && len(script2) > 0 {
+		x1, x2 := script1[0], script2[0]
+		if x1.i1+x1.chg1 < x2.i1 {
+			hunks = appendHunk(hunks, mergeHunk{mode: hunkOurs,
+				i0: x1.i1, chg0: x1.chg1,
+				i1: x1.i2, chg1: x1.chg2,
+				i2: x2.i2 - x2.i1 + x1.i1, chg2: x1.chg1})
+			script1 = script1[1:]
+			continue
+		}
+		if x2.i1+x2.chg1 < x1.i1 {
+			hunks = appendHunk(hunks, mergeHunk{mode: hunkTheirs,
+				i0: x2.i1, chg0: x2.chg1,
+				i1: x1.i2 - x1.i1 + x2.i1, chg1: x2.chg1,
+				i2: x2.i2, chg2: x2.chg2})
+			script2 = script2[1:]
+			continue
+		}
+		if x1.i1 != x2.i1 || x1.chg1 != x2.chg1 || x1.chg2 != x2.chg2 ||
+			!equalLines(merge.ours[x1.i2:x1.i2+x1.chg2], merge.theirs[x2.i2:x2.i2+x2.chg2]) {
+			// the conflict spans both changes
+			off := x1.i1 - x2.i1
+			ffo := off + x1.chg1 - x2.chg1
+			i0, i1, i2 := x1.i1, x1.i2, x2.i2
+			if off > 0 {
+				i0 -= off
+				i1 -= off
+			} else {
+				i2 += off
+			}
+			chg0 := x1.i1 + x1.chg1 - i0
+			chg1 := x1.i2 + x1.chg2 - i1
+			chg2 := x2.i2 + x2.chg2 - i2
+			if ffo < 0 {
+				chg0 -= ffo
+				chg1 -= ffo
+			} else {
+				chg2 += ffo
+			}
+			hunks = appendHunk(hunks, mergeHunk{mode: hunkConflict,
+				i0: i0, chg0: chg0, i1: i1, chg1: chg1, i2: i2, chg2: chg2})
+		}
+
+		end1 := x1.i1 + x1.chg1
+		end2 := x2.i1 + x2.chg1
+		if end1 >= end2 {
+			script2 = script2[1:]
+		}
+		if end2 >= end1 {
+			script1 = script1[1:]
+		}
+	}
+	for _, x1 := range script1 {
+		hunks = appendHunk(hunks, mergeHunk{mode: hunkOurs,
+			i0: x1.i1, chg0: x1.chg1,
+			i1: x1.i2, chg1: x1.chg2,
+			i2: x1.i1 + len(merge.theirs) - len(merge.base), chg2: x1.chg1})
+	}
+	for _, x2 := range script2 {
+		hunks = appendHunk(hunks, mergeHunk{mode: hunkTheirs,
+			i0: x2.i1, chg0: x2.chg1,
+			i1: x2.i1 + len(merge.ours) - len(merge.base), chg1: x2.chg1,
+			i2: x2.i2, chg2: x2.chg2})
+	}
+	return hunks
+}
+
+// equalLines checks whether two runs of lines are the same
+func equalLines(lines1 []string, lines2 []string) bool {
+	if len(lines1) != len(lines2) {
+		return false
+	}
+	for i := range lines1 {
+		if lines1[i] != lines2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// refineConflicts compares the lines of both sides of each conflict, and
+// narrows it down to the lines that differ, a conflict of identical sides
+// being no longer one
+func (merge *lineMerge) refineConflicts(hunks []mergeHunk) ([]mergeHunk, error) {
+	refined := []mergeHunk{}
+	for _, hunk := range hunks {
+		if hunk.mode != hunkConflict || hunk.chg1 == 0 || hunk.chg2 == 0 {
+			refined = append(refined, hunk)
+			continue
+		}
+		script, err := diffLines(merge.ours[hunk.i1:hunk.i1+hunk.chg1],
+			merge.theirs[hunk.i2:hunk.i2+hunk.chg2], DiffHistogram, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(script) == 0 {
+			hunk.mode = hunkBoth
+			refined = append(refined, hunk)
+			continue
+		}
+		for i, change := range script {
+			part := mergeHunk{mode: hunkConflict,
+				i1: hunk.i1 + change.i1, chg1: change.chg1,
+				i2: hunk.i2 + change.i2, chg2: change.chg2}
+			if i == 0 {
+				part.i0, part.chg0 = hunk.i0, hunk.chg0
+			}
+			refined = append(refined, part)
+		}
+	}
+	return refined, nil
+}
+
+// simplifyNonConflicts merges conflicts separated by at most three lines,
+// which take as many lines inside the conflict as outside of it
+func (merge *lineMerge) simplifyNonConflicts(hunks []mergeHunk) []mergeHunk {
+	if len(hunks) == 0 {
+		return hunks
+	}
+	simplified := []mergeHunk{hunks[0]}
+	for _, next := range hunks[1:] {
+		last := &simplified[len(simplified)-1]
+		begin := last.i1 + last.chg1
+		if last.mode != hunkConflict || next.mode != hunkConflict || next.i1-begin > 3 {
+			simplified = append(simplified, next)
+			continue
+		}
+		last.chg1 = next.i1 + next.chg1 - last.i1
+		last.chg2 = next.i2 + next.chg2 - last.i2
+	}
+	return simplified
+}
+
+// output writes the merged lines: ours outside of the hunks, the side
+// taken by each hunk, and conflicts between markers
+func (merge *lineMerge) output(hunks []mergeHunk) []byte {
+	out := bytes.Buffer{}
+	copyLines := func(lines []string, addNewline bool, needsCR bool) {
+		for _, line := range lines {
+			out.WriteString(line)
+		}
+		if addNewline && len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+			if needsCR {
+				out.WriteByte('\r')
+			}
+			out.WriteByte('\n')
+		}
+	}
+	marker := func(c byte, label string, needsCR bool) {
+		out.WriteString(strings.Repeat(string(c), merge.markerSize))
+		if label != "" {
+			out.WriteString(" " + label)
+		}
+		if needsCR {
+			out.WriteByte('\r')
+		}
+		out.WriteByte('\n')
+	}
+
+	i := 0
+	for _, hunk := range hunks {
+		switch hunk.mode {
+		case hunkConflict:
+			needsCR := merge.needsCR(&hunk)
+			copyLines(merge.ours[i:hunk.i1], false, false)
+			marker('<', merge.labels.ours, needsCR)
+			copyLines(merge.ours[hunk.i1:hunk.i1+hunk.chg1], true, needsCR)
+			if merge.style == ConflictStyleDiff3 {
+				marker('|', merge.labels.base, needsCR)
+				copyLines(merge.base[hunk.i0:hunk.i0+hunk.chg0], true, needsCR)
+			}
+			marker('=', "", needsCR)
+			copyLines(merge.theirs[hunk.i2:hunk.i2+hunk.chg2], true, needsCR)
+			marker('>', merge.labels.theirs, needsCR)
+		case hunkOurs:
+			copyLines(merge.ours[i:hunk.i1+hunk.chg1], false, false)
+		case hunkTheirs:
+			copyLines(merge.ours[i:hunk.i1], false, false)
+			copyLines(merge.theirs[hunk.i2:hunk.i2+hunk.chg2], false, false)
+		default:
+			// the lines are copied with the next hunk
+			continue
+		}
+		i = hunk.i1 + hunk.chg1
+	}
+	copyLines(merge.ours[i:], false, false)
+	return out.Bytes()
+}
+
+// needsCR checks whether the lines around a conflict end with CRLF, for
+// the markers to end the same way
+func (merge *lineMerge) needsCR(hunk *mergeHunk) bool {
+	previous := func(i int) int {
+		return max(i-1, 0)
+	}
+	crlf := isCRLF(merge.ours, previous(hunk.i1))
+	if crlf != 0 {
+		crlf = isCRLF(merge.theirs, previous(hunk.i2))
+	}
+	if crlf != 0 {
+		crlf = isCRLF(merge.base, 0)
+	}
+	return crlf > 0
+}
+
+// isCRLF returns 1 if a line ends with CRLF, 0 if it ends with LF, -1 when
+// it cannot be told: the line of an empty file, a last line without end
+// of a file of one line; a last line without end has the end of the line
+// before it
+func isCRLF(lines []string, i int) int {
+	crlf := func(line string) int {
+		if strings.HasSuffix(line, "\r\n") {
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case len(lines) == 0:
+		return -1
+	case i < len(lines)-1 || strings.HasSuffix(lines[i], "\n"):
+		return crlf(lines[i])
+	case i == 0:
+		return -1
+	}
+	return crlf(lines[i-1])
+}
@@ -0,0 +1,537 @@
+package mygit
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// mergeConflict is a path that could not be merged, with its entries in
+// the base, ours and theirs, empty where the path is missing
+type mergeConflict struct {
+	path   string
+	stages [3]TreeEntry
+}
+
+// treeMerge merges the trees of two commits with the trees of their merge
+// bases the way git's "ort" strategy does, without looking for renames:
+// entries changed on one side only are taken from that side, files
+// changed on both sides are merged line by line
+type treeMerge struct {
+	history *commitHistory
+	labels  mergeLabels
+	style   string
+	// depth of the merges of merge bases, whose conflicts are recorded in
+	// the tree of the virtual merge base
+	depth     int
+	conflicts []mergeConflict
+	// messages about the merge of each path, shown sorted by path
+	messages map[string][]string
+	// merged merge bases, which are not objects of the repository
+	virtualCommits int
+}
+
+func newTreeMerge(history *commitHistory, ours string, theirs string) (*treeMerge, error) {
+	style, err := conflictStyle()
+	if err != nil {
+		return nil, err
+	}
+	return &treeMerge{
+		history:  history,
+		labels:   mergeLabels{ours: ours, theirs: theirs},
+		style:    style,
+		messages: map[string][]string{},
+	}, nil
+}
+
+// message records a message about a path, outside of merges of merge bases
+func (merge *treeMerge) message(filePath string, format string, args ...any) {
+	if merge.depth == 0 {
+		merge.messages[filePath] = append(merge.messages[filePath], fmt.Sprintf(format, args...))
+	}
+}
+
+// conflict records the entries of a conflicted path
+func (merge *treeMerge) conflict(filePath string, base *TreeEntry, ours *TreeEntry, theirs *TreeEntry) {
+	if merge.depth > 0 {
+		return
+	}
+	conflict := mergeConflict{path: filePath}
+	for i, entry := range []*TreeEntry{base, ours, theirs} {
+		if entry != nil {
+			conflict.stages[i] = *entry
+		}
+	}
+	merge.conflicts = append(merge.conflicts, conflict)
+}
+
+// sortedMessages returns the messages of the merge, by path
+func (merge *treeMerge) sortedMessages() []string {
+	paths := make([]string, 0, len(merge.messages))
+	for filePath := range merge.messages {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+	messages := []string{}
+	for _, filePath := range paths {
+		messages = append(messages, merge.messages[filePath]...)
+	}
+	return messages
+}
+
+// mergeCommits merges the trees of two commits and returns the merged
+// tree; several merge bases are merged together first, into a virtual
+// merge base
+func (merge *treeMerge) mergeCommits(ours *historyCommit, theirs *historyCommit) (string, error) {
+	bases, err := merge.history.mergeBases(ours, theirs)
+	if err != nil {
+		return "", err
+	}
+
+	var base *historyCommit
+	ancestor := ""
+	switch {
+	case len(bases) == 0 && merge.depth == 0:
+		return "", fmt.Errorf("refusing to merge unrelated histories")
+	case len(bases) == 0:
+		// merge bases without common ancestor are merged from nothing
+		base = &historyCommit{CommitObject: &CommitObject{}}
+		ancestor = "empty tree"
+	case len(bases) == 1:
+		base = bases[0]
+		ancestor = shortestUniqueAbbrev(base.Hash, DefaultAbbrev)
+	default:
+		// the oldest merge bases first
+		base = bases[len(bases)-1]
+		for i := len(bases) - 2; i >= 0; i-- {
+			labels := merge.labels
+			merge.labels = mergeLabels{ours: "Temporary merge branch 1", theirs: "Temporary merge branch 2"}
+			merge.depth++
+			tree, err := merge.mergeCommits(base, bases[i])
+			merge.depth--
+			merge.labels = labels
+			if err != nil {
+				return "", err
+			}
+			merge.virtualCommits++
+			virtual := &historyCommit{CommitObject: &CommitObject{
+				Hash:    fmt.Sprintf("virtual merge base %d", merge.virtualCommits),
+				Tree:    tree,
+				Parents: []string{base.Hash, bases[i].Hash},
+			}}
+			merge.history.commits[virtual.Hash] = virtual
+			base = virtual
+		}
+		ancestor = "merged common ancestors"
+	}
+
+	labels := merge.labels
+	merge.labels.base = ancestor
+	defer func() { merge.labels = labels }()
+	return merge.mergeTrees(base.Tree, ours.Tree, theirs.Tree)
+}
+
+// mergeTrees merges the changes from the base tree to ours and to theirs,
+// and writes the merged tree
+func (merge *treeMerge) mergeTrees(base string, ours string, theirs string) (string, error) {
+	tree, err := merge.mergeDirectory("", base, ours, theirs)
+	if tree == "" && err == nil {
+		tree, err = writeTreeEntries(nil)
+	}
+	return tree, err
+}
+
+// mergeDirectory merges the entries of three trees at a directory, and
+// returns the merged tree, empty if it has no entry
+func (merge *treeMerge) mergeDirectory(dir string, base string, ours string, theirs string) (string, error) {
+	// entries by name, trees sorting as if their name ended with a '/'
+	slots := map[string]*[3]*TreeEntry{}
+	for side, treeOID := range []string{base, ours, theirs} {
+		entries, err := readTreeEntries(treeOID)
+		if err != nil {
+			return "", err
+		}
+		for i := range entries {
+			entry := &entries[i]
+			name := treeEntrySortName(entry)
+			if slots[name] == nil {
+				slots[name] = &[3]*TreeEntry{}
+			}
+			slots[name][side] = entry
+		}
+	}
+	names := make([]string, 0, len(slots))
+	for name := range slots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// directories first, for the files of the same name to be moved
+	// aside from those that are kept
+	merged := []*TreeEntry{}
+	directories := map[string]bool{}
+	for _, name := range names {
+		if !strings.HasSuffix(name, "/") {
+			continue
+		}
+		slot := slots[name]
+		entries, err := merge.mergeEntry(path.Join(dir, strings.TrimSuffix(name, "/")), slot[0], slot[1], slot[2])
+		if err != nil {
+			return "", err
+		}
+		directories[strings.TrimSuffix(name, "/")] = len(entries) > 0
+		merged = append(merged, entries...)
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		slot := *slots[name]
+		filePath := path.Join(dir, name)
+		if directories[name] {
+			// deleted on both sides, or on one side and unchanged
+			// on the other
+			if slot[1] == nil && (slot[2] == nil || sameEntry(slot[0], slot[2])) ||
+				slot[2] == nil && sameEntry(slot[0], slot[1]) {
+				continue
+			}
+			side := merge.labels.ours
+			if slots[name+"/"][1] != nil {
+				side = merge.labels.theirs
+			}
+			movedName := uniqueName(name, side, slots)
+			movedPath := path.Join(dir, movedName)
+			merge.message(movedPath, "CONFLICT (file/directory): directory in the way of %s from %s; moving it to %s instead.",
+				filePath, side, movedPath)
+			for i, entry := range slot {
+				if entry != nil {
+					moved := *entry
+					moved.Name = movedName
+					slot[i] = &moved
+				}
+			}
+			filePath = movedPath
+		}
+		conflicts := len(merge.conflicts)
+		entries, err := merge.mergeEntry(filePath, slot[0], slot[1], slot[2])
+		if err != nil {
+			return "", err
+		}
+		// a file moved aside is left conflicted
+		if filePath != path.Join(dir, name) && len(entries) > 0 && len(merge.conflicts) == conflicts {
+			merge.conflict(filePath, slot[0], slot[1], slot[2])
+		}
+		merged = append(merged, entries...)
+	}
+	if len(merged) == 0 {
+		return "", nil
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return treeEntryLess(merged[i], merged[j])
+	})
+	return writeTreeEntries(merged)
+}
+
+// writeTreeEntries writes a tree of sorted entries
+func writeTreeEntries(entries []*TreeEntry) (string, error) {
+	hash, err := HashTree(&entries, true)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+// uniqueName returns "<name>~<side>" for a file moved aside, with a number
+// added if an entry of the directory has that name
+func uniqueName(name string, side string, slots map[string]*[3]*TreeEntry) string {
+	base := name + "~" + strings.ReplaceAll(side, "/", "_")
+	unique := base
+	for i := 0; slots[unique] != nil || slots[unique+"/"] != nil; i++ {
+		unique = fmt.Sprintf("%s_%d", base, i)
+	}
+	return unique
+}
+
+// mergeEntry merges the entries of a path, all of them trees or none,
+// and returns the merged entries
+func (merge *treeMerge) mergeEntry(filePath string, base *TreeEntry, ours *TreeEntry, theirs *TreeEntry) (
+	[]*TreeEntry, error) {
+	taken := func(entry *TreeEntry) []*TreeEntry {
+		if entry == nil {
+			return nil
+		}
+		return []*TreeEntry{entry}
+	}
+	switch {
+	case sameEntry(ours, theirs):
+		return taken(ours), nil
+	case sameEntry(base, ours):
+		return taken(theirs), nil
+	case sameEntry(base, theirs):
+		return taken(ours), nil
+	}
+
+	hash := func(entry *TreeEntry) string {
+		if entry == nil {
+			return ""
+		}
+		return entry.Hash
+	}
+	name := path.Base(filePath)
+	if ours != nil && ours.Type == ObjectTypeTree || theirs != nil && theirs.Type == ObjectTypeTree {
+		tree, err := merge.mergeDirectory(filePath, hash(base), hash(ours), hash(theirs))
+		if err != nil || tree == "" {
+			return nil, err
+		}
+		entry, err := newTreeEntry("40000", tree, name)
+		return []*TreeEntry{entry}, err
+	}
+
+	switch {
+	case ours != nil && theirs != nil:
+		return merge.mergeFiles(filePath, base, ours, theirs)
+	case merge.depth > 0:
+		// a merge base keeps the base version of a file deleted on a side
+		return taken(base), nil
+	case ours != nil:
+		merge.message(filePath, "CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.",
+			filePath, merge.labels.theirs, merge.labels.ours, merge.labels.ours, filePath)
+		merge.conflict(filePath, base, ours, nil)
+		return taken(ours), nil
+	default:
+		merge.message(filePath, "CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.",
+			filePath, merge.labels.ours, merge.labels.theirs, merge.labels.theirs, filePath)
+		merge.conflict(filePath, base, nil, theirs)
+		return taken(theirs), nil
+	}
+}
+
+// sameEntry checks whether two entries are the same object with the same
+// mode, or are both missing
+func sameEntry(a *TreeEntry, b *TreeEntry) bool {
+	return a == nil && b == nil || a != nil && b != nil && a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+// newTreeEntry returns a tree entry of an object
+func newTreeEntry(mode string, oid string, name string) (*TreeEntry, error) {
+	hash, err := hex.DecodeString(oid)
+	if err != nil {
+		return nil, err
+	}
+	objectType := ObjectTypeBlob
+	switch mode {
+	case "40000":
+		objectType = ObjectTypeTree
+	case "160000":
+		objectType = ObjectTypeCommit
+	}
+	return &TreeEntry{Mode: mode, Type: objectType, Hash: oid, HashBytes: hash, Name: name}, nil
+}
+
+// mergeFiles merges files present on both sides and changed differently:
+// their modes, then their contents, line by line for regular files
+func (merge *treeMerge) mergeFiles(filePath string, base *TreeEntry, ours *TreeEntry, theirs *TreeEntry) (
+	[]*TreeEntry, error) {
+	name := path.Base(filePath)
+	oursMode, theirsMode := treeEntryMode(*ours), treeEntryMode(*theirs)
+	if oursMode&0170000 != theirsMode&0170000 {
+		return merge.mergeDistinctTypes(filePath, base, ours, theirs)
+	}
+
+	clean := true
+	baseMode, baseHash := uint32(0), ""
+	if base != nil {
+		baseMode, baseHash = treeEntryMode(*base), base.Hash
+	}
+	mode := theirs.Mode
+	if oursMode != theirsMode && oursMode != baseMode {
+		mode = ours.Mode
+		clean = theirsMode == baseMode
+	}
+
+	oid := ""
+	reason := "content"
+	switch {
+	case ours.Hash == theirs.Hash || ours.Hash == baseHash:
+		oid = theirs.Hash
+	case theirs.Hash == baseHash:
+		oid = ours.Hash
+	case oursMode&0170000 == 0100000:
+		content, conflicts, err := merge.mergeContents(filePath, base, ours, theirs)
+		if err != nil {
+			return nil, err
+		}
+		if oid, err = writeBlob(content); err != nil {
+			return nil, err
+		}
+		clean = clean && conflicts == 0
+		if base == nil {
+			reason = "add/add"
+		}
+	default:
+		// symbolic links and submodules keep our version, or the base
+		// one in merge bases
+		oid = ours.Hash
+		if merge.depth > 0 && base != nil {
+			oid = base.Hash
+		}
+		clean = false
+		if oursMode == 0160000 {
+			reason = "submodule"
+		}
+	}
+
+	if !clean {
+		merge.message(filePath, "CONFLICT (%s): Merge conflict in %s", reason, filePath)
+		merge.conflict(filePath, base, ours, theirs)
+	}
+	entry, err := newTreeEntry(mode, oid, name)
+	return []*TreeEntry{entry}, err
+}
+
+// mergeContents merges the lines of regular files, binary files keeping
+// our version, or the base one in merge bases
+func (merge *treeMerge) mergeContents(filePath string, base *TreeEntry, ours *TreeEntry, theirs *TreeEntry) (
+	[]byte, int, error) {
+	contents := [3][]byte{}
+	for i, entry := range []*TreeEntry{base, ours, theirs} {
+		if entry == nil {
+			continue
+		}
+		object, err := NewObject(entry.Hash)
+		if err != nil {
+			return nil, 0, err
+		}
+		contents[i] = object.Content
+	}
+
+	if isBinary(contents[0]) || isBinary(contents[1]) || isBinary(contents[2]) {
+		merge.message(filePath, "warning: Cannot merge binary files: %s (%s vs. %s)",
+			filePath, merge.labels.ours, merge.labels.theirs)
+		merge.message(filePath, "Auto-merging %s", filePath)
+		if merge.depth > 0 {
+			return contents[0], 1, nil
+		}
+		return contents[1], 1, nil
+	}
+	merge.message(filePath, "Auto-merging %s", filePath)
+	return mergeLines(contents[0], contents[1], contents[2], &merge.labels, merge.style,
+		conflictMarkerSize+2*merge.depth)
+}
+
+// mergeDistinctTypes keeps files of different types, such as a file and a
+// symbolic link, at different paths: a regular file is moved aside to
+// "<path>~<side>", or both files when neither is a regular file
+func (merge *treeMerge) mergeDistinctTypes(filePath string, base *TreeEntry, ours *TreeEntry, theirs *TreeEntry) (
+	[]*TreeEntry, error) {
+	if merge.depth > 0 {
+		if base == nil {
+			return nil, nil
+		}
+		return []*TreeEntry{base}, nil
+	}
+
+	moveOurs := treeEntryMode(*ours)&0170000 == 0100000
+	moveTheirs := !moveOurs && treeEntryMode(*theirs)&0170000 == 0100000
+	how := "one of them"
+	if !moveOurs && !moveTheirs {
+		moveOurs, moveTheirs = true, true
+		how = "both of them"
+	}
+	merge.message(filePath, "CONFLICT (distinct types): %s had different types on each side; renamed %s so each can be recorded somewhere.",
+		filePath, how)
+
+	// each side keeps the base entry as stage 1 if it is of its type
+	dir := path.Dir(filePath)
+	entries := []*TreeEntry{}
+	for _, side := range []struct {
+		entry *TreeEntry
+		move  bool
+		label string
+		ours  bool
+	}{{ours, moveOurs, merge.labels.ours, true}, {theirs, moveTheirs, merge.labels.theirs, false}} {
+		entry := *side.entry
+		sidePath := filePath
+		if side.move {
+			entry.Name = entry.Name + "~" + strings.ReplaceAll(side.label, "/", "_")
+			sidePath = path.Join(dir, entry.Name)
+		}
+		var sideBase *TreeEntry
+		if base != nil && treeEntryMode(*base)&0170000 == treeEntryMode(entry)&0170000 {
+			sideBase = base
+		}
+		if side.ours {
+			merge.conflict(sidePath, sideBase, &entry, nil)
+		} else {
+			merge.conflict(sidePath, sideBase, nil, &entry)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+type MergeTreeOptions struct {
+	// list the conflicted paths without their stages
+	NameOnly bool
+	// show the messages about the merge, by default when there are
+	// conflicts
+	Messages *bool
+}
+
+// MergeTree merges two commits without touching the index nor the working
+// tree, and shows the merged tree, conflicted files having conflict
+// markers, then the stages of the conflicted files and the messages about
+// the merge; it returns whether the merge is clean
+func MergeTree(branch1 string, branch2 string, options *MergeTreeOptions) (bool, error) {
+	history := newCommitHistory()
+	commits := make([]*historyCommit, 2)
+	for i, revision := range []string{branch1, branch2} {
+		oid, err := resolveRevision(revision)
+		if err != nil {
+			return false, err
+		}
+		if commits[i], err = history.commit(oid); err != nil {
+			return false, err
+		}
+	}
+	merge, err := newTreeMerge(history, branch1, branch2)
+	if err != nil {
+		return false, err
+	}
+	tree, err := merge.mergeCommits(commits[0], commits[1])
+	if err != nil {
+		return false, err
+	}
+
+	clean := len(merge.conflicts) == 0
+	fmt.Println(tree)
+	sort.Slice(merge.conflicts, func(i, j int) bool {
+		return merge.conflicts[i].path < merge.conflicts[j].path
+	})
+	for _, conflict := range merge.conflicts {
+		if options.NameOnly {
+			fmt.Println(quotePath(conflict.path, false))
+			continue
+		}
+		for stage, entry := range conflict.stages {
+			if entry.Name != "" {
+				fmt.Printf("%s %s %d\t%s\n", formatTreeMode(entry.Mode), entry.Hash, stage+1,
+					quotePath(conflict.path, false))
+			}
+		}
+	}
+	showMessages := !clean
+	if options.Messages != nil {
+		showMessages = *options.Messages
+	}
+	if showMessages {
+		fmt.Println()
+		for _, message := range merge.sortedMessages() {
+			fmt.Println(message)
+		}
+	}
+	return clean, nil
+}
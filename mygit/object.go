@@ -27,10 +27,11 @@ func getObjectPath(sha string) string {
 }
 
 // Creates a new git object from the given hash of the object
+// Loose objects are looked up first, then packed objects
 func NewObject(sha string) (*Object, error) {
 	path := getObjectPath(sha)
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil, fmt.Errorf("object %s does not exist", sha)
+		return newPackedObject(sha)
 	}
 
 	hash := sha1.New()
@@ -83,6 +84,10 @@ func NewObject(sha string) (*Object, error) {
 		return nil, err
 	}
 
+	if len(content) != objSize {
+		return nil, fmt.Errorf("corrupt object, size mismatch")
+	}
+
 	return &Object{
 		Type:      objType,
 		Size:      objSize,
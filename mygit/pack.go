@@ -0,0 +1,266 @@
+package mygit
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const packDirectory = ".git/objects/pack"
+
+// number of delta base objects kept in memory per packfile
+const packCacheSize = 256
+
+// pack is a packfile of the object store along with its index
+type pack struct {
+	packPath string
+	index    *packIndex
+	file     *os.File
+
+	// delta base objects cache, by packfile offset
+	cache map[int64]*packCacheEntry
+}
+
+type packCacheEntry struct {
+	objectType PackFileObjectType
+	content    []byte
+}
+
+var loadedPacks []*pack
+var packsLoaded bool
+
+// getPacks returns every packfile of the object store,
+// loading their index on first use
+func getPacks() []*pack {
+	if packsLoaded {
+		return loadedPacks
+	}
+	packsLoaded = true
+
+	indexPaths, err := filepath.Glob(path.Join(packDirectory, "pack-*.idx"))
+	if err != nil {
+		return nil
+	}
+
+	for _, indexPath := range indexPaths {
+		packPath := strings.TrimSuffix(indexPath, ".idx") + ".pack"
+		if _, err := os.Stat(packPath); err != nil {
+			continue
+		}
+		index, err := readPackIndex(indexPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: ignoring pack index %s: %s\n", indexPath, err)
+			continue
+		}
+		loadedPacks = append(loadedPacks, &pack{
+			packPath: packPath,
+			index:    index,
+			cache:    map[int64]*packCacheEntry{},
+		})
+	}
+
+	return loadedPacks
+}
+
+// reloadPacks forgets the loaded packfiles so that
+// packfiles added or removed are taken into account
+func reloadPacks() {
+	for _, p := range loadedPacks {
+		if p.file != nil {
+			p.file.Close()
+		}
+	}
+	loadedPacks = nil
+	packsLoaded = false
+}
+
+// findPackedObject looks up an object in the index of every packfile
+// returns the packfile and the offset of the object in it
+func findPackedObject(sha string) (*pack, int64, bool) {
+	hashBytes, err := hex.DecodeString(sha)
+	if err != nil || len(hashBytes) != 20 {
+		return nil, 0, false
+	}
+
+	for _, p := range getPacks() {
+		if i, found := p.index.find(hashBytes); found {
+			return p, p.index.offset(i), true
+		}
+	}
+	return nil, 0, false
+}
+
+// newPackedObject reads an object stored in a packfile
+func newPackedObject(sha string) (*Object, error) {
+	p, offset, found := findPackedObject(sha)
+	if !found {
+		return nil, fmt.Errorf("object %s does not exist", sha)
+	}
+
+	objectType, content, err := p.readObject(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	objectTypeStr := PackFileObjectTypeString[objectType]
+	hashBytes := hashObjectContent(objectTypeStr, content)
+
+	// check if the hash of the object matches the given hash
+	if sha != fmt.Sprintf("%x", hashBytes) {
+		return nil, fmt.Errorf("corrupt object, hash mismatch")
+	}
+
+	return &Object{
+		Type:      ObjectType(objectTypeStr),
+		Size:      len(content),
+		Path:      p.packPath,
+		Content:   content,
+		Hash:      sha,
+		HashBytes: hashBytes,
+	}, nil
+}
+
+func (p *pack) open() error {
+	if p.file != nil {
+		return nil
+	}
+	file, err := os.Open(p.packPath)
+	if err != nil {
+		return err
+	}
+	p.file = file
+	return nil
+}
+
+// readObject reads the entry at the given offset of the packfile
+// and resolves its delta chain if needed
+func (p *pack) readObject(offset int64) (PackFileObjectType, []byte, error) {
+	if err := p.open(); err != nil {
+		return 0, nil, err
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(p.file, offset, 1<<62))
+
+	size, objectType, err := parseObjectHeader(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	switch objectType {
+	case OBJ_COMMIT, OBJ_TREE, OBJ_BLOB, OBJ_TAG:
+		content, err := parseObject(reader)
+		if err != nil {
+			return 0, nil, err
+		}
+		if uint32(len(content)) != size {
+			return 0, nil, fmt.Errorf("pack file object size mismatch")
+		}
+		return objectType, content, nil
+
+	case OBJ_REF_DELTA:
+		hash := make([]byte, 20)
+		if _, err := io.ReadFull(reader, hash); err != nil {
+			return 0, nil, err
+		}
+		delta, err := parseObject(reader)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		baseHash := fmt.Sprintf("%x", hash)
+		var baseType PackFileObjectType
+		var baseContent []byte
+		if i, found := p.index.find(hash); found {
+			baseType, baseContent, err = p.readBaseObject(p.index.offset(i))
+			if err != nil {
+				return 0, nil, err
+			}
+		} else {
+			baseObject, err := NewObject(baseHash)
+			if err != nil {
+				return 0, nil, err
+			}
+			baseType = packFileObjectType(baseObject.Type)
+			baseContent = baseObject.Content
+		}
+
+		content, err := applyDelta(baseContent, delta)
+		if err != nil {
+			return 0, nil, err
+		}
+		return baseType, content, nil
+
+	case OBJ_OFS_DELTA:
+		negativeOffset, err := parseDeltaOffset(reader)
+		if err != nil {
+			return 0, nil, err
+		}
+		if negativeOffset <= 0 || negativeOffset > offset {
+			return 0, nil, fmt.Errorf("pack file %s base offset out of bounds",
+				PackFileObjectTypeString[objectType])
+		}
+		delta, err := parseObject(reader)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		baseType, baseContent, err := p.readBaseObject(offset - negativeOffset)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		content, err := applyDelta(baseContent, delta)
+		if err != nil {
+			return 0, nil, err
+		}
+		return baseType, content, nil
+	}
+
+	return 0, nil, fmt.Errorf("invalid object type: %d", objectType)
+}
+
+// readBaseObject reads a delta base object, going through the cache
+func (p *pack) readBaseObject(offset int64) (PackFileObjectType, []byte, error) {
+	if cached, ok := p.cache[offset]; ok {
+		return cached.objectType, cached.content, nil
+	}
+
+	objectType, content, err := p.readObject(offset)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(p.cache) >= packCacheSize {
+		p.cache = map[int64]*packCacheEntry{}
+	}
+	p.cache[offset] = &packCacheEntry{objectType: objectType, content: content}
+
+	return objectType, content, nil
+}
+
+// storePackFile moves a received packfile into the object store
+// as pack-<checksum>.pack and writes its index
+func storePackFile(tempPackFilePath string, packFile []byte, entries []*packEntry) error {
+	packChecksum := packFile[len(packFile)-20:]
+	baseName := path.Join(packDirectory, fmt.Sprintf("pack-%x", packChecksum))
+
+	err := os.Rename(tempPackFilePath, baseName+".pack")
+	if err != nil {
+		return err
+	}
+
+	// the index is written last: a packfile is only
+	// visible to readers once its index exists
+	err = writePackIndexFile(baseName+".idx", entries, packChecksum)
+	if err != nil {
+		return err
+	}
+
+	reloadPacks()
+	return nil
+}
@@ -0,0 +1,219 @@
+package mygit
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Pack index (.idx) version 2 format, see `man gitformat-pack`:
+//
+//	┌──────────────────────────────────────────────┐
+//	│ magic "\377tOc" | version 2                   │
+//	│ fanout table: 256 x 4 bytes                   │
+//	│ sorted object names: N x 20 bytes             │
+//	│ CRC32 of packed entries: N x 4 bytes          │
+//	│ offsets: N x 4 bytes (MSB set => large table) │
+//	│ large offsets: M x 8 bytes                    │
+//	│ packfile checksum | index checksum            │
+//	└──────────────────────────────────────────────┘
+var packIndexMagic = []byte{0xff, 't', 'O', 'c'}
+
+const packIndexVersion = 2
+
+// packIndex is an in-memory .idx file
+type packIndex struct {
+	fanout       [256]uint32
+	hashes       []byte
+	crcs         []byte
+	offsets      []byte
+	largeOffsets []byte
+	packChecksum []byte
+}
+
+// readPackIndex reads a version 2 pack index file
+func readPackIndex(path string) (*packIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePackIndex(data)
+}
+
+func parsePackIndex(data []byte) (*packIndex, error) {
+	const headerSize = 8 + 256*4
+	if len(data) < headerSize+40 {
+		return nil, fmt.Errorf("pack index is too small")
+	}
+
+	if !bytes.Equal(data[:4], packIndexMagic) {
+		return nil, fmt.Errorf("invalid pack index header")
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version != packIndexVersion {
+		return nil, fmt.Errorf("unsupported pack index version %d", version)
+	}
+
+	checksum := sha1.Sum(data[:len(data)-20])
+	if !bytes.Equal(checksum[:], data[len(data)-20:]) {
+		return nil, fmt.Errorf("invalid pack index checksum")
+	}
+
+	index := &packIndex{}
+	for i := 0; i < 256; i++ {
+		index.fanout[i] = binary.BigEndian.Uint32(data[8+i*4:])
+	}
+
+	n := int(index.fanout[255])
+	position := headerSize
+	if len(data) < position+n*(20+4+4)+40 {
+		return nil, fmt.Errorf("pack index is truncated")
+	}
+	index.hashes = data[position : position+n*20]
+	position += n * 20
+	index.crcs = data[position : position+n*4]
+	position += n * 4
+	index.offsets = data[position : position+n*4]
+	position += n * 4
+	index.largeOffsets = data[position : len(data)-40]
+	index.packChecksum = data[len(data)-40 : len(data)-20]
+
+	return index, nil
+}
+
+// count returns the number of objects in the index
+func (index *packIndex) count() int {
+	return int(index.fanout[255])
+}
+
+// hash returns the object name at position i
+func (index *packIndex) hash(i int) []byte {
+	return index.hashes[i*20 : (i+1)*20]
+}
+
+// crc32 returns the CRC32 of the packed entry at position i
+func (index *packIndex) crc32(i int) uint32 {
+	return binary.BigEndian.Uint32(index.crcs[i*4:])
+}
+
+// offset returns the packfile offset of the entry at position i
+func (index *packIndex) offset(i int) int64 {
+	offset := binary.BigEndian.Uint32(index.offsets[i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset)
+	}
+	large := int(offset & 0x7fffffff)
+	return int64(binary.BigEndian.Uint64(index.largeOffsets[large*8:]))
+}
+
+// find looks up an object name using the fanout table
+// and a binary search on the sorted names
+func (index *packIndex) find(hashBytes []byte) (int, bool) {
+	low := 0
+	if hashBytes[0] > 0 {
+		low = int(index.fanout[hashBytes[0]-1])
+	}
+	high := int(index.fanout[hashBytes[0]])
+
+	i := low + sort.Search(high-low, func(i int) bool {
+		return bytes.Compare(index.hash(low+i), hashBytes) >= 0
+	})
+	if i < high && bytes.Equal(index.hash(i), hashBytes) {
+		return i, true
+	}
+	return 0, false
+}
+
+// findPrefix returns the object names starting with the given
+// hexadecimal prefix, in order
+func (index *packIndex) findPrefix(prefix string) []string {
+	// the lowest name with this prefix
+	lowest, err := hex.DecodeString(prefix + strings.Repeat("0", 40-len(prefix)))
+	if err != nil {
+		return nil
+	}
+
+	names := []string{}
+	i := sort.Search(index.count(), func(i int) bool {
+		return bytes.Compare(index.hash(i), lowest) >= 0
+	})
+	for ; i < index.count(); i++ {
+		name := hex.EncodeToString(index.hash(i))
+		if !strings.HasPrefix(name, prefix) {
+			break
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// writePackIndex writes a version 2 index of the given packfile entries
+func writePackIndex(w io.Writer, entries []*packEntry, packChecksum []byte) error {
+	sorted := make([]*packEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].hashBytes, sorted[j].hashBytes) < 0
+	})
+
+	buffer := bytes.Buffer{}
+	buffer.Write(packIndexMagic)
+	binary.Write(&buffer, binary.BigEndian, uint32(packIndexVersion))
+
+	var fanout [256]uint32
+	for _, entry := range sorted {
+		fanout[entry.hashBytes[0]]++
+	}
+	for i := 1; i < 256; i++ {
+		fanout[i] += fanout[i-1]
+	}
+	binary.Write(&buffer, binary.BigEndian, fanout)
+
+	for _, entry := range sorted {
+		buffer.Write(entry.hashBytes)
+	}
+	for _, entry := range sorted {
+		binary.Write(&buffer, binary.BigEndian, entry.crc32)
+	}
+
+	largeOffsets := []uint64{}
+	for _, entry := range sorted {
+		if entry.offset < 0x80000000 {
+			binary.Write(&buffer, binary.BigEndian, uint32(entry.offset))
+			continue
+		}
+		binary.Write(&buffer, binary.BigEndian, uint32(0x80000000|len(largeOffsets)))
+		largeOffsets = append(largeOffsets, uint64(entry.offset))
+	}
+	binary.Write(&buffer, binary.BigEndian, largeOffsets)
+
+	buffer.Write(packChecksum)
+	checksum := sha1.Sum(buffer.Bytes())
+	buffer.Write(checksum[:])
+
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+// writePackIndexFile writes the index to a temporary file
+// renamed once complete
+func writePackIndexFile(indexPath string, entries []*packEntry, packChecksum []byte) error {
+	tempIndexPath := indexPath + ".tmp"
+	indexFile, err := os.Create(tempIndexPath)
+	if err != nil {
+		return err
+	}
+	err = writePackIndex(indexFile, entries, packChecksum)
+	indexFile.Close()
+	if err != nil {
+		os.Remove(tempIndexPath)
+		return err
+	}
+
+	return os.Rename(tempIndexPath, indexPath)
+}
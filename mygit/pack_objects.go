@@ -0,0 +1,374 @@
+package mygit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	DefaultPackWindow = 10
+	DefaultPackDepth  = 50
+)
+
+type PackObjectsOptions struct {
+	// packfile and index are written to <BaseName>-<checksum>.{pack,idx}
+	BaseName string
+	// write the packfile to the standard output instead, without index
+	Stdout bool
+	// number of objects considered as delta base for each object,
+	// deltas are disabled when 0
+	Window int
+	// maximum delta chain length
+	Depth int
+	// use OBJ_OFS_DELTA rather than OBJ_REF_DELTA entries
+	DeltaBaseOffset bool
+}
+
+// packObjectInput is an object to pack along with the path it was found at,
+// used to group similar objects when searching for deltas
+type packObjectInput struct {
+	hash string
+	name string
+}
+
+// packObject is an object being written to a packfile
+type packObject struct {
+	hash       string
+	hashBytes  []byte
+	objectType PackFileObjectType
+	content    []byte
+	nameHash   uint32
+
+	// delta against base
+	base  *packObject
+	delta []byte
+	depth int
+	// index of the object as a delta base, while in the window
+	deltaIndex *deltaIndex
+
+	written bool
+	entry   *packEntry
+}
+
+// PackObjects creates a packed archive from the object IDs read from
+// the reader, one per line, optionally followed by a path name
+func PackObjects(reader io.Reader, options *PackObjectsOptions) error {
+	inputs := []packObjectInput{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		hash, name, _ := strings.Cut(line, " ")
+		if len(hash) != 40 {
+			return fmt.Errorf("expected object ID, got garbage:\n %s", line)
+		}
+		inputs = append(inputs, packObjectInput{hash: hash, name: name})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if options.Stdout {
+		_, _, err := writePack(os.Stdout, inputs, options)
+		return err
+	}
+
+	checksum, err := writePackFiles(options.BaseName, inputs, options)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(checksum)
+
+	return nil
+}
+
+// writePackFiles writes a packfile and its index
+// named after the packfile checksum, which is returned
+func writePackFiles(baseName string, inputs []packObjectInput, options *PackObjectsOptions) (string, error) {
+	dir := filepath.Dir(baseName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	tempPackFile, err := os.CreateTemp(dir, "tmp_pack_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempPackFile.Name())
+
+	writer := bufio.NewWriter(tempPackFile)
+	entries, packChecksum, err := writePack(writer, inputs, options)
+	if err == nil {
+		err = writer.Flush()
+	}
+	tempPackFile.Close()
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tempPackFile.Name(), 0644); err != nil {
+		return "", err
+	}
+
+	checksum := fmt.Sprintf("%x", packChecksum)
+	packBaseName := fmt.Sprintf("%s-%s", baseName, checksum)
+
+	err = os.Rename(tempPackFile.Name(), packBaseName+".pack")
+	if err != nil {
+		return "", err
+	}
+
+	err = writePackIndexFile(packBaseName+".idx", entries, packChecksum)
+	if err != nil {
+		return "", err
+	}
+
+	return checksum, nil
+}
+
+// writePack writes a version 2 packfile of the given objects, with deltas
+// Returns the written entries and the packfile checksum
+func writePack(w io.Writer, inputs []packObjectInput, options *PackObjectsOptions) (
+	[]*packEntry, []byte, error) {
+
+	objects := []*packObject{}
+	seen := map[string]bool{}
+	for _, input := range inputs {
+		if seen[input.hash] {
+			continue
+		}
+		seen[input.hash] = true
+
+		object, err := NewObject(input.hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		objectType := packFileObjectType(object.Type)
+		if objectType == 0 {
+			return nil, nil, fmt.Errorf("object %s has unknown type %s", object.Hash, object.Type)
+		}
+		objects = append(objects, &packObject{
+			hash:       object.Hash,
+			hashBytes:  object.HashBytes,
+			objectType: objectType,
+			content:    object.Content,
+			nameHash:   packNameHash(input.name),
+		})
+	}
+
+	findDeltas(objects, options)
+
+	hash := sha1.New()
+	packWriter := &packWriter{w: io.MultiWriter(w, hash)}
+
+	header := bytes.Buffer{}
+	header.WriteString("PACK")
+	binary.Write(&header, binary.BigEndian, uint32(2))
+	binary.Write(&header, binary.BigEndian, uint32(len(objects)))
+	if err := packWriter.write(header.Bytes()); err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]*packEntry, 0, len(objects))
+	for _, object := range objects {
+		written, err := packWriter.writeObject(object, options.DeltaBaseOffset)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries = append(entries, written...)
+	}
+
+	checksum := hash.Sum(nil)
+	if _, err := w.Write(checksum); err != nil {
+		return nil, nil, err
+	}
+
+	return entries, checksum, nil
+}
+
+// findDeltas looks for the best delta base of every object among
+// a sliding window of similar objects: objects are sorted by type,
+// name hash and decreasing size so that a base is usually a larger
+// version of the same file
+func findDeltas(objects []*packObject, options *PackObjectsOptions) {
+	window := options.Window
+	maxDepth := options.Depth
+	if window <= 0 || maxDepth <= 0 {
+		return
+	}
+
+	sorted := make([]*packObject, len(objects))
+	copy(sorted, objects)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.objectType != b.objectType {
+			return a.objectType > b.objectType
+		}
+		if a.nameHash != b.nameHash {
+			return a.nameHash > b.nameHash
+		}
+		return len(a.content) > len(b.content)
+	})
+
+	for i, target := range sorted {
+		if i > window {
+			sorted[i-window-1].deltaIndex = nil
+		}
+
+		for j := max(0, i-window); j < i; j++ {
+			base := sorted[j]
+			if base.objectType != target.objectType || base.depth >= maxDepth {
+				continue
+			}
+
+			// the delta must be worth it, and smaller than the best one so far
+			maxSize := len(target.content)/2 - 20
+			if target.delta != nil {
+				maxSize = len(target.delta) - 1
+			}
+			sizeDiff := len(target.content) - len(base.content)
+			if maxSize <= 0 || sizeDiff >= maxSize || len(target.content) < len(base.content)/32 {
+				continue
+			}
+
+			if base.deltaIndex == nil {
+				base.deltaIndex = newDeltaIndex(base.content)
+			}
+			delta := base.deltaIndex.createDelta(target.content, maxSize)
+			if delta == nil {
+				continue
+			}
+			target.base = base
+			target.delta = delta
+			target.depth = base.depth + 1
+		}
+	}
+}
+
+// packNameHash creates a sortable number from the last sixteen
+// non-whitespace characters of a path: last characters count most,
+// so that files with the same extension sort together
+func packNameHash(name string) uint32 {
+	hash := uint32(0)
+	for _, c := range []byte(name) {
+		if unicode.IsSpace(rune(c)) {
+			continue
+		}
+		hash = (hash >> 2) + (uint32(c) << 24)
+	}
+	return hash
+}
+
+// packWriter writes packfile entries while keeping track of the offset
+type packWriter struct {
+	w      io.Writer
+	offset int64
+}
+
+func (pw *packWriter) write(data []byte) error {
+	n, err := pw.w.Write(data)
+	pw.offset += int64(n)
+	return err
+}
+
+// writeObject writes an object entry, after its delta base if needed
+// Returns every written entry
+func (pw *packWriter) writeObject(object *packObject, deltaBaseOffset bool) ([]*packEntry, error) {
+	if object.written {
+		return nil, nil
+	}
+
+	written := []*packEntry{}
+	if object.base != nil && !object.base.written {
+		baseEntries, err := pw.writeObject(object.base, deltaBaseOffset)
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, baseEntries...)
+	}
+
+	entry := &packEntry{
+		offset:      pw.offset,
+		objectType:  object.objectType,
+		resolved:    true,
+		contentType: object.objectType,
+		hash:        object.hash,
+		hashBytes:   object.hashBytes,
+	}
+
+	data := object.content
+	if object.base != nil {
+		data = object.delta
+		entry.objectType = OBJ_REF_DELTA
+		if deltaBaseOffset {
+			entry.objectType = OBJ_OFS_DELTA
+		}
+	}
+	entry.size = uint32(len(data))
+
+	buffer := bytes.Buffer{}
+	buffer.Write(encodeObjectHeader(entry.objectType, uint64(len(data))))
+	if entry.objectType == OBJ_OFS_DELTA {
+		buffer.Write(encodeDeltaOffset(entry.offset - object.base.entry.offset))
+	} else if entry.objectType == OBJ_REF_DELTA {
+		buffer.Write(object.base.hashBytes)
+	}
+
+	zlibWriter := zlib.NewWriter(&buffer)
+	if _, err := zlibWriter.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zlibWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := pw.write(buffer.Bytes()); err != nil {
+		return nil, err
+	}
+
+	entry.end = pw.offset
+	entry.crc32 = crc32.ChecksumIEEE(buffer.Bytes())
+	object.written = true
+	object.entry = entry
+
+	return append(written, entry), nil
+}
+
+// encodeObjectHeader encodes a packfile entry header,
+// the reverse of parseObjectHeader
+func encodeObjectHeader(objectType PackFileObjectType, size uint64) []byte {
+	b := byte(objectType)<<4 | byte(size&0x0f)
+	size >>= 4
+
+	header := []byte{}
+	for size != 0 {
+		header = append(header, b|0x80)
+		b = byte(size & 0x7f)
+		size >>= 7
+	}
+	return append(header, b)
+}
+
+// encodeDeltaOffset encodes the base offset of a OBJ_OFS_DELTA entry,
+// the reverse of parseDeltaOffset
+func encodeDeltaOffset(offset int64) []byte {
+	encoded := []byte{byte(offset & 0x7f)}
+	for offset >>= 7; offset != 0; offset >>= 7 {
+		offset--
+		encoded = append([]byte{byte(offset&0x7f) | 0x80}, encoded...)
+	}
+	return encoded
+}
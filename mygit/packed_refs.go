@@ -0,0 +1,227 @@
+package mygit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// packed-refs file format:
+//
+//	# pack-refs with: peeled fully-peeled sorted
+//	<oid> <refname>
+//	^<peeled oid>          object an annotated tag points to
+//
+// Loose refs take precedence over packed refs of the same name
+const packedRefsPath = ".git/packed-refs"
+
+const packedRefsHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+
+type packedRef struct {
+	name string
+	oid  string
+	// object the annotated tag oid points to, empty for other objects
+	peeled string
+}
+
+// readPackedRefs returns the refs of the packed-refs file, sorted by name
+func readPackedRefs() ([]packedRef, error) {
+	data, err := os.ReadFile(packedRefsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []packedRef{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "^"):
+			peeled := line[1:]
+			if len(refs) == 0 || len(peeled) != 40 || !isHex(peeled) {
+				return nil, fmt.Errorf("invalid packed-refs line: %s", line)
+			}
+			refs[len(refs)-1].peeled = peeled
+		default:
+			oid, name, found := strings.Cut(line, " ")
+			if !found || len(oid) != 40 || !isHex(oid) || !validRefName(name) {
+				return nil, fmt.Errorf("invalid packed-refs line: %s", line)
+			}
+			refs = append(refs, packedRef{name: name, oid: oid})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].name < refs[j].name
+	})
+	return refs, nil
+}
+
+// findPackedRef looks up a ref in the packed-refs file
+func findPackedRef(refName string) (*packedRef, error) {
+	refs, err := readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	i := sort.Search(len(refs), func(i int) bool {
+		return refs[i].name >= refName
+	})
+	if i < len(refs) && refs[i].name == refName {
+		return &refs[i], nil
+	}
+	return nil, nil
+}
+
+// writePackedRefs writes the packed-refs content of the given refs to the
+// lock of the packed-refs file, peeling annotated tags
+func writePackedRefs(lock *lockFile, refs []packedRef) error {
+	sorted := make([]packedRef, len(refs))
+	copy(sorted, refs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+
+	buffer := bytes.Buffer{}
+	buffer.WriteString(packedRefsHeader)
+	for _, ref := range sorted {
+		fmt.Fprintf(&buffer, "%s %s\n", ref.oid, ref.name)
+
+		peeled := ref.peeled
+		if peeled == "" {
+			if object, err := NewObject(ref.oid); err == nil && object.Type == ObjectTypeTag {
+				peeledObject, err := peelObject(ref.oid)
+				if err != nil {
+					return err
+				}
+				peeled = peeledObject.Hash
+			}
+		}
+		if peeled != "" {
+			fmt.Fprintf(&buffer, "^%s\n", peeled)
+		}
+	}
+
+	_, err := lock.Write(buffer.Bytes())
+	return err
+}
+
+// replacePackedRefs replaces the packed-refs file with the given refs
+func replacePackedRefs(refs []packedRef) error {
+	lock, err := lockPath(packedRefsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+
+	if err := writePackedRefs(lock, refs); err != nil {
+		return err
+	}
+	return lock.commit()
+}
+
+type PackRefsOptions struct {
+	// pack every ref, not only tags and already packed refs
+	All bool
+}
+
+// PackRefs moves loose refs into the packed-refs file and removes
+// the loose files
+func PackRefs(options *PackRefsOptions) error {
+	lock, err := lockPath(packedRefsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+
+	refs, err := readPackedRefs()
+	if err != nil {
+		return err
+	}
+	byName := map[string]packedRef{}
+	for _, ref := range refs {
+		byName[ref.name] = ref
+	}
+
+	looseNames, err := looseRefs("refs/")
+	if err != nil {
+		return err
+	}
+
+	packed := map[string]string{}
+	for _, name := range looseNames {
+		refName := "refs/" + name
+		if !options.All && !strings.HasPrefix(refName, "refs/tags/") {
+			if _, ok := byName[refName]; !ok {
+				continue
+			}
+		}
+
+		oid, symbolic, err := readLooseRef(refName)
+		if err != nil {
+			return err
+		}
+		// symbolic refs such as refs/remotes/origin/HEAD stay loose
+		if symbolic {
+			continue
+		}
+		if len(oid) != 40 || !isHex(oid) {
+			fmt.Fprintf(os.Stderr, "warning: ignoring broken ref %s\n", refName)
+			continue
+		}
+
+		byName[refName] = packedRef{name: refName, oid: oid}
+		packed[refName] = oid
+	}
+
+	refs = make([]packedRef, 0, len(byName))
+	for _, ref := range byName {
+		refs = append(refs, ref)
+	}
+	if err := writePackedRefs(lock, refs); err != nil {
+		return err
+	}
+	if err := lock.commit(); err != nil {
+		return err
+	}
+
+	// a loose ref updated since it was read is kept, it overrides the packed one
+	for refName, oid := range packed {
+		if err := pruneLooseRef(refName, oid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneLooseRef removes a packed loose ref, under its lock,
+// if it still points to oid
+func pruneLooseRef(refName string, oid string) error {
+	lock, err := lockPath(path.Join(".git", refName))
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+
+	current, _, err := readLooseRef(refName)
+	if err != nil || current != oid {
+		return err
+	}
+	if err := os.Remove(path.Join(".git", refName)); err != nil {
+		return err
+	}
+	lock.rollback()
+	removeEmptyRefDirs(refName)
+	return nil
+}
@@ -0,0 +1,151 @@
+package mygit
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// pathspec is a pattern selecting working tree paths: a file, a
+// directory and everything under it, or a glob whose wildcards match
+// '/' too, "." selecting everything
+type pathspec struct {
+	pattern string
+	glob    *regexp.Regexp
+}
+
+func newPathspec(pattern string) *pathspec {
+	spec := &pathspec{pattern: path.Clean(filepath.ToSlash(pattern))}
+	if strings.ContainsAny(spec.pattern, "*?[") {
+		spec.glob = globRegexp(spec.pattern)
+	}
+	return spec
+}
+
+// globRegexp converts a glob to a regular expression matching whole
+// paths, '*' matching any string
+func globRegexp(glob string) *regexp.Regexp {
+	expression := strings.Builder{}
+	expression.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			expression.WriteString(".*")
+		case '?':
+			expression.WriteString(".")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expression.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expression.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expression.WriteString("$")
+	matcher, err := regexp.Compile(expression.String())
+	if err != nil {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(glob) + "$")
+	}
+	return matcher
+}
+
+// matches checks whether a path is selected by the pathspec
+func (spec *pathspec) matches(filePath string) bool {
+	if spec.pattern == "." || filePath == spec.pattern ||
+		strings.HasPrefix(filePath, spec.pattern+"/") {
+		return true
+	}
+	return spec.glob != nil && spec.glob.MatchString(filePath)
+}
+
+// leadsInto checks whether the pathspec may select paths under a
+// directory, comparing the directory with the part before any wildcard
+func (spec *pathspec) leadsInto(dir string) bool {
+	literal := spec.pattern
+	if spec.glob != nil {
+		literal = literal[:strings.IndexAny(literal, "*?[")]
+		if strings.HasPrefix(dir+"/", literal) {
+			return true
+		}
+	}
+	return strings.HasPrefix(literal, dir+"/")
+}
+
+// parsePathspecs returns the pathspecs of the given patterns
+func parsePathspecs(patterns []string) []*pathspec {
+	specs := make([]*pathspec, 0, len(patterns))
+	for _, pattern := range patterns {
+		specs = append(specs, newPathspec(pattern))
+	}
+	return specs
+}
+
+// matchPathspecs checks a path against pathspecs, marking the ones that
+// match it, no pathspec matching every path
+func matchPathspecs(specs []*pathspec, filePath string, matched []bool) bool {
+	if len(specs) == 0 {
+		return true
+	}
+	found := false
+	for i, spec := range specs {
+		if spec.matches(filePath) {
+			matched[i] = true
+			found = true
+		}
+	}
+	return found
+}
+
+// workingTreeFiles returns the files of the working tree, by path
+// relative to its root and sorted, leaving out .git and nested
+// repositories
+func workingTreeFiles() ([]string, map[string]fs.FileInfo, error) {
+	paths := []string{}
+	files := map[string]fs.FileInfo{}
+	err := filepath.WalkDir(".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if filePath == "." {
+				return nil
+			}
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Lstat(filepath.Join(filePath, ".git")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && info.Mode()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		filePath = filepath.ToSlash(filePath)
+		paths = append(paths, filePath)
+		files[filePath] = info
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(paths)
+	return paths, files, nil
+}
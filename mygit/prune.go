@@ -0,0 +1,85 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type PruneOptions struct {
+	// only prune loose objects older than this date, everything by default
+	Expire  string
+	DryRun  bool
+	Verbose bool
+}
+
+// Prune removes the unreachable loose objects older than the expiry date,
+// and the loose objects that are also packed
+func Prune(options *PruneOptions) error {
+	expire := options.Expire
+	if expire == "" {
+		expire = "now"
+	}
+	expireDate, err := parseApproxDate(expire, time.Now())
+	if err != nil {
+		return err
+	}
+
+	roots, err := rootObjects()
+	if err != nil {
+		return err
+	}
+	reachable, err := reachableObjects(rootObjectIDs(roots))
+	if err != nil {
+		return err
+	}
+	reachableSet := make(map[string]bool, len(reachable))
+	for _, input := range reachable {
+		reachableSet[input.hash] = true
+	}
+
+	oids, err := looseObjects()
+	if err != nil {
+		return err
+	}
+
+	for _, oid := range oids {
+		if reachableSet[oid] {
+			continue
+		}
+
+		objectPath := getObjectPath(oid)
+		info, err := os.Stat(objectPath)
+		if err != nil {
+			return err
+		}
+		// objects still in their grace period may be about to be referenced
+		if !info.ModTime().Before(expireDate) {
+			continue
+		}
+
+		if options.DryRun || options.Verbose {
+			objectType := "unknown"
+			if object, err := NewObject(oid); err == nil {
+				objectType = string(object.Type)
+			}
+			fmt.Printf("%s %s\n", oid, objectType)
+		}
+		if options.DryRun {
+			continue
+		}
+
+		if err := os.Remove(objectPath); err != nil {
+			return err
+		}
+		// remove the fan-out directory once empty
+		os.Remove(filepath.Dir(objectPath))
+	}
+
+	if options.DryRun {
+		return nil
+	}
+
+	return prunePacked()
+}
@@ -0,0 +1,238 @@
+package mygit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const zeroOID = "0000000000000000000000000000000000000000"
+
+// rootObject is an object every other reachable object is found from
+type rootObject struct {
+	// HEAD, refs/<ref>, logs/<ref> for reflog entries or index for
+	// staged files
+	name string
+	oid  string
+}
+
+// rootObjects returns the objects pointed to by HEAD, every ref,
+// every reflog entry and the index
+func rootObjects() ([]rootObject, error) {
+	roots := []rootObject{}
+
+	head, err := getHeadOID()
+	if err != nil {
+		return nil, err
+	}
+	if head != "" {
+		roots = append(roots, rootObject{name: "HEAD", oid: head})
+	}
+
+	// refs
+	err = filepath.WalkDir(".git/refs", func(refPath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(refPath)
+		if err != nil {
+			return err
+		}
+		value := strings.TrimSpace(string(data))
+		if strings.HasPrefix(value, "ref: ") {
+			return nil
+		}
+		if len(value) != 40 {
+			fmt.Fprintf(os.Stderr, "warning: ignoring broken ref %s\n", refPath)
+			return nil
+		}
+		roots = append(roots, rootObject{name: gitRelativePath(refPath), oid: value})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// packed refs, unless a loose ref of the same name shadows them
+	packed, err := readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range packed {
+		if _, err := os.Stat(path.Join(".git", ref.name)); err == nil {
+			continue
+		}
+		roots = append(roots, rootObject{name: ref.name, oid: ref.oid})
+	}
+
+	// reflogs: <old_oid> <new_oid> <committer> <timestamp> <tz>\t<message>
+	err = filepath.WalkDir(".git/logs", func(logPath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(logPath)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 {
+				continue
+			}
+			for _, oid := range fields[:2] {
+				if len(oid) == 40 && oid != zeroOID {
+					roots = append(roots, rootObject{name: gitRelativePath(logPath), oid: oid})
+				}
+			}
+		}
+		return scanner.Err()
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// staged files
+	index, err := readIndex()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range index.entries {
+		// submodule commits are not part of the repository
+		if entry.mode != 0160000 {
+			roots = append(roots, rootObject{name: "index", oid: entry.oid})
+		}
+	}
+
+	return roots, nil
+}
+
+// gitRelativePath returns a path relative to the .git directory
+func gitRelativePath(gitPath string) string {
+	return strings.TrimPrefix(filepath.ToSlash(gitPath), ".git/")
+}
+
+// rootObjectIDs returns the object IDs of the given roots
+func rootObjectIDs(roots []rootObject) []string {
+	oids := make([]string, 0, len(roots))
+	for _, root := range roots {
+		oids = append(oids, root.oid)
+	}
+	return oids
+}
+
+// reachableObjects walks commits and trees from the given roots
+// Returns every reachable object once, commits first, along with
+// the path trees and blobs were found at
+func reachableObjects(roots []string) ([]packObjectInput, error) {
+	seen := map[string]bool{}
+	commits := []packObjectInput{}
+	others := []packObjectInput{}
+	trees := []string{}
+
+	queue := []string{}
+	for _, root := range roots {
+		if !seen[root] {
+			seen[root] = true
+			queue = append(queue, root)
+		}
+	}
+
+	// commits and tags
+	for len(queue) > 0 {
+		oid := queue[0]
+		queue = queue[1:]
+
+		object, err := NewObject(oid)
+		if err != nil {
+			return nil, err
+		}
+
+		switch object.Type {
+		case ObjectTypeCommit:
+			commit, err := parseCommitObject(object)
+			if err != nil {
+				return nil, err
+			}
+			commits = append(commits, packObjectInput{hash: oid})
+			if !seen[commit.Tree] {
+				seen[commit.Tree] = true
+				trees = append(trees, commit.Tree)
+			}
+			for _, parent := range commit.Parents {
+				if !seen[parent] {
+					seen[parent] = true
+					queue = append(queue, parent)
+				}
+			}
+		case ObjectTypeTree:
+			trees = append(trees, oid)
+		case ObjectTypeBlob:
+			others = append(others, packObjectInput{hash: oid})
+		case ObjectTypeTag:
+			tag, err := parseTagObject(object)
+			if err != nil {
+				return nil, err
+			}
+			others = append(others, packObjectInput{hash: oid})
+			if !seen[tag.Object] {
+				seen[tag.Object] = true
+				queue = append(queue, tag.Object)
+			}
+		default:
+			return nil, fmt.Errorf("object %s has an unknown type %s", oid, object.Type)
+		}
+	}
+
+	// trees and blobs
+	var walkTree func(oid string, treePath string) error
+	walkTree = func(oid string, treePath string) error {
+		others = append(others, packObjectInput{hash: oid, name: treePath})
+
+		object, err := NewObject(oid)
+		if err != nil {
+			return err
+		}
+		if object.Type != ObjectTypeTree {
+			return fmt.Errorf("object %s is not a tree", oid)
+		}
+		entries, err := parseTree(bufio.NewReader(bytes.NewReader(object.Content)))
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			// submodule commits are not part of the repository
+			if entry.Mode == "160000" || seen[entry.Hash] {
+				continue
+			}
+			seen[entry.Hash] = true
+
+			entryPath := path.Join(treePath, entry.Name)
+			if entry.Type == ObjectTypeTree {
+				if err := walkTree(entry.Hash, entryPath); err != nil {
+					return err
+				}
+			} else {
+				if !objectExists(entry.Hash) {
+					return fmt.Errorf("object %s does not exist", entry.Hash)
+				}
+				others = append(others, packObjectInput{hash: entry.Hash, name: entryPath})
+			}
+		}
+		return nil
+	}
+
+	for _, tree := range trees {
+		if err := walkTree(tree, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return append(commits, others...), nil
+}
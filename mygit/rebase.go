@@ -0,0 +1,1110 @@
+package mygit
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// files of a rebase in progress: the directory of its state, and the
+// commit it stopped at
+const (
+	rebaseDir      = ".git/rebase-merge"
+	rebaseHeadPath = ".git/REBASE_HEAD"
+)
+
+// rebaseState is a rebase in progress, kept in the files of rebaseDir
+type rebaseState struct {
+	// branch rebased, "detached HEAD" when HEAD was detached
+	headName string
+	// commit the commits are replayed onto, and commit HEAD was at
+	onto     string
+	origHead string
+	// commands left to run, and the commands run, the last one being the
+	// command the rebase stopped at
+	todo []todoCommand
+	done []todoCommand
+	// the commits that become empty are left out, instead of stopping
+	// the rebase as an interactive rebase does
+	dropEmpty bool
+}
+
+// rebaseStep is the outcome of a command of a rebase
+type rebaseStep int
+
+const (
+	// the rebase goes on with the next command
+	stepDone rebaseStep = iota
+	// the rebase stops as asked, by edit or break
+	stepStopped
+	// the rebase stops at a conflict or a failed exec
+	stepFailed
+)
+
+// readRebaseState reads the state of the rebase in progress, nil if there
+// is none
+func readRebaseState() (*rebaseState, error) {
+	if _, err := os.Stat(rebaseDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	state := &rebaseState{}
+	for name, value := range map[string]*string{
+		"head-name": &state.headName,
+		"onto":      &state.onto,
+		"orig-head": &state.origHead,
+	} {
+		data, err := os.ReadFile(path.Join(rebaseDir, name))
+		if err != nil {
+			return nil, err
+		}
+		*value = strings.TrimSpace(string(data))
+	}
+	var err error
+	if state.todo, err = readTodoFile(path.Join(rebaseDir, "git-rebase-todo")); err != nil {
+		return nil, err
+	}
+	if state.done, err = readTodoFile(path.Join(rebaseDir, "done")); err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(path.Join(rebaseDir, "drop_redundant_commits"))
+	state.dropEmpty = err == nil
+	return state, nil
+}
+
+// write writes the state of a rebase starting, marked interactive as git
+// marks the rebases run by commands of a todo list
+func (state *rebaseState) write() error {
+	if err := os.MkdirAll(rebaseDir, 0755); err != nil {
+		return err
+	}
+	files := map[string]string{
+		"head-name": state.headName,
+		"onto":      state.onto,
+		"orig-head": state.origHead,
+	}
+	for name, value := range files {
+		if err := os.WriteFile(path.Join(rebaseDir, name), []byte(value+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+	flags := []string{"interactive"}
+	if state.dropEmpty {
+		flags = append(flags, "drop_redundant_commits")
+	}
+	for _, name := range flags {
+		if err := os.WriteFile(path.Join(rebaseDir, name), nil, 0644); err != nil {
+			return err
+		}
+	}
+	return state.writeTodo()
+}
+
+// writeTodo writes the commands left and the commands run, and their
+// numbers
+func (state *rebaseState) writeTodo() error {
+	files := map[string]string{
+		"git-rebase-todo": formatTodo(state.todo, false),
+		"done":            formatTodo(state.done, false),
+		"msgnum":          strconv.Itoa(len(state.done)) + "\n",
+		"end":             strconv.Itoa(len(state.done)+len(state.todo)) + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(path.Join(rebaseDir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type RebaseOptions struct {
+	// let the user edit the todo list before running it
+	Interactive bool
+}
+
+// Rebase replays the commits of HEAD missing from upstream on top of it,
+// merges left out, as well as the commits whose change upstream already
+// has; the branch of HEAD is then moved to the last commit replayed. The
+// commits are replayed by the commands of a todo list, which the user edits
+// in the sequence editor with Interactive. It returns false when stopped at
+// a conflict, the rebase going on with RebaseContinue or RebaseSkip
+func Rebase(upstream string, options *RebaseOptions) (bool, error) {
+	if state, err := readRebaseState(); err != nil {
+		return false, err
+	} else if state != nil {
+		return false, fmt.Errorf("a rebase is already in progress\n" +
+			"hint: try \"git rebase (--continue | --skip | --abort)\"")
+	}
+	if mergeHead, err := readMergeHead(); err != nil {
+		return false, err
+	} else if mergeHead != "" {
+		return false, fmt.Errorf("you have not concluded your merge (MERGE_HEAD exists)")
+	}
+	if pickHead, _, err := readPickHead(); err != nil {
+		return false, err
+	} else if _, err := os.Stat(sequencerDir); pickHead != "" || err == nil {
+		return false, fmt.Errorf("a cherry-pick or revert is in progress")
+	}
+
+	headRef, head, err := readHead()
+	if err != nil {
+		return false, err
+	}
+	if head == "" {
+		return false, fmt.Errorf("cannot rebase an unborn branch")
+	}
+	oid, err := resolveRevision(upstream)
+	if err != nil {
+		return false, fmt.Errorf("invalid upstream '%s'", upstream)
+	}
+	onto, err := peelToCommit(oid)
+	if err != nil {
+		return false, err
+	}
+	headCommit, err := peelToCommit(head)
+	if err != nil {
+		return false, err
+	}
+	if err := requireCleanWorktree(headCommit.Tree); err != nil {
+		return false, err
+	}
+
+	if !options.Interactive {
+		upToDate, err := newCommitHistory().isAncestor(onto.Hash, head)
+		if err != nil {
+			return false, err
+		}
+		// the merges on top of upstream are left out by a rebase
+		if upToDate {
+			commits, err := rangeCommits([]revisionSpec{{oid: onto.Hash, exclude: true}, {oid: head}})
+			if err != nil {
+				return false, err
+			}
+			for _, commit := range commits {
+				upToDate = upToDate && len(commit.Parents) <= 1
+			}
+		}
+		if upToDate && headRef != "" {
+			fmt.Printf("Current branch %s is up to date.\n", strings.TrimPrefix(headRef, headsPrefix))
+			return true, nil
+		} else if upToDate {
+			fmt.Println("HEAD is up to date.")
+			return true, nil
+		}
+	}
+
+	commits, err := rebaseCommits(onto.Hash, head)
+	if err != nil {
+		return false, err
+	}
+	state := &rebaseState{
+		headName:  headRef,
+		onto:      onto.Hash,
+		origHead:  head,
+		dropEmpty: !options.Interactive,
+	}
+	if headRef == "" {
+		state.headName = "detached HEAD"
+	}
+	for _, commit := range commits {
+		state.todo = append(state.todo, pickCommand("pick", commit))
+	}
+	if err := state.write(); err != nil {
+		return false, err
+	}
+
+	if options.Interactive {
+		description := fmt.Sprintf("%s..%s onto %s", shortestUniqueAbbrev(onto.Hash, DefaultAbbrev),
+			shortestUniqueAbbrev(head, DefaultAbbrev), shortestUniqueAbbrev(onto.Hash, DefaultAbbrev))
+		commands, err := editTodo(state.todo, description)
+		if err == nil && len(commands) == 0 {
+			err = fmt.Errorf("nothing to do")
+		}
+		if err != nil {
+			os.RemoveAll(rebaseDir)
+			return false, err
+		}
+		// noop only keeps an empty list from aborting the rebase
+		state.todo = []todoCommand{}
+		for _, command := range commands {
+			if command.action != "noop" {
+				state.todo = append(state.todo, command)
+			}
+		}
+	}
+
+	// the commits already on top of onto are kept as they are
+	start := onto
+	for len(state.todo) > 0 && state.todo[0].action == "pick" {
+		commit, err := peelToCommit(state.todo[0].oid)
+		if err != nil {
+			return false, err
+		}
+		if len(commit.Parents) != 1 || commit.Parents[0] != start.Hash {
+			break
+		}
+		start = commit
+		state.done = append(state.done, state.todo[0])
+		state.todo = state.todo[1:]
+	}
+	if err := state.writeTodo(); err != nil {
+		return false, err
+	}
+
+	if err := writeRef("ORIG_HEAD", head, ""); err != nil {
+		return false, err
+	}
+	if err := checkoutTree(headCommit.Tree, start.Tree, "checkout"); err != nil {
+		os.RemoveAll(rebaseDir)
+		return false, err
+	}
+	if err := writeRef("HEAD", start.Hash, "rebase (start): checkout "+upstream); err != nil {
+		return false, err
+	}
+	return state.run()
+}
+
+// requireCleanWorktree refuses a rebase when the index or the working tree
+// have changes of tracked files
+func requireCleanWorktree(headTree string) error {
+	index, err := readIndex()
+	if err != nil {
+		return err
+	}
+	if len(index.unmerged()) > 0 {
+		return fmt.Errorf("cannot rebase: you have unmerged files")
+	}
+	indexTree, err := WriteTree()
+	if err != nil {
+		return err
+	}
+	if indexTree != headTree {
+		return fmt.Errorf("cannot rebase: Your index contains uncommitted changes.\n" +
+			"Please commit or stash them.")
+	}
+	worktree, err := worktreeDiffFiles(index)
+	if err != nil {
+		return err
+	}
+	if len(diffFiles(indexDiffFiles(index), worktree, nil)) > 0 {
+		return fmt.Errorf("cannot rebase: You have unstaged changes.\n" +
+			"Please commit or stash them.")
+	}
+	return nil
+}
+
+// rebaseCommits returns the commits of head to replay onto upstream,
+// parents first: the commits that upstream does not have, except for
+// merges and the commits whose change upstream has, cherry-picked
+func rebaseCommits(upstream string, head string) ([]*CommitObject, error) {
+	commits, err := rangeCommits([]revisionSpec{{oid: upstream, exclude: true}, {oid: head}})
+	if err != nil || len(commits) == 0 {
+		return commits, err
+	}
+	upstreamCommits, err := rangeCommits([]revisionSpec{{oid: head, exclude: true}, {oid: upstream}})
+	if err != nil {
+		return nil, err
+	}
+	applied := map[string]bool{}
+	for _, commit := range upstreamCommits {
+		if len(commit.Parents) > 1 {
+			continue
+		}
+		id, err := patchID(commit)
+		if err != nil {
+			return nil, err
+		}
+		applied[id] = true
+	}
+
+	replayed := []*CommitObject{}
+	skipped := false
+	for _, commit := range commits {
+		if len(commit.Parents) > 1 {
+			continue
+		}
+		if len(applied) > 0 {
+			id, err := patchID(commit)
+			if err != nil {
+				return nil, err
+			}
+			if applied[id] {
+				fmt.Fprintf(os.Stderr, "warning: skipped previously applied commit %s\n",
+					shortestUniqueAbbrev(commit.Hash, DefaultAbbrev))
+				skipped = true
+				continue
+			}
+		}
+		replayed = append(replayed, commit)
+	}
+	if skipped {
+		fmt.Fprintln(os.Stderr, "hint: use --reapply-cherry-picks to include skipped commits\n"+
+			"hint: Disable this message with \"git config advice.skippedCherryPicks false\"")
+	}
+	return replayed, nil
+}
+
+// patchID identifies the change a commit made to its parent wherever it is
+// applied, as git patch-id does: the changed paths and lines are hashed,
+// leaving out the line numbers and the lines around the changes
+func patchID(commit *CommitObject) (string, error) {
+	parentTree := ""
+	if len(commit.Parents) > 0 {
+		var err error
+		if parentTree, err = commitTreeOID(commit.Parents[0]); err != nil {
+			return "", err
+		}
+	}
+	changes, err := CompareTrees(parentTree, commit.Tree, &CompareTreesOptions{Recursive: true})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha1.New()
+	for _, change := range changes {
+		pair := treeChangePair(change)
+		fmt.Fprintf(hash, "%s %o %o\n", change.Path, pair.old.mode, pair.new.mode)
+		content1, content2, err := pair.contents()
+		if err != nil {
+			return "", err
+		}
+		if isBinary(content1) || isBinary(content2) {
+			fmt.Fprintf(hash, "%s %s\n", pair.old.oid, pair.new.oid)
+			continue
+		}
+		lines1, lines2, script, err := lineChanges(content1, content2, &DiffOptions{})
+		if err != nil {
+			return "", err
+		}
+		for _, change := range script {
+			for _, line := range lines1[change.i1 : change.i1+change.chg1] {
+				hash.Write([]byte("-" + line))
+			}
+			for _, line := range lines2[change.i2 : change.i2+change.chg2] {
+				hash.Write([]byte("+" + line))
+			}
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// editorCommand returns the editor of the user: $GIT_EDITOR, core.editor,
+// $VISUAL, $EDITOR or vi, todo lists being edited with $GIT_SEQUENCE_EDITOR
+// or sequence.editor first
+func editorCommand(sequence bool) (string, error) {
+	variables := []string{"GIT_EDITOR", "core.editor", "VISUAL", "EDITOR"}
+	if sequence {
+		variables = append([]string{"GIT_SEQUENCE_EDITOR", "sequence.editor"}, variables...)
+	}
+	for _, variable := range variables {
+		value := os.Getenv(variable)
+		if strings.Contains(variable, ".") {
+			var err error
+			if value, err = readConfig(variable); err != nil {
+				return "", err
+			}
+		}
+		if value != "" {
+			return value, nil
+		}
+	}
+	return "vi", nil
+}
+
+// runEditor lets the user edit a file with an editor, a shell command
+// given the file as argument, ":" leaving the file as it is
+func runEditor(editor string, filePath string) error {
+	if editor == ":" {
+		return nil
+	}
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, filePath)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("there was a problem with the editor '%s'", editor)
+	}
+	return nil
+}
+
+// todoHelp explains the commands of a todo list, below the commands
+const todoHelp = `
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash" but keep only the previous
+#                    commit's log message
+# x, exec <command> = run command (the rest of the line) using shell
+# b, break = stop here (continue rebase later with 'git rebase --continue')
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+#
+# If you remove a line here THAT COMMIT WILL BE LOST.
+#
+# However, if you remove everything, the rebase will be aborted.
+#
+`
+
+// editTodo lets the user edit the todo list of the rebase in the sequence
+// editor, and returns the commands of the edited list
+func editTodo(commands []todoCommand, description string) ([]todoCommand, error) {
+	editor, err := editorCommand(true)
+	if err != nil {
+		return nil, err
+	}
+	plural := "s"
+	if len(commands) == 1 {
+		plural = ""
+	}
+	todoPath := path.Join(rebaseDir, "git-rebase-todo")
+	content := formatTodo(commands, true)
+	if len(commands) == 0 {
+		content = "noop\n"
+	}
+	content += fmt.Sprintf("\n# Rebase %s (%d command%s)\n#", description, len(commands), plural) + todoHelp
+	if err := os.WriteFile(todoPath, []byte(content), 0644); err != nil {
+		return nil, err
+	}
+	if err := runEditor(editor, todoPath); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(todoPath)
+	if err != nil {
+		return nil, err
+	}
+	if commands, err = parseTodo(string(data)); err != nil {
+		return nil, err
+	}
+	for _, command := range commands {
+		if command.action == "squash" || command.action == "fixup" {
+			return nil, fmt.Errorf("cannot '%s' without a previous commit", command.action)
+		}
+		if command.oid != "" {
+			break
+		}
+	}
+	return commands, nil
+}
+
+// editMessage lets the user edit a commit message in .git/COMMIT_EDITMSG,
+// and returns it cleaned up
+func editMessage(message string) (string, error) {
+	editor, err := editorCommand(false)
+	if err != nil {
+		return "", err
+	}
+	messagePath := ".git/COMMIT_EDITMSG"
+	content := message + "\n\n" +
+		"# Please enter the commit message for your changes. Lines starting\n" +
+		"# with '#' will be ignored, and an empty message aborts the commit.\n"
+	if err := os.WriteFile(messagePath, []byte(content), 0644); err != nil {
+		return "", err
+	}
+	if err := runEditor(editor, messagePath); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(messagePath)
+	if err != nil {
+		return "", err
+	}
+	message = cleanupMessage(string(data))
+	if message == "" {
+		return "", fmt.Errorf("aborting commit due to empty commit message")
+	}
+	return message, nil
+}
+
+// run runs the commands left, until one stops the rebase, and finishes the
+// rebase after the last one; it returns false when the rebase failed
+func (state *rebaseState) run() (bool, error) {
+	for len(state.todo) > 0 {
+		command := state.todo[0]
+		state.todo = state.todo[1:]
+		state.done = append(state.done, command)
+		if err := state.writeTodo(); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(os.Stderr, "Rebasing (%d/%d)\r", len(state.done), len(state.done)+len(state.todo))
+		if err := removeStop(); err != nil {
+			return false, err
+		}
+
+		step, err := state.runCommand(command)
+		if err != nil {
+			// the command is run again by --continue
+			state.todo = append([]todoCommand{command}, state.todo...)
+			state.done = state.done[:len(state.done)-1]
+			if err := state.writeTodo(); err != nil {
+				return false, err
+			}
+			return false, err
+		}
+		if step != stepDone {
+			return step == stepStopped, nil
+		}
+	}
+	return true, state.finish()
+}
+
+// runCommand runs a command of the todo list
+func (state *rebaseState) runCommand(command todoCommand) (rebaseStep, error) {
+	switch command.action {
+	case "drop", "noop":
+		return stepDone, nil
+	case "break":
+		clearLine()
+		return stepStopped, stoppedAtHead()
+	case "exec":
+		clearLine()
+		fmt.Fprintf(os.Stderr, "Executing: %s\n", command.argument)
+		cmd := exec.Command("sh", "-c", command.argument)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: execution failed: %s\n"+
+				"You can fix the problem, and then run\n\n"+
+				"  git rebase --continue\n\n\n", command.argument)
+			return stepFailed, nil
+		}
+		return stepDone, nil
+	}
+
+	_, head, err := readHead()
+	if err != nil {
+		return stepFailed, err
+	}
+	headCommit, err := peelToCommit(head)
+	if err != nil {
+		return stepFailed, err
+	}
+	commit, err := peelToCommit(command.oid)
+	if err != nil {
+		return stepFailed, err
+	}
+
+	// a commit on top of HEAD is kept as it is, or only reworded
+	if (command.action == "pick" || command.action == "edit" || command.action == "reword") &&
+		len(commit.Parents) == 1 && commit.Parents[0] == head {
+		if err := checkoutTree(headCommit.Tree, commit.Tree, "rebase"); err != nil {
+			return stepFailed, err
+		}
+		if err := setHeadOID(commit.Hash, head, "rebase: fast-forward"); err != nil {
+			return stepFailed, err
+		}
+		if command.action == "reword" {
+			return stepDone, amendHead("", "reword")
+		}
+		return state.stopToEdit(command, commit)
+	}
+
+	tree, conflicts, err := applyCommit(headCommit.Tree, commit, command.action == "revert", "rebase")
+	if err != nil {
+		return stepFailed, err
+	}
+	message := pickMessage(commit, command.action == "revert")
+	if len(conflicts) > 0 {
+		return stepFailed, state.stopAtConflicts(commit, message, conflicts)
+	}
+	return state.commit(command, commit, tree, message, false)
+}
+
+// commit records the tree of a command replaying a commit: a new commit
+// on top of HEAD, or HEAD amended by squash and fixup. The commit is left
+// out when its change is already in HEAD. A commit concluded by --continue
+// is resumed
+func (state *rebaseState) commit(command todoCommand, commit *CommitObject, tree string, message string,
+	resumed bool) (rebaseStep, error) {
+	_, head, err := readHead()
+	if err != nil {
+		return stepFailed, err
+	}
+	headCommit, err := peelToCommit(head)
+	if err != nil {
+		return stepFailed, err
+	}
+	parentTree := ""
+	if len(commit.Parents) > 0 {
+		if parentTree, err = commitTreeOID(commit.Parents[0]); err != nil {
+			return stepFailed, err
+		}
+	}
+	squash := command.action == "squash" || command.action == "fixup"
+	if tree == headCommit.Tree && commit.Tree != parentTree && !squash {
+		if !state.dropEmpty && !resumed {
+			return stepFailed, state.stopAtEmpty(commit, message)
+		}
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		fmt.Fprintf(os.Stderr, "dropping %s %s -- patch contents already upstream\n", commit.Hash, subject)
+		return stepDone, nil
+	}
+
+	parents := []string{head}
+	author := commit.author()
+	if command.action == "revert" {
+		author = ""
+	}
+	showSummary := false
+	if squash {
+		parents, author = headCommit.Parents, headCommit.author()
+		if message, err = state.squashMessage(headCommit, command, message); err != nil {
+			return stepFailed, err
+		}
+		// the last of a series of squash and fixup commands gives the
+		// final message, edited when a message of the series is kept
+		if len(state.todo) == 0 || state.todo[0].action != "squash" && state.todo[0].action != "fixup" {
+			if message, showSummary, err = state.finalSquashMessage(commit, message); err != nil {
+				return stepFailed, err
+			}
+		}
+	}
+
+	oid, err := writeCommit(tree, parents, message, author)
+	if err != nil {
+		return stepFailed, err
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	reflogMessage := "rebase (" + command.action + "): " + subject
+	if resumed {
+		reflogMessage = "rebase (continue): " + subject
+	}
+	if err := setHeadOID(oid, head, reflogMessage); err != nil {
+		return stepFailed, err
+	}
+	if showSummary || resumed {
+		// amended commits show their author date
+		if err := printCommitSummary(oid, !resumed || squash); err != nil {
+			return stepFailed, err
+		}
+	}
+	if command.action == "reword" {
+		return stepDone, amendHead("", "reword")
+	}
+	return state.stopToEdit(command, commit)
+}
+
+// amendHead replaces HEAD by a commit of tree with its parents, author and
+// message, the message being edited by the user for reword; the reflog
+// names the action of the rebase
+func amendHead(tree string, action string) error {
+	_, head, err := readHead()
+	if err != nil {
+		return err
+	}
+	headCommit, err := peelToCommit(head)
+	if err != nil {
+		return err
+	}
+	if tree == "" {
+		tree = headCommit.Tree
+	}
+	message := strings.TrimSuffix(headCommit.Message, "\n")
+	if action == "reword" {
+		if message, err = editMessage(message); err != nil {
+			return err
+		}
+	}
+	oid, err := writeCommit(tree, headCommit.Parents, message, headCommit.author())
+	if err != nil {
+		return err
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	if err := setHeadOID(oid, head, "rebase ("+action+"): "+subject); err != nil {
+		return err
+	}
+	return printCommitSummary(oid, true)
+}
+
+// squashMessage returns the message of HEAD melded with the commit of a
+// squash or fixup command, which records the commits melded so far with
+// their messages as comments
+func (state *rebaseState) squashMessage(head *CommitObject, command todoCommand, message string) (string, error) {
+	squashPath := path.Join(rebaseDir, "message-squash")
+	fixupsPath := path.Join(rebaseDir, "current-fixups")
+	combination, err := os.ReadFile(squashPath)
+	if os.IsNotExist(err) {
+		combination = []byte("# This is a combination of 2 commits.\n" +
+			"# This is the 1st commit message:\n\n" +
+			strings.TrimSuffix(head.Message, "\n") + "\n")
+	} else if err != nil {
+		return "", err
+	}
+	fixups, err := os.ReadFile(fixupsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	// the first commit and the ones melded so far, this one included
+	count := strings.Count(string(fixups), "\n") + 2
+
+	_, rest, _ := strings.Cut(string(combination), "\n")
+	text := fmt.Sprintf("# This is a combination of %d commits.\n%s", count, rest)
+	if command.action == "squash" {
+		text += fmt.Sprintf("\n# This is the commit message #%d:\n\n%s\n", count, message)
+	} else {
+		text += fmt.Sprintf("\n# The commit message #%d will be skipped:\n\n", count)
+		for _, line := range strings.Split(message, "\n") {
+			text += strings.TrimRight("# "+line, " ") + "\n"
+		}
+	}
+	fixups = append(fixups, []byte(command.action+" "+command.oid+"\n")...)
+	if err := os.WriteFile(squashPath, []byte(text), 0644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(fixupsPath, fixups, 0644); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(text, "\n"), nil
+}
+
+// finalSquashMessage returns the final message of a series of squash and
+// fixup commands, edited by the user when it has a squash, and whether it
+// was edited; the commit of the last command is left in REBASE_HEAD while
+// editing
+func (state *rebaseState) finalSquashMessage(commit *CommitObject, combination string) (string, bool, error) {
+	fixups, err := os.ReadFile(path.Join(rebaseDir, "current-fixups"))
+	if err != nil {
+		return "", false, err
+	}
+	edited := false
+	message := cleanupMessage(combination)
+	for _, line := range strings.Split(string(fixups), "\n") {
+		if strings.HasPrefix(line, "squash ") {
+			edited = true
+			if err := os.WriteFile(rebaseHeadPath, []byte(commit.Hash+"\n"), 0644); err != nil {
+				return "", false, err
+			}
+			if message, err = editMessage(strings.TrimSuffix(combination, "\n")); err != nil {
+				return "", false, err
+			}
+			break
+		}
+	}
+	for _, name := range []string{"message-squash", "current-fixups"} {
+		if err := os.Remove(path.Join(rebaseDir, name)); err != nil {
+			return "", false, err
+		}
+	}
+	return message, edited, nil
+}
+
+// stopToEdit stops the rebase after the commit of an edit command, for the
+// user to amend it; the commit to amend is recorded in the amend file
+func (state *rebaseState) stopToEdit(command todoCommand, commit *CommitObject) (rebaseStep, error) {
+	if command.action != "edit" {
+		return stepDone, nil
+	}
+	if err := writeStop(commit, pickMessage(commit, false)); err != nil {
+		return stepFailed, err
+	}
+	_, head, err := readHead()
+	if err != nil {
+		return stepFailed, err
+	}
+	if err := os.WriteFile(path.Join(rebaseDir, "amend"), []byte(head+"\n"), 0644); err != nil {
+		return stepFailed, err
+	}
+	clearLine()
+	fmt.Fprintf(os.Stderr, "Stopped at %s...  %s\n"+
+		"You can amend the commit now, with\n\n"+
+		"  git commit --amend \n\n"+
+		"Once you are satisfied with your changes, run\n\n"+
+		"  git rebase --continue\n",
+		shortestUniqueAbbrev(commit.Hash, DefaultAbbrev), command.argument)
+	return stepStopped, nil
+}
+
+// stoppedAtHead tells the commit a break stopped at
+func stoppedAtHead() error {
+	_, head, err := readHead()
+	if err != nil {
+		return err
+	}
+	commit, err := peelToCommit(head)
+	if err != nil {
+		return err
+	}
+	subject, _, _ := strings.Cut(commit.Message, "\n")
+	fmt.Fprintf(os.Stderr, "Stopped at %s (%s)\n", shortestUniqueAbbrev(head, DefaultAbbrev), subject)
+	return nil
+}
+
+// writeStop records the commit a rebase stopped at, in REBASE_HEAD and
+// stopped-sha, with its message
+func writeStop(commit *CommitObject, message string) error {
+	if err := os.WriteFile(rebaseHeadPath, []byte(commit.Hash+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(rebaseDir, "stopped-sha"), []byte(commit.Hash+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(rebaseDir, "message"), []byte(message+"\n\n"), 0644)
+}
+
+// stopAtConflicts leaves the commit whose change conflicts to conclude in
+// the index, with its message in MERGE_MSG
+func (state *rebaseState) stopAtConflicts(commit *CommitObject, message string, conflicts []mergeConflict) error {
+	if err := writeStop(commit, message); err != nil {
+		return err
+	}
+	if err := os.WriteFile(mergeMsgPath, []byte(conflictsMessage(message, conflicts)), 0644); err != nil {
+		return err
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	description := shortestUniqueAbbrev(commit.Hash, DefaultAbbrev) + "... " + subject
+	fmt.Fprintf(os.Stderr, "error: could not apply %s\n"+
+		"hint: Resolve all conflicts manually, mark them as resolved with\n"+
+		"hint: \"git add/rm <conflicted_files>\", then run \"git rebase --continue\".\n"+
+		"hint: You can instead skip this commit: run \"git rebase --skip\".\n"+
+		"hint: To abort and get back to the state before \"git rebase\", run \"git rebase --abort\".\n"+
+		"Could not apply %s\n", description, description)
+	return nil
+}
+
+// stopAtEmpty leaves the commit that became empty to conclude, with
+// commit --allow-empty, or to skip
+func (state *rebaseState) stopAtEmpty(commit *CommitObject, message string) error {
+	if err := writeStop(commit, message); err != nil {
+		return err
+	}
+	if err := os.WriteFile(cherryPickHeadPath, []byte(commit.Hash+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(mergeMsgPath, []byte(message+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := printEmptyPick("rebase"); err != nil {
+		return err
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	fmt.Fprintf(os.Stderr, "Could not apply %s... %s\n", shortestUniqueAbbrev(commit.Hash, DefaultAbbrev), subject)
+	return nil
+}
+
+// removeStop removes the files of the commit a rebase stopped at, as the
+// next command runs; as in git, they are left behind after the last one
+func removeStop() error {
+	for _, filePath := range []string{
+		rebaseHeadPath, path.Join(rebaseDir, "stopped-sha"), path.Join(rebaseDir, "message"),
+		path.Join(rebaseDir, "amend"),
+	} {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish points the branch rebased to the last commit replayed, and HEAD
+// back to the branch
+func (state *rebaseState) finish() error {
+	_, head, err := readHead()
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(state.headName, "refs/") {
+		// the branch and its reflog are left as they are when no commit
+		// changed
+		message := fmt.Sprintf("rebase (finish): %s onto %s", state.headName, state.onto)
+		if head != state.origHead {
+			err := updateRefs([]refUpdate{{name: state.headName, newOID: head, oldOID: state.origHead, message: message}})
+			if err != nil {
+				return err
+			}
+		}
+		if err := writeSymref("HEAD", state.headName, "rebase (finish): returning to "+state.headName); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(rebaseDir); err != nil {
+		return err
+	}
+	clearLine()
+	fmt.Fprintf(os.Stderr, "Successfully rebased and updated %s.\n", state.headName)
+	return nil
+}
+
+// clearLine clears the progress line of a rebase on stderr, with spaces on
+// terminals that do not know escape sequences
+func clearLine() {
+	if term := os.Getenv("TERM"); term == "" || term == "dumb" {
+		fmt.Fprintf(os.Stderr, "\r%80s\r", "")
+	} else {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
+
+// rebaseInProgress returns the rebase in progress, an error if there is none
+func rebaseInProgress() (*rebaseState, error) {
+	state, err := readRebaseState()
+	if err == nil && state == nil {
+		err = fmt.Errorf("no rebase in progress")
+	}
+	return state, err
+}
+
+// RebaseContinue goes on with the rebase in progress: the commit whose
+// conflicts were resolved in the index is concluded first
+func RebaseContinue() (bool, error) {
+	state, err := rebaseInProgress()
+	if err != nil {
+		return false, err
+	}
+	index, err := readIndex()
+	if err != nil {
+		return false, err
+	}
+	if len(index.unmerged()) > 0 {
+		return false, fmt.Errorf("you must edit all merge conflicts and then\n" +
+			"mark them as resolved using git add")
+	}
+	_, head, err := readHead()
+	if err != nil {
+		return false, err
+	}
+	headTree, err := commitTreeOID(head)
+	if err != nil {
+		return false, err
+	}
+	tree, err := WriteTree()
+	if err != nil {
+		return false, err
+	}
+
+	// the commit an edit command stopped at gets the changes staged, unless
+	// the user committed on top of it
+	amend, err := os.ReadFile(path.Join(rebaseDir, "amend"))
+	if err == nil {
+		if tree != headTree && strings.TrimSpace(string(amend)) != head {
+			return false, fmt.Errorf("you have uncommitted changes in your working tree. Please, commit them\n" +
+				"first and then run 'git rebase --continue' again.")
+		}
+		if tree != headTree {
+			if err := amendHead(tree, "continue"); err != nil {
+				return false, err
+			}
+		}
+		return state.run()
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	// a rebase stopped by a conflict has a commit to conclude, unlike a
+	// rebase stopped by break or exec, or a commit whose change was given
+	// up in the index
+	stopped, err := os.ReadFile(path.Join(rebaseDir, "stopped-sha"))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if len(stopped) == 0 || tree == headTree {
+		if err := removePickState(); err != nil {
+			return false, err
+		}
+		if tree != headTree {
+			return false, fmt.Errorf("you have staged changes in your working tree\n" +
+				"If these changes are meant to be squashed into the previous commit, run:\n\n" +
+				"  git commit --amend \n\n" +
+				"If they are meant to go into a new commit, run:\n\n" +
+				"  git commit \n\n" +
+				"In both cases, once you're done, continue with:\n\n" +
+				"  git rebase --continue\n")
+		}
+		return state.run()
+	}
+
+	commit, err := peelToCommit(strings.TrimSpace(string(stopped)))
+	if err != nil {
+		return false, err
+	}
+	message := pickMessage(commit, false)
+	if data, err := os.ReadFile(mergeMsgPath); err == nil {
+		message = cleanupMessage(string(data))
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	command := state.done[len(state.done)-1]
+	step, err := state.commit(command, commit, tree, message, true)
+	if err != nil {
+		return false, err
+	}
+	if err := removePickState(); err != nil {
+		return false, err
+	}
+	if step != stepDone {
+		return step == stepStopped, nil
+	}
+	return state.run()
+}
+
+// RebaseSkip goes on with the rebase in progress, leaving out the commit
+// it stopped at, the index and the working tree being reset to HEAD
+func RebaseSkip() (bool, error) {
+	state, err := rebaseInProgress()
+	if err != nil {
+		return false, err
+	}
+	_, head, err := readHead()
+	if err != nil {
+		return false, err
+	}
+	headTree, err := commitTreeOID(head)
+	if err != nil {
+		return false, err
+	}
+	if err := resetTree(headTree); err != nil {
+		return false, err
+	}
+	if err := removePickState(); err != nil {
+		return false, err
+	}
+	return state.run()
+}
+
+// RebaseAbort abandons the rebase in progress: HEAD goes back to the
+// branch rebased, and the index and the working tree to its commit
+func RebaseAbort() error {
+	state, err := rebaseInProgress()
+	if err != nil {
+		return err
+	}
+	origTree, err := commitTreeOID(state.origHead)
+	if err != nil {
+		return err
+	}
+	if err := resetTree(origTree); err != nil {
+		return err
+	}
+	if strings.HasPrefix(state.headName, "refs/") {
+		err = writeSymref("HEAD", state.headName, "rebase (abort): returning to "+state.headName)
+	} else {
+		err = writeRef("HEAD", state.origHead, "rebase (abort): returning to "+state.origHead)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(rebaseHeadPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := removePickState(); err != nil {
+		return err
+	}
+	return os.RemoveAll(rebaseDir)
+}
+
+// RebaseEditTodo lets the user edit the commands left of the rebase in
+// progress
+func RebaseEditTodo() error {
+	state, err := rebaseInProgress()
+	if err != nil {
+		return err
+	}
+	description := fmt.Sprintf("%s..%s onto %s", shortestUniqueAbbrev(state.onto, DefaultAbbrev),
+		shortestUniqueAbbrev(state.origHead, DefaultAbbrev), shortestUniqueAbbrev(state.onto, DefaultAbbrev))
+	if state.todo, err = editTodo(state.todo, description); err != nil {
+		state.writeTodo()
+		return err
+	}
+	return state.writeTodo()
+}
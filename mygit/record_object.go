@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compress/zlib"
 	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -61,7 +62,7 @@ func writeObject(sha string, header []byte, content io.Reader) error {
 	objectFolderPath := fmt.Sprintf(".git/objects/%s", sha[:2])
 	objectPath := fmt.Sprintf(".git/objects/%s/%s", sha[:2], sha[2:])
 
-	if _, err := os.Stat(objectPath); errors.Is(err, os.ErrNotExist) {
+	if !objectExists(sha) {
 		if err := os.MkdirAll(objectFolderPath, 0755); err != nil &&
 			!errors.Is(err, os.ErrExist) {
 			return err
@@ -192,7 +193,17 @@ func RecordBlob(filePath string, writeOption bool) (*TreeEntry, error) {
 	}, nil
 }
 
+// RecordTree records a directory as a tree, leaving out .git, the ignored
+// files and the directories left empty
 func RecordTree(folderPath string, writeOption bool) (*TreeEntry, error) {
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return nil, err
+	}
+	return recordTree(folderPath, rules, writeOption)
+}
+
+func recordTree(folderPath string, rules *ignoreRules, writeOption bool) (*TreeEntry, error) {
 	directory, err := os.Open(folderPath)
 	if err != nil {
 		return nil, err
@@ -218,17 +229,28 @@ func RecordTree(folderPath string, writeOption bool) (*TreeEntry, error) {
 			continue
 		}
 		entryPath := filepath.Join(folderPath, dirEntry.Name())
-		entry, err := RecordAny(entryPath, writeOption)
+		ignored, err := rules.ignored(filepath.ToSlash(entryPath), dirEntry.IsDir())
+		if err != nil {
+			return nil, err
+		}
+		if ignored {
+			continue
+		}
+		entry, err := recordAny(entryPath, rules, writeOption)
 		if err != nil {
 			return nil, err
 		}
+		// git does not record empty directories
+		if entry.Type == ObjectTypeTree && entry.Hash == emptyTreeOID {
+			continue
+		}
 		entries = append(entries, entry)
 	}
 
-	// entries are already sorted by ReadDir
-	// so the following code is not needed normally:
+	// entries are sorted by name by ReadDir but git sorts
+	// trees as if their name ended with a '/'
 	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Name < entries[j].Name
+		return treeEntryLess(entries[i], entries[j])
 	})
 
 	shaBytes, err := HashTree(&entries, writeOption)
@@ -245,15 +267,35 @@ func RecordTree(folderPath string, writeOption bool) (*TreeEntry, error) {
 	}, nil
 }
 
+// RecordAny records a file as a blob or a directory as a tree, leaving
+// out the ignored files of the directory
 func RecordAny(path string, writeOption bool) (*TreeEntry, error) {
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return nil, err
+	}
+	return recordAny(path, rules, writeOption)
+}
+
+func recordAny(path string, rules *ignoreRules, writeOption bool) (*TreeEntry, error) {
 	fileInfo, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
 
 	if fileInfo.IsDir() {
-		return RecordTree(path, writeOption)
+		return recordTree(path, rules, writeOption)
 	} else {
 		return RecordBlob(path, writeOption)
 	}
 }
+
+// writeBlob stores content as a blob and returns its object ID
+func writeBlob(content []byte) (string, error) {
+	oid := hex.EncodeToString(hashObjectContent(string(ObjectTypeBlob), content))
+	header := fmt.Sprintf("%s %d\x00", ObjectTypeBlob, len(content))
+	if err := writeObject(oid, []byte(header), bytes.NewReader(content)); err != nil {
+		return "", err
+	}
+	return oid, nil
+}
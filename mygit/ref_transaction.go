@@ -0,0 +1,195 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// refUpdate is a change of a ref within a transaction
+type refUpdate struct {
+	name string
+	// object ID the ref is set to, zeroOID to delete the ref,
+	// empty to only verify the old value
+	newOID string
+	// object ID the ref is expected to point to, zeroOID for a ref that
+	// must not exist, empty for no check
+	oldOID string
+	// update a symbolic ref itself rather than the ref it points to
+	noDeref bool
+	// reason of the update, recorded in the reflog
+	message string
+}
+
+// updateRefs applies every update or none of them: each ref is locked and
+// its value checked against the expected one before any ref is changed
+func updateRefs(updates []refUpdate) error {
+	type lockedUpdate struct {
+		refUpdate
+		// ref actually updated, after following symbolic refs
+		target string
+		lock   *lockFile
+		// current object ID of the ref, empty if it does not exist
+		current string
+	}
+
+	// updates of the branch HEAD points to are recorded in the HEAD reflog too
+	headTarget, err := resolveSymref("HEAD")
+	if err != nil {
+		return err
+	}
+
+	locked := []*lockedUpdate{}
+	defer func() {
+		for _, update := range locked {
+			update.lock.rollback()
+		}
+	}()
+
+	seen := map[string]bool{}
+	for _, update := range updates {
+		target := update.name
+		if !update.noDeref {
+			if target, err = resolveSymref(update.name); err != nil {
+				return err
+			}
+		}
+		if seen[target] {
+			return fmt.Errorf("multiple updates for ref '%s' not allowed", target)
+		}
+		seen[target] = true
+
+		lock, err := lockPath(path.Join(".git", target))
+		if err != nil {
+			return fmt.Errorf("cannot lock ref '%s': %s", update.name, err)
+		}
+		current := &lockedUpdate{refUpdate: update, target: target, lock: lock}
+		locked = append(locked, current)
+
+		if current.current, err = readRef(target); err != nil {
+			return err
+		}
+		if err := checkOldOID(current.name, current.current, update.oldOID); err != nil {
+			return err
+		}
+
+		if update.newOID == "" || update.newOID == zeroOID {
+			continue
+		}
+		if err := checkNewOID(target, update.newOID); err != nil {
+			return err
+		}
+		if info, err := os.Stat(path.Join(".git", target)); err == nil && info.IsDir() {
+			return fmt.Errorf("cannot lock ref '%s': there is a non-empty directory '.git/%s' "+
+				"blocking reference '%s'", update.name, target, target)
+		}
+		if _, err := lock.Write([]byte(update.newOID + "\n")); err != nil {
+			return err
+		}
+	}
+
+	// deleted refs leave the packed-refs file first, so that their packed
+	// value does not show up once the loose file is removed
+	deleted := map[string]bool{}
+	for _, update := range locked {
+		if update.newOID == zeroOID {
+			deleted[update.target] = true
+		}
+	}
+	if len(deleted) > 0 {
+		if err := removePackedRefs(deleted); err != nil {
+			return err
+		}
+	}
+
+	for _, update := range locked {
+		switch update.newOID {
+		case "":
+			update.lock.rollback()
+		case zeroOID:
+			err := os.Remove(path.Join(".git", update.target))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			update.lock.rollback()
+			removeEmptyRefDirs(update.target)
+			if err := deleteReflog(update.target); err != nil {
+				return err
+			}
+		default:
+			err := appendReflog(update.target, update.current, update.newOID, update.message)
+			if err != nil {
+				return err
+			}
+			if update.target != "HEAD" && update.target == headTarget {
+				err := appendReflog("HEAD", update.current, update.newOID, update.message)
+				if err != nil {
+					return err
+				}
+			}
+			if err := update.lock.commit(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkOldOID checks the current object ID of a ref against the expected one
+func checkOldOID(refName string, current string, expected string) error {
+	switch {
+	case expected == "":
+		return nil
+	case expected == zeroOID && current != "":
+		return fmt.Errorf("cannot lock ref '%s': reference already exists", refName)
+	case expected != zeroOID && current == "":
+		return fmt.Errorf("cannot lock ref '%s': unable to resolve reference '%s'", refName, refName)
+	case expected != zeroOID && current != expected:
+		return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", refName, current, expected)
+	}
+	return nil
+}
+
+// checkNewOID checks that a ref is set to an existing object,
+// a commit for a branch
+func checkNewOID(refName string, oid string) error {
+	object, err := NewObject(oid)
+	if err != nil {
+		return fmt.Errorf("trying to write ref '%s' with nonexistent object %s", refName, oid)
+	}
+	if strings.HasPrefix(refName, headsPrefix) && object.Type != ObjectTypeCommit {
+		return fmt.Errorf("trying to write non-commit object %s to branch '%s'", oid, refName)
+	}
+	return nil
+}
+
+// removePackedRefs removes refs from the packed-refs file, if any of them
+// is packed
+func removePackedRefs(names map[string]bool) error {
+	lock, err := lockPath(packedRefsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+
+	refs, err := readPackedRefs()
+	if err != nil {
+		return err
+	}
+	kept := []packedRef{}
+	for _, ref := range refs {
+		if !names[ref.name] {
+			kept = append(kept, ref)
+		}
+	}
+	if len(kept) == len(refs) {
+		return nil
+	}
+
+	if err := writePackedRefs(lock, kept); err != nil {
+		return err
+	}
+	return lock.commit()
+}
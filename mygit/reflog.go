@@ -0,0 +1,395 @@
+package mygit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reflog entry format, one line per ref update in .git/logs/<ref>:
+//
+//	<old_oid> <new_oid> <name> <<email>> <timestamp> <tz>\t<message>
+//
+// without the tab when the message is empty, oldest entry first
+const logsDirectory = ".git/logs"
+
+// default age of the reflog entries removed by reflog expire
+const DefaultReflogExpire = "90.days.ago"
+
+type reflogEntry struct {
+	oldOID    string
+	newOID    string
+	timestamp int64
+	timeZone  string
+	message   string
+	// line as read, written back when rewriting the reflog
+	line string
+}
+
+// reflogPath returns the path of the reflog of a ref
+func reflogPath(refName string) string {
+	return path.Join(logsDirectory, refName)
+}
+
+// shouldLogRef checks whether updates of a ref are recorded: HEAD,
+// branches and remote-tracking branches are, other refs only once they
+// have a reflog
+func shouldLogRef(refName string) bool {
+	if refName == "HEAD" || strings.HasPrefix(refName, headsPrefix) ||
+		strings.HasPrefix(refName, "refs/remotes/") || strings.HasPrefix(refName, "refs/notes/") {
+		return true
+	}
+	_, err := os.Stat(reflogPath(refName))
+	return err == nil
+}
+
+// appendReflog records a ref update from oldOID to newOID, empty object
+// IDs standing for a missing ref, with the committer identity
+func appendReflog(refName string, oldOID string, newOID string, message string) error {
+	if !shouldLogRef(refName) {
+		return nil
+	}
+	if oldOID == "" {
+		oldOID = zeroOID
+	}
+	if newOID == "" {
+		newOID = zeroOID
+	}
+
+	line := fmt.Sprintf("%s %s %s <%s> %s", oldOID, newOID,
+		getCommitterName(), getCommitterEmail(), getCommitterDate())
+	// a message is a single line of single spaces
+	if message = strings.Join(strings.Fields(message), " "); message != "" {
+		line += "\t" + message
+	}
+
+	logPath := reflogPath(refName)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(line + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// readReflog returns the entries of the reflog of a ref, oldest first,
+// none if it has no reflog
+func readReflog(refName string) ([]reflogEntry, error) {
+	data, err := os.ReadFile(reflogPath(refName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []reflogEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		entry, err := parseReflogEntry(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", reflogPath(refName), err)
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, scanner.Err()
+}
+
+func parseReflogEntry(line string) (*reflogEntry, error) {
+	header, message, _ := strings.Cut(line, "\t")
+	fields := strings.Fields(header)
+	if len(fields) < 4 || len(fields[0]) != 40 || len(fields[1]) != 40 {
+		return nil, fmt.Errorf("invalid reflog entry: %s", line)
+	}
+	timestamp, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reflog entry: %s", line)
+	}
+
+	return &reflogEntry{
+		oldOID:    fields[0],
+		newOID:    fields[1],
+		timestamp: timestamp,
+		timeZone:  fields[len(fields)-1],
+		message:   message,
+		line:      line,
+	}, nil
+}
+
+// writeReflog replaces the reflog of a ref with the given entries
+func writeReflog(refName string, entries []reflogEntry) error {
+	lock, err := lockPath(reflogPath(refName))
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+
+	buffer := bytes.Buffer{}
+	for _, entry := range entries {
+		buffer.WriteString(entry.line + "\n")
+	}
+	if _, err := lock.Write(buffer.Bytes()); err != nil {
+		return err
+	}
+	return lock.commit()
+}
+
+// deleteReflog removes the reflog of a ref along with the directories
+// it leaves empty
+func deleteReflog(refName string) error {
+	logPath := reflogPath(refName)
+	if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	removeEmptyDirs(filepath.Dir(logPath), 4)
+	return nil
+}
+
+// renameReflog moves the reflog of a renamed ref
+func renameReflog(oldRefName string, newRefName string) error {
+	if _, err := os.Stat(reflogPath(oldRefName)); os.IsNotExist(err) {
+		return nil
+	}
+	newPath := reflogPath(newRefName)
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(reflogPath(oldRefName), newPath); err != nil {
+		return err
+	}
+	return deleteReflog(oldRefName)
+}
+
+// dwimReflog expands a short ref name to the full name of a ref that has
+// a reflog, see refDWIMRules
+// An empty name stands for the current branch, or HEAD when detached
+func dwimReflog(name string) (string, error) {
+	if name == "" {
+		refName, _, err := readHead()
+		if err != nil || refName != "" {
+			return refName, err
+		}
+		return "HEAD", nil
+	}
+	if !validRefName(name) {
+		return "", nil
+	}
+
+	for _, rule := range refDWIMRules {
+		refName := fmt.Sprintf(rule, name)
+		if !strings.HasPrefix(refName, "refs/") && !isPseudoRef(refName) {
+			continue
+		}
+		if info, err := os.Stat(reflogPath(refName)); err == nil && !info.IsDir() {
+			return refName, nil
+		}
+	}
+	return "", nil
+}
+
+// resolveReflogRevision resolves "<ref>@{<n>}", the nth prior value of
+// the ref, and "<ref>@{<date>}", its value at the given date
+func resolveReflogRevision(name string, ref string, selector string) (string, error) {
+	refName, err := dwimReflog(ref)
+	if err != nil {
+		return "", err
+	}
+	if refName == "" {
+		return "", unknownRevisionError(name)
+	}
+	entries, err := readReflog(refName)
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		ref = strings.TrimPrefix(refName, headsPrefix)
+	}
+
+	// large numbers are timestamps, as in git
+	if n, err := strconv.Atoi(selector); err == nil && n >= 0 && n < 100000000 {
+		switch {
+		case n < len(entries):
+			return entries[len(entries)-1-n].newOID, nil
+		// the value before the oldest entry
+		case n == len(entries) && n > 0 && entries[0].oldOID != zeroOID:
+			return entries[0].oldOID, nil
+		}
+		return "", fmt.Errorf("log for '%s' only has %d entries", ref, len(entries))
+	}
+
+	date, err := parseApproxDate(selector, time.Now())
+	if err != nil {
+		return "", unknownRevisionError(name)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("log for '%s' is empty", ref)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].timestamp <= date.Unix() {
+			return entries[i].newOID, nil
+		}
+	}
+
+	oldest := entries[0]
+	oldestDate, err := parseObjectDate(strconv.FormatInt(oldest.timestamp, 10), oldest.timeZone)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(os.Stderr, "warning: log for '%s' only goes back to %s\n",
+		ref, oldestDate.Format("Mon, 2 Jan 2006 15:04:05 -0700"))
+	if oldest.oldOID != zeroOID {
+		return oldest.oldOID, nil
+	}
+	return oldest.newOID, nil
+}
+
+// ReflogShow prints the reflog of a ref, HEAD by default, newest first
+func ReflogShow(ref string) error {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	refName, err := dwimReflog(ref)
+	if err != nil {
+		return err
+	}
+	if refName == "" {
+		return unknownRevisionError(ref)
+	}
+
+	entries, err := readReflog(refName)
+	if err != nil {
+		return err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		fmt.Printf("%s %s@{%d}: %s\n", shortestUniqueAbbrev(entry.newOID, DefaultAbbrev),
+			ref, len(entries)-1-i, entry.message)
+	}
+	return nil
+}
+
+type ReflogExpireOptions struct {
+	// entries older than this date are removed, see parseApproxDate
+	Expire string
+	// expire the reflogs of every ref
+	All bool
+	// do not remove anything, just report what would be removed
+	DryRun bool
+}
+
+// ReflogExpire removes the old entries of the reflogs of the given refs
+func ReflogExpire(refs []string, options *ReflogExpireOptions) error {
+	expire := options.Expire
+	if expire == "" {
+		expire = DefaultReflogExpire
+	}
+	expireDate, err := parseApproxDate(expire, time.Now())
+	if err != nil {
+		return err
+	}
+
+	refNames := []string{}
+	if options.All {
+		refNames, err = reflogRefs()
+		if err != nil {
+			return err
+		}
+	}
+	for _, ref := range refs {
+		refName, err := dwimReflog(ref)
+		if err != nil {
+			return err
+		}
+		if refName == "" {
+			return fmt.Errorf("reflog could not be found: '%s'", ref)
+		}
+		refNames = append(refNames, refName)
+	}
+
+	for _, refName := range refNames {
+		entries, err := readReflog(refName)
+		if err != nil {
+			return err
+		}
+		kept := []reflogEntry{}
+		for _, entry := range entries {
+			if !expireDate.IsZero() && entry.timestamp <= expireDate.Unix() {
+				if options.DryRun {
+					fmt.Printf("would prune %s\n", entry.line)
+				}
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		if len(kept) == len(entries) || options.DryRun {
+			continue
+		}
+		if err := writeReflog(refName, kept); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reflogRefs returns the names of the refs that have a reflog
+func reflogRefs() ([]string, error) {
+	refNames := []string{}
+	if _, err := os.Stat(reflogPath("HEAD")); err == nil {
+		refNames = append(refNames, "HEAD")
+	}
+	// reflogs mirror the refs hierarchy under .git/logs
+	names, err := looseRefs("logs/refs/")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		refNames = append(refNames, "refs/"+name)
+	}
+	return refNames, nil
+}
+
+// ReflogDelete removes single reflog entries given as "<ref>@{<n>}",
+// one after the other
+func ReflogDelete(specs []string) error {
+	for _, spec := range specs {
+		ref, selector, found := strings.Cut(spec, "@{")
+		n, err := strconv.Atoi(strings.TrimSuffix(selector, "}"))
+		if !found || !strings.HasSuffix(selector, "}") || err != nil || n < 0 {
+			return fmt.Errorf("not a reflog: %s", spec)
+		}
+
+		refName, err := dwimReflog(ref)
+		if err != nil {
+			return err
+		}
+		if refName == "" {
+			return fmt.Errorf("%s: no reflog for '%s'", spec, ref)
+		}
+		entries, err := readReflog(refName)
+		if err != nil {
+			return err
+		}
+		if n >= len(entries) {
+			return fmt.Errorf("%s: log for '%s' only has %d entries", spec, ref, len(entries))
+		}
+
+		i := len(entries) - 1 - n
+		entries = append(entries[:i], entries[i+1:]...)
+		if err := writeReflog(refName, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package mygit
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maximum number of symbolic refs followed to resolve a ref
+const maxSymrefDepth = 5
+
+// rules used to expand a short ref name, in order, see git-rev-parse
+var refDWIMRules = []string{
+	"%s",
+	"refs/%s",
+	"refs/tags/%s",
+	"refs/heads/%s",
+	"refs/remotes/%s",
+	"refs/remotes/%s/HEAD",
+}
+
+// readRef returns the object ID a ref points to, following symbolic refs,
+// from its loose file or else from the packed-refs file
+// Returns an empty object ID when the ref does not exist
+func readRef(refName string) (string, error) {
+	refName, err := resolveSymref(refName)
+	if err != nil {
+		return "", err
+	}
+
+	value, _, err := readLooseRef(refName)
+	if err != nil {
+		return "", err
+	}
+	if value != "" {
+		if len(value) != 40 || !isHex(value) {
+			return "", fmt.Errorf("invalid ref %s: %s", refName, value)
+		}
+		return value, nil
+	}
+
+	// symbolic refs are never packed, nor refs outside of refs/
+	if !strings.HasPrefix(refName, "refs/") {
+		return "", nil
+	}
+	packed, err := findPackedRef(refName)
+	if err != nil || packed == nil {
+		return "", err
+	}
+	return packed.oid, nil
+}
+
+// resolveSymref follows the symbolic refs from refName to the first ref
+// that is not symbolic, which may not exist
+// Fails beyond maxSymrefDepth symbolic refs and on cycles
+func resolveSymref(refName string) (string, error) {
+	chain := []string{refName}
+	for {
+		target, symbolic, err := readLooseRef(refName)
+		if err != nil {
+			return "", err
+		}
+		if !symbolic {
+			return refName, nil
+		}
+		if !validRefName(target) {
+			return "", fmt.Errorf("invalid symbolic ref %s: %s", refName, target)
+		}
+
+		for _, name := range chain {
+			if name == target {
+				return "", fmt.Errorf("symbolic ref cycle: %s -> %s", strings.Join(chain, " -> "), target)
+			}
+		}
+		chain = append(chain, target)
+		if len(chain) > maxSymrefDepth+1 {
+			return "", fmt.Errorf("too many levels of symbolic refs for %s", chain[0])
+		}
+		refName = target
+	}
+}
+
+// readLooseRef returns the content of the file of a ref, the target ref
+// for a symbolic ref
+// Returns an empty value when the file does not exist
+func readLooseRef(refName string) (string, bool, error) {
+	refPath := path.Join(".git", refName)
+	// a missing ref, or a ref prefix such as refs/heads
+	if info, err := os.Stat(refPath); err != nil || info.IsDir() {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(refPath)
+	if err != nil {
+		return "", false, err
+	}
+
+	value := strings.TrimSpace(string(data))
+	target, symbolic := strings.CutPrefix(value, "ref: ")
+	return target, symbolic, nil
+}
+
+// readHead returns the branch ref HEAD points to, empty when HEAD is
+// detached, and the commit HEAD points to, empty on an unborn branch
+func readHead() (string, string, error) {
+	data, err := os.ReadFile(".git/HEAD")
+	if err != nil {
+		return "", "", err
+	}
+
+	value := strings.TrimSpace(string(data))
+	if refName, symbolic := strings.CutPrefix(value, "ref: "); symbolic {
+		oid, err := readRef(refName)
+		return refName, oid, err
+	}
+
+	if len(value) != 40 || !isHex(value) {
+		return "", "", fmt.Errorf("invalid HEAD: %s", value)
+	}
+	return "", value, nil
+}
+
+// writeRef points a ref to an object ID, the ref itself even when it is
+// a symbolic ref such as HEAD, message is recorded in the reflog
+func writeRef(refName string, oid string, message string) error {
+	return updateRefs([]refUpdate{{name: refName, newOID: oid, noDeref: true, message: message}})
+}
+
+// writeSymref points a symbolic ref such as HEAD to another ref,
+// the change of object ID is recorded in the reflog unless message is empty
+func writeSymref(refName string, target string, message string) error {
+	lock, err := lockPath(path.Join(".git", refName))
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+
+	if _, err := lock.Write([]byte("ref: " + target + "\n")); err != nil {
+		return err
+	}
+
+	if message != "" {
+		oldOID, err := readRef(refName)
+		if err != nil {
+			return err
+		}
+		newOID, err := readRef(target)
+		if err != nil {
+			return err
+		}
+		if err := appendReflog(refName, oldOID, newOID, message); err != nil {
+			return err
+		}
+	}
+	return lock.commit()
+}
+
+// deleteRef removes a ref, loose and packed
+func deleteRef(refName string) error {
+	return updateRefs([]refUpdate{{name: refName, newOID: zeroOID, noDeref: true}})
+}
+
+// removeEmptyRefDirs removes the directories a deleted ref leaves empty
+func removeEmptyRefDirs(refName string) {
+	removeEmptyDirs(filepath.Dir(path.Join(".git", refName)), 3)
+}
+
+// listRefs returns the sorted names, relative to prefix, of the loose and
+// packed refs under prefix such as "refs/heads/"
+func listRefs(prefix string) ([]string, error) {
+	names, err := looseRefs(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	packed, err := readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		seen[name] = true
+	}
+	for _, ref := range packed {
+		name, found := strings.CutPrefix(ref.name, prefix)
+		if found && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// looseRefs returns the sorted names, relative to prefix, of the refs
+// stored as files under prefix
+func looseRefs(prefix string) ([]string, error) {
+	names := []string{}
+	root := path.Join(".git", prefix)
+	err := filepath.WalkDir(root, func(refPath string, d fs.DirEntry, err error) error {
+		// lock files of refs being updated are not refs
+		if err != nil || d.IsDir() || strings.HasSuffix(refPath, lockSuffix) {
+			return err
+		}
+		name, err := filepath.Rel(root, refPath)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(name))
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// dwimRef expands a short ref name such as "master" or "origin/feature"
+// with the rules of refDWIMRules
+// Returns the full ref name and the object ID it points to, or empty
+// strings when no ref matches
+func dwimRef(name string) (string, string, error) {
+	if !validRefName(name) {
+		return "", "", nil
+	}
+
+	for _, rule := range refDWIMRules {
+		refName := fmt.Sprintf(rule, name)
+		// only pseudo refs such as HEAD live outside of refs/
+		if !strings.HasPrefix(refName, "refs/") && !isPseudoRef(refName) {
+			continue
+		}
+		oid, err := readRef(refName)
+		if err != nil {
+			return "", "", err
+		}
+		if oid != "" {
+			return refName, oid, nil
+		}
+	}
+
+	return "", "", nil
+}
+
+// isPseudoRef checks that name looks like HEAD, ORIG_HEAD or FETCH_HEAD
+func isPseudoRef(name string) bool {
+	return name != "" && strings.Trim(name, "ABCDEFGHIJKLMNOPQRSTUVWXYZ_") == ""
+}
+
+// validRefName checks that name is a valid reference name,
+// see git check-ref-format
+func validRefName(name string) bool {
+	if name == "" || name == "@" || strings.HasPrefix(name, "-") ||
+		strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") ||
+		strings.Contains(name, "//") {
+		return false
+	}
+	if strings.ContainsAny(name, " ~^:?*[\\\x7f") {
+		return false
+	}
+	for _, r := range name {
+		if r < 0x20 {
+			return false
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	return true
+}
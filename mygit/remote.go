@@ -8,16 +8,18 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"net/http"
 	"os"
 	"path"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
+const remoteOriginPrefix = "refs/remotes/origin/"
+
 const (
 	smartRefDiscoveryPath = "/info/refs?service=git-upload-pack"
 	gitUploadPackPath     = "/git-upload-pack"
@@ -68,17 +70,17 @@ func Clone(url string, repoName string) error {
 		return err
 	}
 
-	err = writeRefsToDisk(remoteRefs.refs)
-	if err != nil {
-		return err
-	}
-
 	if len(remoteRefs.refs) == 0 {
 		return fmt.Errorf("no refs found in remote repository")
 	}
 
 	// create negotation request
-	negotationRequest := createNegotationRequest("", remoteRefs.refs)
+	// offset deltas are smaller on the wire and supported when unpacking
+	requestedCap := capabilities("")
+	if remoteRefs.cap.has("ofs-delta") {
+		requestedCap = "ofs-delta"
+	}
+	negotationRequest := createNegotationRequest(requestedCap, remoteRefs.refs)
 
 	// get the packfile
 	requestReader := strings.NewReader(negotationRequest)
@@ -138,33 +140,40 @@ func Clone(url string, repoName string) error {
 
 	fmt.Printf("remote: Number of objects: %d\n", numObjects)
 
-	err = parsePackFile(packFile, numObjects)
+	entries, err := parsePackFile(packFile, numObjects)
 	if err != nil {
 		return err
 	}
 
-	// checkout the HEAD ref and write files to disk
-	headRef := remoteRefs.refs[0]
-	object, err := NewObject(headRef.ObjectId)
-	if err != nil {
-		return err
+	deltaCount := 0
+	for _, entry := range entries {
+		if entry.isDelta() {
+			deltaCount++
+		}
 	}
+	fmt.Printf("remote: Resolving deltas: %d\n", deltaCount)
 
-	commitObject, err := parseCommitObject(object)
+	// keep the packfile as is and write its index next to it
+	tempPackFile.Close()
+	err = storePackFile(tempPackFilePath, packFile, entries)
 	if err != nil {
 		return err
 	}
 
-	treeObject, err := NewObject(commitObject.Tree)
+	// refs are written once the objects they point to are stored
+	err = writeRefsToDisk(remoteRefs.refs, remoteRefs.cap.symref("HEAD"), url)
 	if err != nil {
 		return err
 	}
-	err = writeTreeToDisk(treeObject, ".")
+
+	// checkout the HEAD ref and write files to disk
+	headRef := remoteRefs.refs[0]
+	commitObject, err := peelToCommit(headRef.ObjectId)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return checkoutTree("", commitObject.Tree, "checkout")
 }
 
 type remoteRefs struct {
@@ -233,39 +242,97 @@ func discoverRefsSmartHttp(url string) (*remoteRefs, error) {
 	return &remoteRefs, nil
 }
 
-func writeRefsToDisk(refs []*ref) error {
-	// remotes/origin/HEAD
-	err := os.MkdirAll(".git/refs/remotes/origin/", 0755)
-	if err != nil {
+// writeRefsToDisk records the remote branches as refs/remotes/origin/<branch>
+// and the tags in the packed-refs file, and checks out headTarget, the
+// branch the remote HEAD points to, tracking the remote one
+func writeRefsToDisk(refs []*ref, headTarget string, url string) error {
+	message := "clone: from " + url
+	headOID := ""
+	packed := []packedRef{}
+	for _, ref := range refs {
+		switch {
+		case ref.Name == "HEAD":
+			headOID = ref.ObjectId
+		case strings.HasSuffix(ref.Name, "^{}"):
+			// peeled tag "<tag>^{}", follows the tag
+			tagName := strings.TrimSuffix(ref.Name, "^{}")
+			if len(packed) > 0 && packed[len(packed)-1].name == tagName {
+				packed[len(packed)-1].peeled = ref.ObjectId
+			}
+		case strings.HasPrefix(ref.Name, headsPrefix):
+			packed = append(packed, packedRef{
+				name: remoteOriginPrefix + strings.TrimPrefix(ref.Name, headsPrefix),
+				oid:  ref.ObjectId,
+			})
+		case strings.HasPrefix(ref.Name, tagsPrefix):
+			packed = append(packed, packedRef{name: ref.Name, oid: ref.ObjectId})
+		}
+	}
+	if err := replacePackedRefs(packed); err != nil {
 		return err
 	}
-	err = os.WriteFile(".git/refs/remotes/origin/HEAD",
-		[]byte("ref: refs/remotes/origin/"+master+"\n"), 0644)
-	if err != nil {
+
+	branch, found := strings.CutPrefix(headTarget, headsPrefix)
+	if !found {
+		// servers that do not advertise symref
+		branch = remoteHeadBranch(refs, headOID)
+	}
+	if err := writeRemoteConfig(url, branch); err != nil {
 		return err
 	}
+	if branch == "" {
+		return nil
+	}
+	// HEAD first, so that the creation of the branch is in its reflog too
+	if err := writeSymref("HEAD", headsPrefix+branch, ""); err != nil {
+		return err
+	}
+	if err := writeRef(headsPrefix+branch, headOID, message); err != nil {
+		return err
+	}
+	return writeSymref(remoteOriginPrefix+"HEAD", remoteOriginPrefix+branch, message)
+}
 
-	// tags
-	err = os.MkdirAll(".git/refs/tags", 0755)
+// writeRemoteConfig records the origin remote and the branch tracking
+// it, if any, in the repository configuration
+func writeRemoteConfig(url string, branch string) error {
+	config := fmt.Sprintf("[remote \"origin\"]\n\turl = %s\n"+
+		"\tfetch = +refs/heads/*:%s*\n", url, remoteOriginPrefix)
+	if branch != "" {
+		config += fmt.Sprintf("[branch \"%s\"]\n\tremote = origin\n\tmerge = %s%s\n",
+			branch, headsPrefix, branch)
+	}
+
+	file, err := os.OpenFile(configPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
 		return err
 	}
+	_, err = file.WriteString(config)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
 
+// remoteHeadBranch guesses the branch the remote HEAD points to among the
+// branches at the HEAD commit, master or main first, when the remote does
+// not tell
+func remoteHeadBranch(refs []*ref, headOID string) string {
+	candidates := []string{}
 	for _, ref := range refs {
-		if ref.Name != "HEAD" {
-			refPath := path.Join(".git", ref.Name)
-			folder := filepath.Dir(refPath)
-			err := os.MkdirAll(folder, 0755)
-			if err != nil {
-				return err
-			}
-			err = os.WriteFile(refPath, []byte(ref.ObjectId+"\n"), 0644)
-			if err != nil {
-				return err
-			}
+		if name, ok := strings.CutPrefix(ref.Name, headsPrefix); ok && ref.ObjectId == headOID {
+			candidates = append(candidates, name)
 		}
 	}
-	return nil
+	for _, name := range candidates {
+		if name == master || name == "main" {
+			return name
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return ""
 }
 
 func pktLineValue(line string) (string, error) {
@@ -353,6 +420,39 @@ type ref struct {
 
 type capabilities string
 
+// has reports whether the capability list contains the given capability
+func (c capabilities) has(name string) bool {
+	for _, capability := range strings.Fields(string(c)) {
+		if capability == name || strings.HasPrefix(capability, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// values returns the values of the "<name>=<value>" capabilities,
+// such as symref which may be given several times
+func (c capabilities) values(name string) []string {
+	values := []string{}
+	for _, capability := range strings.Fields(string(c)) {
+		if value, found := strings.CutPrefix(capability, name+"="); found {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// symref returns the ref a symbolic ref of the remote, such as HEAD,
+// points to according to the symref capability, empty if not advertised
+func (c capabilities) symref(refName string) string {
+	for _, value := range c.values("symref") {
+		if source, target, found := strings.Cut(value, ":"); found && source == refName {
+			return target
+		}
+	}
+	return ""
+}
+
 func parseRef(buf []byte) (*ref, capabilities, error) {
 	readerBytes := bytes.NewReader(buf)
 	reader := bufio.NewReader(readerBytes)
@@ -419,6 +519,11 @@ func createNegotationRequest(cap capabilities, reflist []*ref) string {
 // Parses the packfile header
 // returns version, number of objects
 func parsePackFileHeader(packFile []byte) (uint32, uint32, error) {
+	// header (12 bytes) and trailing checksum (20 bytes)
+	if len(packFile) < 32 {
+		return 0, 0, fmt.Errorf("pack file is too small: %d bytes", len(packFile))
+	}
+
 	packFileBuffer := bytes.NewReader(packFile)
 
 	magic := make([]byte, 4)
@@ -436,6 +541,9 @@ func parsePackFileHeader(packFile []byte) (uint32, uint32, error) {
 		return 0, 0, err
 	}
 	version := binary.BigEndian.Uint32(versionBytes)
+	if version != 2 && version != 3 {
+		return 0, 0, fmt.Errorf("unsupported packfile version %d", version)
+	}
 
 	numObjectsBytes := make([]byte, 4)
 	_, err = packFileBuffer.Read(numObjectsBytes)
@@ -461,97 +569,186 @@ func verifyPackFileChecksum(packFile []byte) error {
 	return nil
 }
 
-func parsePackFile(packFile []byte, numberObjects uint32) error {
-	packFileBuffer := bytes.NewReader(packFile)
+// packEntry describes an object entry of a packfile
+type packEntry struct {
+	offset     int64
+	end        int64 // offset of the next entry
+	objectType PackFileObjectType
+	size       uint32
+	crc32      uint32
+
+	// base object of a delta entry, for OBJ_OFS_DELTA
+	// entries it is only known once resolved
+	baseHash string
+	// base object offset of a OBJ_OFS_DELTA entry
+	baseOffset int64
+	// length of the delta chain
+	depth int
+
+	// inflated data: object content or delta instructions
+	data []byte
+
+	// set once the entry is resolved
+	resolved    bool
+	contentType PackFileObjectType
+	content     []byte
+	hash        string
+	hashBytes   []byte
+}
+
+// parsePackFile reads every object entry of the packfile
+// and resolves their content and hash
+func parsePackFile(packFile []byte, numberObjects uint32) ([]*packEntry, error) {
+	// the trailing checksum is not part of any entry
+	packFileBuffer := bytes.NewReader(packFile[:len(packFile)-20])
 
 	// skip header (12 bytes)
 	packFileBuffer.Seek(12, 0)
 
-	var deltaObjects []deltaObject
+	entries := make([]*packEntry, 0, numberObjects)
+	var deltaEntries []*packEntry
 
 	// read object entries
 	var i uint32
 	for i = 0; i < numberObjects; i++ {
-		// read object header
-		size, objectType, err := parseObjectHeader(packFileBuffer)
+		offset := packFileBuffer.Size() - int64(packFileBuffer.Len())
+
+		entry, err := parsePackEntry(packFileBuffer, offset)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("pack file truncated: entry %d of %d at offset %d is incomplete",
+				i+1, numberObjects, offset)
+		}
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("pack file entry %d at offset %d: %w", i+1, offset, err)
 		}
 
-		// commit, tag, tree or blob
-		if objectType == OBJ_COMMIT ||
-			objectType == OBJ_TAG ||
-			objectType == OBJ_TREE ||
-			objectType == OBJ_BLOB {
+		entry.end = packFileBuffer.Size() - int64(packFileBuffer.Len())
+		entry.crc32 = crc32.ChecksumIEEE(packFile[entry.offset:entry.end])
+		entries = append(entries, entry)
 
-			object, err := parseObject(packFileBuffer)
-			if err != nil {
-				return err
-			}
+		if entry.isDelta() {
+			deltaEntries = append(deltaEntries, entry)
+		}
+	}
 
-			if uint32(len(object)) != size {
-				return fmt.Errorf("pack file object size mismatch")
-			}
+	if packFileBuffer.Len() > 0 {
+		return nil, fmt.Errorf("pack file has %d bytes of garbage after the last entry",
+			packFileBuffer.Len())
+	}
 
-			objectTypeStr := PackFileObjectTypeString[objectType]
+	if len(deltaEntries) > 0 {
+		err := applyDeltas(entries, deltaEntries)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-			// write object to disk
-			err = writePackFileObject(objectTypeStr, object)
-			if err != nil {
-				return err
-			}
-		} else if objectType == OBJ_OFS_DELTA {
-			size, err := parseSize(packFileBuffer)
-			if err != nil {
-				return err
-			}
-			object, err := parseObject(packFileBuffer)
-			if err != nil {
-				return err
-			}
-			if uint32(len(object)) != size {
-				return fmt.Errorf("pack file %s object size mismatch",
-					PackFileObjectTypeString[objectType])
-			}
+	// an object must appear only once in a packfile
+	seen := make(map[string]*packEntry, len(entries))
+	for _, entry := range entries {
+		if other, ok := seen[entry.hash]; ok {
+			return nil, fmt.Errorf("duplicate object %s in pack file at offsets %d and %d",
+				entry.hash, other.offset, entry.offset)
+		}
+		seen[entry.hash] = entry
+	}
 
-			// TODO: OBJECT OFFSET DELTA
-			panic("not implemented")
+	return entries, nil
+}
 
-		} else if objectType == OBJ_REF_DELTA {
-			hash := make([]byte, 20)
-			_, err := packFileBuffer.Read(hash)
-			if err != nil {
-				return err
-			}
+// parsePackEntry reads the object entry starting at the given offset
+// Non delta entries are resolved right away
+func parsePackEntry(packFileBuffer *bytes.Reader, offset int64) (*packEntry, error) {
+	// read object header
+	size, objectType, err := parseObjectHeader(packFileBuffer)
+	if err != nil {
+		return nil, err
+	}
 
-			object, err := parseObject(packFileBuffer)
-			if err != nil {
-				return err
-			}
+	entry := &packEntry{
+		offset:     offset,
+		objectType: objectType,
+		size:       size,
+	}
 
-			if uint32(len(object)) != size {
-				return fmt.Errorf("pack file %s object size mismatch",
-					PackFileObjectTypeString[objectType])
-			}
+	// commit, tag, tree or blob
+	if objectType == OBJ_COMMIT ||
+		objectType == OBJ_TAG ||
+		objectType == OBJ_TREE ||
+		objectType == OBJ_BLOB {
 
-			deltaObjects = append(deltaObjects, deltaObject{
-				baseObject: fmt.Sprintf("%x", hash),
-				data:       object,
-			})
+		object, err := parseObject(packFileBuffer)
+		if err != nil {
+			return nil, err
+		}
 
-		} else {
-			return fmt.Errorf("invalid object type: %d", objectType)
+		if uint32(len(object)) != size {
+			return nil, fmt.Errorf("pack file object size mismatch")
 		}
-	}
 
-	if len(deltaObjects) > 0 {
-		err := applyDeltas(deltaObjects)
+		entry.data = object
+		entry.resolve(objectType, object)
+	} else if objectType == OBJ_OFS_DELTA {
+		negativeOffset, err := parseDeltaOffset(packFileBuffer)
+		if err != nil {
+			return nil, err
+		}
+		if negativeOffset <= 0 || negativeOffset > offset {
+			return nil, fmt.Errorf("pack file %s base offset out of bounds",
+				PackFileObjectTypeString[objectType])
+		}
+
+		object, err := parseObject(packFileBuffer)
+		if err != nil {
+			return nil, err
+		}
+		if uint32(len(object)) != size {
+			return nil, fmt.Errorf("pack file %s object size mismatch",
+				PackFileObjectTypeString[objectType])
+		}
+
+		entry.baseOffset = offset - negativeOffset
+		entry.data = object
+
+	} else if objectType == OBJ_REF_DELTA {
+		hash := make([]byte, 20)
+		_, err := io.ReadFull(packFileBuffer, hash)
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		object, err := parseObject(packFileBuffer)
+		if err != nil {
+			return nil, err
+		}
+
+		if uint32(len(object)) != size {
+			return nil, fmt.Errorf("pack file %s object size mismatch",
+				PackFileObjectTypeString[objectType])
 		}
+
+		entry.baseHash = fmt.Sprintf("%x", hash)
+		entry.data = object
+
+	} else {
+		return nil, fmt.Errorf("invalid object type: %d", objectType)
 	}
 
-	return nil
+	return entry, nil
+}
+
+// isDelta reports whether the entry is stored as a delta
+func (e *packEntry) isDelta() bool {
+	return e.objectType == OBJ_OFS_DELTA || e.objectType == OBJ_REF_DELTA
+}
+
+// resolve sets the final type, content and hash of the entry
+func (e *packEntry) resolve(objectType PackFileObjectType, content []byte) {
+	e.resolved = true
+	e.contentType = objectType
+	e.content = content
+	e.hashBytes = hashObjectContent(PackFileObjectTypeString[objectType], content)
+	e.hash = fmt.Sprintf("%x", e.hashBytes)
 }
 
 // ======================== Object parsing ========================
@@ -576,7 +773,14 @@ var PackFileObjectTypeString = map[PackFileObjectType]string{
 	OBJ_REF_DELTA: "ref-delta",
 }
 
-func parseObjectHeader(packFileBuffer *bytes.Reader) (size uint32, objectType PackFileObjectType, err error) {
+// packReader is read byte by byte by zlib, so that the
+// underlying position stays right after the compressed data
+type packReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func parseObjectHeader(packFileBuffer io.ByteReader) (size uint32, objectType PackFileObjectType, err error) {
 	// read the first byte
 	firstByte, err := packFileBuffer.ReadByte()
 	if err != nil {
@@ -615,7 +819,7 @@ func parseObjectHeader(packFileBuffer *bytes.Reader) (size uint32, objectType Pa
 	return
 }
 
-func parseObject(packFileBuffer *bytes.Reader) ([]byte, error) {
+func parseObject(packFileBuffer packReader) ([]byte, error) {
 	zlibReader, err := zlib.NewReader(packFileBuffer)
 	if err != nil {
 		return nil, err
@@ -636,7 +840,7 @@ func parseObject(packFileBuffer *bytes.Reader) ([]byte, error) {
 // [MSB 1 bit][SIZE 7 bit]
 // [MSB 1 bit][SIZE 7 bit]
 // ...
-func parseSize(data *bytes.Reader) (uint32, error) {
+func parseSize(data io.ByteReader) (uint32, error) {
 	b, err := data.ReadByte()
 	if err != nil {
 		return 0, err
@@ -659,72 +863,133 @@ func parseSize(data *bytes.Reader) (uint32, error) {
 	return size, nil
 }
 
-// ======================== Delta object ========================
+// reads the base object offset of a OBJ_OFS_DELTA entry,
+// relative to the entry offset
+//
+// Unlike sizes, the offset is encoded most significant bytes first
+// and 1 is added to each continuation byte so that every value
+// has a single encoding:
+//
+// [MSB 1 bit][OFFSET 7 bit]
+// [MSB 1 bit][OFFSET 7 bit]
+// ...
+func parseDeltaOffset(data io.ByteReader) (int64, error) {
+	b, err := data.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	offset := int64(b & 0x7f)
+	for b&0x80 != 0 {
+		b, err = data.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		offset = ((offset + 1) << 7) | int64(b&0x7f)
+	}
 
-type deltaObject struct {
-	baseObject string
-	data       []byte
+	return offset, nil
 }
 
-func applyDeltas(deltaObjects []deltaObject) error {
-	// We would need to check if deltaObjects can be resolved
-	// that is: if the root base object is already written to disk
+// ======================== Delta object ========================
+
+// applyDeltas resolves the delta entries of a packfile
+// against their base object, either from the same packfile
+// or already present in the object store
+func applyDeltas(entries []*packEntry, deltaEntries []*packEntry) error {
+	resolvedEntries := map[string]*packEntry{}
+	entriesByOffset := map[int64]*packEntry{}
+	for _, entry := range entries {
+		if entry.resolved {
+			resolvedEntries[entry.hash] = entry
+		}
+		entriesByOffset[entry.offset] = entry
+	}
 
-	fmt.Printf("remote: Resolving deltas: %d\n", len(deltaObjects))
-	for len(deltaObjects) > 0 {
-		noBaseDeltaObjects := []deltaObject{}
+	for len(deltaEntries) > 0 {
+		noBaseDeltaEntries := []*packEntry{}
 		atLeastOneBaseObject := false
 
-		for _, deltaObject := range deltaObjects {
-			if objectExists(deltaObject.baseObject) {
-				atLeastOneBaseObject = true
-				err := applyDelta(deltaObject)
+		for _, deltaEntry := range deltaEntries {
+			var baseType PackFileObjectType
+			var baseContent []byte
+			baseDepth := 0
+
+			if deltaEntry.objectType == OBJ_OFS_DELTA {
+				baseEntry, ok := entriesByOffset[deltaEntry.baseOffset]
+				if !ok {
+					return fmt.Errorf("no pack file entry at base offset %d", deltaEntry.baseOffset)
+				}
+				if !baseEntry.resolved {
+					// the base is itself a delta not resolved yet
+					noBaseDeltaEntries = append(noBaseDeltaEntries, deltaEntry)
+					continue
+				}
+				baseType = baseEntry.contentType
+				baseContent = baseEntry.content
+				baseDepth = baseEntry.depth
+				deltaEntry.baseHash = baseEntry.hash
+			} else if baseEntry, ok := resolvedEntries[deltaEntry.baseHash]; ok {
+				baseType = baseEntry.contentType
+				baseContent = baseEntry.content
+				baseDepth = baseEntry.depth
+			} else if objectExists(deltaEntry.baseHash) {
+				baseObject, err := NewObject(deltaEntry.baseHash)
 				if err != nil {
 					return err
 				}
+				baseType = packFileObjectType(baseObject.Type)
+				baseContent = baseObject.Content
 			} else {
-				noBaseDeltaObjects = append(noBaseDeltaObjects, deltaObject)
+				noBaseDeltaEntries = append(noBaseDeltaEntries, deltaEntry)
+				continue
+			}
+
+			atLeastOneBaseObject = true
+			content, err := applyDelta(baseContent, deltaEntry.data)
+			if err != nil {
+				return err
 			}
+			deltaEntry.resolve(baseType, content)
+			deltaEntry.depth = baseDepth + 1
+			resolvedEntries[deltaEntry.hash] = deltaEntry
 		}
 
 		if !atLeastOneBaseObject {
 			return fmt.Errorf("no base object found for delta objects, cannot resolve")
 		}
 
-		deltaObjects = noBaseDeltaObjects
+		deltaEntries = noBaseDeltaEntries
 	}
 
 	return nil
 }
 
-func applyDelta(deltaObject deltaObject) error {
-	baseObject, err := NewObject(deltaObject.baseObject)
-	if err != nil {
-		return err
-	}
-
-	deltaData := bytes.NewReader(deltaObject.data)
+// applyDelta reconstructs an object from its base object content
+// and the delta instructions
+func applyDelta(baseContent []byte, delta []byte) ([]byte, error) {
+	deltaData := bytes.NewReader(delta)
 	baseSize, err := parseSize(deltaData) // source buffer size
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// check if the base object size matches the size in the delta object
-	if baseSize != uint32(len(baseObject.Content)) {
-		return fmt.Errorf("base object size mismatch")
+	if baseSize != uint32(len(baseContent)) {
+		return nil, fmt.Errorf("base object size mismatch")
 	}
 
 	expectedSize, err := parseSize(deltaData) // target buffer size
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	buffer := bytes.NewBuffer(nil)
+	buffer := bytes.NewBuffer(make([]byte, 0, expectedSize))
 
 	for deltaData.Len() > 0 {
 		opCode, err := deltaData.ReadByte()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// check MSB
@@ -743,7 +1008,7 @@ func applyDelta(deltaObject deltaObject) error {
 				if opCode&(1<<bit) != 0 {
 					nextByte, err := deltaData.ReadByte()
 					if err != nil {
-						return err
+						return nil, err
 					}
 					arg |= uint64(nextByte) << (bit * 8)
 				}
@@ -753,38 +1018,38 @@ func applyDelta(deltaObject deltaObject) error {
 			if size == 0 {
 				size = 0x10000
 			}
-			buffer.Write(baseObject.Content[offset : offset+size])
+			if offset+size > uint64(len(baseContent)) {
+				return nil, fmt.Errorf("delta copy instruction out of base object bounds")
+			}
+			buffer.Write(baseContent[offset : offset+size])
 
-		} else { // insert instruction
+		} else if opCode != 0 { // insert instruction
 			size := uint32(opCode & 0x7f)
 			data := make([]byte, size)
-			_, err := deltaData.Read(data)
+			_, err := io.ReadFull(deltaData, data)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			buffer.Write(data)
+		} else {
+			return nil, fmt.Errorf("invalid delta instruction")
 		}
 	}
 
 	if buffer.Len() != int(expectedSize) {
-		return fmt.Errorf("delta object size mismatch")
-	}
-
-	// write object to disk
-	err = writePackFileObject(string(baseObject.Type), buffer.Bytes())
-	if err != nil {
-		return err
+		return nil, fmt.Errorf("delta object size mismatch")
 	}
 
-	return nil
+	return buffer.Bytes(), nil
 }
 
 func objectExists(sha string) bool {
 	objectPath := getObjectPath(sha)
-	if _, err := os.Stat(objectPath); err != nil || errors.Is(err, os.ErrNotExist) {
-		return false
+	if _, err := os.Stat(objectPath); err == nil {
+		return true
 	}
-	return true
+	_, _, found := findPackedObject(sha)
+	return found
 }
 
 // ======================== Helpers ========================
@@ -793,22 +1058,21 @@ func toPktLine(value string) string {
 	return fmt.Sprintf("%04x%s", len(value)+4, value)
 }
 
-func writePackFileObject(objectType string, object []byte) error {
-	header := fmt.Sprintf("%s %d\x00", objectType, len(object))
+// hashObjectContent computes the object ID of an object
+// from its type and content
+func hashObjectContent(objectType string, content []byte) []byte {
 	hash := sha1.New()
-	if _, err := hash.Write([]byte(header)); err != nil {
-		return err
-	}
-	if _, err := hash.Write(object); err != nil {
-		return err
-	}
-
-	sha := fmt.Sprintf("%x", hash.Sum(nil))
+	hash.Write([]byte(fmt.Sprintf("%s %d\x00", objectType, len(content))))
+	hash.Write(content)
+	return hash.Sum(nil)
+}
 
-	err := writeObject(sha, []byte(header), bytes.NewReader(object))
-	if err != nil {
-		return err
+// packFileObjectType returns the packfile type of an object type
+func packFileObjectType(objectType ObjectType) PackFileObjectType {
+	for packType, name := range PackFileObjectTypeString {
+		if name == string(objectType) {
+			return packType
+		}
 	}
-
-	return nil
+	return 0
 }
@@ -0,0 +1,60 @@
+package mygit
+
+import (
+	"fmt"
+)
+
+type RevParseOptions struct {
+	// abbreviate the object IDs to at least Short characters,
+	// 0 prints full object IDs
+	Short int
+	// require a single revision naming an existing object
+	Verify bool
+}
+
+// RevParse prints the object IDs selected by the given revision
+// expressions, excluded ones prefixed with '^'
+func RevParse(revisions []string, options *RevParseOptions) error {
+	if options.Verify && len(revisions) != 1 {
+		return fmt.Errorf("needed a single revision")
+	}
+
+	for _, revision := range revisions {
+		specs, err := parseRevisionSpecs(revision)
+		if err != nil {
+			return err
+		}
+		if options.Verify && (len(specs) != 1 || specs[0].exclude) {
+			return fmt.Errorf("needed a single revision")
+		}
+
+		for _, spec := range specs {
+			oid := spec.oid
+			if options.Short > 0 {
+				oid = shortestUniqueAbbrev(oid, options.Short)
+			}
+			if spec.exclude {
+				oid = "^" + oid
+			}
+			fmt.Println(oid)
+		}
+	}
+	return nil
+}
+
+// Disambiguate prints every object ID starting with the given prefix
+func Disambiguate(prefix string) error {
+	if !isObjectPrefix(prefix) {
+		return fmt.Errorf("invalid object ID prefix '%s', at least %d hexadecimal characters are required",
+			prefix, minAbbrev)
+	}
+
+	oids, err := findObjectsByPrefix(prefix)
+	if err != nil {
+		return err
+	}
+	for _, oid := range oids {
+		fmt.Println(oid)
+	}
+	return nil
+}
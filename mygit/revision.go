@@ -0,0 +1,410 @@
+package mygit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Revision expressions, see gitrevisions(7):
+//
+//	<sha1>, <abbreviated sha1>     full or abbreviated object ID
+//	<refname>, @                   ref name expanded with refDWIMRules, HEAD
+//	@{-<n>}                        n-th branch checked out before the current one
+//	<rev>~<n>                      n-th first parent ancestor
+//	<rev>^<n>                      n-th parent, ^0 is the commit itself
+//	<rev>^{<type>}, <rev>^{}       object peeled to the given type, tags peeled
+//	<rev>:<path>                   tree entry at path in the tree of rev
+//	<rev1>..<rev2>                 commits reachable from rev2 but not rev1
+//	<rev1>...<rev2>                commits reachable from either but not both
+
+// revisionSpec is an object selected by a revision expression, or excluded
+// from the selection ("^<rev>")
+type revisionSpec struct {
+	oid     string
+	exclude bool
+}
+
+// unknownRevisionError formats the error of a revision that cannot be resolved
+func unknownRevisionError(revision string) error {
+	return fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree", revision)
+}
+
+// resolveRevision returns the object ID of a single revision expression
+func resolveRevision(revision string) (string, error) {
+	if revision == "" {
+		return "", unknownRevisionError(revision)
+	}
+
+	// <rev>:<path>
+	if rev, treePath, found := splitRevisionPath(revision); found {
+		if rev == "" {
+			return "", fmt.Errorf("index paths are not supported: '%s'", revision)
+		}
+		treeOID, err := resolveRevision(rev + "^{tree}")
+		if err != nil {
+			return "", err
+		}
+		oid, err := lookupTreePath(treeOID, treePath)
+		if err != nil {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", treePath, rev)
+		}
+		return oid, nil
+	}
+
+	// ref names cannot contain '~' or '^', suffixes start at the first one
+	end := strings.IndexAny(revision, "~^")
+	if end < 0 {
+		end = len(revision)
+	}
+	oid, err := resolveRevisionBase(revision[:end])
+	if err != nil {
+		return "", err
+	}
+
+	suffix := revision[end:]
+	for len(suffix) > 0 {
+		operator := suffix[0]
+		suffix = suffix[1:]
+
+		// ^{<type>}
+		if operator == '^' && strings.HasPrefix(suffix, "{") {
+			closing := strings.IndexByte(suffix, '}')
+			if closing < 0 {
+				return "", unknownRevisionError(revision)
+			}
+			oid, err = peelRevision(oid, suffix[1:closing])
+			if err != nil {
+				return "", fmt.Errorf("%s: %s", revision, err)
+			}
+			suffix = suffix[closing+1:]
+			continue
+		}
+
+		digits := len(suffix) - len(strings.TrimLeft(suffix, "0123456789"))
+		n := 1
+		if digits > 0 {
+			n, err = strconv.Atoi(suffix[:digits])
+			if err != nil {
+				return "", unknownRevisionError(revision)
+			}
+			suffix = suffix[digits:]
+		}
+
+		commit, err := peelToCommit(oid)
+		if err != nil {
+			return "", err
+		}
+
+		switch operator {
+		case '~':
+			for i := 0; i < n; i++ {
+				if len(commit.Parents) == 0 {
+					return "", unknownRevisionError(revision)
+				}
+				if commit, err = peelToCommit(commit.Parents[0]); err != nil {
+					return "", err
+				}
+			}
+			oid = commit.Hash
+		case '^':
+			if n == 0 {
+				oid = commit.Hash
+			} else if n <= len(commit.Parents) {
+				oid = commit.Parents[n-1]
+			} else {
+				return "", unknownRevisionError(revision)
+			}
+		}
+	}
+
+	return oid, nil
+}
+
+// resolveRevisionBase resolves a revision without suffix: an object ID,
+// a ref name or @{-<n>}
+func resolveRevisionBase(name string) (string, error) {
+	if name == "@" {
+		name = "HEAD"
+	}
+
+	// @{-<n>}
+	if nth, found := strings.CutPrefix(name, "@{-"); found && strings.HasSuffix(nth, "}") {
+		n, err := strconv.Atoi(strings.TrimSuffix(nth, "}"))
+		if err != nil || n <= 0 {
+			return "", unknownRevisionError(name)
+		}
+		branch, err := previousBranch(n)
+		if err != nil {
+			return "", err
+		}
+		if branch == "" {
+			return "", fmt.Errorf("%s: only %d checkouts yet", name, n-1)
+		}
+		return resolveRevisionBase(branch)
+	}
+
+	// <ref>@{<n>}, <ref>@{<date>}
+	if i := strings.LastIndex(name, "@{"); i >= 0 && strings.HasSuffix(name, "}") {
+		ref, selector := name[:i], name[i+2:len(name)-1]
+		switch strings.ToLower(selector) {
+		case "u", "upstream", "push":
+			return "", fmt.Errorf("upstream revisions are not supported: '%s'", name)
+		}
+		return resolveReflogRevision(name, ref, selector)
+	}
+
+	if len(name) == 40 && isHex(strings.ToLower(name)) {
+		oid := strings.ToLower(name)
+		if !objectExists(oid) {
+			return "", unknownRevisionError(name)
+		}
+		return oid, nil
+	}
+
+	_, oid, err := dwimRef(name)
+	if err != nil {
+		return "", err
+	}
+	if oid != "" {
+		return oid, nil
+	}
+
+	if isObjectPrefix(name) {
+		oid, err := resolveAbbrev(name)
+		if err != nil && !isAmbiguous(err) {
+			return "", unknownRevisionError(name)
+		}
+		return oid, err
+	}
+
+	return "", unknownRevisionError(name)
+}
+
+// splitRevisionPath splits "<rev>:<path>" on the first ':' outside of braces,
+// so that "@{2024-01-01 10:00}" is not split
+func splitRevisionPath(revision string) (string, string, bool) {
+	depth := 0
+	for i, c := range revision {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ':':
+			if depth == 0 {
+				return revision[:i], revision[i+1:], true
+			}
+		}
+	}
+	return revision, "", false
+}
+
+// peelRevision peels an object to the given type, "" peels tags
+// to the first object that is not a tag, "object" accepts any object
+func peelRevision(oid string, objectType string) (string, error) {
+	switch objectType {
+	case "object":
+		if !objectExists(oid) {
+			return "", fmt.Errorf("object %s does not exist", oid)
+		}
+		return oid, nil
+	case string(ObjectTypeTag):
+		object, err := NewObject(oid)
+		if err != nil {
+			return "", err
+		}
+		if object.Type != ObjectTypeTag {
+			return "", fmt.Errorf("object %s is a %s, not a tag", oid, object.Type)
+		}
+		return oid, nil
+	case "":
+		object, err := peelObject(oid)
+		if err != nil {
+			return "", err
+		}
+		return object.Hash, nil
+	case string(ObjectTypeCommit), string(ObjectTypeTree), string(ObjectTypeBlob):
+	default:
+		return "", fmt.Errorf("invalid object type '%s'", objectType)
+	}
+
+	object, err := peelObject(oid)
+	if err != nil {
+		return "", err
+	}
+	// commits peel to their tree
+	if object.Type == ObjectTypeCommit && objectType == string(ObjectTypeTree) {
+		commit, err := parseCommitObject(object)
+		if err != nil {
+			return "", err
+		}
+		return commit.Tree, nil
+	}
+	if string(object.Type) != objectType {
+		return "", fmt.Errorf("object %s is a %s, not a %s", object.Hash, object.Type, objectType)
+	}
+	return object.Hash, nil
+}
+
+// lookupTreePath returns the object ID of the entry at path in a tree,
+// the tree itself for an empty path
+func lookupTreePath(treeOID string, treePath string) (string, error) {
+	oid := treeOID
+	for _, name := range strings.Split(treePath, "/") {
+		if name == "" {
+			continue
+		}
+
+		object, err := NewObject(oid)
+		if err != nil {
+			return "", err
+		}
+		if object.Type != ObjectTypeTree {
+			return "", fmt.Errorf("object %s is not a tree", oid)
+		}
+		entries, err := parseTree(bufio.NewReader(bytes.NewReader(object.Content)))
+		if err != nil {
+			return "", err
+		}
+
+		found := false
+		for _, entry := range entries {
+			if entry.Name == name {
+				oid, found = entry.Hash, true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("path '%s' does not exist", treePath)
+		}
+	}
+	return oid, nil
+}
+
+// previousBranch returns the n-th branch (or commit) checked out before
+// the current one, found in the HEAD reflog checkout messages
+// Returns an empty name when there were not that many checkouts
+func previousBranch(n int) (string, error) {
+	entries, err := readReflog("HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		moving, found := strings.CutPrefix(entries[i].message, "checkout: moving from ")
+		if !found {
+			continue
+		}
+		n--
+		if n == 0 {
+			from, _, _ := strings.Cut(moving, " to ")
+			return from, nil
+		}
+	}
+	return "", nil
+}
+
+// parseRevisionSpecs parses a revision argument, either a single revision,
+// an excluded "^<rev>" or a range, in the order git rev-parse prints them
+func parseRevisionSpecs(argument string) ([]revisionSpec, error) {
+	if excluded, found := strings.CutPrefix(argument, "^"); found {
+		oid, err := resolveRevision(excluded)
+		if err != nil {
+			return nil, err
+		}
+		return []revisionSpec{{oid: oid, exclude: true}}, nil
+	}
+
+	// ranges, a path may contain ".." but not before the ':'
+	rev, _, _ := splitRevisionPath(argument)
+	symmetric := strings.Contains(rev, "...")
+	separator := ".."
+	if symmetric {
+		separator = "..."
+	}
+	from, to, isRange := strings.Cut(argument, separator)
+	if !isRange || !strings.Contains(rev, "..") {
+		oid, err := resolveRevision(argument)
+		if err != nil {
+			return nil, err
+		}
+		return []revisionSpec{{oid: oid}}, nil
+	}
+
+	// a missing side of a range is HEAD
+	if from == "" {
+		from = "HEAD"
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+	fromOID, err := resolveRevision(from)
+	if err != nil {
+		return nil, err
+	}
+	toOID, err := resolveRevision(to)
+	if err != nil {
+		return nil, err
+	}
+
+	if !symmetric {
+		return []revisionSpec{{oid: toOID}, {oid: fromOID, exclude: true}}, nil
+	}
+
+	specs := []revisionSpec{{oid: toOID}, {oid: fromOID}}
+	bases, err := mergeBases(fromOID, toOID)
+	if err != nil {
+		return nil, err
+	}
+	for _, base := range bases {
+		specs = append(specs, revisionSpec{oid: base, exclude: true})
+	}
+	return specs, nil
+}
+
+// commitAncestors returns a commit and all of its ancestors, by object ID
+func commitAncestors(oid string) (map[string]*CommitObject, error) {
+	ancestors := map[string]*CommitObject{}
+	queue := []string{oid}
+	for len(queue) > 0 {
+		oid := queue[0]
+		queue = queue[1:]
+		if _, ok := ancestors[oid]; ok {
+			continue
+		}
+
+		commit, err := peelToCommit(oid)
+		if err != nil {
+			return nil, err
+		}
+		ancestors[commit.Hash] = commit
+		queue = append(queue, commit.Parents...)
+	}
+	return ancestors, nil
+}
+
+// mergeBases returns the best common ancestors of two commits: the common
+// ancestors that are not an ancestor of another common ancestor
+func mergeBases(a string, b string) ([]string, error) {
+	history := newCommitHistory()
+	one, err := history.commit(a)
+	if err != nil {
+		return nil, err
+	}
+	two, err := history.commit(b)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := history.mergeBases(one, two)
+	if err != nil {
+		return nil, err
+	}
+	bases := make([]string, len(commits))
+	for i, commit := range commits {
+		bases[i] = commit.Hash
+	}
+	return bases, nil
+}
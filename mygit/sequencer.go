@@ -0,0 +1,746 @@
+package mygit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// files of a cherry-pick or a revert left to conclude: the commit it
+// stopped at, and for several commits the commits left to apply along with
+// the commit HEAD was at before the first one
+const (
+	cherryPickHeadPath = ".git/CHERRY_PICK_HEAD"
+	revertHeadPath     = ".git/REVERT_HEAD"
+	sequencerDir       = ".git/sequencer"
+)
+
+// todoCommand is a line of the todo list of cherry-pick, revert and rebase:
+// "<action> <commit> <subject>", or "exec <command>" and "break"
+type todoCommand struct {
+	action string
+	// commit the action applies to, empty for exec and break
+	oid string
+	// subject of the commit, or the command run by exec
+	argument string
+}
+
+// todoActions are the actions of the todo lines, by name and abbreviation
+var todoActions = map[string]string{
+	"pick": "pick", "p": "pick",
+	"revert": "revert",
+	"reword": "reword", "r": "reword",
+	"edit": "edit", "e": "edit",
+	"squash": "squash", "s": "squash",
+	"fixup": "fixup", "f": "fixup",
+	"exec": "exec", "x": "exec",
+	"break": "break", "b": "break",
+	"drop": "drop", "d": "drop",
+	"noop": "noop",
+}
+
+// parseTodo parses a todo list, skipping empty lines and comments
+// starting with '#'; the commits of the commands are resolved to full
+// object IDs
+func parseTodo(content string) ([]todoCommand, error) {
+	commands := []todoCommand{}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		word, rest, _ := strings.Cut(line, " ")
+		action, ok := todoActions[word]
+		if !ok {
+			return nil, fmt.Errorf("invalid line %d: %s", i+1, line)
+		}
+		rest = strings.TrimSpace(rest)
+
+		switch action {
+		case "exec":
+			if rest == "" {
+				return nil, fmt.Errorf("missing command in line %d: %s", i+1, line)
+			}
+			commands = append(commands, todoCommand{action: action, argument: rest})
+		case "break", "noop":
+			commands = append(commands, todoCommand{action: action})
+		default:
+			name, subject, _ := strings.Cut(rest, " ")
+			oid, err := resolveRevision(name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid line %d: %s", i+1, line)
+			}
+			commit, err := peelToCommit(oid)
+			if err != nil {
+				return nil, fmt.Errorf("invalid line %d: %s", i+1, line)
+			}
+			commands = append(commands, todoCommand{action: action, oid: commit.Hash, argument: subject})
+		}
+	}
+	return commands, nil
+}
+
+// formatTodo returns the lines of a todo list, with abbreviated object IDs
+// if abbreviate is set
+func formatTodo(commands []todoCommand, abbreviate bool) string {
+	builder := strings.Builder{}
+	for _, command := range commands {
+		builder.WriteString(command.action)
+		if command.oid != "" {
+			oid := command.oid
+			if abbreviate {
+				oid = shortestUniqueAbbrev(oid, DefaultAbbrev)
+			}
+			builder.WriteString(" " + oid)
+		}
+		builder.WriteString(prefixed(" ", command.argument) + "\n")
+	}
+	return builder.String()
+}
+
+// readTodoFile reads a todo list, none if the file does not exist
+func readTodoFile(filePath string) ([]todoCommand, error) {
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseTodo(string(data))
+}
+
+// pickCommand returns the todo command applying a commit
+func pickCommand(action string, commit *CommitObject) todoCommand {
+	subject, _, _ := strings.Cut(commit.Message, "\n")
+	return todoCommand{action: action, oid: commit.Hash, argument: subject}
+}
+
+// cleanupMessage cleans up a commit message edited by the user: comment
+// lines starting with '#' and trailing spaces are removed, as well as
+// leading, trailing and consecutive empty lines
+func cleanupMessage(message string) string {
+	lines := []string{}
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// rangeCommits returns the commits reachable from the revisions included
+// by specs and not from the excluded ones, parents before their children
+func rangeCommits(specs []revisionSpec) ([]*CommitObject, error) {
+	excluded := map[string]bool{}
+	for _, spec := range specs {
+		if !spec.exclude {
+			continue
+		}
+		ancestors, err := commitAncestors(spec.oid)
+		if err != nil {
+			return nil, err
+		}
+		for oid := range ancestors {
+			excluded[oid] = true
+		}
+	}
+
+	commits := []*CommitObject{}
+	seen := map[string]bool{}
+	var visit func(commit *CommitObject) error
+	visit = func(commit *CommitObject) error {
+		if excluded[commit.Hash] || seen[commit.Hash] {
+			return nil
+		}
+		seen[commit.Hash] = true
+		for _, parent := range commit.Parents {
+			parentCommit, err := peelToCommit(parent)
+			if err != nil {
+				return err
+			}
+			if err := visit(parentCommit); err != nil {
+				return err
+			}
+		}
+		commits = append(commits, commit)
+		return nil
+	}
+	for _, spec := range specs {
+		if spec.exclude {
+			continue
+		}
+		commit, err := peelToCommit(spec.oid)
+		if err != nil {
+			return nil, err
+		}
+		if err := visit(commit); err != nil {
+			return nil, err
+		}
+	}
+	return commits, nil
+}
+
+// applyCommit applies the change a commit made to its parent onto the tree
+// of HEAD with a three-way merge, the reversed change for a revert: the
+// index and the working tree are updated with the merged tree, the
+// conflicted paths being left as stages in the index. The messages of the
+// merge are shown, only at conflicts for a rebase. It returns the merged
+// tree and the conflicts
+func applyCommit(headTree string, commit *CommitObject, revert bool, operation string) (
+	string, []mergeConflict, error) {
+	if len(commit.Parents) > 1 {
+		return "", nil, fmt.Errorf("commit %s is a merge but no -m option was given", commit.Hash)
+	}
+	parentTree := ""
+	if len(commit.Parents) == 1 {
+		var err error
+		if parentTree, err = commitTreeOID(commit.Parents[0]); err != nil {
+			return "", nil, err
+		}
+	}
+
+	subject, _, _ := strings.Cut(commit.Message, "\n")
+	label := fmt.Sprintf("%s (%s)", shortestUniqueAbbrev(commit.Hash, DefaultAbbrev), subject)
+	base, theirs := parentTree, commit.Tree
+	baseLabel, theirsLabel := "parent of "+label, label
+	if parentTree == "" {
+		baseLabel = "(empty tree)"
+	}
+	if revert {
+		base, theirs = theirs, base
+		baseLabel, theirsLabel = theirsLabel, baseLabel
+	}
+
+	merge, err := newTreeMerge(newCommitHistory(), "HEAD", theirsLabel)
+	if err != nil {
+		return "", nil, err
+	}
+	merge.labels.base = baseLabel
+	tree, err := merge.mergeTrees(base, headTree, theirs)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := checkoutTree(headTree, tree, operation); err != nil {
+		return "", nil, err
+	}
+	if operation != "rebase" || len(merge.conflicts) > 0 {
+		for _, message := range merge.sortedMessages() {
+			fmt.Println(message)
+		}
+	}
+	if len(merge.conflicts) > 0 {
+		if err := writeConflictStages(merge.conflicts); err != nil {
+			return "", nil, err
+		}
+	}
+	return tree, merge.conflicts, nil
+}
+
+// printCommitSummary shows a commit made on top of HEAD by cherry-pick,
+// revert or rebase: "[<branch> <abbreviated object ID>] <subject>", its
+// author when it is not the committer, its author date if showDate is set,
+// and the summary of its changes
+func printCommitSummary(oid string, showDate bool) error {
+	headRef, _, err := readHead()
+	if err != nil {
+		return err
+	}
+	commit, err := peelToCommit(oid)
+	if err != nil {
+		return err
+	}
+	branch := strings.TrimPrefix(headRef, headsPrefix)
+	if headRef == "" {
+		branch = "detached HEAD"
+	}
+	subject, _, _ := strings.Cut(commit.Message, "\n")
+
+	out := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(out, "[%s %s] %s\n", branch, shortestUniqueAbbrev(commit.Hash, DefaultAbbrev), subject)
+	if commit.AuthorName != commit.CommitterName || commit.AuthorEmail != commit.CommitterEmail {
+		fmt.Fprintf(out, " Author: %s <%s>\n", commit.AuthorName, commit.AuthorEmail)
+	}
+	if showDate {
+		date, err := parseObjectDate(commit.AuthorDateSeconds, commit.AuthorDateTimeZone)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, " Date: %s\n", date.Format("Mon Jan 2 15:04:05 2006 -0700"))
+	}
+
+	pairs, stats, err := changeStats(commit.Parents[0], commit.Hash)
+	if err != nil {
+		return err
+	}
+	insertions, deletions := 0, 0
+	for _, stat := range stats {
+		if !stat.binary {
+			insertions += stat.added
+			deletions += stat.deleted
+		}
+	}
+	writeStatSummary(out, len(stats), insertions, deletions)
+	writeDiffSummary(out, pairs)
+	return out.Flush()
+}
+
+// readPickHead returns the commit a cherry-pick or a revert stopped at,
+// empty when none is left to conclude, and whether it is a revert
+func readPickHead() (string, bool, error) {
+	for _, filePath := range []string{cherryPickHeadPath, revertHeadPath} {
+		data, err := os.ReadFile(filePath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		oid, _, _ := strings.Cut(string(data), "\n")
+		return oid, filePath == revertHeadPath, nil
+	}
+	return "", false, nil
+}
+
+// removePickState removes the files of a cherry-pick or a revert stopped
+// at a commit
+func removePickState() error {
+	for _, filePath := range []string{cherryPickHeadPath, revertHeadPath, mergeMsgPath} {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// pickOperation names the command applying the commits of an action
+func pickOperation(action string) string {
+	if action == "revert" {
+		return "revert"
+	}
+	return "cherry-pick"
+}
+
+// pickMessage returns the message of the commit applying the change of a
+// commit: its own message, or for a revert a message naming it
+func pickMessage(commit *CommitObject, revert bool) string {
+	if revert {
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		return fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s.", subject, commit.Hash)
+	}
+	return strings.TrimSuffix(commit.Message, "\n")
+}
+
+// CherryPick applies the changes of commits to HEAD, each recorded in a new
+// commit with the message and the author of the original commit
+// "<commit>..<commit>" ranges apply every commit of the range, the oldest
+// first. It returns false when stopped at a commit whose change conflicts
+// or is already in HEAD, the cherry-pick going on with Continue or Skip
+func CherryPick(revisions []string) (bool, error) {
+	return startPicks("pick", revisions)
+}
+
+// Revert applies the reversed changes of commits to HEAD, each recorded in
+// a new commit; ranges revert the newest commit first. It returns false
+// when stopped at a commit, as CherryPick does
+func Revert(revisions []string) (bool, error) {
+	return startPicks("revert", revisions)
+}
+
+// startPicks starts a cherry-pick or a revert of the commits of revisions
+func startPicks(action string, revisions []string) (bool, error) {
+	operation := pickOperation(action)
+	if pickHead, _, err := readPickHead(); err != nil {
+		return false, err
+	} else if _, err := os.Stat(sequencerDir); pickHead != "" || err == nil {
+		return false, fmt.Errorf("a cherry-pick or revert is already in progress\n" +
+			"hint: try \"git " + operation + " (--continue | --skip | --abort)\"")
+	}
+	if mergeHead, err := readMergeHead(); err != nil {
+		return false, err
+	} else if mergeHead != "" {
+		return false, fmt.Errorf("you have not concluded your merge (MERGE_HEAD exists)")
+	}
+
+	_, head, err := readHead()
+	if err != nil {
+		return false, err
+	}
+	if head == "" {
+		return false, fmt.Errorf("cannot %s onto an unborn branch", operation)
+	}
+	headTree, err := commitTreeOID(head)
+	if err != nil {
+		return false, err
+	}
+	index, err := readIndex()
+	if err != nil {
+		return false, err
+	}
+	if len(index.unmerged()) > 0 {
+		return false, fmt.Errorf("%s is not possible because you have unmerged files", operation)
+	}
+	if err := requireCleanIndex(headTree, operation); err != nil {
+		return false, err
+	}
+
+	// single commits are applied in the given order, ranges parents first
+	specs := []revisionSpec{}
+	ranges := false
+	for _, revision := range revisions {
+		revisionSpecs, err := parseRevisionSpecs(revision)
+		if err != nil {
+			return false, err
+		}
+		for _, spec := range revisionSpecs {
+			ranges = ranges || spec.exclude
+		}
+		specs = append(specs, revisionSpecs...)
+	}
+	commits := []*CommitObject{}
+	if ranges {
+		if commits, err = rangeCommits(specs); err != nil {
+			return false, err
+		}
+		if action == "revert" {
+			for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+				commits[i], commits[j] = commits[j], commits[i]
+			}
+		}
+	} else {
+		for _, spec := range specs {
+			commit, err := peelToCommit(spec.oid)
+			if err != nil {
+				return false, err
+			}
+			commits = append(commits, commit)
+		}
+	}
+	if len(commits) == 0 {
+		return false, fmt.Errorf("empty commit set passed")
+	}
+	commands := make([]todoCommand, len(commits))
+	for i, commit := range commits {
+		commands[i] = pickCommand(action, commit)
+	}
+
+	// several commits are applied in a sequence that can be aborted back
+	// to the commit HEAD was at
+	if len(commands) > 1 {
+		if err := os.MkdirAll(sequencerDir, 0755); err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(path.Join(sequencerDir, "head"), []byte(head+"\n"), 0644); err != nil {
+			return false, err
+		}
+	}
+	return runPicks(commands)
+}
+
+// runPicks applies the commits of the commands one after the other, until
+// one stops the sequence; the commands left are saved in the sequencer
+// directory for the sequence to go on
+func runPicks(commands []todoCommand) (bool, error) {
+	_, err := os.Stat(sequencerDir)
+	sequence := err == nil
+	for len(commands) > 0 {
+		if sequence {
+			if err := os.WriteFile(path.Join(sequencerDir, "todo"), []byte(formatTodo(commands, true)), 0644); err != nil {
+				return false, err
+			}
+		}
+		picked, err := pickCommit(commands[0])
+		if err != nil || !picked {
+			return false, err
+		}
+		commands = commands[1:]
+
+		if sequence {
+			_, head, err := readHead()
+			if err != nil {
+				return false, err
+			}
+			if err := os.WriteFile(path.Join(sequencerDir, "abort-safety"), []byte(head+"\n"), 0644); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, os.RemoveAll(sequencerDir)
+}
+
+// pickCommit applies the change of the commit of a pick or a revert command
+// to HEAD and commits it, unless it conflicts or is already in HEAD: the
+// commit is then left to conclude in CHERRY_PICK_HEAD or REVERT_HEAD and
+// MERGE_MSG, and pickCommit returns false
+func pickCommit(command todoCommand) (bool, error) {
+	revert := command.action == "revert"
+	operation := pickOperation(command.action)
+	_, head, err := readHead()
+	if err != nil {
+		return false, err
+	}
+	headTree, err := commitTreeOID(head)
+	if err != nil {
+		return false, err
+	}
+	commit, err := peelToCommit(command.oid)
+	if err != nil {
+		return false, err
+	}
+
+	tree, conflicts, err := applyCommit(headTree, commit, revert, operation)
+	if err != nil {
+		return false, err
+	}
+	message := pickMessage(commit, revert)
+	if len(conflicts) == 0 && tree == headTree && revert {
+		// as in git, a revert making no change is left without REVERT_HEAD
+		if err := os.WriteFile(mergeMsgPath, []byte(message+"\n"), 0644); err != nil {
+			return false, err
+		}
+		return false, printEmptyPick(operation)
+	}
+	if len(conflicts) > 0 || tree == headTree {
+		pickHeadPath := cherryPickHeadPath
+		if revert {
+			pickHeadPath = revertHeadPath
+		}
+		if err := os.WriteFile(pickHeadPath, []byte(commit.Hash+"\n"), 0644); err != nil {
+			return false, err
+		}
+		if len(conflicts) == 0 {
+			if err := os.WriteFile(mergeMsgPath, []byte(message+"\n"), 0644); err != nil {
+				return false, err
+			}
+			return false, printEmptyPick(operation)
+		}
+		if err := os.WriteFile(mergeMsgPath, []byte(conflictsMessage(message, conflicts)), 0644); err != nil {
+			return false, err
+		}
+		verb := "apply"
+		if revert {
+			verb = "revert"
+		}
+		fmt.Fprintf(os.Stderr, "error: could not %s %s... %s\n", verb,
+			shortestUniqueAbbrev(commit.Hash, DefaultAbbrev), command.argument)
+		fmt.Fprintf(os.Stderr, "hint: After resolving the conflicts, mark them with\n"+
+			"hint: \"git add/rm <pathspec>\", then run\n"+
+			"hint: \"git %[1]s --continue\".\n"+
+			"hint: You can instead skip this commit with \"git %[1]s --skip\".\n"+
+			"hint: To abort and get back to the state before \"git %[1]s\",\n"+
+			"hint: run \"git %[1]s --abort\".\n", operation)
+		return false, nil
+	}
+
+	author := ""
+	if !revert {
+		author = commit.author()
+	}
+	oid, err := writeCommit(tree, []string{head}, message, author)
+	if err != nil {
+		return false, err
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	if err := setHeadOID(oid, head, operation+": "+subject); err != nil {
+		return false, err
+	}
+	return true, printCommitSummary(oid, true)
+}
+
+// printEmptyPick tells that the commit applied by an operation made no
+// change, except for a revert, and shows the status of the working tree
+func printEmptyPick(operation string) error {
+	if operation != "revert" {
+		fmt.Fprintf(os.Stderr, "The previous cherry-pick is now empty, possibly due to conflict resolution.\n"+
+			"If you wish to commit it anyway, use:\n\n"+
+			"    git commit --allow-empty\n\n"+
+			"Otherwise, please use 'git %s --skip'\n", operation)
+	}
+	renames, err := DefaultRenameOptions("status")
+	if err != nil {
+		return err
+	}
+	return Status(&StatusOptions{UntrackedFiles: "normal", Renames: renames})
+}
+
+// sequencerTodo returns the commands of the cherry-pick or the revert in
+// progress, the first one being the command it stopped at, and whether a
+// commit is left to conclude
+func sequencerTodo() ([]todoCommand, bool, error) {
+	pickHead, _, err := readPickHead()
+	if err != nil {
+		return nil, false, err
+	}
+	commands, err := readTodoFile(path.Join(sequencerDir, "todo"))
+	if err != nil {
+		return nil, false, err
+	}
+	if pickHead == "" && commands == nil {
+		return nil, false, fmt.Errorf("no cherry-pick or revert in progress")
+	}
+	return commands, pickHead != "", nil
+}
+
+// ContinuePicks concludes the commit a cherry-pick or a revert stopped at
+// with the resolved index, and goes on with the commits left
+func ContinuePicks() (bool, error) {
+	commands, stopped, err := sequencerTodo()
+	if err != nil {
+		return false, err
+	}
+	if stopped {
+		if err := commitPickHead(); err != nil {
+			return false, err
+		}
+	}
+	if len(commands) > 0 {
+		commands = commands[1:]
+	}
+	return runPicks(commands)
+}
+
+// commitPickHead commits the index resolving the commit a cherry-pick or a
+// revert stopped at, with the message left in MERGE_MSG
+func commitPickHead() error {
+	pickHead, revert, err := readPickHead()
+	if err != nil {
+		return err
+	}
+	operation := pickOperation("pick")
+	if revert {
+		operation = pickOperation("revert")
+	}
+	index, err := readIndex()
+	if err != nil {
+		return err
+	}
+	if len(index.unmerged()) > 0 {
+		return fmt.Errorf("committing is not possible because you have unmerged files")
+	}
+
+	_, head, err := readHead()
+	if err != nil {
+		return err
+	}
+	headTree, err := commitTreeOID(head)
+	if err != nil {
+		return err
+	}
+	tree, err := WriteTree()
+	if err != nil {
+		return err
+	}
+	if tree == headTree {
+		return fmt.Errorf("the previous %s is now empty, use --skip to skip it", operation)
+	}
+	commit, err := peelToCommit(pickHead)
+	if err != nil {
+		return err
+	}
+	message := pickMessage(commit, revert)
+	if data, err := os.ReadFile(mergeMsgPath); err == nil {
+		message = cleanupMessage(string(data))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if message == "" {
+		return fmt.Errorf("aborting commit due to empty commit message")
+	}
+
+	// a cherry-picked commit keeps its author
+	author, reflogMessage := "", "commit: "
+	if !revert {
+		author, reflogMessage = commit.author(), "commit (cherry-pick): "
+	}
+	oid, err := writeCommit(tree, []string{head}, message, author)
+	if err != nil {
+		return err
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	if err := setHeadOID(oid, head, reflogMessage+subject); err != nil {
+		return err
+	}
+	if err := removePickState(); err != nil {
+		return err
+	}
+	return printCommitSummary(oid, !revert)
+}
+
+// SkipPick skips the commit a cherry-pick or a revert stopped at, the
+// index and the working tree being reset to HEAD, and goes on with the
+// commits left
+func SkipPick() (bool, error) {
+	commands, stopped, err := sequencerTodo()
+	if err != nil {
+		return false, err
+	}
+	if stopped {
+		_, head, err := readHead()
+		if err != nil {
+			return false, err
+		}
+		if err := resetHead(head); err != nil {
+			return false, err
+		}
+		if err := removePickState(); err != nil {
+			return false, err
+		}
+	}
+	if len(commands) > 0 {
+		commands = commands[1:]
+	}
+	return runPicks(commands)
+}
+
+// AbortPicks abandons a cherry-pick or a revert: HEAD, the index and the
+// working tree are reset to the commit HEAD was at before the first commit
+// applied
+func AbortPicks() error {
+	if _, _, err := sequencerTodo(); err != nil {
+		return err
+	}
+	_, head, err := readHead()
+	if err != nil {
+		return err
+	}
+	target := head
+	if data, err := os.ReadFile(path.Join(sequencerDir, "head")); err == nil {
+		target = strings.TrimSpace(string(data))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := resetHead(target); err != nil {
+		return err
+	}
+	if err := removePickState(); err != nil {
+		return err
+	}
+	return os.RemoveAll(sequencerDir)
+}
+
+// resetHead resets HEAD, the index and the working tree to a commit, as
+// "git reset --merge" does, the commit HEAD was at being kept in ORIG_HEAD
+func resetHead(oid string) error {
+	_, head, err := readHead()
+	if err != nil {
+		return err
+	}
+	tree, err := commitTreeOID(oid)
+	if err != nil {
+		return err
+	}
+	if err := resetTree(tree); err != nil {
+		return err
+	}
+	if err := writeRef("ORIG_HEAD", head, ""); err != nil {
+		return err
+	}
+	return setHeadOID(oid, head, "reset: moving to "+oid)
+}
@@ -0,0 +1,136 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidRef = errors.New("not a valid ref")
+
+type ShowRefOptions struct {
+	// only show branches, tags, or both
+	Heads bool
+	Tags  bool
+	// show HEAD too
+	Head bool
+	// show the object annotated tags point to, as <ref>^{}
+	Dereference bool
+	// only show the object names
+	Hash bool
+	// abbreviate the object names to at least this length, 0 for full names
+	Abbrev int
+	// the patterns are full ref names that must all exist
+	Verify bool
+	// do not print anything
+	Quiet bool
+}
+
+// ShowRef prints the refs matching one of the patterns, all of them
+// without pattern, and returns whether any matched
+// A pattern matches the ref names ending with its components, master
+// matches refs/heads/master and refs/remotes/origin/master
+func ShowRef(patterns []string, options *ShowRefOptions) (bool, error) {
+	if options.Verify {
+		return true, verifyRefs(patterns, options)
+	}
+
+	refs, err := localRefs()
+	if err != nil {
+		return false, err
+	}
+	if options.Head {
+		oid, err := readRef("HEAD")
+		if err != nil {
+			return false, err
+		}
+		if oid != "" {
+			refs = append([]*refInfo{{name: "HEAD", oid: oid}}, refs...)
+		}
+	}
+
+	matched := false
+	for _, ref := range refs {
+		if ref.name != "HEAD" && (options.Heads || options.Tags) &&
+			!(options.Heads && strings.HasPrefix(ref.name, headsPrefix)) &&
+			!(options.Tags && strings.HasPrefix(ref.name, tagsPrefix)) {
+			continue
+		}
+		if len(patterns) > 0 && !refEndsWithPattern(ref.name, patterns) {
+			continue
+		}
+
+		matched = true
+		if err := showRef(ref, options); err != nil {
+			return false, err
+		}
+	}
+	return matched, nil
+}
+
+// verifyRefs prints the refs given with their full names, failing on the
+// first one that does not exist with ErrInvalidRef
+func verifyRefs(refNames []string, options *ShowRefOptions) error {
+	if len(refNames) == 0 {
+		return fmt.Errorf("--verify requires a reference")
+	}
+	for _, refName := range refNames {
+		oid := ""
+		if refName == "HEAD" || strings.HasPrefix(refName, "refs/") {
+			var err error
+			if oid, err = readRef(refName); err != nil {
+				return err
+			}
+		}
+		if oid == "" {
+			return fmt.Errorf("'%s' - %w", refName, ErrInvalidRef)
+		}
+		if err := showRef(&refInfo{name: refName, oid: oid}, options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refEndsWithPattern checks whether a ref name ends with the components
+// of one of the patterns
+func refEndsWithPattern(refName string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if refName == pattern || strings.HasSuffix(refName, "/"+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// showRef prints a ref, followed by the object it peels to for an
+// annotated tag when dereferencing
+func showRef(ref *refInfo, options *ShowRefOptions) error {
+	if options.Quiet {
+		return nil
+	}
+	printRef(ref.name, ref.oid, options)
+
+	if !options.Dereference {
+		return nil
+	}
+	peeled, err := ref.peeled()
+	if err != nil {
+		return err
+	}
+	if peeled != nil {
+		printRef(ref.name+"^{}", peeled.oid, options)
+	}
+	return nil
+}
+
+func printRef(refName string, oid string, options *ShowRefOptions) {
+	if options.Abbrev > 0 {
+		oid = shortestUniqueAbbrev(oid, options.Abbrev)
+	}
+	if options.Hash {
+		fmt.Println(oid)
+		return
+	}
+	fmt.Printf("%s %s\n", oid, refName)
+}
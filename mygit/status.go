@@ -0,0 +1,1058 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+type StatusOptions struct {
+	// 0 for the long format, 1 for the short and porcelain v1 format,
+	// 2 for the porcelain v2 format
+	Porcelain int
+	// show the branch and its upstream in the short and porcelain formats
+	Branch bool
+	// terminate entries with NUL and do not quote paths
+	NullTerminated bool
+	// "normal" to show untracked directories, "all" to show the files
+	// in them, "no" to show none
+	UntrackedFiles string
+	// show ignored files too
+	Ignored bool
+	// detection of the files renamed or copied in the index
+	Renames RenameOptions
+}
+
+// statusEntry is a path that differs between HEAD, the index and the
+// working tree
+type statusEntry struct {
+	path string
+	// status of the index against HEAD and of the working tree against
+	// the index: ' ' unmodified, 'M' modified, 'T' type changed, 'A' added,
+	// 'D' deleted, 'R' renamed, 'C' copied, 'U' unmerged
+	staged   byte
+	unstaged byte
+	// path in HEAD of a renamed or copied file, and the similarity score
+	origPath string
+	score    int
+
+	headMode     uint32
+	indexMode    uint32
+	worktreeMode uint32
+	headOID      string
+	indexOID     string
+	// entries of the merge stages 1 to 3 of an unmerged path
+	stages [3]*indexEntry
+}
+
+// unmerged checks whether the entry is a merge conflict
+func (entry *statusEntry) unmerged() bool {
+	return entry.stages[0] != nil || entry.stages[1] != nil || entry.stages[2] != nil
+}
+
+// repositoryStatus is the state of HEAD, the index and the working tree
+type repositoryStatus struct {
+	// current branch, empty when HEAD is detached
+	branch string
+	head   string
+	// upstream ref of the current branch, if any, and whether it exists
+	upstream       string
+	upstreamExists bool
+	ahead          int
+	behind         int
+	// a merge is left to conclude
+	merging bool
+	// a cherry-pick or a revert is in progress, stopped at pickHead, which
+	// is empty when the commit was concluded with commits left to apply
+	cherryPicking bool
+	reverting     bool
+	pickHead      string
+	// the rebase in progress, if any
+	rebase *rebaseState
+
+	entries   []*statusEntry
+	untracked []string
+	ignored   []string
+}
+
+// Status shows the changes between HEAD and the index, the changes
+// between the index and the working tree, and the untracked files
+func Status(options *StatusOptions) error {
+	status, err := readStatus(options)
+	if err != nil {
+		return err
+	}
+
+	switch options.Porcelain {
+	case 0:
+		return status.printLong(options)
+	case 1:
+		status.printShort(options)
+	case 2:
+		status.printPorcelainV2(options)
+	default:
+		return fmt.Errorf("unsupported porcelain version %d", options.Porcelain)
+	}
+	return nil
+}
+
+func readStatus(options *StatusOptions) (*repositoryStatus, error) {
+	status := &repositoryStatus{}
+	refName, head, err := readHead()
+	if err != nil {
+		return nil, err
+	}
+	status.branch = strings.TrimPrefix(refName, headsPrefix)
+	status.head = head
+	mergeHead, err := readMergeHead()
+	if err != nil {
+		return nil, err
+	}
+	status.merging = mergeHead != ""
+	if err := status.readSequence(); err != nil {
+		return nil, err
+	}
+
+	if status.branch != "" {
+		if err := status.readTracking(refName); err != nil {
+			return nil, err
+		}
+	}
+
+	// the stat data of the files found unchanged is refreshed in the index,
+	// unless another process is updating it
+	lock, lockErr := lockPath(indexFilePath)
+	if lockErr == nil {
+		defer lock.rollback()
+	}
+	index, err := readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshed, err := status.readChanges(index, &options.Renames)
+	if err != nil {
+		return nil, err
+	}
+	if refreshed && lockErr == nil {
+		if err := writeIndex(lock, index); err != nil {
+			return nil, err
+		}
+		if err := lock.commit(); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.UntrackedFiles != "no" {
+		if err := status.readUntracked(index, options); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// readSequence reads the cherry-pick, revert or rebase in progress
+func (status *repositoryStatus) readSequence() error {
+	pickHead, revert, err := readPickHead()
+	if err != nil {
+		return err
+	}
+	picking := pickHead != ""
+	if !picking {
+		// between two commits of a sequence, its next command telling
+		// whether it picks or reverts
+		todo, err := readTodoFile(path.Join(sequencerDir, "todo"))
+		if err != nil {
+			return err
+		}
+		picking = len(todo) > 0
+		revert = picking && todo[0].action == "revert"
+	}
+	if status.rebase, err = readRebaseState(); err != nil {
+		return err
+	}
+	// a commit a rebase stopped at is also in CHERRY_PICK_HEAD
+	status.pickHead = pickHead
+	status.cherryPicking = picking && !revert && status.rebase == nil && !status.merging
+	status.reverting = picking && revert
+	return nil
+}
+
+// readTracking compares the current branch with its upstream
+func (status *repositoryStatus) readTracking(refName string) error {
+	upstream, err := branchUpstream(refName)
+	if err != nil || upstream == "" {
+		return err
+	}
+	status.upstream = upstream
+	upstreamOID, err := readRef(upstream)
+	if err != nil || upstreamOID == "" || status.head == "" {
+		return err
+	}
+	status.upstreamExists = true
+	status.ahead, status.behind, err = aheadBehind(status.head, upstreamOID)
+	return err
+}
+
+// aheadBehind counts the commits of a that are not in b, and the commits
+// of b that are not in a
+func aheadBehind(a string, b string) (int, int, error) {
+	ancestorsA, err := commitAncestors(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	ancestorsB, err := commitAncestors(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	ahead, behind := 0, 0
+	for oid := range ancestorsA {
+		if _, ok := ancestorsB[oid]; !ok {
+			ahead++
+		}
+	}
+	for oid := range ancestorsB {
+		if _, ok := ancestorsA[oid]; !ok {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// readChanges compares HEAD with the index and the index with the working
+// tree, returning whether the stat data of an index entry was refreshed
+func (status *repositoryStatus) readChanges(index *stagingIndex, renames *RenameOptions) (bool, error) {
+	headTree, err := commitTreeOID(status.head)
+	if err != nil {
+		return false, err
+	}
+	headFiles, err := treeFiles(headTree)
+	if err != nil {
+		return false, err
+	}
+
+	entries := map[string]*statusEntry{}
+	refreshed := false
+	for _, indexEntry := range index.entries {
+		entry := entries[indexEntry.path]
+		if entry == nil {
+			entry = &statusEntry{path: indexEntry.path, staged: ' ', unstaged: ' '}
+			entries[indexEntry.path] = entry
+		}
+		if headEntry, ok := headFiles[indexEntry.path]; ok {
+			entry.headMode = treeIndexEntry(indexEntry.path, headEntry).mode
+			entry.headOID = headEntry.Hash
+		}
+
+		if stage := indexEntry.stage(); stage > 0 {
+			entry.stages[stage-1] = indexEntry
+			if info, err := os.Lstat(indexEntry.path); err == nil {
+				entry.worktreeMode = workingFileMode(info)
+			}
+			continue
+		}
+
+		entry.indexMode = indexEntry.mode
+		entry.indexOID = indexEntry.oid
+		switch {
+		case indexEntry.extendedFlags&indexFlagIntentToAdd != 0:
+			entry.unstaged = 'A'
+		case entry.headOID == "":
+			entry.staged = 'A'
+		case entry.headMode&0170000 != entry.indexMode&0170000:
+			entry.staged = 'T'
+		case entry.headMode != entry.indexMode || entry.headOID != entry.indexOID:
+			entry.staged = 'M'
+		}
+
+		unstaged, mode, refresh, err := worktreeStatus(index, indexEntry)
+		if err != nil {
+			return false, err
+		}
+		entry.worktreeMode = mode
+		if entry.unstaged == ' ' {
+			entry.unstaged = unstaged
+		}
+		refreshed = refreshed || refresh
+	}
+
+	for filePath, headEntry := range headFiles {
+		if _, ok := entries[filePath]; ok {
+			continue
+		}
+		entries[filePath] = &statusEntry{
+			path:     filePath,
+			staged:   'D',
+			unstaged: ' ',
+			headMode: treeIndexEntry(filePath, headEntry).mode,
+			headOID:  headEntry.Hash,
+		}
+	}
+	if err := detectStagedRenames(entries, renames); err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		if entry.unmerged() {
+			entry.staged, entry.unstaged = unmergedStatus(entry.stages)
+		}
+		if entry.staged != ' ' || entry.unstaged != ' ' {
+			status.entries = append(status.entries, entry)
+		}
+	}
+	sort.Slice(status.entries, func(i, j int) bool {
+		return status.entries[i].path < status.entries[j].path
+	})
+	return refreshed, nil
+}
+
+// detectStagedRenames pairs the files added to the index with the files
+// deleted from it, or modified when looking for copies, as diff does
+// The added file becomes renamed or copied, and a renamed file is no longer
+// shown as deleted
+func detectStagedRenames(entries map[string]*statusEntry, renames *RenameOptions) error {
+	paths := []string{}
+	for filePath, entry := range entries {
+		if !entry.unmerged() && strings.IndexByte("ADM", entry.staged) >= 0 {
+			paths = append(paths, filePath)
+		}
+	}
+	sort.Strings(paths)
+	pairs := []diffPair{}
+	for _, filePath := range paths {
+		entry := entries[filePath]
+		pairs = append(pairs, diffPair{
+			old: diffFile{path: filePath, mode: entry.headMode, oid: entry.headOID},
+			new: diffFile{path: filePath, mode: entry.indexMode, oid: entry.indexOID},
+		})
+	}
+	pairs, err := detectRenames(pairs, renames)
+	if err != nil {
+		return err
+	}
+
+	for _, pair := range pairs {
+		if !pair.renamed() {
+			continue
+		}
+		entry, source := entries[pair.new.path], entries[pair.old.path]
+		entry.staged = pair.status()
+		entry.origPath = pair.old.path
+		entry.score = pair.score
+		entry.headMode, entry.headOID = source.headMode, source.headOID
+		if !pair.copied {
+			delete(entries, pair.old.path)
+		}
+	}
+	return nil
+}
+
+// worktreeStatus compares a working tree file with its index entry,
+// hashing it only when its stat data changed, and returns its status,
+// its mode, and whether the stat data of the entry was refreshed
+func worktreeStatus(index *stagingIndex, entry *indexEntry) (byte, uint32, bool, error) {
+	info, err := os.Lstat(entry.path)
+	if os.IsNotExist(err) || (err == nil && info.IsDir() && entry.mode != 0160000) {
+		return 'D', 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+	mode := workingFileMode(info)
+
+	switch {
+	// submodules are not looked into
+	case entry.mode == 0160000:
+		return ' ', entry.mode, false, nil
+	case mode&0170000 != entry.mode&0170000:
+		return 'T', mode, false, nil
+	case index.upToDate(entry, info):
+		return ' ', mode, false, nil
+	}
+
+	oid, err := hashWorkingFile(entry.path, info, false)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if oid != entry.oid || mode != entry.mode {
+		return 'M', mode, false, nil
+	}
+	entry.setStat(info)
+	return ' ', mode, true, nil
+}
+
+// unmergedStatus returns the two letters describing a conflict from the
+// merge stages present: the base, ours and theirs
+func unmergedStatus(stages [3]*indexEntry) (byte, byte) {
+	base, ours, theirs := stages[0] != nil, stages[1] != nil, stages[2] != nil
+	switch {
+	case base && !ours && !theirs:
+		return 'D', 'D'
+	case !base && ours && !theirs:
+		return 'A', 'U'
+	case base && ours && !theirs:
+		return 'U', 'D'
+	case !base && !ours && theirs:
+		return 'U', 'A'
+	case base && !ours && theirs:
+		return 'D', 'U'
+	case !base && ours && theirs:
+		return 'A', 'A'
+	}
+	return 'U', 'U'
+}
+
+// readUntracked lists the files that are not in the index, ignored or not
+func (status *repositoryStatus) readUntracked(index *stagingIndex, options *StatusOptions) error {
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return err
+	}
+	scan := &untrackedScan{
+		tracked:     map[string]bool{},
+		trackedDirs: map[string]bool{},
+		rules:       rules,
+		all:         options.UntrackedFiles == "all",
+	}
+	for _, entry := range index.entries {
+		scan.tracked[entry.path] = true
+		for dir := path.Dir(entry.path); dir != "."; dir = path.Dir(dir) {
+			scan.trackedDirs[dir] = true
+		}
+	}
+
+	status.untracked, status.ignored, err = scan.visit("", false)
+	if err != nil {
+		return err
+	}
+	sort.Strings(status.untracked)
+	sort.Strings(status.ignored)
+	if !options.Ignored {
+		status.ignored = nil
+	}
+	return nil
+}
+
+// untrackedScan walks the working tree for untracked and ignored files
+type untrackedScan struct {
+	tracked     map[string]bool
+	trackedDirs map[string]bool
+	rules       *ignoreRules
+	// list the files of untracked directories rather than the directories
+	all bool
+}
+
+// visit lists the untracked and ignored files of a directory, a directory
+// without tracked files being listed as "<dir>/" when all of its files
+// are untracked, or all of them ignored
+func (scan *untrackedScan) visit(dir string, dirIgnored bool) ([]string, []string, error) {
+	dirEntries, err := os.ReadDir(path.Join(".", dir))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := scan.rules.loadDir(dir); err != nil {
+		return nil, nil, err
+	}
+
+	untracked := []string{}
+	ignored := []string{}
+	for _, dirEntry := range dirEntries {
+		if dirEntry.Name() == ".git" {
+			continue
+		}
+		entryPath := path.Join(dir, dirEntry.Name())
+
+		if !dirEntry.IsDir() {
+			switch {
+			case scan.tracked[entryPath]:
+			case dirIgnored || scan.rules.match(entryPath, false).excludes():
+				ignored = append(ignored, entryPath)
+			default:
+				untracked = append(untracked, entryPath)
+			}
+			continue
+		}
+
+		if scan.tracked[entryPath] {
+			continue
+		}
+		entryIgnored := dirIgnored || scan.rules.match(entryPath, true).excludes()
+		if scan.trackedDirs[entryPath] {
+			u, i, err := scan.visit(entryPath, entryIgnored)
+			if err != nil {
+				return nil, nil, err
+			}
+			untracked = append(untracked, u...)
+			ignored = append(ignored, i...)
+			continue
+		}
+		// nested repositories are not looked into
+		if _, err := os.Lstat(path.Join(entryPath, ".git")); err == nil {
+			if entryIgnored {
+				ignored = append(ignored, entryPath+"/")
+			} else {
+				untracked = append(untracked, entryPath+"/")
+			}
+			continue
+		}
+
+		u, i, err := scan.visit(entryPath, entryIgnored)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case scan.all:
+			untracked = append(untracked, u...)
+			ignored = append(ignored, i...)
+		case len(u) > 0:
+			untracked = append(untracked, entryPath+"/")
+			ignored = append(ignored, i...)
+		case len(i) > 0:
+			ignored = append(ignored, entryPath+"/")
+		}
+	}
+	return untracked, ignored, nil
+}
+
+// quotePath quotes a path the way git does when it holds special
+// characters: double quotes, backslashes, control characters and
+// non-ASCII bytes, and spaces too if quoteSpace is set
+func quotePath(filePath string, quoteSpace bool) string {
+	quoted := strings.Builder{}
+	needed := false
+	for i := 0; i < len(filePath); i++ {
+		c := filePath[i]
+		switch {
+		case c == '"' || c == '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteByte(c)
+		case c == '\a':
+			quoted.WriteString(`\a`)
+		case c == '\b':
+			quoted.WriteString(`\b`)
+		case c == '\t':
+			quoted.WriteString(`\t`)
+		case c == '\n':
+			quoted.WriteString(`\n`)
+		case c == '\v':
+			quoted.WriteString(`\v`)
+		case c == '\f':
+			quoted.WriteString(`\f`)
+		case c == '\r':
+			quoted.WriteString(`\r`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&quoted, "\\%03o", c)
+		case c == ' ' && quoteSpace:
+			quoted.WriteByte(c)
+		default:
+			quoted.WriteByte(c)
+			continue
+		}
+		needed = true
+	}
+	if !needed {
+		return filePath
+	}
+	return `"` + quoted.String() + `"`
+}
+
+// displayPath returns a path as printed by the short and porcelain
+// formats, the short one quoting paths with spaces too
+func displayPath(filePath string, options *StatusOptions) string {
+	if options.NullTerminated {
+		return filePath
+	}
+	return quotePath(filePath, options.Porcelain == 1)
+}
+
+// printShort prints the short and porcelain v1 formats:
+//
+//	## <branch>...<upstream> [ahead <n>, behind <m>]
+//	XY <path>
+//	XY <orig path> -> <path>
+//	?? <untracked>
+//	!! <ignored>
+func (status *repositoryStatus) printShort(options *StatusOptions) {
+	end := "\n"
+	if options.NullTerminated {
+		end = "\x00"
+	}
+
+	if options.Branch {
+		header := "## "
+		switch {
+		case status.head == "":
+			header += "No commits yet on " + status.branch
+		case status.branch == "":
+			header += "HEAD (no branch)"
+		default:
+			header += status.branch
+		}
+		if status.upstream != "" {
+			upstream, _ := shortRefName(status.upstream)
+			header += "..." + upstream
+			switch {
+			case !status.upstreamExists:
+				header += " [gone]"
+			case status.ahead > 0 && status.behind > 0:
+				header += fmt.Sprintf(" [ahead %d, behind %d]", status.ahead, status.behind)
+			case status.ahead > 0:
+				header += fmt.Sprintf(" [ahead %d]", status.ahead)
+			case status.behind > 0:
+				header += fmt.Sprintf(" [behind %d]", status.behind)
+			}
+		}
+		fmt.Print(header + end)
+	}
+
+	for _, entry := range status.entries {
+		switch {
+		case entry.origPath == "":
+			fmt.Printf("%c%c %s%s", entry.staged, entry.unstaged, displayPath(entry.path, options), end)
+		case options.NullTerminated:
+			fmt.Printf("%c%c %s%s%s%s", entry.staged, entry.unstaged, entry.path, end, entry.origPath, end)
+		default:
+			fmt.Printf("%c%c %s -> %s%s", entry.staged, entry.unstaged,
+				displayPath(entry.origPath, options), displayPath(entry.path, options), end)
+		}
+	}
+	for _, filePath := range status.untracked {
+		fmt.Printf("?? %s%s", displayPath(filePath, options), end)
+	}
+	for _, filePath := range status.ignored {
+		fmt.Printf("!! %s%s", displayPath(filePath, options), end)
+	}
+}
+
+// printPorcelainV2 prints the porcelain v2 format:
+//
+//	# branch.oid <commit> | (initial)
+//	# branch.head <branch> | (detached)
+//	# branch.upstream <upstream>
+//	# branch.ab +<ahead> -<behind>
+//	1 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <path>
+//	2 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <X><score> <path>\t<orig path>
+//	u <XY> <sub> <m1> <m2> <m3> <mW> <h1> <h2> <h3> <path>
+//	? <untracked>
+//	! <ignored>
+func (status *repositoryStatus) printPorcelainV2(options *StatusOptions) {
+	end := "\n"
+	if options.NullTerminated {
+		end = "\x00"
+	}
+
+	if options.Branch {
+		head := status.head
+		if head == "" {
+			head = "(initial)"
+		}
+		fmt.Printf("# branch.oid %s%s", head, end)
+		branch := status.branch
+		if branch == "" {
+			branch = "(detached)"
+		}
+		fmt.Printf("# branch.head %s%s", branch, end)
+		if status.upstream != "" {
+			upstream, _ := shortRefName(status.upstream)
+			fmt.Printf("# branch.upstream %s%s", upstream, end)
+			if status.upstreamExists {
+				fmt.Printf("# branch.ab +%d -%d%s", status.ahead, status.behind, end)
+			}
+		}
+	}
+
+	dot := func(c byte) byte {
+		if c == ' ' {
+			return '.'
+		}
+		return c
+	}
+	oid := func(oid string) string {
+		if oid == "" {
+			return zeroOID
+		}
+		return oid
+	}
+	for _, entry := range status.entries {
+		xy := string([]byte{dot(entry.staged), dot(entry.unstaged)})
+		if entry.unmerged() {
+			modes := []string{}
+			oids := []string{}
+			for _, stage := range entry.stages {
+				if stage == nil {
+					modes = append(modes, "000000")
+					oids = append(oids, zeroOID)
+					continue
+				}
+				modes = append(modes, fmt.Sprintf("%06o", stage.mode))
+				oids = append(oids, stage.oid)
+			}
+			fmt.Printf("u %s N... %s %06o %s %s%s", xy, strings.Join(modes, " "), entry.worktreeMode,
+				strings.Join(oids, " "), displayPath(entry.path, options), end)
+			continue
+		}
+		if entry.origPath != "" {
+			separator := "\t"
+			if options.NullTerminated {
+				separator = "\x00"
+			}
+			fmt.Printf("2 %s N... %06o %06o %06o %s %s %c%d %s%s%s%s", xy, entry.headMode, entry.indexMode,
+				entry.worktreeMode, oid(entry.headOID), oid(entry.indexOID), entry.staged,
+				similarityPercent(entry.score), displayPath(entry.path, options), separator,
+				displayPath(entry.origPath, options), end)
+			continue
+		}
+		fmt.Printf("1 %s N... %06o %06o %06o %s %s %s%s", xy, entry.headMode, entry.indexMode,
+			entry.worktreeMode, oid(entry.headOID), oid(entry.indexOID), displayPath(entry.path, options), end)
+	}
+	for _, filePath := range status.untracked {
+		fmt.Printf("? %s%s", displayPath(filePath, options), end)
+	}
+	for _, filePath := range status.ignored {
+		fmt.Printf("! %s%s", displayPath(filePath, options), end)
+	}
+}
+
+// labels of the changes in the long format
+var statusLabels = map[byte]string{
+	'A': "new file:",
+	'M': "modified:",
+	'D': "deleted:",
+	'T': "typechange:",
+	'R': "renamed:",
+	'C': "copied:",
+}
+
+// labels of the conflicts in the long format
+var unmergedLabels = map[string]string{
+	"DD": "both deleted:",
+	"AU": "added by us:",
+	"UD": "deleted by them:",
+	"UA": "added by them:",
+	"DU": "deleted by us:",
+	"AA": "both added:",
+	"UU": "both modified:",
+}
+
+// printLong prints the long format, each section with hints on the
+// commands that change it
+func (status *repositoryStatus) printLong(options *StatusOptions) error {
+	if status.branch != "" {
+		fmt.Printf("On branch %s\n", status.branch)
+	} else if status.rebase != nil {
+		fmt.Printf("interactive rebase in progress; onto %s\n",
+			shortestUniqueAbbrev(status.rebase.onto, DefaultAbbrev))
+	} else {
+		description, err := detachedDescription(status.head)
+		if err != nil {
+			return err
+		}
+		fmt.Println(description)
+	}
+	if status.head != "" {
+		status.printTracking()
+	} else {
+		fmt.Print("\nNo commits yet\n\n")
+	}
+
+	staged := []*statusEntry{}
+	unmerged := []*statusEntry{}
+	unstaged := []*statusEntry{}
+	hasDeleted := false
+	for _, entry := range status.entries {
+		switch {
+		case entry.unmerged():
+			unmerged = append(unmerged, entry)
+			continue
+		case entry.staged != ' ':
+			staged = append(staged, entry)
+		}
+		if entry.unstaged != ' ' {
+			unstaged = append(unstaged, entry)
+			hasDeleted = hasDeleted || entry.unstaged == 'D'
+		}
+	}
+
+	unstageHint := `  (use "git restore --staged <file>..." to unstage)`
+	switch {
+	case status.merging && len(unmerged) > 0:
+		fmt.Println("You have unmerged paths.")
+		fmt.Println(`  (fix conflicts and run "git commit")`)
+		fmt.Println(`  (use "git merge --abort" to abort the merge)`)
+		fmt.Println()
+	case status.merging:
+		fmt.Println("All conflicts fixed but you are still merging.")
+		fmt.Println(`  (use "git commit" to conclude merge)`)
+		fmt.Println()
+	case status.head == "":
+		unstageHint = `  (use "git rm --cached <file>..." to unstage)`
+	}
+	if status.rebase != nil {
+		status.printRebase(len(unmerged) > 0)
+	}
+	if status.cherryPicking || status.reverting {
+		status.printSequence(len(unmerged) > 0)
+	}
+	printHint := func(hint string) {
+		// files are not unstaged from a merge or a cherry-pick
+		if !status.merging && (status.pickHead == "" || status.reverting) {
+			fmt.Println(hint)
+		}
+	}
+	if len(staged) > 0 {
+		fmt.Println("Changes to be committed:")
+		printHint(unstageHint)
+		for _, entry := range staged {
+			name := quotePath(entry.path, false)
+			if entry.origPath != "" {
+				name = quotePath(entry.origPath, false) + " -> " + name
+			}
+			fmt.Printf("\t%-12s%s\n", statusLabels[entry.staged], name)
+		}
+		fmt.Println()
+	}
+
+	if len(unmerged) > 0 {
+		fmt.Println("Unmerged paths:")
+		printHint(unstageHint)
+		bothDeleted, deleteConflict, notDeleted := false, false, false
+		for _, entry := range unmerged {
+			switch {
+			case entry.stages[1] == nil && entry.stages[2] == nil:
+				bothDeleted = true
+			case entry.stages[0] != nil && (entry.stages[1] == nil || entry.stages[2] == nil):
+				deleteConflict = true
+			default:
+				notDeleted = true
+			}
+		}
+		switch {
+		case !bothDeleted && !deleteConflict:
+			fmt.Println(`  (use "git add <file>..." to mark resolution)`)
+		case bothDeleted && !deleteConflict && !notDeleted:
+			fmt.Println(`  (use "git rm <file>..." to mark resolution)`)
+		default:
+			fmt.Println(`  (use "git add/rm <file>..." as appropriate to mark resolution)`)
+		}
+		for _, entry := range unmerged {
+			label := unmergedLabels[string([]byte{entry.staged, entry.unstaged})]
+			fmt.Printf("\t%-17s%s\n", label, quotePath(entry.path, false))
+		}
+		fmt.Println()
+	}
+
+	if len(unstaged) > 0 {
+		fmt.Println("Changes not staged for commit:")
+		if hasDeleted {
+			fmt.Println(`  (use "git add/rm <file>..." to update what will be committed)`)
+		} else {
+			fmt.Println(`  (use "git add <file>..." to update what will be committed)`)
+		}
+		fmt.Println(`  (use "git restore <file>..." to discard changes in working directory)`)
+		for _, entry := range unstaged {
+			fmt.Printf("\t%-12s%s\n", statusLabels[entry.unstaged], quotePath(entry.path, false))
+		}
+		fmt.Println()
+	}
+
+	if len(status.untracked) > 0 {
+		fmt.Println("Untracked files:")
+		fmt.Println(`  (use "git add <file>..." to include in what will be committed)`)
+		for _, filePath := range status.untracked {
+			fmt.Printf("\t%s\n", quotePath(filePath, false))
+		}
+		fmt.Println()
+	}
+	if len(status.ignored) > 0 {
+		fmt.Println("Ignored files:")
+		fmt.Println(`  (use "git add -f <file>..." to include in what will be committed)`)
+		for _, filePath := range status.ignored {
+			fmt.Printf("\t%s\n", quotePath(filePath, false))
+		}
+		fmt.Println()
+	}
+	if options.UntrackedFiles == "no" && len(staged) > 0 {
+		fmt.Println("Untracked files not listed (use -u option to show untracked files)")
+	}
+
+	switch {
+	case len(staged) > 0:
+	case len(unstaged) > 0 || len(unmerged) > 0:
+		fmt.Println(`no changes added to commit (use "git add" and/or "git commit -a")`)
+	case len(status.untracked) > 0:
+		fmt.Println(`nothing added to commit but untracked files present (use "git add" to track)`)
+	case status.head == "":
+		fmt.Println(`nothing to commit (create/copy files and use "git add" to track)`)
+	case options.UntrackedFiles == "no":
+		fmt.Println("nothing to commit (use -u to show untracked files)")
+	default:
+		fmt.Println("nothing to commit, working tree clean")
+	}
+	return nil
+}
+
+// printRebase prints the commands of the rebase in progress, the last ones
+// run and the next ones, and what is left to do at the commit it stopped at
+func (status *repositoryStatus) printRebase(unmerged bool) {
+	const shown = 2
+	rebase := status.rebase
+	if len(rebase.done) == 0 {
+		fmt.Println("No commands done.")
+	} else {
+		plural := "s"
+		if len(rebase.done) == 1 {
+			plural = ""
+		}
+		fmt.Printf("Last command%s done (%d command%s done):\n", plural, len(rebase.done), plural)
+		for _, command := range rebase.done[max(len(rebase.done)-shown, 0):] {
+			fmt.Print("   " + formatTodo([]todoCommand{command}, true))
+		}
+		if len(rebase.done) > shown {
+			fmt.Printf("  (see more in file %s)\n", path.Join(rebaseDir, "done"))
+		}
+	}
+	if len(rebase.todo) == 0 {
+		fmt.Println("No commands remaining.")
+	} else {
+		plural := "s"
+		if len(rebase.todo) == 1 {
+			plural = ""
+		}
+		fmt.Printf("Next command%s to do (%d remaining command%s):\n", plural, len(rebase.todo), plural)
+		for _, command := range rebase.todo[:min(len(rebase.todo), shown)] {
+			fmt.Print("   " + formatTodo([]todoCommand{command}, true))
+		}
+		fmt.Println(`  (use "git rebase --edit-todo" to view and edit)`)
+	}
+
+	onto := ""
+	if branch, ok := strings.CutPrefix(rebase.headName, headsPrefix); ok {
+		onto = fmt.Sprintf(" branch '%s' on '%s'", branch, shortestUniqueAbbrev(rebase.onto, DefaultAbbrev))
+	}
+	_, err := os.Stat(mergeMsgPath)
+	switch {
+	case unmerged:
+		fmt.Printf("You are currently rebasing%s.\n", onto)
+		fmt.Println(`  (fix conflicts and then run "git rebase --continue")`)
+		fmt.Println(`  (use "git rebase --skip" to skip this patch)`)
+		fmt.Println(`  (use "git rebase --abort" to check out the original branch)`)
+	case err == nil:
+		fmt.Printf("You are currently rebasing%s.\n", onto)
+		fmt.Println(`  (all conflicts fixed: run "git rebase --continue")`)
+	default:
+		fmt.Printf("You are currently editing a commit while rebasing%s.\n", onto)
+		fmt.Println(`  (use "git commit --amend" to amend the current commit)`)
+		fmt.Println(`  (use "git rebase --continue" once you are satisfied with your changes)`)
+	}
+	fmt.Println()
+}
+
+// printSequence prints the commit the cherry-pick or the revert in
+// progress stopped at, and how to go on
+func (status *repositoryStatus) printSequence(unmerged bool) {
+	command := "cherry-pick"
+	if status.reverting {
+		command = "revert"
+	}
+	switch {
+	case status.pickHead == "" && status.reverting:
+		fmt.Println("Revert currently in progress.")
+	case status.pickHead == "":
+		fmt.Println("Cherry-pick currently in progress.")
+	case status.reverting:
+		fmt.Printf("You are currently reverting commit %s.\n", shortestUniqueAbbrev(status.pickHead, DefaultAbbrev))
+	default:
+		fmt.Printf("You are currently cherry-picking commit %s.\n",
+			shortestUniqueAbbrev(status.pickHead, DefaultAbbrev))
+	}
+	switch {
+	case unmerged:
+		fmt.Printf("  (fix conflicts and run \"git %s --continue\")\n", command)
+	case status.pickHead == "":
+		fmt.Printf("  (run \"git %s --continue\" to continue)\n", command)
+	default:
+		fmt.Printf("  (all conflicts fixed: run \"git %s --continue\")\n", command)
+	}
+	fmt.Printf("  (use \"git %s --skip\" to skip this patch)\n", command)
+	fmt.Printf("  (use \"git %s --abort\" to cancel the %s operation)\n", command, command)
+	fmt.Println()
+}
+
+// printTracking prints how the current branch compares to its upstream
+func (status *repositoryStatus) printTracking() {
+	if status.upstream == "" {
+		return
+	}
+	upstream, _ := shortRefName(status.upstream)
+	plural := func(n int) string {
+		if n == 1 {
+			return "commit"
+		}
+		return "commits"
+	}
+
+	switch {
+	case !status.upstreamExists:
+		fmt.Printf("Your branch is based on '%s', but the upstream is gone.\n", upstream)
+		fmt.Println(`  (use "git branch --unset-upstream" to fixup)`)
+	case status.ahead == 0 && status.behind == 0:
+		fmt.Printf("Your branch is up to date with '%s'.\n", upstream)
+	case status.behind == 0:
+		fmt.Printf("Your branch is ahead of '%s' by %d %s.\n", upstream, status.ahead, plural(status.ahead))
+		fmt.Println(`  (use "git push" to publish your local commits)`)
+	case status.ahead == 0:
+		fmt.Printf("Your branch is behind '%s' by %d %s, and can be fast-forwarded.\n",
+			upstream, status.behind, plural(status.behind))
+		fmt.Println(`  (use "git pull" to update your local branch)`)
+	default:
+		fmt.Printf("Your branch and '%s' have diverged,\n"+
+			"and have %d and %d different commits each, respectively.\n",
+			upstream, status.ahead, status.behind)
+		fmt.Println(`  (use "git pull" to merge the remote branch into yours)`)
+	}
+	fmt.Println()
+}
+
+// detachedDescription describes a detached HEAD from the last checkout
+// in the HEAD reflog: "HEAD detached at <name>" when HEAD is still at the
+// commit checked out, "HEAD detached from <name>" otherwise
+func detachedDescription(head string) (string, error) {
+	entries, err := readReflog("HEAD")
+	if err != nil {
+		return "", err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		_, target, found := strings.Cut(entries[i].message, "checkout: moving from ")
+		if !found {
+			continue
+		}
+		if _, target, found = strings.Cut(target, " to "); !found {
+			continue
+		}
+
+		// a ref checked out is named, other revisions are abbreviated
+		checkedOut := entries[i].newOID
+		name := shortestUniqueAbbrev(checkedOut, DefaultAbbrev)
+		refName, oid, err := dwimRef(target)
+		if err != nil {
+			return "", err
+		}
+		if refName != "" {
+			commit, err := peelToCommit(oid)
+			if err == nil && commit.Hash == checkedOut {
+				name = strings.TrimPrefix(refName, "refs/")
+				for _, prefix := range []string{"tags/", "remotes/"} {
+					name = strings.TrimPrefix(name, prefix)
+				}
+			}
+		}
+
+		if checkedOut == head {
+			return "HEAD detached at " + name, nil
+		}
+		return "HEAD detached from " + name, nil
+	}
+	return "Not currently on any branch.", nil
+}
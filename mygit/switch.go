@@ -0,0 +1,395 @@
+package mygit
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type SwitchOptions struct {
+	// name of a branch to create at the target and switch to
+	Create string
+	// detach HEAD at the target commit instead of switching to a branch
+	Detach bool
+}
+
+// Switch switches to a branch, "-" being the previously checked out one,
+// or detaches HEAD at a commit, and updates the working tree
+func Switch(target string, options *SwitchOptions) error {
+	if options.Create != "" {
+		err := CreateBranch(options.Create, target, &BranchOptions{})
+		if err != nil {
+			return err
+		}
+		return switchTo(headsPrefix+options.Create, "", options.Create, true)
+	}
+
+	if target == "-" {
+		previous, err := previousBranch(1)
+		if err != nil {
+			return err
+		}
+		if previous == "" {
+			return fmt.Errorf("no previous branch")
+		}
+		target = previous
+	}
+
+	if !options.Detach {
+		oid, err := branchOID(target)
+		if err != nil {
+			return err
+		}
+		if oid == "" {
+			return fmt.Errorf("invalid reference: %s", target)
+		}
+		return switchTo(headsPrefix+target, oid, target, false)
+	}
+
+	oid, err := resolveRevision(target)
+	if err != nil {
+		return err
+	}
+	commit, err := peelToCommit(oid)
+	if err != nil {
+		return err
+	}
+	return switchTo("", commit.Hash, target, false)
+}
+
+// Checkout switches to a branch if one has the given name,
+// otherwise detaches HEAD at the given commit
+func Checkout(target string) error {
+	if target != "-" {
+		oid, err := branchOID(target)
+		if err != nil {
+			return err
+		}
+		if oid == "" {
+			return Switch(target, &SwitchOptions{Detach: true})
+		}
+	}
+	return Switch(target, &SwitchOptions{})
+}
+
+// switchTo checks out a commit and points HEAD to the branch refName,
+// or to the commit itself when refName is empty, name being the branch
+// or revision switched to as given by the user
+func switchTo(refName string, oid string, name string, created bool) error {
+	oldRef, oldOID, err := readHead()
+	if err != nil {
+		return err
+	}
+	if refName != "" && oid == "" {
+		oid, err = readRef(refName)
+		if err != nil {
+			return err
+		}
+	}
+	branch := strings.TrimPrefix(refName, headsPrefix)
+
+	// the HEAD reflog records checkouts, @{-<n>} looks them up
+	from := strings.TrimPrefix(oldRef, headsPrefix)
+	if oldRef == "" {
+		from = oldOID
+	}
+	message := fmt.Sprintf("checkout: moving from %s to %s", from, name)
+
+	if refName != "" && refName == oldRef {
+		if err := appendReflog("HEAD", oldOID, oid, message); err != nil {
+			return err
+		}
+		fmt.Printf("Already on '%s'\n", branch)
+		return nil
+	}
+
+	oldTree, err := commitTreeOID(oldOID)
+	if err != nil {
+		return err
+	}
+	newTree, err := commitTreeOID(oid)
+	if err != nil {
+		return err
+	}
+	if err := checkoutTree(oldTree, newTree, "checkout"); err != nil {
+		return err
+	}
+
+	if oldRef == "" && oldOID != oid {
+		description, err := describeCommit(oldOID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Previous HEAD position was %s\n", description)
+	}
+
+	if refName == "" {
+		if err := writeRef("HEAD", oid, message); err != nil {
+			return err
+		}
+		description, err := describeCommit(oid)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("HEAD is now at %s\n", description)
+		return nil
+	}
+
+	if err := writeSymref("HEAD", refName, message); err != nil {
+		return err
+	}
+	if created {
+		fmt.Printf("Switched to a new branch '%s'\n", branch)
+	} else {
+		fmt.Printf("Switched to branch '%s'\n", branch)
+	}
+	return nil
+}
+
+// commitTreeOID returns the tree of a commit, empty for an empty object ID
+func commitTreeOID(oid string) (string, error) {
+	if oid == "" {
+		return "", nil
+	}
+	commit, err := peelToCommit(oid)
+	if err != nil {
+		return "", err
+	}
+	return commit.Tree, nil
+}
+
+// describeCommit returns "<short_oid> <subject>" for a commit
+func describeCommit(oid string) (string, error) {
+	commit, err := peelToCommit(oid)
+	if err != nil {
+		return "", err
+	}
+	subject, _, _ := strings.Cut(commit.Message, "\n")
+	return fmt.Sprintf("%s %s", shortestUniqueAbbrev(commit.Hash, DefaultAbbrev), subject), nil
+}
+
+// checkoutTree updates the working tree and the index from the files of
+// oldTree to the files of newTree, refusing to overwrite local changes,
+// staged or not; operation names the command in these refusals
+func checkoutTree(oldTree string, newTree string, operation string) error {
+	oldFiles, err := treeFiles(oldTree)
+	if err != nil {
+		return err
+	}
+	newFiles, err := treeFiles(newTree)
+	if err != nil {
+		return err
+	}
+
+	lock, index, err := lockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+	// a repository without index has the files of the old tree staged
+	if _, err := os.Stat(indexFilePath); os.IsNotExist(err) {
+		for filePath, entry := range oldFiles {
+			index.add(treeIndexEntry(filePath, entry))
+		}
+	}
+	// whether the index has other content than a tree entry
+	staged := func(filePath string, entry TreeEntry) bool {
+		indexEntry := index.entry(filePath)
+		return indexEntry == nil || indexEntry.oid != entry.Hash || indexEntry.treeMode() != entry.Mode
+	}
+
+	removed := []string{}
+	updated := []string{}
+	localChanges := []string{}
+	untracked := []string{}
+
+	for filePath, newEntry := range newFiles {
+		oldEntry, tracked := oldFiles[filePath]
+		if tracked && oldEntry.Mode == newEntry.Mode && oldEntry.Hash == newEntry.Hash {
+			continue
+		}
+		updated = append(updated, filePath)
+
+		if tracked {
+			if modified, err := workingFileModified(filePath, oldEntry); err != nil {
+				return err
+			} else if modified || staged(filePath, oldEntry) {
+				localChanges = append(localChanges, filePath)
+			}
+			continue
+		}
+		// a new file staged with the content checked out is kept
+		if index.entry(filePath) != nil {
+			if modified, err := workingFileModified(filePath, newEntry); err != nil {
+				return err
+			} else if modified || staged(filePath, newEntry) {
+				localChanges = append(localChanges, filePath)
+			}
+			continue
+		}
+		// an untracked file identical to the checked out one is kept,
+		// a directory is in the way only if it holds untracked files
+		if info, err := os.Lstat(filePath); err == nil {
+			if info.IsDir() && newEntry.Mode != "160000" {
+				if hasUntrackedFiles(filePath, oldFiles) {
+					untracked = append(untracked, filePath)
+				}
+			} else if modified, err := workingFileModified(filePath, newEntry); err != nil {
+				return err
+			} else if modified {
+				untracked = append(untracked, filePath)
+			}
+		}
+	}
+
+	for filePath, oldEntry := range oldFiles {
+		if _, ok := newFiles[filePath]; ok {
+			continue
+		}
+		removed = append(removed, filePath)
+		if modified, err := workingFileModified(filePath, oldEntry); err != nil {
+			return err
+		} else if modified || staged(filePath, oldEntry) {
+			localChanges = append(localChanges, filePath)
+		}
+	}
+
+	action := operation
+	if operation == "checkout" {
+		action = "switch branches"
+	}
+	if len(localChanges) > 0 {
+		sort.Strings(localChanges)
+		return fmt.Errorf("your local changes to the following files would be overwritten by %s:\n\t%s\n"+
+			"Please commit your changes before you %s",
+			operation, strings.Join(localChanges, "\n\t"), action)
+	}
+	if len(untracked) > 0 {
+		sort.Strings(untracked)
+		return fmt.Errorf("the following untracked working tree files would be overwritten by %s:\n\t%s\n"+
+			"Please move or remove them before you %s",
+			operation, strings.Join(untracked, "\n\t"), action)
+	}
+
+	// removals first, a removed file may be replaced by a directory
+	sort.Strings(removed)
+	for _, filePath := range removed {
+		if err := os.RemoveAll(filePath); err != nil {
+			return err
+		}
+		removeEmptyDirs(filepath.Dir(filePath), 0)
+		index.remove(filePath)
+	}
+
+	sort.Strings(updated)
+	for _, filePath := range updated {
+		if err := writeWorkingFile(filePath, newFiles[filePath]); err != nil {
+			return err
+		}
+		entry := treeIndexEntry(filePath, newFiles[filePath])
+		info, err := os.Lstat(filePath)
+		if err != nil {
+			return err
+		}
+		entry.setStat(info)
+		index.add(entry)
+	}
+
+	if err := writeIndex(lock, index); err != nil {
+		return err
+	}
+	return lock.commit()
+}
+
+// treeIndexEntry returns the index entry of a tree file, without stat data
+func treeIndexEntry(filePath string, entry TreeEntry) *indexEntry {
+	mode, _ := strconv.ParseUint(entry.Mode, 8, 32)
+	return &indexEntry{path: filePath, oid: entry.Hash, mode: uint32(mode)}
+}
+
+// hasUntrackedFiles checks whether a working tree directory holds files
+// that are not in the given tracked files
+func hasUntrackedFiles(dir string, tracked map[string]TreeEntry) bool {
+	untracked := false
+	filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if _, ok := tracked[filepath.ToSlash(filePath)]; !ok {
+			untracked = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return untracked
+}
+
+// workingFileModified checks whether the working tree file differs from
+// a tree entry, a missing file is not a modification
+func workingFileModified(filePath string, entry TreeEntry) (bool, error) {
+	info, err := os.Lstat(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var content []byte
+	switch {
+	case entry.Mode == "160000":
+		return !info.IsDir(), nil
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return false, err
+		}
+		content = []byte(target)
+	case info.Mode().IsRegular():
+		content, err = os.ReadFile(filePath)
+		if err != nil {
+			return false, err
+		}
+	default:
+		return true, nil
+	}
+
+	hash := fmt.Sprintf("%x", hashObjectContent(string(ObjectTypeBlob), content))
+	return hash != entry.Hash, nil
+}
+
+// writeWorkingFile writes a tree entry to the working tree: a file,
+// an executable file, a symbolic link or an empty submodule directory
+func writeWorkingFile(filePath string, entry TreeEntry) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filePath); err != nil {
+		return err
+	}
+
+	if entry.Mode == "160000" {
+		return os.MkdirAll(filePath, 0755)
+	}
+
+	object, err := NewObject(entry.Hash)
+	if err != nil {
+		return err
+	}
+	if object.Type != ObjectTypeBlob {
+		return fmt.Errorf("object %s is not a blob", entry.Hash)
+	}
+
+	switch entry.Mode {
+	case "120000":
+		return os.Symlink(string(object.Content), filePath)
+	case "100755":
+		return os.WriteFile(filePath, object.Content, 0755)
+	default:
+		return os.WriteFile(filePath, object.Content, 0644)
+	}
+}
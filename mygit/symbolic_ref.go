@@ -0,0 +1,119 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+var ErrNotSymbolicRef = errors.New("not a symbolic ref")
+
+type SymbolicRefOptions struct {
+	// shorten the ref name, refs/heads/master to master
+	Short bool
+	// reason of the update, recorded in the reflog
+	Message string
+}
+
+// ShowSymbolicRef prints the ref a symbolic ref points to, following
+// symbolic refs to the last one
+// Returns ErrNotSymbolicRef when the ref is missing or not symbolic
+func ShowSymbolicRef(refName string, options *SymbolicRefOptions) error {
+	if _, symbolic, err := readLooseRef(refName); err != nil {
+		return err
+	} else if !symbolic {
+		return fmt.Errorf("ref %s is %w", refName, ErrNotSymbolicRef)
+	}
+
+	target, err := resolveSymref(refName)
+	if err != nil {
+		return err
+	}
+	if options.Short {
+		target, err = shortRefName(target)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println(target)
+	return nil
+}
+
+// SetSymbolicRef points a symbolic ref to a ref
+func SetSymbolicRef(refName string, target string, options *SymbolicRefOptions) error {
+	if !validRefName(refName) || !(strings.HasPrefix(refName, "refs/") || isPseudoRef(refName)) {
+		return fmt.Errorf("refusing to update ref with bad name '%s'", refName)
+	}
+	if !validRefName(target) {
+		return fmt.Errorf("refusing to point %s to invalid ref '%s'", refName, target)
+	}
+	if refName == "HEAD" && !strings.HasPrefix(target, "refs/") {
+		return fmt.Errorf("refusing to point HEAD outside of refs/")
+	}
+
+	// the new target must not close a cycle
+	for name, depth := target, 0; depth <= maxSymrefDepth; depth++ {
+		if name == refName {
+			return fmt.Errorf("refusing to point %s to %s: symbolic ref cycle", refName, target)
+		}
+		next, symbolic, err := readLooseRef(name)
+		if err != nil {
+			return err
+		}
+		if !symbolic {
+			break
+		}
+		name = next
+	}
+
+	return writeSymref(refName, target, options.Message)
+}
+
+// DeleteSymbolicRef deletes a symbolic ref, other than HEAD
+// Returns ErrNotSymbolicRef when the ref is missing or not symbolic
+func DeleteSymbolicRef(refName string) error {
+	if refName == "HEAD" {
+		return fmt.Errorf("deleting '%s' is not allowed", refName)
+	}
+	if _, symbolic, err := readLooseRef(refName); err != nil {
+		return err
+	} else if !symbolic {
+		return fmt.Errorf("cannot delete %s, %w", refName, ErrNotSymbolicRef)
+	}
+
+	lock, err := lockPath(path.Join(".git", refName))
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+
+	if err := os.Remove(path.Join(".git", refName)); err != nil {
+		return err
+	}
+	lock.rollback()
+	removeEmptyRefDirs(refName)
+	return deleteReflog(refName)
+}
+
+// shortRefName returns the shortest name that expands to refName with
+// the rules of refDWIMRules, refName itself if none does
+func shortRefName(refName string) (string, error) {
+	for _, prefix := range []string{headsPrefix, tagsPrefix, "refs/remotes/", "refs/"} {
+		short, found := strings.CutPrefix(refName, prefix)
+		if !found {
+			continue
+		}
+		// an other ref may take precedence, refs/tags/master over
+		// refs/heads/master
+		expanded, _, err := dwimRef(short)
+		if err != nil {
+			return "", err
+		}
+		if expanded == refName || expanded == "" {
+			return short, nil
+		}
+	}
+	return refName, nil
+}
@@ -0,0 +1,279 @@
+package mygit
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const tagsPrefix = "refs/tags/"
+
+type TagObject struct {
+	Hash   string
+	Object string
+	Type   ObjectType
+	Tag    string
+
+	TaggerName         string
+	TaggerEmail        string
+	TaggerDateSeconds  string
+	TaggerDateTimeZone string
+
+	Message string
+}
+
+// parseTagObject parses an annotated tag object
+//
+//	object <oid>
+//	type <type>
+//	tag <name>
+//	tagger <name> <<email>> <date_seconds> <date_timezone>
+//
+//	<message>
+func parseTagObject(object *Object) (*TagObject, error) {
+	if object.Type != ObjectTypeTag {
+		return nil, fmt.Errorf("object %s is not a tag", object.Hash)
+	}
+
+	header, message, found := bytes.Cut(object.Content, []byte("\n\n"))
+	if !found {
+		// a tag without message
+		header = bytes.TrimSuffix(object.Content, []byte("\n"))
+	}
+	lines := strings.Split(string(header), "\n")
+
+	next := func(prefix string) (string, error) {
+		if len(lines) == 0 || !strings.HasPrefix(lines[0], prefix) {
+			return "", fmt.Errorf("invalid tag object: missing '%s' line", strings.TrimSpace(prefix))
+		}
+		value := strings.TrimPrefix(lines[0], prefix)
+		lines = lines[1:]
+		return value, nil
+	}
+
+	tag := &TagObject{Hash: object.Hash, Message: string(message)}
+
+	target, err := next("object ")
+	if err != nil {
+		return nil, err
+	}
+	if len(target) != 40 || !isHex(target) {
+		return nil, fmt.Errorf("invalid tag object: invalid object %s", target)
+	}
+	tag.Object = target
+
+	targetType, err := next("type ")
+	if err != nil {
+		return nil, err
+	}
+	tag.Type = ObjectType(targetType)
+
+	tag.Tag, err = next("tag ")
+	if err != nil {
+		return nil, err
+	}
+
+	// very old tags have no tagger
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "tagger ") {
+		const taggerRegex = `tagger ([^<]*) <([^>]*)> (\d+) (.*)`
+		re := regexp.MustCompile(taggerRegex)
+		matches := re.FindStringSubmatch(lines[0])
+		if len(matches) < 5 {
+			return nil, fmt.Errorf("invalid tag object: error parsing tagger line")
+		}
+		tag.TaggerName = strings.TrimSpace(matches[1])
+		tag.TaggerEmail = matches[2]
+		tag.TaggerDateSeconds = matches[3]
+		tag.TaggerDateTimeZone = matches[4]
+	}
+
+	return tag, nil
+}
+
+// peelObject follows annotated tags until an object that is not a tag
+func peelObject(oid string) (*Object, error) {
+	seen := map[string]bool{}
+	for {
+		object, err := NewObject(oid)
+		if err != nil {
+			return nil, err
+		}
+		if object.Type != ObjectTypeTag {
+			return object, nil
+		}
+
+		if seen[oid] {
+			return nil, fmt.Errorf("tag cycle at %s", oid)
+		}
+		seen[oid] = true
+
+		tag, err := parseTagObject(object)
+		if err != nil {
+			return nil, err
+		}
+		oid = tag.Object
+	}
+}
+
+// peelToCommit returns the commit an object ID points to,
+// following annotated tags
+func peelToCommit(oid string) (*CommitObject, error) {
+	object, err := peelObject(oid)
+	if err != nil {
+		return nil, err
+	}
+	if object.Type != ObjectTypeCommit {
+		return nil, fmt.Errorf("%s is not a commit object", oid)
+	}
+	return parseCommitObject(object)
+}
+
+func createTagObject(target string, name string, message string) ([]byte, string, error) {
+	object, err := NewObject(target)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tagContent := bytes.Buffer{}
+	tagContent.WriteString(fmt.Sprintf("object %s\n", target))
+	tagContent.WriteString(fmt.Sprintf("type %s\n", object.Type))
+	tagContent.WriteString(fmt.Sprintf("tag %s\n", name))
+
+	// the tagger is the committer
+	taggerName := getCommitterName()
+	if taggerName == "" {
+		return nil, "", fmt.Errorf("tagger name not set")
+	}
+	taggerEmail := getCommitterEmail()
+	if taggerEmail == "" {
+		return nil, "", fmt.Errorf("tagger email not set")
+	}
+	tagContent.WriteString(fmt.Sprintf("tagger %s <%s> %s\n", taggerName, taggerEmail, getCommitterDate()))
+
+	// the message ends with a single newline, as git's cleanup leaves it
+	tagContent.WriteString("\n")
+	tagContent.WriteString(strings.TrimRight(message, "\n"))
+	tagContent.WriteString("\n")
+
+	tagRaw := bytes.Buffer{}
+	tagRaw.WriteString(fmt.Sprintf("tag %d\x00", tagContent.Len()))
+	tagRaw.Write(tagContent.Bytes())
+
+	tagRawBytes := tagRaw.Bytes()
+
+	hash := sha1.New()
+	hash.Write(tagRawBytes)
+	hashString := fmt.Sprintf("%x", hash.Sum(nil))
+
+	return tagRawBytes, hashString, nil
+}
+
+type TagOptions struct {
+	// create an annotated tag object, implied by a message
+	Annotate bool
+	Message  string
+	// replace an existing tag
+	Force bool
+}
+
+// CreateTag creates a tag pointing to target (HEAD by default),
+// lightweight unless annotated
+func CreateTag(name string, target string, options *TagOptions) error {
+	if !validRefName(name) {
+		return fmt.Errorf("'%s' is not a valid tag name", name)
+	}
+
+	refName := tagsPrefix + name
+	previousOID, err := readRef(refName)
+	if err != nil {
+		return err
+	}
+	if previousOID != "" && !options.Force {
+		return fmt.Errorf("tag '%s' already exists", name)
+	}
+
+	if target == "" {
+		target = "HEAD"
+	}
+	oid, err := resolveRevision(target)
+	if err != nil {
+		return err
+	}
+
+	if options.Annotate || options.Message != "" {
+		if options.Message == "" {
+			return fmt.Errorf("annotated tags require a message, use -m <message>")
+		}
+		tagRawBytes, tagOID, err := createTagObject(oid, name, options.Message)
+		if err != nil {
+			return err
+		}
+		if err := writeAnyObject(tagOID, tagRawBytes); err != nil {
+			return err
+		}
+		oid = tagOID
+	}
+
+	if err := writeRef(refName, oid, ""); err != nil {
+		return err
+	}
+
+	if previousOID != "" && previousOID != oid {
+		fmt.Printf("Updated tag '%s' (was %.7s)\n", name, previousOID)
+	}
+
+	return nil
+}
+
+// DeleteTag deletes the given tag reference
+func DeleteTag(name string) error {
+	if !validRefName(name) {
+		return fmt.Errorf("tag '%s' not found", name)
+	}
+	oid, err := readRef(tagsPrefix + name)
+	if err != nil {
+		return err
+	}
+	if oid == "" {
+		return fmt.Errorf("tag '%s' not found", name)
+	}
+
+	if err := deleteRef(tagsPrefix + name); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted tag '%s' (was %.7s)\n", name, oid)
+
+	return nil
+}
+
+// ListTags prints the tag names, only the ones matching
+// one of the patterns if any
+func ListTags(patterns []string) error {
+	names, err := tagNames()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if len(patterns) == 0 {
+			fmt.Println(name)
+			continue
+		}
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, name); matched {
+				fmt.Println(name)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// tagNames returns the sorted tag names
+func tagNames() ([]string, error) {
+	return listRefs(tagsPrefix)
+}
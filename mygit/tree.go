@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"path"
 	"strings"
 )
@@ -18,8 +17,12 @@ const (
 	ObjectTypeBlob   ObjectType = "blob"
 	ObjectTypeTree   ObjectType = "tree"
 	ObjectTypeCommit ObjectType = "commit"
+	ObjectTypeTag    ObjectType = "tag"
 )
 
+// object ID of the tree without entries
+const emptyTreeOID = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
 // TreeEntry represents an entry in a git tree object
 type TreeEntry struct {
 	Mode      string
@@ -50,13 +53,22 @@ func (o *Object) PrintTreeContent(options *PrintTreeContentOptions) error {
 		if options.NameOnly {
 			fmt.Println(treeEntry.Name)
 		} else {
-			fmt.Printf("%s %s %s\t%s\n", treeEntry.Mode, treeEntry.Type, treeEntry.Hash, treeEntry.Name)
+			fmt.Printf("%s %s %s\t%s\n", formatTreeMode(treeEntry.Mode), treeEntry.Type, treeEntry.Hash, treeEntry.Name)
 		}
 	}
 
 	return nil
 }
 
+// formatTreeMode pads a mode to 6 digits, trees are stored as "40000"
+// but displayed as "040000"
+func formatTreeMode(mode string) string {
+	if len(mode) < 6 {
+		return strings.Repeat("0", 6-len(mode)) + mode
+	}
+	return mode
+}
+
 // parseTree parses all entries in a tree object
 // Format of the tree object content:
 //
@@ -74,22 +86,24 @@ func parseTree(objContent *bufio.Reader) ([]TreeEntry, error) {
 			return nil, err
 		}
 
-		split := strings.Split(header[:len(header)-1], " ")
-		if len(split) != 2 {
+		// names may contain spaces, the mode may not
+		mode, name, found := strings.Cut(header[:len(header)-1], " ")
+		if !found {
 			return nil, fmt.Errorf("invalid tree entry format")
 		}
 
-		mode := split[0]
-		name := split[1]
-
 		hash := make([]byte, 20)
-		if _, err := objContent.Read(hash); err != nil {
+		if _, err := io.ReadFull(objContent, hash); err != nil {
 			return nil, err
 		}
 
 		objType := ObjectTypeBlob
-		if mode == "40000" {
+		switch mode {
+		case "40000":
 			objType = ObjectTypeTree
+		case "160000":
+			// submodule commit
+			objType = ObjectTypeCommit
 		}
 
 		entries = append(entries, TreeEntry{
@@ -104,41 +118,56 @@ func parseTree(objContent *bufio.Reader) ([]TreeEntry, error) {
 	return entries, nil
 }
 
-func writeTreeToDisk(treeObject *Object, treePath string) error {
-	if treeObject.Type != ObjectTypeTree {
-		return fmt.Errorf("object %s is not a tree", treeObject.Hash)
-	}
+// treeEntryLess orders tree entries the way git does: by name,
+// a tree name being compared as if it ended with a '/'
+func treeEntryLess(a *TreeEntry, b *TreeEntry) bool {
+	return treeEntrySortName(a) < treeEntrySortName(b)
+}
 
-	err := os.MkdirAll(treePath, 0755)
-	if err != nil {
-		return err
+func treeEntrySortName(entry *TreeEntry) string {
+	if entry.Type == ObjectTypeTree {
+		return entry.Name + "/"
 	}
+	return entry.Name
+}
 
-	treeEntries, err := parseTree(bufio.NewReader(bytes.NewReader(treeObject.Content)))
-	if err != nil {
-		return err
+// treeFiles returns every file of a tree and its subtrees by path,
+// an empty tree object ID gives no file
+func treeFiles(treeOID string) (map[string]TreeEntry, error) {
+	files := map[string]TreeEntry{}
+	if treeOID == "" {
+		return files, nil
 	}
 
-	for _, entry := range treeEntries {
-		object, err := NewObject(entry.Hash)
+	var walk func(oid string, treePath string) error
+	walk = func(oid string, treePath string) error {
+		object, err := NewObject(oid)
 		if err != nil {
 			return err
 		}
-		fullpath := path.Join(treePath, entry.Name)
-		if entry.Type == ObjectTypeBlob {
-			err := writeBlobToDisk(object, fullpath)
-			if err != nil {
-				return err
-			}
-		} else if entry.Type == ObjectTypeTree {
-			err := writeTreeToDisk(object, fullpath)
-			if err != nil {
-				return err
+		if object.Type != ObjectTypeTree {
+			return fmt.Errorf("object %s is not a tree", oid)
+		}
+		entries, err := parseTree(bufio.NewReader(bytes.NewReader(object.Content)))
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			entryPath := path.Join(treePath, entry.Name)
+			if entry.Type == ObjectTypeTree {
+				if err := walk(entry.Hash, entryPath); err != nil {
+					return err
+				}
+				continue
 			}
-		} else {
-			return fmt.Errorf("invalid object type %s", entry.Type)
+			files[entryPath] = entry
 		}
+		return nil
 	}
 
-	return nil
+	if err := walk(treeOID, ""); err != nil {
+		return nil, err
+	}
+	return files, nil
 }
@@ -0,0 +1,147 @@
+package mygit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type UpdateRefOptions struct {
+	// delete the ref instead of updating it
+	Delete bool
+	// update a symbolic ref itself rather than the ref it points to
+	NoDeref bool
+	// reason of the updates, recorded in the reflog
+	Message string
+}
+
+// UpdateRef points a ref to the object newValue names, or deletes it,
+// provided it points to the object oldValue names
+// An empty oldValue skips the check, zeroOID requires the ref not to exist
+func UpdateRef(refName string, newValue string, oldValue string, options *UpdateRefOptions) error {
+	if newValue == "" && !options.Delete {
+		return fmt.Errorf("%s: not a valid SHA1", newValue)
+	}
+	update, err := newRefUpdate(refName, newValue, oldValue, options.NoDeref)
+	if err != nil {
+		return err
+	}
+	if options.Delete {
+		update.newOID = zeroOID
+	}
+	update.message = options.Message
+	return updateRefs([]refUpdate{*update})
+}
+
+// UpdateRefStdin reads ref updates, one command per line, and applies
+// all of them or none:
+//
+//	update <ref> <new-value> [<old-value>]
+//	create <ref> <new-value>
+//	delete <ref> [<old-value>]
+//	verify <ref> [<old-value>]
+//	option no-deref
+func UpdateRefStdin(input io.Reader, options *UpdateRefOptions) error {
+	updates := []refUpdate{}
+	noDeref := options.NoDeref
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		command, rest, _ := strings.Cut(line, " ")
+		args := strings.Split(rest, " ")
+
+		var update *refUpdate
+		var err error
+		switch {
+		case command == "option" && rest == "no-deref":
+			// applies to the next command only
+			noDeref = true
+			continue
+		case command == "update" && (len(args) == 2 || len(args) == 3):
+			oldValue := ""
+			if len(args) == 3 {
+				oldValue = zeroValue(args[2])
+			}
+			update, err = newRefUpdate(args[0], zeroValue(args[1]), oldValue, noDeref)
+		case command == "create" && len(args) == 2:
+			if zeroValue(args[1]) == zeroOID {
+				return fmt.Errorf("create %s: zero <new-oid>", args[0])
+			}
+			update, err = newRefUpdate(args[0], args[1], zeroOID, noDeref)
+		case command == "delete" && (len(args) == 1 || len(args) == 2):
+			oldValue := ""
+			if len(args) == 2 {
+				if oldValue = zeroValue(args[1]); oldValue == zeroOID {
+					return fmt.Errorf("delete %s: zero <old-oid>", args[0])
+				}
+			}
+			update, err = newRefUpdate(args[0], zeroOID, oldValue, noDeref)
+		case command == "verify" && (len(args) == 1 || len(args) == 2):
+			// without an old value, the ref must not exist
+			oldValue := zeroOID
+			if len(args) == 2 {
+				oldValue = zeroValue(args[1])
+			}
+			update, err = newRefUpdate(args[0], "", oldValue, noDeref)
+		default:
+			return fmt.Errorf("invalid command: %s", line)
+		}
+		if err != nil {
+			return err
+		}
+
+		update.message = options.Message
+		updates = append(updates, *update)
+		noDeref = options.NoDeref
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return updateRefs(updates)
+}
+
+// zeroValue returns zeroOID for an empty value, the value otherwise
+func zeroValue(value string) string {
+	if value == "" {
+		return zeroOID
+	}
+	return value
+}
+
+// newRefUpdate resolves the new and old values of an update of refName,
+// an empty value is left empty
+func newRefUpdate(refName string, newValue string, oldValue string, noDeref bool) (*refUpdate, error) {
+	if !validRefName(refName) || !(strings.HasPrefix(refName, "refs/") || isPseudoRef(refName)) {
+		return nil, fmt.Errorf("refusing to update ref with bad name '%s'", refName)
+	}
+
+	newOID, err := resolveRefValue(newValue)
+	if err != nil {
+		return nil, err
+	}
+	oldOID, err := resolveRefValue(oldValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &refUpdate{name: refName, newOID: newOID, oldOID: oldOID, noDeref: noDeref}, nil
+}
+
+// resolveRefValue returns the object ID a value of update-ref names,
+// zeroOID and empty values are kept as is
+func resolveRefValue(value string) (string, error) {
+	if value == "" || value == zeroOID {
+		return value, nil
+	}
+	oid, err := resolveRevision(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: not a valid SHA1", value)
+	}
+	return oid, nil
+}
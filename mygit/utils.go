@@ -1,8 +1,26 @@
 package mygit
 
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
 func sanitizeURL(url string) string {
 	if url[len(url)-1] == '/' {
 		url = url[:len(url)-1]
 	}
 	return url
 }
+
+// removeEmptyDirs removes dir and the parents it leaves empty, keeping the
+// first depth directories of the path, such as .git/refs/heads for a depth
+// of 3, or none of a path relative to the working tree root for 0
+func removeEmptyDirs(dir string, depth int) {
+	for ; dir != "." && dir != "/" && strings.Count(dir, "/") >= depth; dir = filepath.Dir(dir) {
+		// fails on the first directory that is not empty
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package mygit
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type VerifyPackOptions struct {
+	Path     string
+	Verbose  bool
+	StatOnly bool
+}
+
+// VerifyPack checks a packfile against its index
+// and optionally describes every entry of the packfile
+func VerifyPack(options *VerifyPackOptions) error {
+	basePath := strings.TrimSuffix(strings.TrimSuffix(options.Path, ".idx"), ".pack")
+	packPath := basePath + ".pack"
+	indexPath := basePath + ".idx"
+
+	index, err := readPackIndex(indexPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", indexPath, err)
+	}
+
+	packFile, err := os.ReadFile(packPath)
+	if err != nil {
+		return err
+	}
+
+	entries, err := indexPackFile(packFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", packPath, err)
+	}
+
+	err = verifyPackIndex(index, packFile, entries)
+	if err != nil {
+		return fmt.Errorf("%s: %w", indexPath, err)
+	}
+
+	if !options.Verbose && !options.StatOnly {
+		return nil
+	}
+
+	if !options.StatOnly {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].offset < entries[j].offset
+		})
+		for _, entry := range entries {
+			fmt.Printf("%s %-6s %d %d %d", entry.hash,
+				PackFileObjectTypeString[entry.contentType],
+				entry.size, entry.end-entry.offset, entry.offset)
+			if entry.isDelta() {
+				fmt.Printf(" %d %s", entry.depth, entry.baseHash)
+			}
+			fmt.Println()
+		}
+	}
+
+	// delta chain length histogram
+	chainLengths := map[int]int{}
+	maxDepth := 0
+	for _, entry := range entries {
+		chainLengths[entry.depth]++
+		maxDepth = max(maxDepth, entry.depth)
+	}
+	if chainLengths[0] > 0 {
+		fmt.Printf("non delta: %d %s\n", chainLengths[0], pluralObjects(chainLengths[0]))
+	}
+	for depth := 1; depth <= maxDepth; depth++ {
+		if chainLengths[depth] > 0 {
+			fmt.Printf("chain length = %d: %d %s\n", depth, chainLengths[depth],
+				pluralObjects(chainLengths[depth]))
+		}
+	}
+
+	if !options.StatOnly {
+		fmt.Printf("%s: ok\n", packPath)
+	}
+
+	return nil
+}
+
+func pluralObjects(count int) string {
+	if count == 1 {
+		return "object"
+	}
+	return "objects"
+}
+
+// verifyPackIndex checks that the index describes exactly the packfile entries
+func verifyPackIndex(index *packIndex, packFile []byte, entries []*packEntry) error {
+	if !bytes.Equal(index.packChecksum, packFile[len(packFile)-20:]) {
+		return fmt.Errorf("packfile checksum does not match the index")
+	}
+
+	if index.count() != len(entries) {
+		return fmt.Errorf("index has %d objects but packfile has %d",
+			index.count(), len(entries))
+	}
+
+	for i := 1; i < index.count(); i++ {
+		if bytes.Compare(index.hash(i-1), index.hash(i)) >= 0 {
+			return fmt.Errorf("index object names are not sorted")
+		}
+	}
+
+	for _, entry := range entries {
+		i, found := index.find(entry.hashBytes)
+		if !found {
+			return fmt.Errorf("object %s is missing from the index", entry.hash)
+		}
+		if index.offset(i) != entry.offset {
+			return fmt.Errorf("object %s has offset %d in the index but %d in the packfile",
+				entry.hash, index.offset(i), entry.offset)
+		}
+		if index.crc32(i) != entry.crc32 {
+			return fmt.Errorf("object %s CRC32 mismatch", entry.hash)
+		}
+	}
+
+	return nil
+}
+
+// ShowIndex dumps a pack index file read from the given reader
+// Format of each line: <offset> <object_id> (<crc32>)
+func ShowIndex(reader io.Reader) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	index, err := parsePackIndex(data)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < index.count(); i++ {
+		fmt.Printf("%d %s (%08x)\n", index.offset(i), hex.EncodeToString(index.hash(i)),
+			index.crc32(i))
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    echo "hello" > hello.txt
+    echo "world" > world.txt
+    mkdir -p dir/sub
+    echo "a" > dir/a.c
+    echo "b" > dir/sub/b.c
+    echo "notes" > dir/notes.txt
+    echo "script" > run.sh
+    chmod +x run.sh
+    ln -s hello.txt link
+}
+
+# index_version: version of .git/index, from its header
+index_version() {
+    od -An -tu1 -j7 -N1 .git/index | tr -d ' '
+}
+
+# compare <message> <git_command> <mygit_command>: same output and index
+# after running the git command in ./git and the mygit command in ./mygit
+compare() {
+    (cd git && eval "git $2" > ../ref_add.txt 2>&1; git ls-files -s > ../ref_index.txt)
+    (cd mygit && eval "$mygit $3" > ../got_add.txt 2>&1; git ls-files -s > ../got_index.txt)
+    if ! diff -u ref_add.txt got_add.txt || ! diff -u ref_index.txt got_index.txt; then
+        echo "[KO] $1: output or index differs"
+        exit 1
+    else
+        echo "[OK] $1: same output and index"
+    fi
+}
+
+# change <dir>: same working tree changes in ./<dir>
+change() {
+    echo "changed" >> $1/hello.txt
+    echo "changed" >> $1/dir/a.c
+    rm $1/world.txt
+    echo "new" > $1/new.txt
+    echo "new" > $1/dir/sub/new.c
+}
+
+config
+
+mkdir git mygit
+(cd git && prepare)
+(cd mygit && prepare)
+
+compare "add -n" "add -n 'dir/*.c' hello.txt" "add -n 'dir/*.c' hello.txt"
+compare "add pathspec" "add 'dir/*.c' hello.txt" "add 'dir/*.c' hello.txt"
+compare "add directory" "add -v dir" "add -v dir"
+compare "add ." "add ." "add ."
+
+cd mygit
+if [ -n "$(git diff --name-only)" ] || [ -n "$(git ls-files -o)" ] ||
+    [ "$(git write-tree)" != "$($mygit write-tree)" ]; then
+    echo "[KO] add: index differs from the working tree"
+    exit 1
+else
+    echo "[OK] add: index matches the working tree"
+fi
+git commit -q -m "first"
+cd ..
+(cd git && git commit -q -m "first")
+
+change git
+change mygit
+compare "add -u -n" "add -u -n" "add -u -n"
+compare "add -u" "add -u dir" "add -u dir"
+compare "add -A" "add -A" "add -A"
+
+if (cd mygit && $mygit add unknown 2> /dev/null) || [ -f mygit/.git/index.lock ]; then
+    echo "[KO] add: unknown pathspec accepted"
+    exit 1
+else
+    echo "[OK] add: unknown pathspec rejected"
+fi
+
+# commit records the index only
+cd mygit
+echo "staged" > staged.txt
+echo "unstaged" > unstaged.txt
+$mygit add staged.txt
+$mygit commit -m "second" > /dev/null
+if [ "$(git ls-tree --name-only HEAD -- staged.txt unstaged.txt)" != "staged.txt" ] ||
+    [ -n "$(git diff --cached --name-only)" ]; then
+    echo "[KO] commit: index not committed"
+    exit 1
+else
+    echo "[OK] commit: index committed"
+fi
+if $mygit commit -m "empty" > /dev/null 2>&1; then
+    echo "[KO] commit: nothing to commit accepted"
+    exit 1
+else
+    echo "[OK] commit: nothing to commit rejected"
+fi
+echo "changed" >> staged.txt
+$mygit commit -a -m "third" > /dev/null
+if [ -n "$(git diff HEAD --name-only -- staged.txt)" ]; then
+    echo "[KO] commit -a: tracked change not committed"
+    exit 1
+else
+    echo "[OK] commit -a: tracked change committed"
+fi
+rm unstaged.txt
+
+# index versions 3 and 4, written by git then by mygit
+echo "intent" > intent.txt
+git add -N intent.txt
+echo "other" > other.txt
+$mygit add other.txt
+if [ "$(index_version)" != 3 ] || [ "$(git write-tree)" != "$($mygit write-tree)" ] ||
+    [ "$(git ls-files -s | grep -c intent.txt)" != 1 ]; then
+    echo "[KO] add: index version 3 not kept"
+    exit 1
+else
+    echo "[OK] add: index version 3 kept"
+fi
+git add intent.txt
+
+git update-index --index-version 4
+echo "four" >> dir/sub/b.c
+$mygit add dir
+if [ "$(index_version)" != 4 ] || [ "$(git write-tree)" != "$($mygit write-tree)" ] ||
+    [ -n "$(git diff --name-only)" ]; then
+    echo "[KO] add: index version 4 not kept"
+    exit 1
+else
+    echo "[OK] add: index version 4 kept"
+fi
+
+rm .git/index
+git config index.version 4
+$mygit add .
+if [ "$(index_version)" != 4 ] || [ -n "$(git diff --name-only)" ]; then
+    echo "[KO] add: index.version not used"
+    exit 1
+else
+    echo "[OK] add: index.version used"
+fi
+git config --unset index.version
+$mygit commit -m "fourth" > /dev/null
+
+# switch updates the index along with the working tree
+$mygit switch -c feature HEAD~2 > /dev/null
+if [ -n "$(git status --porcelain)" ] || [ "$(git write-tree)" != "$(git rev-parse HEAD^{tree})" ]; then
+    echo "[KO] switch: index not updated"
+    exit 1
+else
+    echo "[OK] switch: index updated"
+fi
+
+echo "staged change" > staged.txt
+$mygit add staged.txt
+git checkout -q -- staged.txt
+if $mygit switch master > /dev/null 2>&1; then
+    echo "[KO] switch: staged change overwritten"
+    exit 1
+else
+    echo "[OK] switch: staged change kept"
+fi
@@ -0,0 +1,101 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    mkdir repo && cd repo
+    git init > /dev/null 2>&1
+    mkdir dir
+    echo "first" > dir/file.txt
+    echo "readme" > readme.md
+    git add . > /dev/null
+    git commit -q -m "first"
+    git branch feature
+    echo "second" > dir/file.txt
+    echo "new" > new.txt
+    git add . > /dev/null
+    git commit -q -m "second"
+}
+
+# same_tree <revision>: compares the working tree with a revision tree
+# outputs are written out of the working tree, commit records every file
+same_tree() {
+    rm -rf ../expected && mkdir ../expected
+    git archive "$1" | tar -x -C ../expected
+    diff -r -x .git ../expected .
+}
+
+config
+
+prepare
+
+git branch -v > ../ref_branch.txt
+$mygit branch -v > ../got_branch.txt
+diff -u ../ref_branch.txt ../got_branch.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] branch -v: output differs"
+    exit 1
+else
+    echo "[OK] branch -v: same output"
+fi
+
+$mygit switch feature > /dev/null
+if [ "$(git symbolic-ref HEAD)" != "refs/heads/feature" ] || ! same_tree feature; then
+    echo "[KO] switch: working tree or HEAD not updated"
+    exit 1
+else
+    echo "[OK] switch: working tree and HEAD updated"
+fi
+
+$mygit checkout master~1 > /dev/null
+if git symbolic-ref -q HEAD > /dev/null ||
+    [ "$(git rev-parse HEAD)" != "$(git rev-parse master~1)" ] || ! same_tree master~1; then
+    echo "[KO] checkout: HEAD not detached"
+    exit 1
+else
+    echo "[OK] checkout: HEAD detached"
+fi
+
+echo "detached" > detached.txt
+$mygit add detached.txt
+$mygit commit -m "detached" > /dev/null
+if git symbolic-ref -q HEAD > /dev/null || [ "$(git rev-parse HEAD~1)" != "$(git rev-parse master~1)" ]; then
+    echo "[KO] commit: detached HEAD not moved"
+    exit 1
+else
+    echo "[OK] commit: detached HEAD moved"
+fi
+
+$mygit branch detached
+$mygit switch master > /dev/null
+echo "local change" > dir/file.txt
+if $mygit switch feature 2> /dev/null; then
+    echo "[KO] switch: local changes overwritten"
+    exit 1
+else
+    echo "[OK] switch: local changes kept"
+fi
+git checkout -q dir/file.txt
+
+$mygit branch -d detached 2> /dev/null
+if [ -z "$(git branch --list detached)" ]; then
+    echo "[KO] branch -d: unmerged branch deleted"
+    exit 1
+fi
+$mygit branch -D detached > /dev/null
+$mygit branch -m master main
+if [ -n "$(git branch --list detached)" ] || [ "$(git symbolic-ref HEAD)" != "refs/heads/main" ]; then
+    echo "[KO] branch -D -m: branches not deleted or renamed"
+    exit 1
+else
+    echo "[OK] branch -d -D -m: branches deleted and renamed"
+fi
@@ -16,4 +16,50 @@ if [ $? -ne 0 ]; then
     exit 1
 else
     echo "[OK] good output"
-fi
\ No newline at end of file
+fi
+
+mkdir -p dir
+echo "$test_text" > dir/file.txt
+echo "other content" > other.txt
+git add . > /dev/null 2>&1
+tree=$(git write-tree)
+
+git cat-file -p $tree > ref.txt
+$mygit cat-file -p $tree > got.txt
+
+diff -u ref.txt got.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] cat-file -p tree failed"
+    exit 1
+else
+    echo "[OK] cat-file -p tree: good output"
+fi
+
+for option in -t -s; do
+    if [ "$(git cat-file $option $tree)" != "$($mygit cat-file $option $tree)" ] ||
+        [ "$(git cat-file $option $hash)" != "$($mygit cat-file $option $hash)" ]; then
+        echo "[KO] cat-file $option failed"
+        exit 1
+    fi
+done
+echo "[OK] cat-file -t -s: good output"
+
+missing=$(echo "not stored" | git hash-object --stdin)
+if $mygit cat-file -e $hash && ! $mygit cat-file -e $missing; then
+    echo "[OK] cat-file -e: good exit status"
+else
+    echo "[KO] cat-file -e failed"
+    exit 1
+fi
+
+printf "%s\n%s\n%s\n" $hash $tree $missing > names.txt
+for option in --batch --batch-check; do
+    git cat-file $option < names.txt > ref.txt
+    $mygit cat-file $option < names.txt > got.txt
+    cmp ref.txt got.txt
+    if [ $? -ne 0 ]; then
+        echo "[KO] cat-file $option failed"
+        exit 1
+    fi
+done
+echo "[OK] cat-file --batch --batch-check: good output"
@@ -0,0 +1,116 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+# compare <message> <command>: same output and exit status from git and
+# mygit in the same repository
+compare() {
+    eval "git $2" > ../ref_out.txt 2>/dev/null
+    echo "exit $?" >> ../ref_out.txt
+    eval "$mygit $2" > ../got_out.txt 2>/dev/null
+    echo "exit $?" >> ../got_out.txt
+    if ! diff -u ../ref_out.txt ../got_out.txt; then
+        echo "[KO] $1: output differs"
+        exit 1
+    else
+        echo "[OK] $1: same output"
+    fi
+}
+
+prepare() {
+    git init -q -b master
+    cat > .gitignore <<'EOF'
+# build outputs
+*.o
+build/
+/root.txt
+*.log
+!keep.log
+node_modules
+**/cache/**
+doc/**/*.pdf
+trailing\ 
+\#hash
+[abc].tmp
+EOF
+    printf "*.swp\n" > .git/info/exclude
+    mkdir -p src/sub build node_modules/pkg doc/a/b a/cache/x sub
+    printf "*.c\n!keep.c\n" > src/.gitignore
+    printf "gen/\n/local.txt\n" > src/sub/.gitignore
+    for file in main.o build/out node_modules/pkg/index.js root.txt sub/root.txt \
+        debug.log keep.log src/a.c src/keep.c src/sub/b.c src/sub/local.txt \
+        local.txt a/cache/x/y doc/a/b/book.pdf doc/book.pdf "trailing " "#hash" \
+        a.tmp d.tmp .file.swp src/main.go; do
+        echo "content" > "$file"
+    done
+    mkdir -p src/sub/gen && echo "gen" > src/sub/gen/out.go
+    git add -f src/a.c
+}
+
+config
+
+mkdir repo && cd repo
+prepare
+git config core.excludesFile "$PWD/../global_ignore"
+printf "*.global\n" > ../global_ignore
+echo "global" > file.global
+
+paths="main.o build build/out node_modules/pkg/index.js root.txt sub/root.txt \
+    debug.log keep.log src/a.c src/keep.c src/sub/b.c src/sub/local.txt local.txt \
+    a/cache/x/y a/cache doc/a/b/book.pdf doc/book.pdf 'trailing ' '#hash' a.tmp \
+    d.tmp .file.swp src/main.go src/sub/gen/out.go src/sub/gen/ file.global missing"
+
+compare "check-ignore" "check-ignore $paths"
+compare "check-ignore -v" "check-ignore -v $paths"
+compare "check-ignore -v -n" "check-ignore -v -n $paths"
+compare "check-ignore --no-index" "check-ignore -v --no-index src/a.c"
+compare "check-ignore -q" "check-ignore -q debug.log"
+compare "check-ignore nothing ignored" "check-ignore src/main.go keep.log"
+compare "check-ignore -v negated" "check-ignore -v keep.log"
+
+compare "status" "status --porcelain --ignored"
+compare "status all files" "status --porcelain --ignored --untracked-files=all"
+
+cd ..
+mkdir git mygit
+(cd git && prepare)
+(cd mygit && prepare)
+
+# compare_add <message> <arguments>: same output, exit status and index
+# after adding files in ./git and ./mygit
+compare_add() {
+    (cd git && eval "git add $2" > ../ref_add.txt 2>&1; echo "exit $?" >> ../ref_add.txt; git ls-files -s > ../ref_index.txt)
+    (cd mygit && eval "$mygit add $2" > ../got_add.txt 2>&1; echo "exit $?" >> ../got_add.txt; git ls-files -s > ../got_index.txt)
+    # git hints how to turn the advice off
+    grep -v "^hint: Turn this message off\|advice.addIgnoredFile" ref_add.txt > ref_add_filtered.txt
+    if ! diff -u ref_add_filtered.txt got_add.txt || ! diff -u ref_index.txt got_index.txt; then
+        echo "[KO] $1: output or index differs"
+        exit 1
+    else
+        echo "[OK] $1: same output and index"
+    fi
+}
+
+compare_add "add ignored file" "debug.log src/main.go"
+compare_add "add ignored directory" "build"
+compare_add "add glob over ignored files" "'*.log'"
+compare_add "add everything" "-A"
+compare_add "add -f" "-f debug.log build"
+
+(cd git && git commit -q -m "first" && git rev-parse HEAD^{tree} > ../ref_tree.txt)
+(cd mygit && $mygit commit -m "first" > /dev/null && git rev-parse HEAD^{tree} > ../got_tree.txt)
+if ! diff -u ref_tree.txt got_tree.txt; then
+    echo "[KO] commit: tree differs"
+    exit 1
+else
+    echo "[OK] commit: same tree"
+fi
@@ -0,0 +1,86 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028260 +0200"
+
+    export GIT_EDITOR=true
+}
+
+# state: the commits and their authors, the index, the status and the
+# sequence left to conclude
+state() {
+    git log --format='%H %P %an <%ae> %ad %s' -4
+    git log --format=%B -1
+    git reflog -3
+    git ls-files -s
+    git status
+    git status --porcelain=v2
+    ls .git | grep "HEAD\|MSG\|sequencer"
+    cat .git/CHERRY_PICK_HEAD .git/REVERT_HEAD .git/MERGE_MSG .git/sequencer/* 2> /dev/null
+}
+
+# compare_pick <message> <commands>: same commands run by git and mygit, as
+# $tool, on copies of the repository: output, commits, index and working
+# tree
+compare_pick() {
+    rm -rf ref got && cp -r repo ref && cp -r repo got
+    (cd ref && tool=git && eval "$2" > ../ref_pick.txt 2>&1; echo "exit $?" >> ../ref_pick.txt; state >> ../ref_pick.txt)
+    (cd got && tool=$mygit && eval "$2" > ../got_pick.txt 2>&1; echo "exit $?" >> ../got_pick.txt; state >> ../got_pick.txt)
+    if ! cmp -s ref_pick.txt got_pick.txt || ! diff -r --no-dereference -x .git ref got > /dev/null; then
+        diff -u ref_pick.txt got_pick.txt
+        diff -r --no-dereference -x .git ref got
+        echo "[KO] $1: differs"
+        exit 1
+    else
+        echo "[OK] $1: same result"
+    fi
+}
+
+config
+
+git init -q -b master repo && cd repo
+seq 1 10 > a
+echo "b" > b
+git add .
+git commit -q -m "base"
+
+# commits of another author, one of them conflicting with master
+git checkout -q -b side
+sed -i 's/^3$/three/' a
+GIT_AUTHOR_NAME=other GIT_AUTHOR_EMAIL=other@example.com git commit -q -a -m "three"
+sed -i 's/^5$/five/' a
+git commit -q -a -m "five
+
+with a body"
+echo "x" > x
+git add x
+git commit -q -m "x"
+git mv b bb
+git commit -q -m "rename b"
+
+git checkout -q master
+sed -i 's/^5$/FIVE/' a
+git commit -q -a -m "FIVE"
+cd ..
+
+compare_pick "cherry-pick" '$tool cherry-pick side~3'
+compare_pick "cherry-pick of several commits" '$tool cherry-pick side~3 side~1 side'
+compare_pick "cherry-pick of a range" '$tool cherry-pick master..side~1'
+compare_pick "conflict" '$tool cherry-pick side~2'
+compare_pick "conflict concluded" '$tool cherry-pick side~2; seq 1 10 > a; git add a; $tool cherry-pick --continue > /dev/null'
+compare_pick "conflict in a sequence" '$tool cherry-pick side~3 side~2 side'
+compare_pick "sequence continued" '$tool cherry-pick side~3 side~2 side; seq 1 10 > a; git add a; $tool cherry-pick --continue > /dev/null'
+compare_pick "sequence skipping a commit" '$tool cherry-pick side~3 side~2 side; $tool cherry-pick --skip'
+compare_pick "sequence aborted" '$tool cherry-pick side~3 side~2 side; $tool cherry-pick --abort'
+compare_pick "commit already applied" '$tool cherry-pick side~3; $tool cherry-pick side~3'
+compare_pick "revert" '$tool revert HEAD'
+compare_pick "revert conflict" '$tool revert HEAD~1'
+compare_pick "revert concluded" '$tool revert HEAD~1; seq 1 10 > a; git add a; $tool revert --continue > /dev/null'
+compare_pick "revert aborted" '$tool revert HEAD~1; $tool revert --abort'
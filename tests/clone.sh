@@ -2,8 +2,7 @@ mygit=mygit
 
 repo='https://github.com/codecrafters-io/git-sample-1'
 
-# git reference uses packfile with index rather than
-# unpacking to objects as done in this implementation
+# packfile naming and object layout may differ from git reference
 # so we test only files and directories and not .git/
 
 $mygit clone $repo got_repo
@@ -37,6 +37,7 @@ print_object > $result/ref_objects.txt
 rm -rf .git
 
 $mygit init
+$mygit add hello.txt
 $mygit write-tree
 $mygit commit-tree -m "Initial commit" $tree  > $result/got_commit_tree.txt
 
@@ -36,6 +36,7 @@ git commit-tree -m "Second commit" -p $commit $tree > $result/ref_commit_tree.tx
 rm -rf .git
 
 $mygit init
+$mygit add hello.txt
 $mygit write-tree
 commit=$($mygit commit-tree -m "Initial commit" $tree)
 git commit-tree -m "Second commit" -p $commit $tree > $result/got_commit_tree.txt
@@ -0,0 +1,114 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+# compare <message> <arguments>: same diff output from git and mygit
+compare() {
+    eval "git diff $2" > ../ref_diff.txt 2>&1
+    eval "$mygit diff $2" > ../got_diff.txt 2>&1
+    if ! cmp -s ../ref_diff.txt ../got_diff.txt; then
+        diff -u ../ref_diff.txt ../got_diff.txt | cat -A
+        echo "[KO] $1: diff differs"
+        exit 1
+    else
+        echo "[OK] $1: same diff"
+    fi
+}
+
+# compare_all <message> <arguments>: same diff in every format
+compare_all() {
+    compare "$1" "$2"
+    compare "$1 (-U0)" "-U0 $2"
+    compare "$1 (-U1)" "--unified=1 $2"
+    compare "$1 (patience)" "--patience $2"
+    compare "$1 (histogram)" "--diff-algorithm=histogram $2"
+    compare "$1 (minimal)" "--minimal $2"
+    compare "$1 (stat)" "--stat $2"
+    compare "$1 (name-only)" "--name-only $2"
+    compare "$1 (name-status)" "--name-status $2"
+}
+
+# program <seed>: a C like file whose functions change with the seed
+program() {
+    for f in main parse eval print; do
+        echo "int $f(int argc)"
+        echo "{"
+        for i in 1 2 3 4 5 6; do
+            if [ $(( (i + $1) % 4 )) -eq 0 ]; then
+                echo "    $f$i = argc * $1;"
+            else
+                echo "    $f$i = argc;"
+            fi
+        done
+        echo "    return 0;"
+        echo "}"
+        echo ""
+    done
+}
+
+config
+
+mkdir repo && cd repo
+git init -q -b master
+
+compare "empty repository" ""
+
+program 1 > program.c
+printf "a\nb\nc\n" > letters.txt
+printf "no newline" > tail.txt
+printf "binary\000data\n" > data.bin
+echo "target" > target.txt
+echo "link me" > link
+echo "exec" > script.sh
+echo "spaces" > "with space.txt"
+mkdir -p dir/sub
+seq 1 30 > dir/sub/numbers.txt
+: > empty.txt
+$mygit add . > /dev/null
+compare_all "new files staged" "--cached"
+
+$mygit commit -m "first" > /dev/null
+compare_all "clean working tree" ""
+
+program 2 > program.c
+printf "a\nB\nc\nd\n" > letters.txt
+printf "no newline at all" > tail.txt
+printf "binary\000changed\n" > data.bin
+rm link && ln -s target.txt link
+chmod +x script.sh
+echo "more spaces" >> "with space.txt"
+seq 5 35 | sed 's/^2.$/twenty/' > dir/sub/numbers.txt
+rm empty.txt
+compare_all "working tree changes" ""
+compare_all "working tree changes against HEAD" "HEAD"
+compare_all "pathspec" "-- dir program.c"
+
+$mygit add program.c letters.txt data.bin > /dev/null
+compare_all "some changes staged" "--cached"
+compare_all "some changes unstaged" ""
+
+# moved blocks tell the algorithms apart
+{ program 3 | sed -n '19,36p'; program 3 | sed -n '1,18p'; program 3 | sed -n '37,$p'; } > program.c
+compare_all "moved functions" ""
+
+$mygit add -A > /dev/null
+$mygit commit -m "second" > /dev/null
+compare_all "two commits" "HEAD~1 HEAD"
+compare_all "commit range" "HEAD~1..HEAD"
+compare_all "reversed commits" "HEAD HEAD~1"
+compare "stat of two commits" "--stat HEAD~1 HEAD"
+COLUMNS=40 compare "stat with a narrow terminal" "--stat HEAD~1 HEAD"
+
+mkdir -p very/long/directory/name/to/shorten/in/the/stat/output/of/diff
+seq 1 200 > very/long/directory/name/to/shorten/in/the/stat/output/of/diff/file.txt
+$mygit add . > /dev/null
+compare "stat with a long name" "--cached --stat"
@@ -0,0 +1,86 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+# compare <message> <arguments>: same diff-tree output from git and mygit
+compare() {
+    eval "git diff-tree $2" > ../ref_diff_tree.txt 2>/dev/null
+    eval "$mygit diff-tree $2" > ../got_diff_tree.txt 2>/dev/null
+    if ! cmp -s ../ref_diff_tree.txt ../got_diff_tree.txt; then
+        diff -u ../ref_diff_tree.txt ../got_diff_tree.txt | cat -A
+        echo "[KO] $1: output differs"
+        exit 1
+    else
+        echo "[OK] $1: same output"
+    fi
+}
+
+# compare_all <message> <arguments>: same output with and without
+# recursion, and NUL terminated
+compare_all() {
+    compare "$1" "$2"
+    compare "$1 (-r)" "-r $2"
+    compare "$1 (-r -z)" "-r -z $2"
+    compare "$1 (--root)" "--root $2"
+    compare "$1 (-r --root)" "-r --root $2"
+}
+
+config
+
+mkdir repo && cd repo
+git init -q -b master
+
+echo "a" > a.txt
+echo "b" > b.txt
+mkdir -p dir/sub dir.d
+echo "x" > dir/x.txt
+echo "y" > dir/sub/y.txt
+echo "z" > dir.d/z.txt
+echo "file" > file
+echo "link" > link
+echo "tab" > "$(printf 'with\ttab')"
+echo "space" > "with space"
+git add .
+git commit -q -m "first"
+
+compare_all "root commit" "HEAD"
+
+echo "changed" >> a.txt
+git rm -q b.txt
+echo "new" > c.txt
+echo "x2" > dir/x.txt
+echo "new y" > dir/sub/new.txt
+chmod +x dir/sub/y.txt
+git rm -q file
+mkdir file && echo "now a directory" > file/inside
+rm link && ln -s a.txt link
+echo "changed tab" > "$(printf 'with\ttab')"
+git add -A
+git commit -q -m "second"
+
+compare_all "commit" "HEAD"
+compare_all "two commits" "HEAD~1 HEAD"
+compare_all "two commits reversed" "HEAD HEAD~1"
+compare_all "two trees" "HEAD~1^{tree} HEAD^{tree}"
+compare_all "pathspec" "HEAD -- dir"
+compare_all "pathspecs after commits" "HEAD~1 HEAD dir/sub a.txt"
+
+git commit -q --allow-empty -m "empty"
+compare_all "empty commit" "HEAD"
+
+git checkout -q -b side HEAD~2
+echo "side" > side.txt
+git add side.txt
+git commit -q -m "side"
+git merge -q master -m "merge"
+compare_all "merge commit" "HEAD"
+compare_all "merge commit (-m)" "-m HEAD"
@@ -0,0 +1,81 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    echo "first" > file.txt
+    git add . > /dev/null
+    git commit -q -m "first
+
+with a body"
+    git branch feature
+    git tag v1.0
+    git tag -a -m "annotated" v2.0
+    git pack-refs --all
+
+    export GIT_AUTHOR_DATE="1715030000 -0500"
+    export GIT_COMMITTER_DATE="1715030000 -0500"
+    echo "second" > file.txt
+    git commit -q -a -m "second
+on two lines"
+    git tag -a -m "newer" v3.0
+    git update-ref refs/remotes/origin/master HEAD~
+    git symbolic-ref refs/remotes/origin/HEAD refs/remotes/origin/master
+    git config branch.master.remote origin
+    git config branch.master.merge refs/heads/master
+}
+
+compare() {
+    git for-each-ref "$@" > ../ref_for_each_ref.txt
+    $mygit for-each-ref "$@" > ../got_for_each_ref.txt
+    if ! diff -u ../ref_for_each_ref.txt ../got_for_each_ref.txt; then
+        echo "[KO] for-each-ref $*: output differs"
+        exit 1
+    else
+        echo "[OK] for-each-ref $*: same output"
+    fi
+}
+
+config
+
+mkdir repo && cd repo
+prepare
+
+compare
+compare refs/heads
+compare "refs/tags/v[12]*"
+compare --format="%(refname:short) %(objectname:short) %(HEAD) %(symref)"
+compare --format="%(refname:lstrip=2) %(refname:rstrip=-2) %(objecttype) %(objectsize)"
+compare --format="%(refname) %(upstream) %(upstream:short)" refs/heads
+git config remote.origin.fetch "+refs/heads/*:refs/remotes/origin/*"
+compare --format="%(refname) %(upstream) %(upstream:short)" refs/heads
+git config branch.feature.remote .
+git config branch.feature.merge refs/heads/master
+compare --format="%(refname) %(upstream) %(upstream:short)" refs/heads
+compare --format="%(subject)|%(body)|%(contents:subject)" refs/heads
+compare --format="%(authorname) %(authoremail) %(authordate)" refs/heads
+compare --format="%(committerdate:iso) %(committerdate:unix) %(creatordate:short)"
+compare --format="%(taggername) %(taggerdate:raw) %(*objectname) %(*objecttype) %(*subject)" refs/tags
+compare --format="%%%(refname)%09%41"
+compare --sort=-refname
+compare --sort=committerdate --sort=-objecttype
+compare --sort=-creatordate --count=2
+compare --points-at=HEAD~
+compare --points-at=v2.0 --format="%(refname)"
+
+if $mygit for-each-ref --format="%(unknown)" > /dev/null 2>&1; then
+    echo "[KO] for-each-ref: unknown field accepted"
+    exit 1
+else
+    echo "[OK] for-each-ref: unknown field rejected"
+fi
@@ -0,0 +1,69 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    for i in 1 2 3; do
+        echo "commit $i" >> history.txt
+        git add . > /dev/null
+        git commit -q -m "commit $i"
+    done
+    git repack -adq
+    # dangling blob and commit
+    echo "dangling" | git hash-object -w --stdin > /dev/null
+    git commit-tree -m "dangling" HEAD^{tree} > /dev/null
+}
+
+config
+
+prepare
+
+# git lists dangling objects in hash table order
+git fsck 2>&1 | sort > ref_fsck.txt
+$mygit fsck 2>&1 | sort > got_fsck.txt
+
+diff -u ref_fsck.txt got_fsck.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] fsck: output differs"
+    exit 1
+else
+    echo "[OK] fsck: same output"
+fi
+
+$mygit prune --expire never
+if [ -n "$($mygit prune -n)" ] && [ "$(git count-objects | cut -d' ' -f1)" = "2" ]; then
+    echo "[OK] prune: objects kept until expiry"
+else
+    echo "[KO] prune: objects removed before expiry"
+    exit 1
+fi
+
+$mygit prune
+if [ "$(git count-objects | cut -d' ' -f1)" = "0" ] && git fsck --no-dangling; then
+    echo "[OK] prune: unreachable objects removed"
+else
+    echo "[KO] prune: unreachable objects left"
+    exit 1
+fi
+
+# unsorted tree
+bad_tree=$(printf '100644 b\0%s100644 a\0%s' \
+    "$(git rev-parse HEAD:history.txt | xxd -r -p)" \
+    "$(git rev-parse HEAD:history.txt | xxd -r -p)" | git hash-object -t tree -w --literally --stdin)
+$mygit fsck > /dev/null 2> got_fsck.txt
+if [ $? -ne 0 ] && grep -q "error in tree $bad_tree: treeNotSorted" got_fsck.txt; then
+    echo "[OK] fsck: unsorted tree reported"
+else
+    echo "[KO] fsck: unsorted tree not reported"
+    exit 1
+fi
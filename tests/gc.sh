@@ -0,0 +1,59 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    for i in 1 2 3 4 5; do
+        seq 1 $((i * 100)) > numbers.txt
+        mkdir -p dir
+        echo "commit $i" >> dir/history.txt
+        git add . > /dev/null
+        git commit -q -m "commit $i"
+    done
+    git branch feature HEAD~2
+}
+
+config
+
+prepare
+
+git log --all --format=%H > ref_log.txt
+
+$mygit gc
+
+git log --all --format=%H > got_log.txt
+
+diff -u ref_log.txt got_log.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] gc: history changed"
+    exit 1
+else
+    echo "[OK] gc: same history"
+fi
+
+git fsck --full --no-dangling
+if [ $? -ne 0 ]; then
+    echo "[KO] gc: corrupt repository"
+    exit 1
+else
+    echo "[OK] gc: valid repository"
+fi
+
+loose=$(git count-objects -v | grep "^count:" | cut -d' ' -f2)
+packs=$(git count-objects -v | grep "^packs:" | cut -d' ' -f2)
+if [ "$loose" != "0" ] || [ "$packs" != "1" ]; then
+    echo "[KO] gc: $loose loose objects and $packs packs left"
+    exit 1
+else
+    echo "[OK] gc: no loose objects left, single pack"
+fi
@@ -0,0 +1,65 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    for i in 1 2 3 4 5 6 7 8 9 10; do
+        seq 1 $((i * 100)) > numbers.txt
+        echo "commit $i" >> history.txt
+        git add . > /dev/null
+        git commit -q -m "commit $i"
+    done
+}
+
+config
+
+prepare
+
+# offset deltas
+pack=$(git rev-list --objects HEAD | git pack-objects -q --delta-base-offset ofs)
+cp ofs-$pack.idx ref_ofs.idx
+
+$mygit index-pack -o got_ofs.idx ofs-$pack.pack > got_ofs.txt
+echo $pack > ref_ofs.txt
+
+# reference deltas
+pack=$(git rev-list --objects HEAD | git pack-objects -q ref)
+cp ref-$pack.idx ref_ref.idx
+
+$mygit index-pack -o got_ref.idx ref-$pack.pack > got_ref.txt
+echo $pack > ref_ref.txt
+
+diff -u ref_ofs.txt got_ofs.txt && cmp ref_ofs.idx got_ofs.idx
+if [ $? -ne 0 ]; then
+    echo "[KO] index-pack failed with offset deltas"
+    exit 1
+else
+    echo "[OK] same index with offset deltas"
+fi
+
+diff -u ref_ref.txt got_ref.txt && cmp ref_ref.idx got_ref.idx
+if [ $? -ne 0 ]; then
+    echo "[KO] index-pack failed with reference deltas"
+    exit 1
+else
+    echo "[OK] same index with reference deltas"
+fi
+
+head -c 1000 ref-$pack.pack > truncated.pack
+$mygit index-pack truncated.pack 2> got_error.txt
+if [ $? -eq 0 ] || ! grep -q "truncated" got_error.txt; then
+    echo "[KO] truncated pack not detected"
+    exit 1
+else
+    echo "[OK] truncated pack detected"
+fi
@@ -0,0 +1,248 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+# compare <message> <command>: same output and exit status from git and
+# mygit, run in the repository
+compare() {
+    (cd repo && eval "git $2" > ../ref_merge.txt 2>&1; echo "exit $?" >> ../ref_merge.txt)
+    (cd repo && eval "$mygit $2" > ../got_merge.txt 2>&1; echo "exit $?" >> ../got_merge.txt)
+    if ! cmp -s ref_merge.txt got_merge.txt; then
+        diff -u ref_merge.txt got_merge.txt
+        echo "[KO] $1: output differs"
+        exit 1
+    else
+        echo "[OK] $1: same output"
+    fi
+}
+
+# state: the commits, the index, the status and the merge left to conclude
+state() {
+    git rev-parse HEAD ORIG_HEAD
+    git log --format='%H %P %s' -2
+    git reflog -1
+    git ls-files -s
+    git status
+    git status --porcelain=v2
+    cat .git/MERGE_HEAD .git/MERGE_MSG .git/MERGE_MODE 2> /dev/null
+}
+
+# compare_merge <message> <arguments>: same merge of copies of the
+# repository by git and mygit: output, commits, index and working tree
+compare_merge() {
+    rm -rf ref got && cp -r repo ref && cp -r repo got
+    (cd ref && eval "git merge $2" > ../ref_merge.txt 2>&1; echo "exit $?" >> ../ref_merge.txt; state >> ../ref_merge.txt)
+    (cd got && eval "$mygit merge $2" > ../got_merge.txt 2>&1; echo "exit $?" >> ../got_merge.txt; state >> ../got_merge.txt)
+    if ! cmp -s ref_merge.txt got_merge.txt || ! diff -r --no-dereference -x .git ref got > /dev/null; then
+        diff -u ref_merge.txt got_merge.txt
+        diff -r --no-dereference -x .git ref got
+        echo "[KO] $1: merge differs"
+        exit 1
+    else
+        echo "[OK] $1: same merge"
+    fi
+}
+
+config
+
+git init -q -b master repo && cd repo
+seq 1 30 > a
+echo "b" > b
+echo "file" > df
+echo "type" > type
+echo "deleted" > deleted
+echo "exec" > exec
+echo "binary" > binary
+mkdir d
+echo "f" > d/f
+seq 1 20 > rename-me
+git add .
+git commit -q -m "base"
+git branch ahead
+git branch clean
+git branch conflict
+
+# fast-forward: new, renamed, deleted files and a mode change
+git checkout -q ahead
+echo "new" > new
+chmod +x b
+git mv rename-me renamed
+git rm -q d/f
+git add -A
+git commit -q -m "ahead"
+
+# changes merging without conflicts
+git checkout -q clean
+sed -i 's/^3$/three/' a
+echo "clean" > clean
+git add clean
+git commit -q -a -m "clean"
+
+# every kind of conflict
+git checkout -q conflict
+sed -i 's/^20$/twenty conflict/; s/^5$/five/' a
+rm df && mkdir df && echo "in" > df/x
+rm type && ln -s target type
+echo "modified" > deleted
+chmod +x exec
+printf 'bin\0conflict' > binary
+echo "conflict" > added
+mkdir dir && echo "x" > dir/x
+git add -A
+git commit -q -m "conflict"
+
+git checkout -q master
+sed -i 's/^20$/twenty master/; s/^28$/28 master/' a
+echo "changed" > df
+echo "type master" > type
+git rm -q deleted
+echo "master" > exec
+printf 'bin\0master' > binary
+echo "master" > added
+echo "dir" > dir
+git add -A
+git commit -q -m "master"
+git tag v1 conflict
+
+# criss-cross merges, with two merge bases
+git checkout -q -b cross1 clean~
+echo "cross1" >> a
+git commit -q -a -m "cross1"
+git checkout -q -b cross2 clean~
+sed -i 's/^1$/one/' a
+git commit -q -a -m "cross2"
+git checkout -q cross1
+git merge -q --no-edit cross2 > /dev/null
+echo "cross1" > cross1
+git add cross1
+git commit -q -m "cross1 again"
+git checkout -q cross2
+git merge -q --no-edit cross1~ > /dev/null
+sed -i 's/^30$/thirty/' a
+git commit -q -a -m "cross2 again"
+git checkout -q master
+
+# commit <name> <date> <parents>...: a commit of the tree of HEAD, tagged
+commit() {
+    name=$1 date=$2 parents=""
+    shift 2
+    for parent in "$@"; do
+        parents="$parents -p $parent"
+    done
+    git tag $name $(GIT_COMMITTER_DATE="$date +0200" git commit-tree $parents -m $name HEAD^{tree})
+}
+
+# commit dates going back in time, from skewed clocks: the merge of skew0
+# and skew2 has a redundant merge base, skew0, an ancestor of skew2
+commit skew0 1715028800
+commit skew1 1715028700 skew0
+commit skew2 1715028300 skew1
+commit skew3 1715028100 skew2 skew0
+
+# octo1 and octo2 are both merge bases of octo3 and octo4, and the merge
+# base of octo1 with octo2 is an ancestor of octo2
+commit octo0 1715028000
+commit octo1 1715028100 octo0
+commit octo2 1715028200 octo0
+commit octo3 1715028300 octo1 octo2
+commit octo4 1715028400 octo1 octo2
+
+# lines moved on one side and changed on the other: the lines matched by
+# git's histogram diff make it a conflict, where a Myers diff merges them
+git checkout -q -b moved clean~
+printf '%s\n' g "}" c "}" "x++" g e e e b f "" "" > lines
+git add lines
+git commit -q -m "lines"
+git branch edited
+printf '%s\n' "}" c "}" e e e "x++" g b f "" "" > lines
+git commit -q -a -m "lines moved"
+git checkout -q edited
+printf '%s\n' g "}" c "}" "x++" g e edited e b f "" "" > lines
+git commit -q -a -m "line edited"
+git checkout -q master
+cd ..
+
+compare "merge-base" "merge-base master conflict"
+compare "merge-base --all" "merge-base --all cross1 cross2"
+compare "merge-base of several commits" "merge-base --all master clean conflict"
+compare "merge-base --octopus" "merge-base --octopus master clean conflict"
+compare "merge-base of an ancestor" "merge-base skew2 skew3"
+compare "merge-base with a redundant base" "merge-base --all skew3 skew2 skew1"
+compare "merge-base --octopus with a redundant base" "merge-base --all --octopus octo3 octo4 octo2"
+compare "merge-base unrelated" "merge-base master \$(git commit-tree -m root \$(git write-tree))"
+compare "merge-tree" "merge-tree --write-tree master conflict"
+compare "merge-tree reversed" "merge-tree --write-tree conflict master"
+compare "merge-tree --name-only" "merge-tree --write-tree --name-only master conflict"
+compare "merge-tree --no-messages" "merge-tree --write-tree --no-messages master conflict"
+compare "merge-tree clean" "merge-tree --write-tree master clean"
+compare "merge-tree --messages" "merge-tree --write-tree --messages master clean"
+compare "merge-tree criss-cross" "merge-tree --write-tree cross1 cross2"
+compare "merge-tree of moved lines" "merge-tree --write-tree moved edited"
+
+compare_merge "already up to date" "master~"
+compare_merge "clean merge" "clean"
+compare_merge "merge message" "-m 'Merge clean' clean"
+compare_merge "conflicts" "conflict"
+compare_merge "tag" "v1"
+compare_merge "criss-cross" "cross2"
+(cd repo && git config merge.conflictStyle diff3)
+compare_merge "diff3 conflicts" "conflict"
+(cd repo && git config --unset merge.conflictStyle && git checkout -q conflict)
+compare_merge "reversed conflicts" "master"
+(cd repo && git checkout -q clean~)
+compare_merge "fast-forward" "ahead"
+compare_merge "no fast-forward" "--no-ff ahead"
+compare_merge "merge into a detached HEAD" "master"
+(cd repo && git checkout -q clean)
+compare_merge "merge into a branch" "master"
+(cd repo && git checkout -q moved)
+compare_merge "moved lines" "edited"
+
+# refused merges leave everything as it was
+rm -rf got && cp -r repo got && cd got
+before=$(git rev-parse HEAD && git ls-files -s && git status --porcelain=v2)
+echo "untracked" > new
+if $mygit merge ahead > /dev/null 2>&1 || $mygit merge --ff-only conflict > /dev/null 2>&1 ||
+    [ "$before" != "$(rm new && git rev-parse HEAD && git ls-files -s && git status --porcelain=v2)" ]; then
+    echo "[KO] refused merges: repository changed"
+    exit 1
+else
+    echo "[OK] refused merges: repository unchanged"
+fi
+cd ..
+
+# a merge concluded by a commit, and an aborted merge
+(cd repo && git checkout -q master)
+rm -rf ref got && cp -r repo ref && cp -r repo got
+for tool in git $mygit; do
+    [ $tool = git ] && dir=ref || dir=got
+    (cd $dir && $tool merge conflict
+    $tool merge conflict
+    seq 1 10 > a && rm -f type && echo "resolved" > type && rm df~HEAD dir~HEAD type~HEAD
+    $tool add a type binary deleted added df~HEAD dir~HEAD type~HEAD
+    $tool status --short
+    $tool commit -m "merged" | sed 's/^\[[^]]*\]//'
+    git log --format='%H %P %s' -1
+    git reflog -1
+    ls .git/MERGE_HEAD
+    $tool merge cross2
+    $tool merge --abort
+    git status --porcelain=v2
+    $tool merge --abort) > $dir.txt 2> /dev/null
+done
+if ! cmp -s ref.txt got.txt || ! diff -r --no-dereference -x .git ref got > /dev/null; then
+    diff -u ref.txt got.txt
+    echo "[KO] commit and abort: merge differs"
+    exit 1
+else
+    echo "[OK] commit and abort: same merge"
+fi
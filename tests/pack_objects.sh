@@ -0,0 +1,56 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    for i in 1 2 3 4 5 6 7 8 9 10; do
+        seq 1 $((i * 100)) > numbers.txt
+        echo "commit $i" >> history.txt
+        git add . > /dev/null
+        git commit -q -m "commit $i"
+    done
+}
+
+config
+
+prepare
+
+git rev-list --objects HEAD > objects.txt
+cut -d' ' -f1 objects.txt | sort > ref_objects.txt
+
+for option in "" "--delta-base-offset"; do
+    rm -rf got
+    mkdir got
+    pack=$($mygit pack-objects $option got/pack < objects.txt)
+
+    git verify-pack got/pack-$pack.idx
+    if [ $? -ne 0 ]; then
+        echo "[KO] pack-objects $option: invalid pack"
+        exit 1
+    fi
+
+    git show-index < got/pack-$pack.idx | cut -d' ' -f2 | sort > got_objects.txt
+    diff -u ref_objects.txt got_objects.txt
+    if [ $? -ne 0 ]; then
+        echo "[KO] pack-objects $option: wrong objects"
+        exit 1
+    fi
+
+    deltas=$(git verify-pack -v got/pack-$pack.idx | grep -c "chain length")
+    if [ $deltas -eq 0 ]; then
+        echo "[KO] pack-objects $option: no deltas"
+        exit 1
+    fi
+
+    echo "[OK] pack-objects $option: valid pack with deltas"
+done
@@ -0,0 +1,101 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    echo "first" > file.txt
+    git add . > /dev/null
+    git commit -q -m "first"
+    git tag v1.0
+    git tag -a -m "release 1.1" v1.1
+    git branch feature
+    echo "second" > file.txt
+    git add . > /dev/null
+    git commit -q -m "second"
+    git branch topic/nested
+}
+
+config
+
+prepare
+
+# refs only in packed-refs, as left by git gc
+git pack-refs --all
+if [ -e .git/refs/heads/master ] || [ -e .git/refs/tags/v1.0 ]; then
+    echo "[KO] git pack-refs left loose refs"
+    exit 1
+fi
+
+git branch > ref_branch.txt
+$mygit branch > got_branch.txt
+git tag > ref_tag.txt
+$mygit tag > got_tag.txt
+git rev-parse feature v1.0 v1.1 'v1.1^{}' master~1 > ref_rev.txt
+$mygit rev-parse feature v1.0 v1.1 'v1.1^{}' master~1 > got_rev.txt
+# log formats differ, the commits walked are the same
+git log --format="commit %H" > ref_log.txt
+$mygit log | grep "^commit " > got_log.txt
+for name in branch tag rev log; do
+    if ! diff -u ref_$name.txt got_$name.txt; then
+        echo "[KO] packed refs: $name output differs"
+        exit 1
+    fi
+done
+echo "[OK] packed refs are read"
+
+# loose refs take precedence over packed ones
+$mygit branch -f feature master
+if [ "$($mygit rev-parse feature)" != "$(git rev-parse master)" ] ||
+    [ "$(git rev-parse feature)" != "$(git rev-parse master)" ]; then
+    echo "[KO] loose ref does not override packed ref"
+    exit 1
+else
+    echo "[OK] loose ref overrides packed ref"
+fi
+
+# deleting a packed ref
+$mygit tag -d v1.0 > /dev/null
+if git rev-parse -q --verify refs/tags/v1.0 > /dev/null || grep -q v1.0 .git/packed-refs; then
+    echo "[KO] packed tag not deleted"
+    exit 1
+else
+    echo "[OK] packed tag deleted"
+fi
+
+# pack-refs --all, readable by git
+git show-ref > ref_show_ref.txt
+$mygit pack-refs --all
+git show-ref > got_show_ref.txt
+if [ -n "$(find .git/refs -type f)" ] || ! diff -u ref_show_ref.txt got_show_ref.txt; then
+    echo "[KO] pack-refs --all: refs differ or loose refs left"
+    exit 1
+else
+    echo "[OK] pack-refs --all: every ref packed"
+fi
+
+# same packed-refs file as git, peeled lines included
+cp .git/packed-refs got_packed_refs.txt
+git pack-refs --all
+if ! diff -u .git/packed-refs got_packed_refs.txt; then
+    echo "[KO] pack-refs: packed-refs differs from git"
+    exit 1
+else
+    echo "[OK] pack-refs: same packed-refs as git"
+fi
+
+if ! git fsck --no-dangling > /dev/null 2>&1; then
+    echo "[KO] git fsck failed"
+    exit 1
+else
+    echo "[OK] git fsck passed"
+fi
@@ -0,0 +1,126 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028260 +0200"
+
+    export GIT_EDITOR=true
+}
+
+# state: the commits of every branch, the reflogs, the index, the status and
+# the rebase left to conclude
+state() {
+    git log --format='%H %P %an <%ae> %ad %s' -6 --all
+    git log --format=%B -1
+    git reflog -8
+    git reflog side -2
+    git ls-files -s
+    git status
+    git status --porcelain=v2
+    ls .git | grep "HEAD\|MSG\|rebase"
+    cat .git/REBASE_HEAD .git/MERGE_MSG 2> /dev/null
+    for file in head-name onto orig-head git-rebase-todo done msgnum end stopped-sha message amend; do
+        cat .git/rebase-merge/$file 2> /dev/null
+    done
+}
+
+# compare_rebase <message> <commands>: same commands run by git and mygit,
+# as $tool, on copies of the repository: output, commits, index and working
+# tree
+compare_rebase() {
+    rm -rf ref got && cp -r repo ref && cp -r repo got
+    (cd ref && tool=git && eval "$2" > ../ref_rebase.txt 2>&1; echo "exit $?" >> ../ref_rebase.txt; state >> ../ref_rebase.txt)
+    (cd got && tool=$mygit && eval "$2" > ../got_rebase.txt 2>&1; echo "exit $?" >> ../got_rebase.txt; state >> ../got_rebase.txt)
+    if ! cmp -s ref_rebase.txt got_rebase.txt || ! diff -r --no-dereference -x .git ref got > /dev/null; then
+        diff -u ref_rebase.txt got_rebase.txt
+        diff -r --no-dereference -x .git ref got
+        echo "[KO] $1: differs"
+        exit 1
+    else
+        echo "[OK] $1: same result"
+    fi
+}
+
+config
+
+git init -q -b master repo && cd repo
+seq 1 10 > a
+echo "b" > b
+git add .
+git commit -q -m "base"
+
+# side: commits of another author, one already cherry-picked on master, one
+# conflicting with master
+git checkout -q -b side
+sed -i 's/^3$/three/' a
+GIT_AUTHOR_NAME=other GIT_AUTHOR_EMAIL=other@example.com git commit -q -a -m "three"
+sed -i 's/^5$/five/' a
+git commit -q -a -m "five
+
+with a body"
+echo "x" > x
+git add x
+git commit -q -m "x"
+git mv b bb
+git commit -q -m "rename b"
+sed -i 's/^8$/EIGHT/' a
+git commit -q -a -m "EIGHT"
+
+git checkout -q master
+sed -i 's/^8$/eight/' a
+git commit -q -a -m "eight"
+echo "x" > x
+git add x
+git commit -q -m "x again"
+git checkout -q side
+cd ..
+
+compare_rebase "conflict" '$tool rebase master'
+compare_rebase "conflict concluded" '$tool rebase master; seq 1 10 > a; git add a; $tool rebase --continue'
+compare_rebase "commit skipped" '$tool rebase master; $tool rebase --skip'
+compare_rebase "rebase aborted" '$tool rebase master; $tool rebase --abort'
+compare_rebase "rebase without conflicts" '$tool rebase master~1'
+compare_rebase "up to date" '$tool rebase side~2'
+compare_rebase "detached HEAD" 'git checkout -q --detach; $tool rebase master~1'
+
+# interactive rebases, with the todo list edited by sed
+compare_rebase "interactive rebase" 'GIT_SEQUENCE_EDITOR=: $tool rebase -i master~1'
+compare_rebase "squash and fixup" \
+    'GIT_SEQUENCE_EDITOR="sed -i -e 2s/^pick/squash/ -e 3s/^pick/fixup/" $tool rebase -i master~1'
+compare_rebase "fixups" 'GIT_SEQUENCE_EDITOR="sed -i -e 2s/^pick/fixup/ -e 3s/^pick/f/" $tool rebase -i master~1'
+compare_rebase "reword" \
+    'GIT_SEQUENCE_EDITOR="sed -i 2s/^pick/reword/" GIT_EDITOR="sed -i s/five/FIVE/" $tool rebase -i master~1'
+compare_rebase "drop" 'GIT_SEQUENCE_EDITOR="sed -i 2d" $tool rebase -i master~1'
+compare_rebase "edit" 'GIT_SEQUENCE_EDITOR="sed -i 2s/^pick/edit/" $tool rebase -i master~1'
+compare_rebase "edit amended" 'GIT_SEQUENCE_EDITOR="sed -i 2s/^pick/edit/" $tool rebase -i master~1;
+    echo "y" > y; git add y; $tool rebase --continue'
+compare_rebase "todo edited" 'GIT_SEQUENCE_EDITOR="sed -i 2s/^pick/edit/" $tool rebase -i master~1;
+    GIT_SEQUENCE_EDITOR="sed -i 1d" $tool rebase --edit-todo; $tool status; $tool rebase --continue'
+compare_rebase "exec and break" \
+    'GIT_SEQUENCE_EDITOR="sed -i -e \"2i exec echo run\" -e \"3i break\"" $tool rebase -i master~1;
+    $tool status; $tool rebase --continue'
+compare_rebase "failed exec" 'GIT_SEQUENCE_EDITOR="sed -i \"1i exec false\"" $tool rebase -i master~1;
+    $tool status; $tool rebase --continue'
+compare_rebase "squash conflict" 'GIT_SEQUENCE_EDITOR="sed -i 4s/^pick/squash/" $tool rebase -i master;
+    $tool status; seq 1 10 > a; git add a; $tool rebase --continue'
+compare_rebase "empty commit" 'git checkout -q -b up master~2; echo x > x; echo y > y; git add x y;
+    git commit -q -m "x and y"; git checkout -q side; $tool rebase -i up; $tool status; $tool rebase --continue'
+
+# refused rebases leave everything as it was
+rm -rf got && cp -r repo got && cd got
+echo "changed" >> a
+before=$(git rev-parse HEAD && git ls-files -s && git status --porcelain=v2)
+if $mygit rebase master > /dev/null 2>&1 || (git add a && $mygit rebase master > /dev/null 2>&1) ||
+    [ "$before" != "$(git reset -q && git rev-parse HEAD && git ls-files -s && git status --porcelain=v2)" ]; then
+    echo "[KO] refused rebases: repository changed"
+    exit 1
+else
+    echo "[OK] refused rebases: repository unchanged"
+fi
+cd ..
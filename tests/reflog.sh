@@ -0,0 +1,104 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+# run <git|mygit>: same history and ref moves in ./<git|mygit>
+run() {
+    mkdir $1 && cd $1
+    git init > /dev/null 2>&1
+    echo "first" > file.txt
+    if [ $1 = git ]; then
+        git add . > /dev/null
+        git commit -q -m "first"
+    else
+        $mygit add . > /dev/null
+        $mygit commit -m "first" > /dev/null
+    fi
+    export GIT_COMMITTER_DATE="1715028260 +0200"
+    echo "second" > file.txt
+    if [ $1 = git ]; then
+        git add . > /dev/null
+        git commit -q -m "second"
+    else
+        $mygit add . > /dev/null
+        $mygit commit -m "second" > /dev/null
+    fi
+    export GIT_COMMITTER_DATE="1715028270 +0200"
+    ${1%git}git branch feature HEAD~1
+    ${1%git}git switch feature > /dev/null 2>&1
+    ${1%git}git checkout master > /dev/null 2>&1
+    ${1%git}git checkout HEAD~1 > /dev/null 2>&1
+    ${1%git}git switch master > /dev/null 2>&1
+    ${1%git}git update-ref -m "manual  update" refs/heads/feature master
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+    cd ..
+}
+
+config
+
+mygit=${mygit:-mygit}
+run git
+run mygit
+
+for log in HEAD refs/heads/master refs/heads/feature; do
+    if ! diff -u git/.git/logs/$log mygit/.git/logs/$log; then
+        echo "[KO] reflog: $log differs"
+        exit 1
+    fi
+done
+echo "[OK] reflog: same entries as git"
+
+cd mygit
+
+revisions="master@{1} HEAD@{2} @{1} feature@{0} feature@{1} @{-1} HEAD@{1715028265} master@{2024-05-06}"
+git rev-parse $revisions > ../ref_rev.txt 2> /dev/null
+$mygit rev-parse $revisions > ../got_rev.txt 2> /dev/null
+if ! diff -u ../ref_rev.txt ../got_rev.txt; then
+    echo "[KO] reflog revisions: output differs"
+    exit 1
+else
+    echo "[OK] reflog revisions: same output"
+fi
+
+for ref in "" master feature; do
+    git reflog show $ref > ../ref_show.txt
+    $mygit reflog show $ref > ../got_show.txt
+    if ! diff -u ../ref_show.txt ../got_show.txt; then
+        echo "[KO] reflog show $ref: output differs"
+        exit 1
+    fi
+done
+echo "[OK] reflog show: same output"
+
+cd ../git
+git reflog delete HEAD@{1} HEAD@{3}
+git reflog expire --expire=1715028265 master
+cd ../mygit
+$mygit reflog delete HEAD@{1} HEAD@{3}
+$mygit reflog expire --expire=1715028265 master
+cd ..
+for log in HEAD refs/heads/master; do
+    if ! diff -u git/.git/logs/$log mygit/.git/logs/$log; then
+        echo "[KO] reflog delete, expire: $log differs"
+        exit 1
+    fi
+done
+echo "[OK] reflog delete, expire: same entries as git"
+
+cd mygit
+$mygit branch -D feature > /dev/null
+if [ -e .git/logs/refs/heads/feature ]; then
+    echo "[KO] branch -D: reflog not deleted"
+    exit 1
+else
+    echo "[OK] branch -D: reflog deleted"
+fi
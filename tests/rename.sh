@@ -0,0 +1,148 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+# compare <message> <command>: same output from git and mygit
+compare() {
+    eval "git $2" > ../ref_rename.txt 2>/dev/null
+    eval "$mygit $2" > ../got_rename.txt 2>/dev/null
+    if ! cmp -s ../ref_rename.txt ../got_rename.txt; then
+        diff -u ../ref_rename.txt ../got_rename.txt | cat -A
+        echo "[KO] $1: output differs"
+        exit 1
+    else
+        echo "[OK] $1: same output"
+    fi
+}
+
+# compare_log <message> <arguments>: same commits listed by git and mygit
+compare_log() {
+    eval "git log --format=%H $2" > ../ref_rename.txt 2>/dev/null
+    eval "$mygit log $2" 2>/dev/null | sed -n 's/^commit //p' > ../got_rename.txt
+    if ! cmp -s ../ref_rename.txt ../got_rename.txt; then
+        diff -u ../ref_rename.txt ../got_rename.txt
+        echo "[KO] $1: commits differ"
+        exit 1
+    else
+        echo "[OK] $1: same commits"
+    fi
+}
+
+# compare_diffs <message> <arguments>: same diff and diff-tree output in
+# the formats that show renames
+compare_diffs() {
+    compare "$1 (diff)" "diff $2"
+    compare "$1 (diff --stat)" "diff --stat $2"
+    compare "$1 (diff --name-status)" "diff --name-status $2"
+    compare "$1 (diff -C --name-status)" "diff -C --name-status $2"
+    compare "$1 (diff --no-renames --name-status)" "diff --no-renames --name-status $2"
+    compare "$1 (diff -M90% --name-status)" "diff -M90% --name-status $2"
+    compare "$1 (diff-tree -r)" "diff-tree -r $2"
+    compare "$1 (diff-tree -r -M)" "diff-tree -r -M $2"
+    compare "$1 (diff-tree -M)" "diff-tree -M $2"
+    compare "$1 (diff-tree -r -M -z)" "diff-tree -r -M -z $2"
+    compare "$1 (diff-tree -r -C)" "diff-tree -r -C $2"
+    compare "$1 (diff-tree -r -M3)" "diff-tree -r -M3 $2"
+}
+
+# compare_status <message>: same status in every format
+compare_status() {
+    compare "$1 (long)" "status"
+    compare "$1 (short)" "status --short"
+    compare "$1 (porcelain)" "status --porcelain"
+    compare "$1 (porcelain -z)" "status --porcelain -z"
+    compare "$1 (porcelain v2)" "status --porcelain=v2"
+    compare "$1 (porcelain v2 -z)" "status --porcelain=v2 -z"
+    compare "$1 (no renames)" "status --short --no-renames"
+    compare "$1 (find renames 95%)" "status --short --find-renames=95"
+}
+
+config
+
+mkdir repo && cd repo
+git init -q -b master
+
+seq 1 50 > a
+seq 100 140 > b
+mkdir -p d/e
+seq 200 230 > d/e/x
+seq 300 330 > same
+echo "small" > small
+echo "one" > dup1
+echo "one" > dup2
+echo "target" > target
+ln -s target link
+git add .
+git commit -q -m "first"
+
+# exact renames, a renamed directory, a rename with changes, a rename
+# with a space, a copy, a deleted file
+git mv a a2
+seq 1 48 > a2
+mv b "b b"
+git mv d/e d/f
+cp same same.copy
+echo "added" >> same
+git rm -q small
+git mv dup1 dup3
+git mv link link2
+git add -A
+git commit -q -m "renames"
+
+compare_diffs "renames" "HEAD~ HEAD"
+
+# renames between the index and the working tree are not looked for,
+# added files not being compared
+git mv a2 a3
+compare_diffs "index and HEAD" "--cached HEAD"
+compare "index and working tree (name-status)" "diff --name-status"
+compare_status "staged rename"
+
+echo "more" >> a3
+git mv "b b" "c c"
+git mv same.copy same.renamed
+echo "new" > new
+git add new
+compare_status "staged renames with changes"
+
+git config status.renames copies
+echo "copy" >> same
+cp same same2
+git add same same2
+compare_status "copies"
+git config status.renames false
+compare_status "renames turned off"
+git config --unset status.renames
+git commit -q -m "more renames"
+
+# history of a file across renames
+seq 1 60 > a3
+git commit -q -a -m "change a3"
+mkdir g
+git mv a3 g/a4
+git commit -q -m "move a3"
+git checkout -q -b side HEAD~2
+echo "side" > side
+git add side
+git commit -q -m "side"
+git checkout -q master
+git merge -q --no-edit side
+echo "last" >> g/a4
+git commit -q -a -m "last"
+
+compare_log "follow" "--follow g/a4"
+compare_log "follow after --" "--follow -- g/a4"
+compare_log "follow from a revision" "--follow HEAD~2 g/a4"
+compare_log "path without follow" "g/a4"
+compare_log "renamed path" "-- a3"
+compare_log "merged path" "-- side"
+compare_log "copied file" "--follow same2"
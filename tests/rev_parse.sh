@@ -0,0 +1,126 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    for i in $(seq 1 100); do
+        echo "$i" > file.txt
+        git add . > /dev/null
+        git commit -q -m "commit $i"
+    done
+    git repack -dq
+}
+
+config
+
+prepare
+
+git rev-list --all --objects | cut -c1-40 > objects.txt
+
+for object in $(cat objects.txt); do
+    git rev-parse --short $object
+done > ref_short.txt
+for object in $(cat objects.txt); do
+    $mygit rev-parse --short $object
+done > got_short.txt
+
+diff -u ref_short.txt got_short.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] rev-parse --short: output differs"
+    exit 1
+else
+    echo "[OK] rev-parse --short: same output"
+fi
+
+# a prefix shared by several objects
+prefix=$(cut -c1-4 objects.txt | sort | uniq -d | head -1)
+git rev-parse --disambiguate=$prefix > ref_disambiguate.txt
+$mygit rev-parse --disambiguate=$prefix > got_disambiguate.txt
+
+diff -u ref_disambiguate.txt got_disambiguate.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] rev-parse --disambiguate: output differs"
+    exit 1
+else
+    echo "[OK] rev-parse --disambiguate: same output"
+fi
+
+if $mygit cat-file -t $prefix 2> got_error.txt ||
+    ! grep -q "ambiguous" got_error.txt; then
+    echo "[KO] cat-file: ambiguous prefix accepted"
+    exit 1
+else
+    echo "[OK] cat-file: ambiguous prefix rejected"
+fi
+
+short_head=$(git rev-parse --short HEAD)
+short_tree=$(git rev-parse --short HEAD^{tree})
+commit=$($mygit commit-tree $short_tree -p $short_head -m "abbreviated")
+if [ "$(git rev-parse $commit^{tree})" != "$(git rev-parse HEAD^{tree})" ] ||
+    [ "$(git rev-parse $commit^)" != "$(git rev-parse HEAD)" ]; then
+    echo "[KO] commit-tree: abbreviated object IDs not resolved"
+    exit 1
+else
+    echo "[OK] commit-tree: abbreviated object IDs resolved"
+fi
+
+$mygit log $short_head > got_log.txt
+$mygit log $(git rev-parse HEAD) > ref_log.txt
+diff -u ref_log.txt got_log.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] log: abbreviated object ID not resolved"
+    exit 1
+else
+    echo "[OK] log: abbreviated object ID resolved"
+fi
+
+git branch feature HEAD~10
+git checkout -q feature
+echo "feature" > feature.txt
+git add . > /dev/null
+git commit -q -m "feature"
+git tag -a -m "annotated" v1.0 HEAD~2
+git checkout -q master
+git merge -q --no-ff -m "merge" feature
+
+# rev_parse <command>: resolves every revision with the given git command
+rev_parse() {
+    for revision in HEAD @ master heads/master refs/heads/master v1.0 \
+        'v1.0^{}' 'v1.0^{tag}' 'v1.0^{commit}' 'v1.0^{tree}' HEAD~3 HEAD^2 'HEAD^^' \
+        'HEAD~2^0' 'HEAD^2~1' HEAD: HEAD:file.txt 'master~1:file.txt' 'HEAD^{tree}:file.txt' \
+        @{-1} master..feature feature..master master...feature ..feature ^feature; do
+        echo "$revision"
+        $1 rev-parse "$revision"
+    done
+}
+
+rev_parse git > ref_revisions.txt
+rev_parse $mygit > got_revisions.txt
+
+diff -u ref_revisions.txt got_revisions.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] rev-parse: revisions differ"
+    exit 1
+else
+    echo "[OK] rev-parse: same revisions"
+fi
+
+git log --format="commit %H" feature..master | sort > ref_log.txt
+$mygit log feature..master | grep "^commit" | sort > got_log.txt
+diff -u ref_log.txt got_log.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] log: range differs"
+    exit 1
+else
+    echo "[OK] log: same range"
+fi
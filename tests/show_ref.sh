@@ -0,0 +1,73 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    echo "first" > file.txt
+    git add . > /dev/null
+    git commit -q -m "first"
+    git branch feature
+    git branch topic/master
+    git tag v1.0
+    git tag -a -m "annotated" v2.0
+    git pack-refs --all
+    echo "second" > file.txt
+    git commit -q -a -m "second"
+    git update-ref refs/remotes/origin/master HEAD
+}
+
+compare() {
+    git show-ref "$@" > ../ref_show_ref.txt
+    ref_status=$?
+    $mygit show-ref "$@" > ../got_show_ref.txt
+    got_status=$?
+    if [ $ref_status != $got_status ] || ! diff -u ../ref_show_ref.txt ../got_show_ref.txt; then
+        echo "[KO] show-ref $*: output differs"
+        exit 1
+    else
+        echo "[OK] show-ref $*: same output"
+    fi
+}
+
+config
+
+mkdir repo && cd repo
+prepare
+
+compare
+compare --head
+compare --heads
+compare --tags
+compare -d
+compare --hash
+compare --hash --abbrev=10 --tags
+compare master
+compare -d master v2.0
+compare unknown
+compare --verify refs/heads/master refs/tags/v2.0
+compare --verify HEAD
+
+if $mygit show-ref --verify master > /dev/null 2>&1; then
+    echo "[KO] show-ref --verify: short name accepted"
+    exit 1
+else
+    echo "[OK] show-ref --verify: short name rejected"
+fi
+
+if [ -n "$($mygit show-ref --verify -q refs/heads/unknown 2>&1)" ] ||
+    $mygit show-ref --verify -q refs/heads/unknown; then
+    echo "[KO] show-ref --verify -q: not quiet"
+    exit 1
+else
+    echo "[OK] show-ref --verify -q: quiet"
+fi
@@ -0,0 +1,146 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+# compare <message> <arguments>: same status output from git and mygit,
+# mygit running first so that it finds the index stat data stale
+compare() {
+    eval "$mygit status $2" > ../got_status.txt 2>&1
+    eval "git status $2" > ../ref_status.txt 2>&1
+    if ! cmp -s ../ref_status.txt ../got_status.txt; then
+        diff -u ../ref_status.txt ../got_status.txt | cat -A
+        echo "[KO] $1: status differs"
+        exit 1
+    else
+        echo "[OK] $1: same status"
+    fi
+}
+
+# compare_all <message>: same status in every format
+compare_all() {
+    compare "$1 (long)" ""
+    compare "$1 (short)" "-s -b"
+    compare "$1 (porcelain v1)" "--porcelain -b"
+    compare "$1 (porcelain v2)" "--porcelain=v2 -b"
+    compare "$1 (porcelain v2 -z)" "--porcelain=v2 -b -z"
+    compare "$1 (ignored)" "--ignored"
+    compare "$1 (untracked files)" "-s --untracked-files=all --ignored"
+    compare "$1 (no untracked files)" "--untracked-files=no"
+}
+
+config
+
+mkdir repo && cd repo
+git init -q -b master
+printf "*.log\nbuild/\n!keep.log\n" > .gitignore
+printf "*.tmp\n" > .git/info/exclude
+
+compare_all "empty repository"
+
+echo "hello" > hello.txt
+mkdir -p dir/sub
+echo "a" > dir/a.c
+echo "b" > dir/sub/b.c
+$mygit add . > /dev/null
+compare_all "initial commit"
+
+$mygit commit -m "first" > /dev/null
+compare_all "clean working tree"
+
+echo "changed" >> hello.txt
+echo "new" > new.txt
+rm dir/a.c
+mkdir -p untracked/deep
+echo "u" > untracked/deep/u.txt
+echo "log" > debug.log
+echo "keep" > keep.log
+echo "tmp" > dir/sub/x.tmp
+mkdir -p build ignored_only
+echo "o" > build/out.o
+echo "l" > ignored_only/trace.log
+mkdir empty
+echo "space" > "with space.txt"
+compare_all "unstaged changes"
+
+$mygit add hello.txt new.txt > /dev/null
+echo "again" >> hello.txt
+chmod +x dir/sub/b.c
+compare_all "staged and unstaged changes"
+
+git add dir/sub/b.c
+compare_all "mode change staged"
+
+rm hello.txt
+ln -s new.txt hello.txt
+compare_all "type change"
+rm hello.txt
+echo "hello" > hello.txt
+echo "changed" >> hello.txt
+echo "again" >> hello.txt
+
+git commit -q -a -m "second"
+git branch -q upstream HEAD~1
+git config branch.master.remote .
+git config branch.master.merge refs/heads/upstream
+compare_all "ahead of upstream"
+
+git branch -q -f upstream master
+git checkout -q upstream
+echo "upstream" > upstream.txt
+git add upstream.txt
+git commit -q -m "upstream"
+git checkout -q master
+compare_all "behind upstream"
+
+echo "master" > master.txt
+git add master.txt
+git commit -q -m "master"
+compare_all "diverged from upstream"
+
+git branch -q -D upstream
+compare_all "upstream gone"
+
+git checkout -q HEAD~1
+compare_all "detached HEAD at a commit"
+git checkout -q -b tmp && git checkout -q master && git checkout -q tmp~0
+git tag v1.0 master
+git checkout -q v1.0
+compare_all "detached HEAD at a tag"
+git commit -q --allow-empty -m "detached"
+compare_all "detached HEAD from a tag"
+git checkout -q master
+
+# conflicts straight in the index: stages 1 (base), 2 (ours), 3 (theirs)
+base=$(echo base | git hash-object -w --stdin)
+ours=$(echo ours | git hash-object -w --stdin)
+theirs=$(echo theirs | git hash-object -w --stdin)
+{
+    printf "0 0000000000000000000000000000000000000000\tmaster.txt\n"
+    printf "100644 $base 1\tmaster.txt\n"
+    printf "100644 $ours 2\tmaster.txt\n"
+    printf "100644 $theirs 3\tmaster.txt\n"
+    printf "100644 $ours 2\tadded_by_us.txt\n"
+    printf "100644 $base 1\tdeleted_by_them.txt\n"
+    printf "100644 $ours 2\tdeleted_by_them.txt\n"
+    printf "100644 $ours 2\tboth_added.txt\n"
+    printf "100644 $theirs 3\tboth_added.txt\n"
+} | git update-index --index-info
+echo "conflict" > both_added.txt
+compare_all "unmerged paths"
+
+{
+    printf "0 0000000000000000000000000000000000000000\tadded_by_us.txt\n"
+    printf "0 0000000000000000000000000000000000000000\tdeleted_by_them.txt\n"
+    printf "0 0000000000000000000000000000000000000000\tboth_added.txt\n"
+    printf "100644 $base 1\tboth_deleted.txt\n"
+} | git update-index --index-info
+compare_all "unmerged paths, both deleted"
@@ -0,0 +1,88 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    echo "first" > file.txt
+    git add . > /dev/null
+    git commit -q -m "first"
+    git branch feature
+    git tag v1.0
+}
+
+config
+
+prepare
+
+git symbolic-ref HEAD > ref_read.txt
+git symbolic-ref --short HEAD >> ref_read.txt
+$mygit symbolic-ref HEAD > got_read.txt
+$mygit symbolic-ref --short HEAD >> got_read.txt
+if ! diff -u ref_read.txt got_read.txt; then
+    echo "[KO] symbolic-ref: output differs"
+    exit 1
+else
+    echo "[OK] symbolic-ref: same output"
+fi
+
+$mygit symbolic-ref -m "to feature" HEAD refs/heads/feature
+if [ "$(git symbolic-ref HEAD)" != "refs/heads/feature" ] ||
+    ! tail -1 .git/logs/HEAD | grep -q "	to feature$"; then
+    echo "[KO] symbolic-ref: HEAD not updated"
+    exit 1
+else
+    echo "[OK] symbolic-ref: HEAD updated"
+fi
+
+# symbolic refs pointing to symbolic refs
+$mygit symbolic-ref refs/heads/alias refs/heads/master
+$mygit symbolic-ref refs/heads/alias2 refs/heads/alias
+if [ "$($mygit symbolic-ref refs/heads/alias2)" != "$(git symbolic-ref refs/heads/alias2)" ] ||
+    [ "$($mygit rev-parse alias2)" != "$(git rev-parse master)" ]; then
+    echo "[KO] symbolic-ref: chain not followed"
+    exit 1
+else
+    echo "[OK] symbolic-ref: chain followed"
+fi
+
+if $mygit symbolic-ref refs/heads/master refs/heads/alias2 2> /dev/null ||
+    [ "$(git rev-parse master)" != "$(git rev-parse feature)" ]; then
+    echo "[KO] symbolic-ref: cycle created"
+    exit 1
+fi
+# a cycle made behind our back
+echo "ref: refs/heads/alias2" > .git/refs/heads/alias
+if $mygit rev-parse alias > /dev/null 2>&1; then
+    echo "[KO] symbolic-ref: cycle resolved"
+    exit 1
+else
+    echo "[OK] symbolic-ref: cycles detected"
+fi
+echo "ref: refs/heads/master" > .git/refs/heads/alias
+
+$mygit symbolic-ref -q refs/heads/master
+if [ $? -ne 1 ] || [ -n "$($mygit symbolic-ref -q refs/heads/master 2>&1)" ]; then
+    echo "[KO] symbolic-ref -q: wrong status or output"
+    exit 1
+else
+    echo "[OK] symbolic-ref -q: quiet on refs that are not symbolic"
+fi
+
+$mygit symbolic-ref --delete refs/heads/alias2
+if [ -e .git/refs/heads/alias2 ] || $mygit symbolic-ref --delete HEAD 2> /dev/null ||
+    $mygit symbolic-ref --delete refs/heads/master 2> /dev/null; then
+    echo "[KO] symbolic-ref --delete: wrong ref deleted"
+    exit 1
+else
+    echo "[OK] symbolic-ref --delete: only symbolic refs deleted"
+fi
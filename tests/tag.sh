@@ -0,0 +1,92 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    echo "first" > file.txt
+    git add . > /dev/null
+    git commit -q -m "first"
+}
+
+config
+
+prepare
+
+git tag -a -m "release 1.0" ref-v1.0
+$mygit tag -a -m "release 1.0" v1.0
+
+ref_oid=$(git rev-parse ref-v1.0)
+got_oid=$(git rev-parse v1.0)
+git cat-file -p $ref_oid | sed 's/ref-v1.0/v1.0/' > ref_tag.txt
+$mygit cat-file -p $got_oid > got_tag.txt
+
+diff -u ref_tag.txt got_tag.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] tag -a: tag object differs"
+    exit 1
+else
+    echo "[OK] tag -a: same tag object"
+fi
+
+git tag -a -m "release 1.1
+" ref-v1.1
+$mygit tag -a -m "release 1.1
+" v1.1
+git cat-file -p ref-v1.1 | sed 's/ref-v1.1/v1.1/' > ref_tag.txt
+$mygit cat-file -p v1.1 > got_tag.txt
+diff -u ref_tag.txt got_tag.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] tag -m: message newline differs"
+    exit 1
+else
+    echo "[OK] tag -m: same message newline"
+fi
+
+$mygit tag v1.0-light
+$mygit tag -m "nested" v1.0-nested v1.0
+git fsck --no-dangling
+if [ $? -ne 0 ] || [ "$(git rev-parse v1.0-light)" != "$(git rev-parse HEAD)" ] ||
+    [ "$(git rev-parse v1.0-nested^{commit})" != "$(git rev-parse HEAD)" ]; then
+    echo "[KO] tag: invalid tags"
+    exit 1
+else
+    echo "[OK] tag: lightweight and nested tags"
+fi
+
+$mygit log $got_oid > got_log.txt
+$mygit log $(git rev-parse HEAD) > ref_log.txt
+diff -u ref_log.txt got_log.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] log: tag not peeled"
+    exit 1
+else
+    echo "[OK] log: tag peeled to its commit"
+fi
+
+git tag -l 'v*' > ref_list.txt
+$mygit tag -l 'v*' > got_list.txt
+diff -u ref_list.txt got_list.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] tag -l: list differs"
+    exit 1
+else
+    echo "[OK] tag -l: same list"
+fi
+
+$mygit tag -d v1.0-light > /dev/null
+if git rev-parse -q --verify v1.0-light > /dev/null; then
+    echo "[KO] tag -d: tag not deleted"
+    exit 1
+else
+    echo "[OK] tag -d: tag deleted"
+fi
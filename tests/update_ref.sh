@@ -0,0 +1,121 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    mkdir repo && cd repo
+    git init > /dev/null 2>&1
+    echo "first" > file.txt
+    git add . > /dev/null
+    git commit -q -m "first"
+    echo "second" > file.txt
+    git add . > /dev/null
+    git commit -q -m "second"
+    git branch packed HEAD~1
+    git pack-refs --all
+}
+
+config
+
+prepare
+
+first=$(git rev-parse HEAD~1)
+second=$(git rev-parse HEAD)
+
+$mygit update-ref refs/heads/feature HEAD~1
+if [ "$(git rev-parse refs/heads/feature)" != "$first" ]; then
+    echo "[KO] update-ref: ref not created"
+    exit 1
+else
+    echo "[OK] update-ref: ref created"
+fi
+
+# compare-and-swap
+if $mygit update-ref refs/heads/feature $second $second 2> /dev/null ||
+    [ "$(git rev-parse refs/heads/feature)" != "$first" ]; then
+    echo "[KO] update-ref: ref updated despite wrong old value"
+    exit 1
+fi
+if $mygit update-ref refs/heads/feature $second "" 2> /dev/null; then
+    echo "[KO] update-ref: existing ref updated despite empty old value"
+    exit 1
+fi
+$mygit update-ref refs/heads/feature $second $first
+if [ "$(git rev-parse refs/heads/feature)" != "$second" ]; then
+    echo "[KO] update-ref: ref not updated with right old value"
+    exit 1
+else
+    echo "[OK] update-ref: old value checked"
+fi
+
+$mygit update-ref -d refs/heads/packed $first
+if git rev-parse -q --verify refs/heads/packed > /dev/null; then
+    echo "[KO] update-ref -d: packed ref not deleted"
+    exit 1
+else
+    echo "[OK] update-ref -d: packed ref deleted"
+fi
+
+# a held lock makes writers fail without touching the ref
+touch .git/refs/heads/master.lock
+echo "third" > file.txt
+if $mygit commit -a -m "third" > /dev/null 2>&1 || [ "$(git rev-parse HEAD)" != "$second" ]; then
+    echo "[KO] commit: ref updated while locked"
+    exit 1
+else
+    echo "[OK] commit: locked ref left untouched"
+fi
+rm .git/refs/heads/master.lock
+
+# transactions are all-or-nothing
+printf 'create refs/heads/a %s\nupdate refs/heads/feature %s %s\n' $first $first $first |
+    $mygit update-ref --stdin 2> /dev/null
+if [ $? -eq 0 ] || git rev-parse -q --verify refs/heads/a > /dev/null ||
+    [ "$(git rev-parse refs/heads/feature)" != "$second" ]; then
+    echo "[KO] update-ref --stdin: failed transaction partially applied"
+    exit 1
+fi
+printf 'create refs/heads/a %s\nupdate refs/heads/feature %s %s\nverify refs/heads/master %s\ndelete refs/heads/feature %s\n' \
+    $first $first $second $second $second | $mygit update-ref --stdin 2> /dev/null
+if [ $? -eq 0 ]; then
+    echo "[KO] update-ref --stdin: two updates of one ref accepted"
+    exit 1
+fi
+printf 'create refs/heads/a %s\nupdate refs/heads/feature %s %s\nverify refs/heads/master %s\n' \
+    $first $first $second $second | $mygit update-ref --stdin
+if [ "$(git rev-parse refs/heads/a)" != "$first" ] ||
+    [ "$(git rev-parse refs/heads/feature)" != "$first" ]; then
+    echo "[KO] update-ref --stdin: transaction not applied"
+    exit 1
+else
+    echo "[OK] update-ref --stdin: transactions are all-or-nothing"
+fi
+
+# concurrent commits: every commit that succeeds stays in history
+for i in 1 2 3 4 5 6 7 8; do
+    ( echo "$i" > "file$i.txt"; $mygit add "file$i.txt" 2> /dev/null && $mygit commit -m "commit $i" > /dev/null 2>&1 && echo ok > "../ok$i" ) &
+done
+wait
+succeeded=$(ls ../ok* 2> /dev/null | wc -l)
+if [ "$succeeded" -lt 1 ] || [ "$(git rev-list --count HEAD)" -ne $((2 + succeeded)) ]; then
+    echo "[KO] concurrent commits: commits lost"
+    exit 1
+else
+    echo "[OK] concurrent commits: no commit lost"
+fi
+
+if ! git fsck --no-dangling > /dev/null 2>&1; then
+    echo "[KO] git fsck failed"
+    exit 1
+else
+    echo "[OK] git fsck passed"
+fi
@@ -0,0 +1,51 @@
+mygit=mygit
+
+config() {
+    export GIT_AUTHOR_EMAIL=wlmsrvty@william.ovh
+    export GIT_AUTHOR_NAME=wlmsrvty
+
+    export GIT_COMMITTER_EMAIL=wlmsrvty@william.ovh
+    export GIT_COMMITTER_NAME=wlmsrvty
+
+    export GIT_AUTHOR_DATE="1715028250 +0200"
+    export GIT_COMMITTER_DATE="1715028250 +0200"
+}
+
+prepare() {
+    git init > /dev/null 2>&1
+    for i in 1 2 3 4 5 6 7 8 9 10; do
+        seq 1 $((i * 100)) > numbers.txt
+        echo "commit $i" >> history.txt
+        git add . > /dev/null
+        git commit -q -m "commit $i"
+    done
+    git repack -a -d -q
+}
+
+config
+
+prepare
+
+index=$(ls .git/objects/pack/*.idx)
+
+git verify-pack -v $index > ref_verify.txt
+$mygit verify-pack -v $index > got_verify.txt
+
+diff -u ref_verify.txt got_verify.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] verify-pack failed"
+    exit 1
+else
+    echo "[OK] verify-pack: good output"
+fi
+
+git show-index < $index > ref_show.txt
+$mygit show-index < $index > got_show.txt
+
+diff -u ref_show.txt got_show.txt
+if [ $? -ne 0 ]; then
+    echo "[KO] show-index failed"
+    exit 1
+else
+    echo "[OK] show-index: good output"
+fi
@@ -26,6 +26,7 @@ rm -rf .git
 got_result=$(mktemp -d)
 
 $mygit init
+$mygit add .
 $mygit write-tree > $got_result/got_command.txt
 print_object > $got_result/got_print_object.txt
 